@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/samber/oops"
+	"github.com/spf13/cobra"
+
+	"github.com/drornir/better-actions/pkg/artifacts"
+	"github.com/drornir/better-actions/pkg/config"
+	"github.com/drornir/better-actions/pkg/runner"
+)
+
+var artifactsCmd = &cobra.Command{
+	Use:   "artifacts",
+	Short: "Inspect the artifacts of past runs",
+	Long: "Inspect the artifacts that workflow runs uploaded. " +
+		"A run is identified by the run ID that bact prints when it runs, or 'latest' for the most recent run",
+}
+
+var artifactsLsCmd = &cobra.Command{
+	Use:   "ls <run>",
+	Short: "List the artifacts of a run",
+	Args:  cobra.ExactArgs(1),
+	RunE:  listArtifacts,
+}
+
+var artifactsGetCmd = &cobra.Command{
+	Use:   "get <run> <name>",
+	Short: "Extract an artifact of a run into a directory",
+	Args:  cobra.ExactArgs(2),
+	RunE:  getArtifact,
+}
+
+var artifactsGetParams struct {
+	output string
+}
+
+func init() {
+	rootCmd.AddCommand(artifactsCmd)
+	artifactsCmd.AddCommand(artifactsLsCmd)
+	artifactsCmd.AddCommand(artifactsGetCmd)
+
+	artifactsGetCmd.Flags().StringVarP(&artifactsGetParams.output, "output", "o", "", "Directory to extract into. Defaults to ./<name>")
+}
+
+// openRunArtifacts opens the artifact store of a run. run is a run id or "latest".
+func openRunArtifacts(run string) (*artifacts.Store, string, error) {
+	dir, err := stateDir(config.GetConfig())
+	if err != nil {
+		return nil, "", err
+	}
+	if run == "latest" {
+		run, err = latestRun(dir)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	artifactsDir := filepath.Join(runner.RunDir(dir, run), "artifacts")
+	if _, err := os.Stat(artifactsDir); err != nil {
+		return nil, "", oops.With("run", run, "stateDir", dir).Errorf("run %s has no artifacts", run)
+	}
+	store, err := artifacts.NewStore(artifactsDir)
+	return store, run, err
+}
+
+func latestRun(stateDir string) (string, error) {
+	entries, err := os.ReadDir(filepath.Join(stateDir, "runs"))
+	if err != nil {
+		return "", oops.With("stateDir", stateDir).Wrapf(err, "listing runs")
+	}
+	var latest string
+	var latestTime time.Time
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !e.IsDir() {
+			continue
+		}
+		if info.ModTime().After(latestTime) {
+			latest, latestTime = e.Name(), info.ModTime()
+		}
+	}
+	if latest == "" {
+		return "", oops.With("stateDir", stateDir).Errorf("there are no runs")
+	}
+	return latest, nil
+}
+
+func listArtifacts(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	store, run, err := openRunArtifacts(args[0])
+	if err != nil {
+		return err
+	}
+	list, err := store.List(ctx)
+	if err != nil {
+		return oops.Wrapf(err, "listing artifacts of run %s", run)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSIZE\tCREATED")
+	for _, a := range list {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\n", a.ID, a.Name, a.Size, a.CreatedAt.Local().Format(time.DateTime))
+	}
+	return tw.Flush()
+}
+
+func getArtifact(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	store, run, err := openRunArtifacts(args[0])
+	if err != nil {
+		return err
+	}
+	name := args[1]
+	dest := artifactsGetParams.output
+	if dest == "" {
+		dest = name
+	}
+
+	f, art, err := store.Open(ctx, name)
+	if err != nil {
+		return oops.Wrapf(err, "opening artifact %s of run %s", name, run)
+	}
+	defer f.Close()
+	if err := artifacts.ExtractZip(f, art.Size, dest); err != nil {
+		return oops.Wrapf(err, "extracting artifact %s", name)
+	}
+	fmt.Printf("Extracted artifact %s of run %s into %s\n", name, run, dest)
+	return nil
+}
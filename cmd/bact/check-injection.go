@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/drornir/better-actions/pkg/config"
+	"github.com/drornir/better-actions/pkg/lint"
+	"github.com/drornir/better-actions/pkg/runner"
+)
+
+var checkInjectionCmd = &cobra.Command{
+	Use:   "check-injection [paths...]",
+	Short: "Find script injections in workflow files",
+	Long: "Find values that whoever triggers a workflow controls, like pull request titles and branch names, " +
+		"that expressions interpolate into the scripts of run steps and actions/github-script, " +
+		"and suggest passing them in env instead. The severity of the findings is injection.severity in the config. " +
+		"Paths are workflow files or directories of them, and default to " + runner.WorkflowsDir + ". " +
+		"Exits with a non-zero code if there are findings with severity error",
+	RunE:          checkInjection,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+}
+
+var checkInjectionParams struct {
+	format string
+}
+
+func init() {
+	rootCmd.AddCommand(checkInjectionCmd)
+	checkInjectionCmd.Flags().StringVar(&checkInjectionParams.format, "format", "text", "Output format: text, json or sarif")
+}
+
+func checkInjection(cmd *cobra.Command, args []string) error {
+	format, err := lint.ParseFormat(checkInjectionParams.format)
+	if err != nil {
+		return reportedError(err)
+	}
+	severity, err := lint.ParseSeverity(config.GetConfig().Injection.Severity)
+	if err != nil {
+		return reportedError(err)
+	}
+	if len(args) == 0 {
+		args = []string{runner.WorkflowsDir}
+	}
+	files, err := workflowFiles(args)
+	if err != nil {
+		return reportedError(err)
+	}
+
+	var diagnostics []lint.Diagnostic
+	for _, file := range files {
+		fileDiagnostics, err := lint.CheckInjectionFile(file, severity)
+		if err != nil {
+			return reportedError(err)
+		}
+		diagnostics = append(diagnostics, fileDiagnostics...)
+	}
+	if err := lint.Write(os.Stdout, format, diagnostics); err != nil {
+		return reportedError(err)
+	}
+
+	if len(diagnostics) == 0 {
+		fmt.Fprintf(os.Stderr, "No script injections in %d files\n", len(files))
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "%d script injections in %d files\n", len(diagnostics), len(files))
+	if severity == lint.SeverityError {
+		return &exitCodeError{code: 1}
+	}
+	return nil
+}
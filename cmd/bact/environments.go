@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samber/oops"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/drornir/better-actions/pkg/config"
+	"github.com/drornir/better-actions/pkg/runner"
+)
+
+var workflowApproveCmd = &cobra.Command{
+	Use:   "approve <run> [job]",
+	Short: "Approve a job that waits to deploy to a protected environment",
+	Long: "Approve (or reject with --reject) a job that waits to deploy to an environment that requires approval. " +
+		"A run is identified by the run ID that bact prints when it runs, or 'latest' for the most recent run. " +
+		"Without a job, lists the jobs of the run that wait for approval",
+	Args: cobra.RangeArgs(1, 2),
+	RunE: approveJob,
+}
+
+var workflowApproveParams struct {
+	reject bool
+}
+
+func init() {
+	workflowCmd.AddCommand(workflowApproveCmd)
+	workflowApproveCmd.Flags().BoolVar(&workflowApproveParams.reject, "reject", false, "Reject the deployment, failing the job")
+}
+
+// environmentsFile is the format of environments.file: environments by name
+type environmentsFile map[string]struct {
+	Vars    map[string]string `yaml:"vars"`
+	Secrets struct {
+		Providers string `yaml:"providers"`
+		Dotenv    string `yaml:"dotenv"`
+		Dir       string `yaml:"dir"`
+		Env       string `yaml:"env"`
+		Command   string `yaml:"command"`
+		Encrypted string `yaml:"encrypted"`
+		KeyFile   string `yaml:"key-file"`
+	} `yaml:"secrets"`
+	Protection struct {
+		RequiredApproval bool     `yaml:"required-approval"`
+		WaitTimer        string   `yaml:"wait-timer"`
+		Branches         []string `yaml:"branches"`
+	} `yaml:"protection"`
+}
+
+// loadEnvironments reads the environments of environments.file. Paths in it are relative to the file.
+func loadEnvironments(path string) (map[string]*runner.Environment, error) {
+	if path == "" {
+		return nil, nil
+	}
+	oopser := oops.With("path", path)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, oopser.Wrapf(err, "reading environments file")
+	}
+	var file environmentsFile
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, oopser.Wrapf(err, "parsing environments file")
+	}
+
+	base := filepath.Dir(path)
+	relative := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(base, p)
+	}
+	environments := make(map[string]*runner.Environment, len(file))
+	for name, def := range file {
+		oopser := oopser.With("environment", name)
+		providers, err := secretProviders(config.SecretsConfig{
+			Providers: def.Secrets.Providers,
+			Dotenv:    relative(def.Secrets.Dotenv),
+			Dir:       relative(def.Secrets.Dir),
+			Env:       def.Secrets.Env,
+			Command:   def.Secrets.Command,
+			Encrypted: relative(def.Secrets.Encrypted),
+			KeyFile:   relative(def.Secrets.KeyFile),
+		})
+		if err != nil {
+			return nil, oopser.Wrapf(err, "invalid secrets")
+		}
+		var waitTimer time.Duration
+		if def.Protection.WaitTimer != "" {
+			waitTimer, err = time.ParseDuration(def.Protection.WaitTimer)
+			if err != nil {
+				return nil, oopser.Wrapf(err, "invalid protection.wait-timer")
+			}
+		}
+		environments[name] = &runner.Environment{
+			Name:            name,
+			Vars:            def.Vars,
+			SecretProviders: providers,
+			Protection: runner.ProtectionRules{
+				RequiredApproval: def.Protection.RequiredApproval,
+				WaitTimer:        waitTimer,
+				Branches:         def.Protection.Branches,
+			},
+		}
+	}
+	return environments, nil
+}
+
+// promptApprover asks for approval on the terminal, and also accepts the decisions of bact workflow approve
+type promptApprover struct {
+	files runner.FileApprover
+	// prompt is held by the job that the terminal asks about, one at a time, so an answer can't go to
+	// the wrong job
+	prompt    chan struct{}
+	linesOnce sync.Once
+	lines     chan string
+}
+
+// newApprover returns an approver that prompts when stdin is a terminal, and a [runner.FileApprover] otherwise
+func newApprover() runner.Approver {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return runner.FileApprover{}
+	}
+	return &promptApprover{prompt: make(chan struct{}, 1)}
+}
+
+func (a *promptApprover) Approve(ctx context.Context, req runner.ApprovalRequest) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type decision struct {
+		approved bool
+		err      error
+	}
+	// the request is pending for bact workflow approve right away, also while the terminal asks about
+	// another job
+	fromFile := make(chan decision, 1)
+	go func() {
+		approved, err := a.files.Approve(ctx, req)
+		fromFile <- decision{approved, err}
+	}()
+	select {
+	case d := <-fromFile:
+		return d.approved, d.err
+	case a.prompt <- struct{}{}:
+	}
+	defer func() { <-a.prompt }()
+
+	fmt.Fprintf(os.Stderr, "Deploy job %s to environment %s? [y/N] ", req.Job, req.Environment)
+	select {
+	case d := <-fromFile:
+		fmt.Fprintln(os.Stderr)
+		return d.approved, d.err
+	case line, ok := <-a.stdinLines():
+		if !ok {
+			// stdin was closed, only bact workflow approve can decide
+			d := <-fromFile
+			return d.approved, d.err
+		}
+		cancel()
+		<-fromFile
+		answer := strings.ToLower(strings.TrimSpace(line))
+		return answer == "y" || answer == "yes", nil
+	}
+}
+
+// stdinLines reads stdin in the background. It's never stopped, since a read of stdin can't be cancelled.
+func (a *promptApprover) stdinLines() <-chan string {
+	a.linesOnce.Do(func() {
+		a.lines = make(chan string)
+		go func() {
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				a.lines <- scanner.Text()
+			}
+			close(a.lines)
+		}()
+	})
+	return a.lines
+}
+
+func approveJob(cmd *cobra.Command, args []string) error {
+	dir, err := stateDir(config.GetConfig())
+	if err != nil {
+		return err
+	}
+	run := args[0]
+	if run == "latest" {
+		run, err = latestRun(dir)
+		if err != nil {
+			return err
+		}
+	}
+	runDir := runner.RunDir(dir, run)
+
+	if len(args) == 1 {
+		pending, err := runner.PendingApprovals(runDir)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			fmt.Printf("No jobs of run %s wait for approval\n", run)
+			return nil
+		}
+		for _, req := range pending {
+			fmt.Printf("%s\tenvironment %s\twaiting since %s\n", req.Job, req.Environment, req.RequestedAt.Local().Format(time.DateTime))
+		}
+		return nil
+	}
+
+	job := args[1]
+	if err := runner.DecideApproval(runDir, job, !workflowApproveParams.reject); err != nil {
+		return oops.With("run", run).Wrap(err)
+	}
+	if workflowApproveParams.reject {
+		fmt.Printf("Rejected the deployment of job %s of run %s\n", job, run)
+	} else {
+		fmt.Printf("Approved the deployment of job %s of run %s\n", job, run)
+	}
+	return nil
+}
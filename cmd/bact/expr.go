@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json/v2"
+	"fmt"
+	"os"
+
+	"github.com/samber/oops"
+	"github.com/spf13/cobra"
+
+	"github.com/drornir/better-actions/pkg/config"
+	"github.com/drornir/better-actions/pkg/repl"
+	"github.com/drornir/better-actions/pkg/runner/expr"
+)
+
+var exprCmd = &cobra.Command{
+	Use:   "expr",
+	Short: "Evaluate and debug expressions",
+	Long: "Evaluate expressions like the runner does, to debug the if of jobs and steps without pushing commits. " +
+		"The contexts come from the JSON file of --context, with the properties github, env, job, jobs, steps, " +
+		"runner, secrets, vars, strategy, matrix, needs and inputs, like " +
+		`{"github": {"event_name": "push", "ref": "refs/heads/main"}, "job": {"status": "success"}}. ` +
+		"The better-actions extension functions are available when expressions.extensions is set",
+}
+
+var exprEvalCmd = &cobra.Command{
+	Use:   "eval <expression>",
+	Short: "Print the value of an expression and its type",
+	Long: "Print the value of an expression, with or without ${{ }}, and its type. " +
+		"With --if, evaluate it like the if of a job or a step, where success() is implied, and print true or false",
+	Args:          cobra.ExactArgs(1),
+	RunE:          evalExpression,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+}
+
+var exprAstCmd = &cobra.Command{
+	Use:           "ast <expression>",
+	Short:         "Print the parse tree of an expression",
+	Args:          cobra.ExactArgs(1),
+	RunE:          printExpressionAST,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+}
+
+var exprReplCmd = &cobra.Command{
+	Use:   "repl",
+	Short: "Evaluate expressions interactively",
+	Long: "Read expressions and print their values, with tab completion of the paths of the contexts. " +
+		"Enter :help for the commands",
+	Args:          cobra.NoArgs,
+	RunE:          runExpressionREPL,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+}
+
+var exprParams struct {
+	context   string
+	condition bool
+}
+
+func init() {
+	rootCmd.AddCommand(exprCmd)
+	exprCmd.AddCommand(exprEvalCmd)
+	exprCmd.AddCommand(exprAstCmd)
+	exprCmd.AddCommand(exprReplCmd)
+	exprCmd.PersistentFlags().StringVar(&exprParams.context, "context", "", "Path to a JSON file of the contexts. Defaults to empty contexts")
+	exprEvalCmd.Flags().BoolVar(&exprParams.condition, "if", false, "Evaluate the expression as the if of a job or a step")
+}
+
+// readEvalContext reads the contexts of the file of --context
+func readEvalContext() (*expr.EvalContext, error) {
+	evalContext := &expr.EvalContext{}
+	if exprParams.context == "" {
+		return evalContext, nil
+	}
+	content, err := os.ReadFile(exprParams.context)
+	if err != nil {
+		return nil, oops.With("path", exprParams.context).Wrapf(err, "reading context file")
+	}
+	if err := json.Unmarshal(content, evalContext); err != nil {
+		return nil, oops.With("path", exprParams.context).Wrapf(err, "parsing context file")
+	}
+	return evalContext, nil
+}
+
+func newExpressionREPL(cmd *cobra.Command) (*repl.REPL, error) {
+	evalContext, err := readEvalContext()
+	if err != nil {
+		return nil, err
+	}
+	functions := expressionFunctions(config.GetConfig())
+	if functions == nil {
+		functions = expr.DefaultFunctions()
+	}
+	evaluator, err := expr.NewEvaluatorWithFunctions(cmd.Context(), evalContext, functions)
+	if err != nil {
+		return nil, err
+	}
+	contexts, err := expr.UnmarshalFromGo(*evalContext)
+	if err != nil {
+		return nil, oops.Wrapf(err, "converting contexts")
+	}
+	return &repl.REPL{
+		Evaluator: evaluator,
+		Contexts:  contexts.Object.Value,
+		Functions: functions,
+		In:        cmd.InOrStdin(),
+		Out:       cmd.OutOrStdout(),
+	}, nil
+}
+
+func evalExpression(cmd *cobra.Command, args []string) error {
+	r, err := newExpressionREPL(cmd)
+	if err != nil {
+		return reportedError(err)
+	}
+	if exprParams.condition {
+		passed, err := r.Evaluator.EvaluateCondition(args[0])
+		if err != nil {
+			return reportedError(err)
+		}
+		fmt.Fprintln(r.Out, passed)
+		return nil
+	}
+	value, err := r.Evaluator.EvaluateValue(args[0])
+	if err != nil {
+		return reportedError(err)
+	}
+	fmt.Fprintln(r.Out, repl.Describe(value))
+	return nil
+}
+
+func printExpressionAST(cmd *cobra.Command, args []string) error {
+	parsed, err := repl.ParseExpression(args[0])
+	if err != nil {
+		return reportedError(err)
+	}
+	fmt.Fprint(cmd.OutOrStdout(), expr.VisualizeAST(parsed))
+	return nil
+}
+
+func runExpressionREPL(cmd *cobra.Command, _ []string) error {
+	r, err := newExpressionREPL(cmd)
+	if err != nil {
+		return reportedError(err)
+	}
+	if err := r.Run(cmd.Context()); err != nil {
+		return reportedError(err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/samber/oops"
+	"github.com/spf13/cobra"
+
+	"github.com/drornir/better-actions/pkg/config"
+	"github.com/drornir/better-actions/pkg/lint"
+	"github.com/drornir/better-actions/pkg/runner"
+)
+
+var lintCmd = &cobra.Command{
+	Use:   "lint [paths...]",
+	Short: "Find problems in workflow files",
+	Long: "Check workflow files against the workflow schema in strict mode, parse their expressions, " +
+		"and check step ids and needs. Paths are workflow files or directories of them, " +
+		"and default to " + runner.WorkflowsDir + ". Exits with a non-zero code if there are problems",
+	RunE:          lintWorkflows,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+}
+
+var lintParams struct {
+	format string
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+	lintCmd.Flags().StringVar(&lintParams.format, "format", "text", "Output format: text, json or sarif")
+}
+
+func lintWorkflows(cmd *cobra.Command, args []string) error {
+	format, err := lint.ParseFormat(lintParams.format)
+	if err != nil {
+		return reportedError(err)
+	}
+	if len(args) == 0 {
+		args = []string{runner.WorkflowsDir}
+	}
+	files, err := workflowFiles(args)
+	if err != nil {
+		return reportedError(err)
+	}
+
+	var diagnostics []lint.Diagnostic
+	for _, file := range files {
+		fileDiagnostics, err := lint.LintFile(file, expressionFunctions(config.GetConfig()))
+		if err != nil {
+			return reportedError(err)
+		}
+		diagnostics = append(diagnostics, fileDiagnostics...)
+	}
+	if err := lint.Write(os.Stdout, format, diagnostics); err != nil {
+		return reportedError(err)
+	}
+
+	if len(diagnostics) == 0 {
+		fmt.Fprintf(os.Stderr, "No problems in %d files\n", len(files))
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "%d problems in %d files\n", len(diagnostics), len(files))
+	return &exitCodeError{code: 1}
+}
+
+// workflowFiles returns the workflow files in paths: the files themselves, and the `*.yml` and `*.yaml` files in directories
+func workflowFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, oops.With("path", path).Wrap(err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, oops.With("path", path).Wrap(err)
+		}
+		for _, entry := range entries {
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			if !entry.IsDir() && (ext == ".yml" || ext == ".yaml") {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+	slices.Sort(files)
+	return slices.Compact(files), nil
+}
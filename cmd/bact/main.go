@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"strings"
 
 	"github.com/drornir/factor3/pkg/factor3"
 	"github.com/fsnotify/fsnotify"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/drornir/better-actions/pkg/config"
 	"github.com/drornir/better-actions/pkg/log"
+	"github.com/drornir/better-actions/pkg/yamls"
 )
 
 var (
@@ -105,10 +107,29 @@ func init() {
 	rootCmd.SetErrPrefix("better-actions error:")
 }
 
+// exitCodeError makes bact exit with code, for commands that already reported why they failed
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit code %d", e.code)
+}
+
+// reportedError prints err to stderr, for commands whose stdout is machine-readable
+func reportedError(err error) error {
+	fmt.Fprintln(os.Stderr, strings.TrimSuffix(yamls.FormatError(err), "\n"))
+	return &exitCodeError{code: 2}
+}
+
 func main() {
 	err := rootCmd.Execute()
 	if err != nil {
-		fmt.Println(err)
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
+		fmt.Println(yamls.FormatError(err))
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+
+	"github.com/samber/oops"
+	"github.com/spf13/cobra"
+
+	"github.com/drornir/better-actions/pkg/config"
+	"github.com/drornir/better-actions/pkg/runner"
+	"github.com/drornir/better-actions/pkg/types"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Run all the workflows in a repository that match an event",
+	Long: "Discover the workflows in " + runner.WorkflowsDir + " of the repository, " +
+		"and run concurrently all the ones that are triggered by the given event.\n" +
+		"The branches and tags filters of the event match the ref of the checkout, or the ref in --github. " +
+		"paths and paths-ignore filters are not supported: workflows run as if the changed files match them.",
+	RunE: runRepoWorkflows,
+}
+
+var runParams struct {
+	event string
+	repo  string
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+
+	runCmd.Flags().StringVar(&runParams.event, "event", "", "Name of the triggering event (e.g push, workflow_dispatch)")
+	runCmd.MarkFlagRequired("event")
+	runCmd.Flags().StringVar(&runParams.repo, "repo", ".", "Path to the root of the repository")
+	addWorkflowContextsFlags(runCmd)
+	addRunnerFlags(runCmd)
+}
+
+func runRepoWorkflows(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	repoRoot, err := filepath.Abs(runParams.repo)
+	if err != nil {
+		return oops.Wrapf(err, "failed to resolve repository path")
+	}
+
+	wfContext, err := parseWorkflowContexts()
+	if err != nil {
+		return err
+	}
+	if wfContext.GitHub == nil {
+		wfContext.GitHub = &types.GitHub{}
+	}
+	wfContext.GitHub.EventName = runParams.event
+
+	workflows, err := runner.DiscoverWorkflows(ctx, repoRoot, runParams.event, wfContext.GitHub, expressionFunctions(config.GetConfig()))
+	if err != nil {
+		return oops.Wrapf(err, "failed to discover workflows")
+	}
+	if len(workflows) == 0 {
+		fmt.Printf("No workflows in %s are triggered by %q\n", filepath.Join(repoRoot, runner.WorkflowsDir), runParams.event)
+		return nil
+	}
+
+	rnr, err := newRunner(wfContext)
+	if err != nil {
+		return err
+	}
+	rnr.RepoDir = repoRoot
+	results, runErr := rnr.RunWorkflows(ctx, workflows, wfContext)
+
+	fmt.Println()
+	for _, res := range results {
+		status := "succeeded"
+		if res.Err != nil {
+			status = "failed"
+		}
+		runID := "-"
+		if res.State != nil {
+			runID = res.State.Run
+		}
+		fmt.Printf("%-9s %s (%s) run %s\n", status, res.Workflow.DisplayName(), res.Workflow.Path, runID)
+		printDeployments(res.State)
+	}
+
+	if runErr != nil {
+		return oops.Wrapf(runErr, "%d out of %d workflows failed", countFailed(results), len(results))
+	}
+	return nil
+}
+
+// printDeployments prints the environments that the jobs of the run deployed to, under its summary line
+func printDeployments(wfState *runner.WorkflowState) {
+	if wfState == nil {
+		return
+	}
+	for _, name := range slices.Sorted(maps.Keys(wfState.Jobs)) {
+		env := wfState.Jobs[name].Environment
+		if env == nil || env.URL == "" {
+			continue
+		}
+		fmt.Printf("%-9s job %s deployed to %s at %s\n", "", name, env.Name, env.URL)
+	}
+}
+
+func countFailed(results []runner.WorkflowRunResult) int {
+	failed := 0
+	for _, res := range results {
+		if res.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
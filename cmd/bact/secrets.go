@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kballard/go-shellquote"
+	"github.com/samber/oops"
+	"github.com/spf13/cobra"
+
+	"github.com/drornir/better-actions/pkg/config"
+	"github.com/drornir/better-actions/pkg/secrets"
+)
+
+// defaultSecretsEnvPrefix is the prefix of the env secrets provider when secrets.env isn't configured
+const defaultSecretsEnvPrefix = "BACT_SECRET_"
+
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Manage the secrets of workflow runs",
+	Long: "Manage the secrets that the providers configured in secrets.providers supply to workflow runs. " +
+		"Values are never printed",
+}
+
+var secretsLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the names of the secrets and the providers they come from",
+	Args:  cobra.NoArgs,
+	RunE:  listSecrets,
+}
+
+var secretsKeygenCmd = &cobra.Command{
+	Use:   "keygen <key-file>",
+	Short: "Create a key for an encrypted secrets file",
+	Args:  cobra.ExactArgs(1),
+	RunE:  secretsKeygen,
+}
+
+var secretsEncryptCmd = &cobra.Command{
+	Use:   "encrypt <dotenv-file>",
+	Short: "Encrypt the values of a dotenv file with the key in secrets.key-file and print it",
+	Long: "Encrypt the values of a dotenv file with the key in secrets.key-file, and print the result. " +
+		"The output is safe to commit and is read by the encrypted provider",
+	Args: cobra.ExactArgs(1),
+	RunE: secretsEncrypt,
+}
+
+func init() {
+	rootCmd.AddCommand(secretsCmd)
+	secretsCmd.AddCommand(secretsLsCmd)
+	secretsCmd.AddCommand(secretsKeygenCmd)
+	secretsCmd.AddCommand(secretsEncryptCmd)
+}
+
+// secretProviders creates the providers of cfg.Providers, in their order
+func secretProviders(cfg config.SecretsConfig) ([]secrets.Provider, error) {
+	var providers []secrets.Provider
+	for name := range strings.SplitSeq(cfg.Providers, ",") {
+		name = strings.TrimSpace(name)
+		oopser := oops.With("provider", name)
+		var p secrets.Provider
+		switch name {
+		case "":
+			continue
+		case "dotenv":
+			if cfg.Dotenv == "" {
+				return nil, oopser.Errorf("secrets.dotenv is required by the dotenv provider")
+			}
+			p = secrets.DotenvFile{Path: cfg.Dotenv}
+		case "dir":
+			if cfg.Dir == "" {
+				return nil, oopser.Errorf("secrets.dir is required by the dir provider")
+			}
+			p = secrets.Dir{Path: cfg.Dir}
+		case "env":
+			prefix := cfg.Env
+			if prefix == "" {
+				prefix = defaultSecretsEnvPrefix
+			}
+			p = secrets.EnvPrefix{Prefix: prefix}
+		case "command":
+			args, err := shellquote.Split(cfg.Command)
+			if err != nil {
+				return nil, oopser.Wrapf(err, "parsing secrets.command")
+			}
+			if len(args) == 0 {
+				return nil, oopser.Errorf("secrets.command is required by the command provider")
+			}
+			p = secrets.Command{Args: args}
+		case "encrypted":
+			if cfg.Encrypted == "" || cfg.KeyFile == "" {
+				return nil, oopser.Errorf("secrets.encrypted and secrets.key-file are required by the encrypted provider")
+			}
+			p = secrets.EncryptedFile{Path: cfg.Encrypted, KeyFile: cfg.KeyFile}
+		default:
+			return nil, oopser.Errorf("unknown secrets provider %q. Expected dotenv, dir, env, command or encrypted", name)
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+func listSecrets(cmd *cobra.Command, args []string) error {
+	providers, err := secretProviders(config.GetConfig().Secrets)
+	if err != nil {
+		return err
+	}
+	sources, err := secrets.Sources(cmd.Context(), providers...)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tPROVIDER")
+	for _, s := range sources {
+		fmt.Fprintf(tw, "%s\t%s\n", s.Name, s.Provider)
+	}
+	return tw.Flush()
+}
+
+func secretsKeygen(cmd *cobra.Command, args []string) error {
+	key, err := secrets.GenerateKey()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return oops.Wrapf(err, "creating key file")
+	}
+	defer f.Close()
+	if _, err := f.WriteString(secrets.EncodeKey(key)); err != nil {
+		return oops.Wrapf(err, "writing key file")
+	}
+	fmt.Fprintf(os.Stderr, "Created %s. Set secrets.key-file to it, and keep it out of version control\n", args[0])
+	return nil
+}
+
+func secretsEncrypt(cmd *cobra.Command, args []string) error {
+	key, err := secrets.ReadKeyFile(config.GetConfig().Secrets.KeyFile)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(args[0])
+	if err != nil {
+		return oops.Wrapf(err, "reading dotenv file")
+	}
+	encrypted, err := secrets.EncryptDotenv(key, string(content))
+	if err != nil {
+		return oops.With("path", args[0]).Wrap(err)
+	}
+	fmt.Print(encrypted)
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/drornir/better-actions/pkg/lint"
+	"github.com/drornir/better-actions/pkg/runner"
+)
+
+var typecheckCmd = &cobra.Command{
+	Use:   "typecheck [paths...]",
+	Short: "Find type errors in the expressions of workflow files",
+	Long: "Infer the types of the expressions of workflow files from the steps, needs, inputs and matrix " +
+		"where they are, and report properties that don't exist and comparisons that are always false. " +
+		"Paths are workflow files or directories of them, and default to " + runner.WorkflowsDir + ". " +
+		"Exits with a non-zero code if there are problems",
+	RunE:          typecheckWorkflows,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+}
+
+var typecheckParams struct {
+	format string
+}
+
+func init() {
+	rootCmd.AddCommand(typecheckCmd)
+	typecheckCmd.Flags().StringVar(&typecheckParams.format, "format", "text", "Output format: text, json or sarif")
+}
+
+func typecheckWorkflows(cmd *cobra.Command, args []string) error {
+	format, err := lint.ParseFormat(typecheckParams.format)
+	if err != nil {
+		return reportedError(err)
+	}
+	if len(args) == 0 {
+		args = []string{runner.WorkflowsDir}
+	}
+	files, err := workflowFiles(args)
+	if err != nil {
+		return reportedError(err)
+	}
+
+	var diagnostics []lint.Diagnostic
+	for _, file := range files {
+		fileDiagnostics, err := lint.TypecheckFile(cmd.Context(), file)
+		if err != nil {
+			return reportedError(err)
+		}
+		diagnostics = append(diagnostics, fileDiagnostics...)
+	}
+	if err := lint.Write(os.Stdout, format, diagnostics); err != nil {
+		return reportedError(err)
+	}
+
+	if len(diagnostics) == 0 {
+		fmt.Fprintf(os.Stderr, "No problems in %d files\n", len(files))
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "%d problems in %d files\n", len(diagnostics), len(files))
+	return &exitCodeError{code: 1}
+}
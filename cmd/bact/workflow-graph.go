@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/samber/oops"
+	"github.com/spf13/cobra"
+
+	"github.com/drornir/better-actions/pkg/config"
+	"github.com/drornir/better-actions/pkg/runner"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+var workflowGraphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Draw the jobs of a workflow and the needs between them",
+	Long: "Draw the jobs of a workflow as nodes with edges to the jobs that need them, in Graphviz DOT, " +
+		"a Mermaid flowchart, which GitHub renders in markdown, or JSON. Jobs with a matrix fan out to its combinations, " +
+		"and jobs that call reusable workflows show them. With --run, the nodes show the results and durations of " +
+		"the jobs in that run of the workflow, which is a run ID or latest",
+	RunE:          graphWorkflow,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+}
+
+var graphWorkflowParams struct {
+	file   string
+	format string
+	run    string
+}
+
+func init() {
+	workflowCmd.AddCommand(workflowGraphCmd)
+
+	workflowGraphCmd.Flags().StringVarP(&graphWorkflowParams.file, "file", "f", "", "Path to the workflow file")
+	workflowGraphCmd.MarkFlagRequired("file")
+	workflowGraphCmd.Flags().StringVar(&graphWorkflowParams.format, "format", "mermaid", "Output format: dot, mermaid or json")
+	workflowGraphCmd.Flags().StringVar(&graphWorkflowParams.run, "run", "", "ID of a run of the workflow, or latest, to show the results of")
+}
+
+func graphWorkflow(cmd *cobra.Command, args []string) error {
+	format := graphWorkflowParams.format
+	if format != "dot" && format != "mermaid" && format != "json" {
+		return reportedError(oops.Errorf("unknown graph format %q, expected dot, mermaid or json", format))
+	}
+	absPath, err := filepath.Abs(graphWorkflowParams.file)
+	if err != nil {
+		return reportedError(oops.Wrapf(err, "resolving workflow file path"))
+	}
+	file, err := os.Open(absPath)
+	if err != nil {
+		return reportedError(oops.Wrapf(err, "opening workflow file"))
+	}
+	defer file.Close()
+	wf, err := yamls.ReadWorkflowWithFunctions(file, false, expressionFunctions(config.GetConfig()))
+	if err != nil {
+		return reportedError(oops.Wrapf(err, "reading workflow file %s", absPath))
+	}
+	wf.File = absPath
+
+	var record *runner.RunRecord
+	if run := graphWorkflowParams.run; run != "" {
+		record, err = readRunRecord(run, absPath)
+		if err != nil {
+			return reportedError(err)
+		}
+	}
+
+	graph, err := runner.WorkflowGraph(cmd.Context(), wf, record)
+	if err != nil {
+		return reportedError(err)
+	}
+	switch format {
+	case "dot":
+		err = graph.WriteDOT(os.Stdout)
+	case "mermaid":
+		err = graph.WriteMermaid(os.Stdout)
+	default:
+		err = json.MarshalWrite(os.Stdout, graph, jsontext.WithIndent("  "))
+		fmt.Println()
+	}
+	if err != nil {
+		return reportedError(oops.Wrapf(err, "writing graph"))
+	}
+	return nil
+}
+
+// readRunRecord reads the record of run, which is a run ID or latest, and checks that it's a run of the
+// workflow file at path
+func readRunRecord(run, path string) (*runner.RunRecord, error) {
+	dir, err := stateDir(config.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+	if run == "latest" {
+		run, err = latestRun(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	record, err := runner.ReadRunRecord(runner.RunDir(dir, run))
+	if err != nil {
+		return nil, oops.With("run", run).Wrap(err)
+	}
+	if record.File != path {
+		return nil, oops.With("run", run).Errorf("run %s is of workflow %s, not %s", run, record.File, path)
+	}
+	return record, nil
+}
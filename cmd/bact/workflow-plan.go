@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/samber/oops"
+	"github.com/spf13/cobra"
+
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+var workflowPlanCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show what running a workflow would do",
+	Long: "Show what running a workflow would do, without running any of its steps: the jobs in the order they run, " +
+		"whether their if and the if of their steps pass, the scripts of run steps with their expressions evaluated " +
+		"and the commands that run them, and the parts of jobs that bact doesn't run like GitHub does, like matrixes " +
+		"and actions that aren't builtin. " +
+		"Expressions that depend on what happens in the run, like the outputs of steps, are shown as they are, and the " +
+		"jobs and steps before are assumed to succeed. Secrets are masked",
+	RunE:          planWorkflow,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+}
+
+var planWorkflowParams struct {
+	file   string
+	format string
+}
+
+func init() {
+	workflowCmd.AddCommand(workflowPlanCmd)
+
+	workflowPlanCmd.Flags().StringVarP(&planWorkflowParams.file, "file", "f", "", "Path to the workflow file")
+	workflowPlanCmd.MarkFlagRequired("file")
+	workflowPlanCmd.Flags().StringVar(&planWorkflowParams.format, "format", "text", "Output format: text or json")
+	addWorkflowContextsFlags(workflowPlanCmd)
+}
+
+func planWorkflow(cmd *cobra.Command, args []string) error {
+	format := planWorkflowParams.format
+	if format != "text" && format != "json" {
+		return reportedError(oops.Errorf("unknown plan format %q, expected text or json", format))
+	}
+	absPath, err := filepath.Abs(planWorkflowParams.file)
+	if err != nil {
+		return reportedError(oops.Wrapf(err, "resolving workflow file path"))
+	}
+	wfContext, err := parseWorkflowContexts()
+	if err != nil {
+		return reportedError(err)
+	}
+	rnr, err := newRunner(wfContext)
+	if err != nil {
+		return reportedError(err)
+	}
+
+	file, err := os.Open(absPath)
+	if err != nil {
+		return reportedError(oops.Wrapf(err, "opening workflow file"))
+	}
+	defer file.Close()
+	wf, err := yamls.ReadWorkflowWithFunctions(file, false, rnr.Functions)
+	if err != nil {
+		return reportedError(oops.Wrapf(err, "reading workflow file %s", absPath))
+	}
+	wf.File = absPath
+	rnr.RepoDir = filepath.Dir(absPath)
+
+	plan, err := rnr.PlanWorkflow(cmd.Context(), wf, wfContext)
+	if err != nil {
+		return reportedError(err)
+	}
+	if format == "json" {
+		if err := json.MarshalWrite(os.Stdout, plan, jsontext.WithIndent("  ")); err != nil {
+			return reportedError(oops.Wrapf(err, "writing plan"))
+		}
+		fmt.Println()
+		return nil
+	}
+	if err := plan.WriteText(os.Stdout); err != nil {
+		return reportedError(err)
+	}
+	return nil
+}
@@ -6,12 +6,17 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/samber/oops"
 	"github.com/spf13/cobra"
 
+	"github.com/drornir/better-actions/pkg/cache"
+	"github.com/drornir/better-actions/pkg/config"
 	"github.com/drornir/better-actions/pkg/runner"
+	"github.com/drornir/better-actions/pkg/runner/expr"
 	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/workspace"
 	"github.com/drornir/better-actions/pkg/yamls"
 )
 
@@ -41,6 +46,13 @@ var runWorkflowParams struct {
 	runner  string
 }
 
+// runnerParams are flags that configure the [runner.Runner] itself rather than the workflow contexts
+var runnerParams struct {
+	keepWorkspace bool
+	keepOnFailure bool
+	timestamps    bool
+}
+
 func init() {
 	// Add workflow command to root
 	rootCmd.AddCommand(workflowCmd)
@@ -52,12 +64,135 @@ func init() {
 	workflowRunCmd.Flags().StringVarP(&workflowFile, "file", "f", "", "Path to the workflow file")
 	workflowRunCmd.MarkFlagRequired("file")
 
-	workflowRunCmd.Flags().StringVar(&runWorkflowParams.github, "github", "", "GitHub data")
-	workflowRunCmd.Flags().StringVar(&runWorkflowParams.env, "env", "", "Environment data")
-	workflowRunCmd.Flags().StringVar(&runWorkflowParams.inputs, "inputs", "", "Inputs data")
-	workflowRunCmd.Flags().StringVar(&runWorkflowParams.secrets, "secrets", "", "Secrets data")
-	workflowRunCmd.Flags().StringVar(&runWorkflowParams.vars, "vars", "", "Variables data")
-	workflowRunCmd.Flags().StringVar(&runWorkflowParams.runner, "runner", "", "Runner data")
+	addWorkflowContextsFlags(workflowRunCmd)
+	addRunnerFlags(workflowRunCmd)
+}
+
+func addRunnerFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&runnerParams.keepWorkspace, "keep-workspace", false, "Keep the job root directories (including the workspace) and print their paths")
+	cmd.Flags().BoolVar(&runnerParams.keepOnFailure, "keep-on-failure", false, "Keep the job root directories of failed jobs and print their paths")
+	cmd.Flags().BoolVar(&runnerParams.timestamps, "timestamps", false, "Prefix every line of step output with the time it was written")
+}
+
+// stateDir returns the configured state directory, or the default one in the user cache directory
+func stateDir(cfg config.Config) (string, error) {
+	if cfg.State.Dir != "" {
+		return filepath.Abs(cfg.State.Dir)
+	}
+	userCache, err := os.UserCacheDir()
+	if err != nil {
+		return "", oops.Wrapf(err, "finding default state directory. Configure state.dir")
+	}
+	return filepath.Join(userCache, "bact"), nil
+}
+
+// expressionFunctions are the functions the expressions of workflows may call, nil for the default ones
+func expressionFunctions(cfg config.Config) expr.FunctionStore {
+	if cfg.Expressions.Extensions {
+		return expr.ExtendedFunctions()
+	}
+	return nil
+}
+
+// newRunner creates a runner configured by the global config and the flags added by [addRunnerFlags]
+func newRunner(wfContext *types.WorkflowContexts) (*runner.Runner, error) {
+	cfg := config.GetConfig()
+
+	mode, err := workspace.ParseMode(cfg.Workspace.Mode)
+	if err != nil {
+		return nil, oops.Wrapf(err, "invalid workspace configuration")
+	}
+
+	envPolicy, err := runner.ParseEnvPolicy(cfg.Env.Policy)
+	if err != nil {
+		return nil, oops.Wrapf(err, "invalid env configuration")
+	}
+
+	rnr := runner.New(os.Stdout, runner.EnvFromMap(wfContext.Env))
+	rnr.EnvPolicy = envPolicy
+	for pattern := range strings.SplitSeq(cfg.Env.Allowlist, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			rnr.EnvAllowlist = append(rnr.EnvAllowlist, pattern)
+		}
+	}
+	rnr.Workspace = workspace.Options{
+		Mode:   mode,
+		Source: cfg.Workspace.Source,
+	}
+	rnr.StateDir, err = stateDir(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Cache.Dir != "" {
+		rnr.CacheDir, err = filepath.Abs(cfg.Cache.Dir)
+		if err != nil {
+			return nil, oops.Wrapf(err, "resolving cache directory")
+		}
+	}
+	rnr.CacheMaxSize, err = cache.ParseSize(cfg.Cache.MaxSize)
+	if err != nil {
+		return nil, oops.Wrapf(err, "invalid cache configuration")
+	}
+	if cfg.Runner.ToolCache != "" {
+		rnr.ToolCacheDir, err = filepath.Abs(cfg.Runner.ToolCache)
+		if err != nil {
+			return nil, oops.Wrapf(err, "resolving tool cache directory")
+		}
+	}
+	rnr.SecretProviders, err = secretProviders(cfg.Secrets)
+	if err != nil {
+		return nil, oops.Wrapf(err, "invalid secrets configuration")
+	}
+	rnr.Environments, err = loadEnvironments(cfg.Environments.File)
+	if err != nil {
+		return nil, oops.Wrapf(err, "invalid environments configuration")
+	}
+	rnr.Approver = newApprover()
+	rnr.Functions = expressionFunctions(cfg)
+	rnr.Timestamps = runnerParams.timestamps
+	switch {
+	case runnerParams.keepWorkspace:
+		rnr.KeepJobRoot = runner.KeepJobRootAlways
+	case runnerParams.keepOnFailure:
+		rnr.KeepJobRoot = runner.KeepJobRootOnFailure
+	}
+	return rnr, nil
+}
+
+func addWorkflowContextsFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&runWorkflowParams.github, "github", "", "GitHub data")
+	cmd.Flags().StringVar(&runWorkflowParams.env, "env", "", "Environment data")
+	cmd.Flags().StringVar(&runWorkflowParams.inputs, "inputs", "", "Inputs data")
+	cmd.Flags().StringVar(&runWorkflowParams.secrets, "secrets", "", "Secrets data. Overrides the secrets of the providers in secrets.providers")
+	cmd.Flags().StringVar(&runWorkflowParams.vars, "vars", "", "Variables data")
+	cmd.Flags().StringVar(&runWorkflowParams.runner, "runner", "", "Runner data")
+}
+
+// parseWorkflowContexts unmarshals the JSON values of the flags added by [addWorkflowContextsFlags]
+func parseWorkflowContexts() (*types.WorkflowContexts, error) {
+	var wfContext types.WorkflowContexts
+	unmarshals := []struct {
+		Name    string
+		Value   string
+		Pointer any
+	}{
+		{"github", runWorkflowParams.github, &wfContext.GitHub},
+		{"env", runWorkflowParams.env, &wfContext.Env},
+		{"inputs", runWorkflowParams.inputs, &wfContext.Inputs},
+		{"secrets", runWorkflowParams.secrets, &wfContext.Secrets},
+		{"vars", runWorkflowParams.vars, &wfContext.Vars},
+		{"runner", runWorkflowParams.runner, &wfContext.Runner},
+	}
+	for _, part := range unmarshals {
+		if part.Value == "" {
+			continue
+		}
+		err := json.Unmarshal([]byte(part.Value), part.Pointer)
+		if err != nil {
+			return nil, oops.Errorf("failed to unmarshal %s data: %w", part.Name, err)
+		}
+	}
+	return &wfContext, nil
 }
 
 func runWorkflow(cmd *cobra.Command, args []string) error {
@@ -79,32 +214,12 @@ func runWorkflow(cmd *cobra.Command, args []string) error {
 
 	fmt.Printf("Running workflow from: %s\n", absPath)
 
-	var wfContext types.WorkflowContexts
-	{
-		unmarshals := []struct {
-			Name    string
-			Value   string
-			Pointer any
-		}{
-			{"github", runWorkflowParams.github, &wfContext.GitHub},
-			{"env", runWorkflowParams.env, &wfContext.Env},
-			{"inputs", runWorkflowParams.inputs, &wfContext.Inputs},
-			{"secrets", runWorkflowParams.secrets, &wfContext.Secrets},
-			{"vars", runWorkflowParams.vars, &wfContext.Vars},
-			{"runner", runWorkflowParams.runner, &wfContext.Runner},
-		}
-		for _, part := range unmarshals {
-			if part.Value == "" {
-				continue
-			}
-			err := json.Unmarshal([]byte(part.Value), part.Pointer)
-			if err != nil {
-				return oops.Errorf("failed to unmarshal %s data: %w", part.Name, err)
-			}
-		}
+	wfContext, err := parseWorkflowContexts()
+	if err != nil {
+		return err
 	}
 
-	if err := executeWorkflowFile(ctx, absPath, &wfContext); err != nil {
+	if err := executeWorkflowFile(ctx, absPath, wfContext); err != nil {
 		return fmt.Errorf("failed to execute workflow: %w", err)
 	}
 
@@ -132,13 +247,21 @@ func executeWorkflowFile(ctx context.Context, filePath string, wfContext *types.
 		return err
 	}
 
-	wf, err := yamls.ReadWorkflow(openFile, false)
+	rnr, err := newRunner(wfContext)
 	if err != nil {
 		return err
 	}
 
-	rnr := runner.New(os.Stdout, runner.EnvFromChain(runner.EnvFromOS(), runner.EnvFromMap(wfContext.Env)))
+	wf, err := yamls.ReadWorkflowWithFunctions(openFile, false, rnr.Functions)
+	if err != nil {
+		return err
+	}
+	wf.File = filePath
+	rnr.RepoDir = filepath.Dir(filePath)
 
-	_, err2 := rnr.RunWorkflow(ctx, wf, wfContext)
+	wfState, err2 := rnr.RunWorkflow(ctx, wf, wfContext)
+	if wfState != nil {
+		fmt.Printf("Run ID: %s\n", wfState.Run)
+	}
 	return err2
 }
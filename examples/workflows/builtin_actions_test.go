@@ -0,0 +1,74 @@
+package workflows_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/runner"
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+func TestBuiltinActionsWorkflow(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	const filename = "builtin_actions.yaml"
+	ctx := makeContext(t, slog.LevelDebug, "file", filename)
+
+	repoDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "README.md"), []byte("hello from the repo"), 0o644))
+	for _, args := range [][]string{
+		{"init", "--quiet", "--initial-branch=main"},
+		{"config", "user.name", "octocat"},
+		{"config", "user.email", "octocat@example.com"},
+		{"remote", "add", "origin", "https://github.com/octo-org/hello-world.git"},
+		{"add", "README.md"},
+		{"commit", "--quiet", "-m", "init"},
+	} {
+		out, err := exec.Command("git", append([]string{"-C", repoDir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	stateDir := t.TempDir()
+
+	runOnce := func(runID string) string {
+		consoleBuffer := &bytes.Buffer{}
+		console := io.MultiWriter(consoleBuffer, t.Output())
+		run := runner.New(console, runner.EnvFromEmpty())
+		run.RepoDir = repoDir
+		run.StateDir = stateDir
+
+		f, err := rootFs.Open(filename)
+		require.NoError(t, err, "failed to open workflow file")
+		wf, err := yamls.ReadWorkflow(f, false)
+		require.NoError(t, err, "failed to read workflow")
+
+		_, err = run.RunWorkflow(ctx, wf, &types.WorkflowContexts{
+			GitHub: &types.GitHub{EventName: "push", RunID: runID},
+		})
+		require.NoError(t, err, "failed to run workflow")
+		return consoleBuffer.String()
+	}
+
+	first := runOnce("1")
+	assert.Contains(t, first, "hello from the repo")
+	assert.Contains(t, first, "Cache not found")
+	assert.Contains(t, first, "Cache saved with key: deps-")
+	assert.Contains(t, first, "artifact round trip ok")
+	assert.Contains(t, first, "artifact service ok")
+	assert.Contains(t, first, "cache service ok")
+	assert.FileExists(t, filepath.Join(runner.RunDir(stateDir, "1"), "artifacts", "app.zip"))
+
+	second := runOnce("2")
+	assert.Contains(t, second, "Cache restored from key: deps-")
+	assert.NotContains(t, second, "Cache saved")
+}
@@ -0,0 +1,136 @@
+package workflows_test
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/concurrency"
+	"github.com/drornir/better-actions/pkg/runner"
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/workspace"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+// syncBuffer is a console that is read while the run writes to it
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func TestConcurrencyWorkflow(t *testing.T) {
+	const filename = "concurrency.yaml"
+
+	type workflowRun struct {
+		console *syncBuffer
+		state   *runner.WorkflowState
+		err     error
+		done    chan struct{}
+	}
+	// every run has its own runner, like separate bact processes sharing the state directory
+	startRun := func(t *testing.T, groupsDir, markerDir, runID, cancelInProgress string) *workflowRun {
+		ctx := makeContext(t, slog.LevelDebug, "file", filename, "run", runID)
+		wr := &workflowRun{console: &syncBuffer{}, done: make(chan struct{})}
+		run := runner.New(wr.console, runner.EnvFromMap(map[string]string{"MARKER_DIR": markerDir}))
+		run.RepoDir = t.TempDir()
+		run.Workspace = workspace.Options{Mode: workspace.ModeEmpty}
+		run.ConcurrencyGroups = &concurrency.Groups{Dir: groupsDir, PollInterval: 10 * time.Millisecond}
+
+		f, err := rootFs.Open(filename)
+		require.NoError(t, err)
+		wf, err := yamls.ReadWorkflow(f, false)
+		require.NoError(t, err)
+
+		go func() {
+			defer close(wr.done)
+			wr.state, wr.err = run.RunWorkflow(ctx, wf, &types.WorkflowContexts{
+				GitHub: &types.GitHub{RunID: runID, RefName: "main", RefType: "branch"},
+				Vars:   types.Vars{"CANCEL_IN_PROGRESS": cancelInProgress},
+			})
+		}()
+		return wr
+	}
+	waitFor := func(t *testing.T, what string, cond func() bool) {
+		t.Helper()
+		require.Eventually(t, cond, 10*time.Second, 10*time.Millisecond, what)
+	}
+	started := func(markerDir, runID string) bool {
+		_, err := os.Stat(filepath.Join(markerDir, "started-"+runID))
+		return err == nil
+	}
+	release := func(t *testing.T, markerDir, runID string) {
+		require.NoError(t, os.WriteFile(filepath.Join(markerDir, "release-"+runID), nil, 0o644))
+	}
+
+	t.Run("queue", func(t *testing.T) {
+		groupsDir, markerDir := t.TempDir(), t.TempDir()
+
+		first := startRun(t, groupsDir, markerDir, "1", "false")
+		waitFor(t, "first run started", func() bool { return started(markerDir, "1") })
+
+		second := startRun(t, groupsDir, markerDir, "2", "false")
+		waitFor(t, "second run waits", func() bool {
+			return strings.Contains(second.console.String(), "waiting for concurrency group deploy-main")
+		})
+		// the newest pending run replaces the second one
+		third := startRun(t, groupsDir, markerDir, "3", "false")
+		<-second.done
+		require.Error(t, second.err)
+		assert.Contains(t, errParse(second.err), "cancelled by concurrency group deploy-main")
+		assert.False(t, started(markerDir, "2"))
+		assert.False(t, started(markerDir, "3"))
+
+		release(t, markerDir, "1")
+		<-first.done
+		require.NoError(t, first.err, errParse(first.err))
+		assert.Equal(t, runner.JobResultSuccess, first.state.Jobs["deploy"].Result)
+
+		waitFor(t, "third run started", func() bool { return started(markerDir, "3") })
+		release(t, markerDir, "3")
+		<-third.done
+		require.NoError(t, third.err, errParse(third.err))
+		assert.Contains(t, third.console.String(), "deployed run 3")
+	})
+
+	t.Run("cancel-in-progress", func(t *testing.T) {
+		groupsDir, markerDir := t.TempDir(), t.TempDir()
+
+		first := startRun(t, groupsDir, markerDir, "1", "true")
+		waitFor(t, "first run started", func() bool { return started(markerDir, "1") })
+
+		second := startRun(t, groupsDir, markerDir, "2", "true")
+		<-first.done
+		require.Error(t, first.err)
+		assert.Contains(t, errParse(first.err), "cancelled by concurrency group deploy-main")
+		require.NotNil(t, first.state)
+		assert.Equal(t, runner.JobResultCancelled, first.state.Jobs["deploy"].Result)
+		assert.Contains(t, first.console.String(), "job deploy: cancelled by concurrency group deploy-main")
+		assert.NotContains(t, first.console.String(), "deployed run 1")
+
+		waitFor(t, "second run started", func() bool { return started(markerDir, "2") })
+		release(t, markerDir, "2")
+		<-second.done
+		require.NoError(t, second.err, errParse(second.err))
+		assert.Contains(t, second.console.String(), "deployed run 2")
+	})
+}
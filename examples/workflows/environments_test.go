@@ -0,0 +1,137 @@
+package workflows_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/runner"
+	"github.com/drornir/better-actions/pkg/runner/expr"
+	"github.com/drornir/better-actions/pkg/secrets"
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+func TestEnvironmentsWorkflow(t *testing.T) {
+	const filename = "environments.yaml"
+
+	dotenv := filepath.Join(t.TempDir(), "staging.env")
+	require.NoError(t, os.WriteFile(dotenv, []byte("DEPLOY_TOKEN=staging-token-value\n"), 0o600))
+
+	newRunner := func(console io.Writer, branches ...string) *runner.Runner {
+		run := runner.New(io.MultiWriter(console, t.Output()), runner.EnvFromEmpty())
+		run.StateDir = t.TempDir()
+		run.Approver = runner.FileApprover{PollInterval: 10 * time.Millisecond}
+		run.Environments = map[string]*runner.Environment{
+			"staging": {
+				Name:            "staging",
+				Vars:            map[string]string{"REGION": "eu-west-1"},
+				SecretProviders: []secrets.Provider{secrets.DotenvFile{Path: dotenv}},
+			},
+			"production": {
+				Name: "production",
+				Protection: runner.ProtectionRules{
+					RequiredApproval: true,
+					Branches:         branches,
+				},
+			},
+		}
+		return run
+	}
+	readWorkflow := func() *yamls.Workflow {
+		f, err := rootFs.Open(filename)
+		require.NoError(t, err)
+		wf, err := yamls.ReadWorkflow(f, false)
+		require.NoError(t, err)
+		return wf
+	}
+	wfContext := func(runID, refName string) *types.WorkflowContexts {
+		return &types.WorkflowContexts{
+			GitHub: &types.GitHub{RunID: runID, RefName: refName, RefType: "branch"},
+			Vars:   types.Vars{"REGION": "default", "SHARED": "repo"},
+		}
+	}
+
+	t.Run("approved", func(t *testing.T) {
+		ctx := makeContext(t, slog.LevelDebug, "file", filename)
+		consoleBuffer := &bytes.Buffer{}
+		run := newRunner(consoleBuffer, "main", "release/*")
+
+		approved := make(chan error, 1)
+		go func() {
+			runDir := runner.RunDir(run.StateDir, "101")
+			for {
+				pending, _ := runner.PendingApprovals(runDir)
+				if len(pending) > 0 {
+					assert.Equal(t, "production", pending[0].Environment)
+					approved <- runner.DecideApproval(runDir, pending[0].Job, true)
+					return
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		}()
+
+		wfState, err := run.RunWorkflow(ctx, readWorkflow(), wfContext("101", "release/1.0"))
+		require.NoError(t, err, errParse(err))
+		require.NoError(t, <-approved)
+
+		console := consoleBuffer.String()
+		assert.Contains(t, console, "waiting for approval to deploy to production. Approve with: bact workflow approve 101 deploy-production")
+		assert.Contains(t, console, "deploying to production")
+		assert.Contains(t, console, "using token ***")
+		assert.NotContains(t, console, "staging-token-value")
+
+		staging := wfState.Jobs["deploy-staging"]
+		require.NotNil(t, staging.Environment)
+		assert.Equal(t, runner.JobEnvironment{Name: "staging", URL: "https://staging.example.com"}, *staging.Environment)
+
+		exprContext, err := runner.MakeExprContext(runner.MakeExprContextParams{Job: staging})
+		require.NoError(t, err)
+		evaluator, err := expr.NewEvaluator(exprContext)
+		require.NoError(t, err)
+		for expression, want := range map[string]string{
+			"vars.REGION":          "eu-west-1",
+			"vars.SHARED":          "repo",
+			"secrets.DEPLOY_TOKEN": "staging-token-value",
+			"github.environment":   "staging",
+		} {
+			got, err := evaluator.EvaluateExpression(expression)
+			require.NoError(t, err, expression)
+			assert.Equal(t, want, got, expression)
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		ctx := makeContext(t, slog.LevelDebug, "file", filename)
+		run := newRunner(&bytes.Buffer{})
+		go func() {
+			runDir := runner.RunDir(run.StateDir, "102")
+			for {
+				if err := runner.DecideApproval(runDir, "deploy-production", false); err == nil {
+					return
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		}()
+
+		_, err := run.RunWorkflow(ctx, readWorkflow(), wfContext("102", "main"))
+		require.Error(t, err)
+		assert.Contains(t, errParse(err), "deployment to environment production was rejected")
+	})
+
+	t.Run("branch not allowed", func(t *testing.T) {
+		ctx := makeContext(t, slog.LevelDebug, "file", filename)
+		run := newRunner(&bytes.Buffer{}, "main")
+
+		_, err := run.RunWorkflow(ctx, readWorkflow(), wfContext("103", "feature/x"))
+		require.Error(t, err)
+		assert.Contains(t, errParse(err), `branch "feature/x" is not allowed to deploy to environment production`)
+	})
+}
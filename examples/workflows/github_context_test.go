@@ -0,0 +1,79 @@
+package workflows_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/runner"
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+func TestGithubContextWorkflow(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	const filename = "github_context.yaml"
+	ctx := makeContext(t, slog.LevelDebug, "file", filename)
+
+	repoDir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "--quiet", "--initial-branch=main"},
+		{"config", "user.name", "octocat"},
+		{"config", "user.email", "octocat@example.com"},
+		{"remote", "add", "origin", "https://github.com/octo-org/hello-world.git"},
+		{"commit", "--quiet", "--allow-empty", "-m", "init"},
+	} {
+		out, err := exec.Command("git", append([]string{"-C", repoDir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	sha, err := exec.Command("git", "-C", repoDir, "rev-parse", "HEAD").Output()
+	require.NoError(t, err)
+	headSHA := strings.TrimSpace(string(sha))
+
+	consoleBuffer := &bytes.Buffer{}
+	console := io.MultiWriter(consoleBuffer, t.Output())
+	run := runner.New(
+		console,
+		runner.EnvFromEmpty(),
+	)
+	run.RepoDir = repoDir
+
+	f, err := rootFs.Open(filename)
+	if err != nil {
+		t.Fatal("failed to open workflow file:", err)
+	}
+	wf, err := yamls.ReadWorkflow(f, false)
+	if err != nil {
+		t.Fatal("failed to read workflow:", err)
+	}
+
+	wfState, err := run.RunWorkflow(ctx, wf, &types.WorkflowContexts{
+		GitHub: &types.GitHub{EventName: "push"},
+	})
+	if err != nil {
+		t.Fatal("failed to run workflow:", err)
+	}
+	assert.Equal(t, headSHA, wfState.GitHub.SHA)
+
+	output := consoleBuffer.String()
+	assert.Contains(t, output, "CI=true")
+	assert.Contains(t, output, "GITHUB_ACTIONS=true")
+	assert.Contains(t, output, "GITHUB_SHA="+headSHA)
+	assert.Contains(t, output, "WF_SHA="+headSHA)
+	assert.Contains(t, output, "GITHUB_REPOSITORY=octo-org/hello-world")
+	assert.Contains(t, output, "WF_REPO=octo-org/hello-world")
+	assert.Contains(t, output, "GITHUB_REF=refs/heads/main")
+	assert.Contains(t, output, "GITHUB_EVENT_NAME=push")
+	assert.Contains(t, output, "GITHUB_JOB=print-context")
+	assert.Contains(t, output, "RUNNER_OS=")
+	assert.Contains(t, output, "event payload exists")
+}
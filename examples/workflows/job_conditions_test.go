@@ -0,0 +1,61 @@
+package workflows_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/runner"
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+func TestJobConditionsWorkflow(t *testing.T) {
+	const filename = "job_conditions.yaml"
+	ctx := makeContext(t, slog.LevelDebug, "file", filename)
+	consoleBuffer := &bytes.Buffer{}
+	run := runner.New(io.MultiWriter(consoleBuffer, t.Output()), runner.EnvFromEmpty())
+
+	f, err := rootFs.Open(filename)
+	require.NoError(t, err)
+	wf, err := yamls.ReadWorkflow(f, false)
+	require.NoError(t, err)
+
+	wfState, err := run.RunWorkflow(ctx, wf, &types.WorkflowContexts{})
+	require.Error(t, err)
+	require.NotNil(t, wfState)
+	assert.Contains(t, errParse(err), "broken")
+	assert.Contains(t, errParse(err), "slow")
+	assert.NotContains(t, errParse(err), "flaky")
+
+	results := map[string]runner.JobResult{}
+	for name, job := range wfState.Jobs {
+		results[name] = job.Result
+	}
+	assert.Equal(t, map[string]runner.JobResult{
+		"build":          runner.JobResultSuccess,
+		"deploy":         runner.JobResultSuccess,
+		"flaky":          runner.JobResultFailure,
+		"tolerant":       runner.JobResultSuccess,
+		"disabled":       runner.JobResultSkipped,
+		"after-disabled": runner.JobResultSkipped,
+		"broken":         runner.JobResultFailure,
+		"cleanup":        runner.JobResultSuccess,
+		"slow":           runner.JobResultCancelled,
+	}, results)
+	assert.Equal(t, map[string]string{"version": "1.2.3"}, wfState.Jobs["build"].Outputs)
+	assert.False(t, wfState.Jobs["flaky"].Failed())
+
+	output := consoleBuffer.String()
+	assert.Contains(t, output, "deploying version 1.2.3")
+	assert.Contains(t, output, "try failed and the job went on")
+	assert.NotContains(t, output, "tolerant job failed")
+	assert.NotContains(t, output, "disabled job ran")
+	assert.NotContains(t, output, "step after the failure ran")
+	assert.Contains(t, output, "broken job failed")
+	assert.Contains(t, output, "cleaning up after broken")
+}
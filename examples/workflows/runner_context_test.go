@@ -0,0 +1,75 @@
+package workflows_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/runner"
+	"github.com/drornir/better-actions/pkg/runner/expr"
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+func TestRunnerContextWorkflow(t *testing.T) {
+	const filename = "runner_context.yaml"
+	ctx := makeContext(t, slog.LevelDebug, "file", filename)
+	stateDir := t.TempDir()
+
+	runOnce := func() (string, *runner.WorkflowState) {
+		t.Helper()
+		consoleBuffer := &bytes.Buffer{}
+		run := runner.New(io.MultiWriter(consoleBuffer, t.Output()), runner.EnvFromEmpty())
+		run.StateDir = stateDir
+
+		f, err := rootFs.Open(filename)
+		require.NoError(t, err)
+		wf, err := yamls.ReadWorkflow(f, false)
+		require.NoError(t, err)
+		wfState, err := run.RunWorkflow(ctx, wf, &types.WorkflowContexts{})
+		require.NoError(t, err, errParse(err))
+		return consoleBuffer.String(), wfState
+	}
+
+	first, wfState := runOnce()
+	assert.Contains(t, first, "runner temp exists")
+	assert.Contains(t, first, "tool cache exists")
+	assert.Contains(t, first, "tool installed")
+	assert.Contains(t, first, "RUNNER_TOOL_CACHE="+filepath.Join(stateDir, "tool-cache"))
+	if runtime.GOOS == "linux" {
+		assert.Contains(t, first, "RUNNER_OS=Linux")
+	}
+	if runtime.GOARCH == "amd64" {
+		assert.Contains(t, first, "RUNNER_ARCH=X64")
+	}
+
+	tempDir := regexp.MustCompile(`RUNNER_TEMP=(\S+)`).FindStringSubmatch(first)
+	require.Len(t, tempDir, 2)
+	_, err := os.Stat(tempDir[1])
+	assert.ErrorIs(t, err, os.ErrNotExist, "runner temp is removed at the end of the job")
+
+	exprContext, err := runner.MakeExprContext(runner.MakeExprContextParams{Job: wfState.Jobs["runner-dirs"]})
+	require.NoError(t, err)
+	evaluator, err := expr.NewEvaluator(exprContext)
+	require.NoError(t, err)
+	for expression, want := range map[string]string{
+		"runner.temp":        tempDir[1],
+		"runner.tool_cache":  filepath.Join(stateDir, "tool-cache"),
+		"runner.environment": "self-hosted",
+	} {
+		got, err := evaluator.EvaluateExpression(expression)
+		require.NoError(t, err, expression)
+		assert.Equal(t, want, got, expression)
+	}
+
+	second, _ := runOnce()
+	assert.Contains(t, second, "tool found in cache")
+}
@@ -0,0 +1,53 @@
+package workflows_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/runner"
+	"github.com/drornir/better-actions/pkg/secrets"
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+func TestSecretsWorkflow(t *testing.T) {
+	const filename = "secrets.yaml"
+	ctx := makeContext(t, slog.LevelDebug, "file", filename)
+
+	dotenv := filepath.Join(t.TempDir(), ".secrets")
+	require.NoError(t, os.WriteFile(dotenv, []byte("TOKEN=dotenv-token\nCERT=\"cert-line-one\ncert-line-two\"\n"), 0o600))
+
+	consoleBuffer := &bytes.Buffer{}
+	run := runner.New(io.MultiWriter(consoleBuffer, t.Output()), runner.EnvFromEmpty())
+	run.SecretProviders = []secrets.Provider{
+		secrets.EnvPrefix{Prefix: "TEST_SECRET_", Environ: []string{"TEST_SECRET_TOKEN=env-token"}},
+		secrets.DotenvFile{Path: dotenv},
+	}
+
+	f, err := rootFs.Open(filename)
+	require.NoError(t, err)
+	wf, err := yamls.ReadWorkflow(f, false)
+	require.NoError(t, err)
+	wfState, err := run.RunWorkflow(ctx, wf, &types.WorkflowContexts{
+		Secrets: types.Secrets{"FLAG_SECRET": "from-flag"},
+	})
+	require.NoError(t, err, errParse(err))
+
+	assert.Equal(t, "env-token", wfState.Secrets["TOKEN"], "the first provider takes precedence")
+	assert.Equal(t, "from-flag", wfState.Secrets["FLAG_SECRET"])
+
+	console := consoleBuffer.String()
+	for _, value := range []string{"env-token", "dotenv-token", "cert-line-one", "cert-line-two"} {
+		assert.NotContains(t, console, value)
+	}
+	assert.Contains(t, console, "token is ***")
+	assert.Contains(t, console, "second line is ***")
+	assert.Contains(t, console, "flag secret is unset", "secrets are not in the environment unless the workflow puts them there")
+}
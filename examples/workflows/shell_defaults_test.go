@@ -0,0 +1,49 @@
+package workflows_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/runner"
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/workspace"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+func TestShellDefaultsWorkflow(t *testing.T) {
+	for _, bin := range []string{"perl", "python3"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s is not installed", bin)
+		}
+	}
+
+	const filename = "shell_defaults.yaml"
+	ctx := makeContext(t, slog.LevelDebug, "file", filename)
+	consoleBuffer := &bytes.Buffer{}
+	run := runner.New(io.MultiWriter(consoleBuffer, t.Output()), runner.EnvFromEmpty())
+	run.RepoDir = t.TempDir()
+	run.Workspace = workspace.Options{Mode: workspace.ModeEmpty}
+
+	f, err := rootFs.Open(filename)
+	require.NoError(t, err)
+	wf, err := yamls.ReadWorkflow(f, false)
+	require.NoError(t, err)
+
+	_, err = run.RunWorkflow(ctx, wf, &types.WorkflowContexts{})
+	require.NoError(t, err, errParse(err))
+
+	output := consoleBuffer.String()
+	assert.Contains(t, output, "workflow default shell is sh")
+	assert.Contains(t, output, "workflow default dir is wf-dir")
+	assert.Contains(t, output, "step shell is bash")
+	assert.Contains(t, output, "configured bash has pipefail")
+	assert.Contains(t, output, "job default shell is python, script is script.py")
+	assert.Contains(t, output, "job default dir is job-dir")
+	assert.Contains(t, output, "custom perl shell ok")
+}
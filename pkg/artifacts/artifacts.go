@@ -0,0 +1,227 @@
+// Package artifacts stores the artifacts of a workflow run on the local file system.
+// Every artifact is a single zip archive, the same format GitHub uses.
+package artifacts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/log"
+)
+
+// Artifact is the metadata of a stored artifact
+type Artifact struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	Digest    string    `json:"digest"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Store keeps artifacts in a directory. It is safe for concurrent use within a process.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewStore returns a Store that keeps its artifacts in dir, creating dir if needed
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, oops.With("dir", dir).Wrapf(err, "creating artifacts directory")
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Dir is the directory the artifacts are stored in
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// ValidateName checks that name is a valid artifact name.
+// The rules are the same as GitHub's, which also guarantees the name is a safe file name.
+func ValidateName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return oops.Errorf("artifact name is empty")
+	}
+	if strings.ContainsAny(name, "\":<>|*?\r\n\\/") {
+		return oops.With("name", name).
+			Errorf(`artifact name %q contains an invalid character (one of " : < > | * ? \r \n \ /)`, name)
+	}
+	if name == "." || name == ".." {
+		return oops.With("name", name).Errorf("artifact name %q is invalid", name)
+	}
+	return nil
+}
+
+// Save stores the zip archive read from r as the artifact called name.
+// If an artifact with the same name exists, Save fails unless overwrite is set.
+func (s *Store) Save(ctx context.Context, name string, overwrite bool, r io.Reader) (Artifact, error) {
+	oopser := oops.FromContext(ctx).With("artifact", name)
+	if err := ValidateName(name); err != nil {
+		return Artifact{}, err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return Artifact{}, oopser.Wrapf(err, "creating temporary file")
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return Artifact{}, oopser.Wrapf(err, "writing artifact content")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, err := s.list()
+	if err != nil {
+		return Artifact{}, err
+	}
+	var nextID int64 = 1
+	for _, a := range existing {
+		if a.Name == name && !overwrite {
+			return Artifact{}, oopser.Errorf("an artifact with the name %q already exists", name)
+		}
+		nextID = max(nextID, a.ID+1)
+	}
+
+	art := Artifact{
+		ID:        nextID,
+		Name:      name,
+		Size:      size,
+		Digest:    "sha256:" + hex.EncodeToString(hash.Sum(nil)),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := os.Rename(tmp.Name(), s.zipPath(name)); err != nil {
+		return Artifact{}, oopser.Wrapf(err, "moving artifact into place")
+	}
+	meta, err := json.MarshalIndent(art, "", "  ")
+	if err != nil {
+		return Artifact{}, oopser.Wrapf(err, "marshaling artifact metadata")
+	}
+	if err := os.WriteFile(s.metaPath(name), meta, 0o644); err != nil {
+		return Artifact{}, oopser.Wrapf(err, "writing artifact metadata")
+	}
+
+	log.FromContext(ctx).D(ctx, "saved artifact", "artifact", name, "artifact.id", art.ID, "artifact.size", size)
+	return art, nil
+}
+
+// List returns all the artifacts sorted by ID
+func (s *Store) List(ctx context.Context) ([]Artifact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+// Get returns the artifact called name, or nil if there isn't one
+func (s *Store) Get(ctx context.Context, name string) (*Artifact, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(name)
+}
+
+// Open opens the zip archive of the artifact called name.
+func (s *Store) Open(ctx context.Context, name string) (*os.File, *Artifact, error) {
+	art, err := s.Get(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if art == nil {
+		return nil, nil, oops.FromContext(ctx).With("artifact", name).Errorf("artifact %q not found", name)
+	}
+	f, err := os.Open(s.zipPath(name))
+	if err != nil {
+		return nil, nil, oops.FromContext(ctx).With("artifact", name).Wrapf(err, "opening artifact")
+	}
+	return f, art, nil
+}
+
+// Delete removes the artifact called name and returns it, or nil if there is no such artifact
+func (s *Store) Delete(ctx context.Context, name string) (*Artifact, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	art, err := s.get(name)
+	if err != nil || art == nil {
+		return nil, err
+	}
+	if err := os.Remove(s.metaPath(name)); err != nil {
+		return nil, oops.FromContext(ctx).With("artifact", name).Wrapf(err, "deleting artifact metadata")
+	}
+	if err := os.Remove(s.zipPath(name)); err != nil {
+		return nil, oops.FromContext(ctx).With("artifact", name).Wrapf(err, "deleting artifact")
+	}
+	return art, nil
+}
+
+func (s *Store) list() ([]Artifact, error) {
+	metas, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, oops.Wrap(err)
+	}
+	arts := make([]Artifact, 0, len(metas))
+	for _, m := range metas {
+		art, err := readMeta(m)
+		if err != nil {
+			return nil, err
+		}
+		arts = append(arts, art)
+	}
+	slices.SortFunc(arts, func(a, b Artifact) int { return int(a.ID - b.ID) })
+	return arts, nil
+}
+
+func (s *Store) get(name string) (*Artifact, error) {
+	art, err := readMeta(s.metaPath(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &art, nil
+}
+
+func readMeta(path string) (Artifact, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Artifact{}, err
+	}
+	var art Artifact
+	if err := json.Unmarshal(b, &art); err != nil {
+		return Artifact{}, oops.With("file", path).Wrapf(err, "parsing artifact metadata")
+	}
+	return art, nil
+}
+
+func (s *Store) zipPath(name string) string {
+	return filepath.Join(s.dir, name+".zip")
+}
+
+func (s *Store) metaPath(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
@@ -0,0 +1,471 @@
+package artifacts
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/log"
+	"github.com/drornir/better-actions/pkg/runtimetoken"
+)
+
+// twirpPrefix is the path of the artifact service of the results API, used by actions/upload-artifact@v4
+// and actions/download-artifact@v4 through ACTIONS_RESULTS_URL
+const twirpPrefix = "/twirp/github.actions.results.api.v1.ArtifactService/"
+
+// Server is an in-process implementation of the artifact service of the GitHub results API.
+// It speaks Twirp with JSON, and accepts blob uploads the way the Azure SDK does it (staged blocks and a
+// block list), so unmodified upstream actions can use it.
+type Server struct {
+	store  *Store
+	signer *runtimetoken.Signer
+
+	listener net.Listener
+	http     *http.Server
+	baseURL  string
+
+	mu      sync.Mutex
+	uploads map[string]*pendingUpload
+}
+
+type pendingUpload struct {
+	id           string
+	name         string
+	runBackendID string
+	dir          string
+}
+
+// NewServer creates a server for the artifacts in store that accepts the tokens of signer.
+// Call [Server.Start] to serve.
+func NewServer(store *Store, signer *runtimetoken.Signer) *Server {
+	return &Server{
+		store:   store,
+		signer:  signer,
+		uploads: make(map[string]*pendingUpload),
+	}
+}
+
+// Start listens on a random port of the loopback interface and serves in the background
+func (s *Server) Start(ctx context.Context) error {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return oops.FromContext(ctx).Wrapf(err, "listening for artifact service")
+	}
+	s.listener = l
+	s.baseURL = "http://" + l.Addr().String() + "/"
+	s.http = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return context.WithoutCancel(ctx) },
+	}
+	go func() {
+		if err := s.http.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.FromContext(ctx).E(ctx, "artifact service stopped", "error", err)
+		}
+	}()
+	log.FromContext(ctx).D(ctx, "artifact service started", "url", s.baseURL)
+	return nil
+}
+
+// Close stops the server and removes unfinished uploads
+func (s *Server) Close() error {
+	s.mu.Lock()
+	for id, u := range s.uploads {
+		os.RemoveAll(u.dir)
+		delete(s.uploads, id)
+	}
+	s.mu.Unlock()
+	if s.http == nil {
+		return nil
+	}
+	return oops.Wrap(s.http.Close())
+}
+
+// URL is the value of ACTIONS_RESULTS_URL. It ends with a slash.
+func (s *Server) URL() string {
+	return s.baseURL
+}
+
+// Handler is the http handler of the server
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+twirpPrefix+"{method}", s.handleTwirp)
+	mux.HandleFunc("PUT /upload/{id}", s.handleUpload)
+	mux.HandleFunc("GET /download/{name}", s.handleDownload)
+	return mux
+}
+
+// twirpError is the error body of the Twirp protocol
+type twirpError struct {
+	Code   string `json:"code"`
+	Msg    string `json:"msg"`
+	status int
+}
+
+func (e *twirpError) Error() string {
+	return e.Code + ": " + e.Msg
+}
+
+func newTwirpError(status int, code, format string, args ...any) *twirpError {
+	return &twirpError{Code: code, Msg: fmt.Sprintf(format, args...), status: status}
+}
+
+func (s *Server) handleTwirp(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	logger := log.FromContext(ctx)
+	method := r.PathValue("method")
+
+	resp, err := func() (any, error) {
+		runID, _, err := s.signer.VerifyRequest(r)
+		if err != nil {
+			return nil, newTwirpError(http.StatusUnauthorized, "unauthenticated", "%s", err.Error())
+		}
+		var req twirpRequest
+		dec := json.NewDecoder(r.Body)
+		dec.UseNumber()
+		if err := dec.Decode(&req); err != nil {
+			return nil, newTwirpError(http.StatusBadRequest, "malformed", "invalid request body: %s", err.Error())
+		}
+		if reqRun := req.str("workflow_run_backend_id"); reqRun != "" && reqRun != runID {
+			return nil, newTwirpError(http.StatusForbidden, "permission_denied", "token is not valid for run %s", reqRun)
+		}
+
+		switch method {
+		case "CreateArtifact":
+			return s.createArtifact(ctx, runID, req)
+		case "FinalizeArtifact":
+			return s.finalizeArtifact(ctx, runID, req)
+		case "ListArtifacts":
+			return s.listArtifacts(ctx, req)
+		case "GetSignedArtifactURL":
+			return s.getSignedArtifactURL(ctx, req)
+		case "DeleteArtifact":
+			return s.deleteArtifact(ctx, req)
+		default:
+			return nil, newTwirpError(http.StatusNotFound, "bad_route", "unknown method %s", method)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		var te *twirpError
+		if !errors.As(err, &te) {
+			te = newTwirpError(http.StatusInternalServerError, "internal", "%s", err.Error())
+		}
+		logger.D(ctx, "artifact service error", "method", method, "error", err)
+		w.WriteHeader(te.status)
+		json.NewEncoder(w).Encode(te)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.W(ctx, "failed to write artifact service response", "method", method, "error", err)
+	}
+}
+
+func (s *Server) createArtifact(ctx context.Context, runID string, req twirpRequest) (any, error) {
+	name := req.str("name")
+	if err := ValidateName(name); err != nil {
+		return nil, newTwirpError(http.StatusBadRequest, "invalid_argument", "%s", err.Error())
+	}
+	if existing, err := s.store.Get(ctx, name); err != nil {
+		return nil, err
+	} else if existing != nil {
+		return nil, newTwirpError(http.StatusConflict, "already_exists", "an artifact with the name %s already exists", name)
+	}
+
+	dir, err := os.MkdirTemp(s.store.Dir(), ".blocks-")
+	if err != nil {
+		return nil, oops.Wrapf(err, "creating upload directory")
+	}
+	u := &pendingUpload{id: filepath.Base(dir), name: name, runBackendID: runID, dir: dir}
+	s.mu.Lock()
+	for id, old := range s.uploads {
+		// a retried upload replaces the unfinished one
+		if old.name == name {
+			os.RemoveAll(old.dir)
+			delete(s.uploads, id)
+		}
+	}
+	s.uploads[u.id] = u
+	s.mu.Unlock()
+
+	return map[string]any{
+		"ok":                true,
+		"signed_upload_url": s.signedURL("upload/" + u.id),
+	}, nil
+}
+
+func (s *Server) finalizeArtifact(ctx context.Context, runID string, req twirpRequest) (any, error) {
+	name := req.str("name")
+	u := s.takeUpload(name, runID)
+	if u == nil {
+		return nil, newTwirpError(http.StatusNotFound, "not_found", "no upload in progress for artifact %s", name)
+	}
+	defer os.RemoveAll(u.dir)
+
+	blob, err := os.Open(filepath.Join(u.dir, "blob"))
+	if err != nil {
+		return nil, newTwirpError(http.StatusBadRequest, "failed_precondition", "artifact %s has no content", name)
+	}
+	defer blob.Close()
+	art, err := s.store.Save(ctx, name, false, blob)
+	if err != nil {
+		return nil, err
+	}
+	if size := req.int("size"); size > 0 && size != art.Size {
+		log.FromContext(ctx).W(ctx, "artifact size mismatch", "artifact", name, "expected", size, "actual", art.Size)
+	}
+	if hash := req.str("hash"); hash != "" && hash != art.Digest {
+		log.FromContext(ctx).W(ctx, "artifact digest mismatch", "artifact", name, "expected", hash, "actual", art.Digest)
+	}
+	return map[string]any{
+		"ok":          true,
+		"artifact_id": strconv.FormatInt(art.ID, 10),
+	}, nil
+}
+
+func (s *Server) listArtifacts(ctx context.Context, req twirpRequest) (any, error) {
+	all, err := s.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nameFilter := req.str("name_filter")
+	idFilter := req.int("id_filter")
+	list := make([]map[string]any, 0, len(all))
+	for _, art := range all {
+		if nameFilter != "" && art.Name != nameFilter {
+			continue
+		}
+		if idFilter != 0 && art.ID != idFilter {
+			continue
+		}
+		list = append(list, map[string]any{
+			"workflow_run_backend_id":     req.str("workflow_run_backend_id"),
+			"workflow_job_run_backend_id": req.str("workflow_job_run_backend_id"),
+			"database_id":                 strconv.FormatInt(art.ID, 10),
+			"name":                        art.Name,
+			"size":                        strconv.FormatInt(art.Size, 10),
+			"created_at":                  art.CreatedAt.Format(time.RFC3339Nano),
+			"digest":                      art.Digest,
+		})
+	}
+	return map[string]any{"artifacts": list}, nil
+}
+
+func (s *Server) getSignedArtifactURL(ctx context.Context, req twirpRequest) (any, error) {
+	name := req.str("name")
+	if art, err := s.store.Get(ctx, name); err != nil {
+		return nil, err
+	} else if art == nil {
+		return nil, newTwirpError(http.StatusNotFound, "not_found", "artifact %s not found", name)
+	}
+	return map[string]any{
+		"signed_url": s.signedURL("download/" + url.PathEscape(name)),
+	}, nil
+}
+
+func (s *Server) deleteArtifact(ctx context.Context, req twirpRequest) (any, error) {
+	name := req.str("name")
+	art, err := s.store.Delete(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if art == nil {
+		return nil, newTwirpError(http.StatusNotFound, "not_found", "artifact %s not found", name)
+	}
+	return map[string]any{
+		"ok":          true,
+		"artifact_id": strconv.FormatInt(art.ID, 10),
+	}, nil
+}
+
+func (s *Server) takeUpload(name, runID string) *pendingUpload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, u := range s.uploads {
+		if u.name == name && u.runBackendID == runID {
+			delete(s.uploads, id)
+			return u
+		}
+	}
+	return nil
+}
+
+// signedURL returns an absolute url for p with a signature, so blob requests need no token like in Azure
+func (s *Server) signedURL(p string) string {
+	return s.baseURL + p + "?sig=" + hex.EncodeToString(s.signer.MAC("/"+p))
+}
+
+func (s *Server) checkSignature(r *http.Request) bool {
+	sig, err := hex.DecodeString(r.URL.Query().Get("sig"))
+	if err != nil {
+		return false
+	}
+	return s.signer.CheckMAC(r.URL.EscapedPath(), sig)
+}
+
+// handleUpload implements the subset of the Azure blob API that the Azure SDK uses to upload a block blob:
+// Put Block (comp=block), Put Block List (comp=blocklist) and a single shot Put Blob.
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !s.checkSignature(r) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	s.mu.Lock()
+	u := s.uploads[r.PathValue("id")]
+	s.mu.Unlock()
+	if u == nil {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	var err error
+	switch query.Get("comp") {
+	case "block":
+		blockID := query.Get("blockid")
+		if blockID == "" {
+			http.Error(w, "missing blockid", http.StatusBadRequest)
+			return
+		}
+		err = writeFileFrom(filepath.Join(u.dir, "block-"+hex.EncodeToString([]byte(blockID))), r.Body)
+	case "blocklist":
+		err = commitBlockList(u.dir, r.Body)
+	case "":
+		err = writeFileFrom(filepath.Join(u.dir, "blob"), r.Body)
+	default:
+		http.Error(w, "unsupported operation", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.FromContext(ctx).W(ctx, "artifact upload failed", "artifact", u.name, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", `"`+strconv.FormatInt(time.Now().UnixNano(), 16)+`"`)
+	w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+	w.Header().Set("x-ms-request-server-encrypted", "false")
+	w.Header().Set("x-ms-version", "2023-11-03")
+	w.WriteHeader(http.StatusCreated)
+}
+
+type blockList struct {
+	Blocks []struct {
+		XMLName xml.Name
+		ID      string `xml:",chardata"`
+	} `xml:",any"`
+}
+
+func commitBlockList(dir string, body io.Reader) error {
+	var list blockList
+	if err := xml.NewDecoder(body).Decode(&list); err != nil {
+		return oops.Wrapf(err, "parsing block list")
+	}
+	out, err := os.Create(filepath.Join(dir, "blob"))
+	if err != nil {
+		return oops.Wrap(err)
+	}
+	defer out.Close()
+	for _, b := range list.Blocks {
+		block, err := os.Open(filepath.Join(dir, "block-"+hex.EncodeToString([]byte(b.ID))))
+		if err != nil {
+			return oops.With("blockid", b.ID).Wrapf(err, "block was not uploaded")
+		}
+		_, err = io.Copy(out, block)
+		block.Close()
+		if err != nil {
+			return oops.Wrap(err)
+		}
+	}
+	return oops.Wrap(out.Close())
+}
+
+func writeFileFrom(path string, r io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return oops.Wrap(err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return oops.Wrap(err)
+	}
+	return oops.Wrap(f.Close())
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	if !s.checkSignature(r) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	f, art, err := s.store.Open(r.Context(), r.PathValue("name"))
+	if err != nil {
+		http.Error(w, "artifact not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/zip")
+	http.ServeContent(w, r, art.Name+".zip", art.CreatedAt, f)
+}
+
+// twirpRequest is a decoded Twirp JSON request. Clients send either the proto field names or their
+// lowerCamelCase JSON names, and wrapper types either as plain values or as {"value": ...}.
+type twirpRequest map[string]any
+
+func (req twirpRequest) get(protoName string) any {
+	if v, ok := req[protoName]; ok {
+		return unwrapValue(v)
+	}
+	return unwrapValue(req[snakeToCamel(protoName)])
+}
+
+func (req twirpRequest) str(protoName string) string {
+	switch v := req.get(protoName).(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return ""
+	}
+}
+
+func (req twirpRequest) int(protoName string) int64 {
+	n, _ := strconv.ParseInt(req.str(protoName), 10, 64)
+	return n
+}
+
+func unwrapValue(v any) any {
+	if m, ok := v.(map[string]any); ok {
+		if inner, ok := m["value"]; ok {
+			return inner
+		}
+	}
+	return v
+}
+
+func snakeToCamel(s string) string {
+	parts := strings.Split(s, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,154 @@
+package artifacts
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/runtimetoken"
+)
+
+// artifactClient does what the upstream @actions/artifact client does
+type artifactClient struct {
+	t       *testing.T
+	baseURL string
+	token   string
+}
+
+func (c *artifactClient) twirp(method string, req map[string]any) (int, map[string]any) {
+	c.t.Helper()
+	body, err := json.Marshal(req)
+	require.NoError(c.t, err)
+	httpReq, err := http.NewRequest(http.MethodPost,
+		c.baseURL+"twirp/github.actions.results.api.v1.ArtifactService/"+method, bytes.NewReader(body))
+	require.NoError(c.t, err)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := http.DefaultClient.Do(httpReq)
+	require.NoError(c.t, err)
+	defer resp.Body.Close()
+	var out map[string]any
+	require.NoError(c.t, json.NewDecoder(resp.Body).Decode(&out))
+	return resp.StatusCode, out
+}
+
+func (c *artifactClient) put(url string, body []byte) {
+	c.t.Helper()
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(body))
+	require.NoError(c.t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(c.t, err)
+	resp.Body.Close()
+	require.Equal(c.t, http.StatusCreated, resp.StatusCode)
+}
+
+func TestServerUploadAndDownload(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	signer, err := runtimetoken.NewSigner()
+	require.NoError(t, err)
+	server := NewServer(store, signer)
+	require.NoError(t, server.Start(t.Context()))
+	defer server.Close()
+
+	token, err := signer.Sign("run-1", "build")
+	require.NoError(t, err)
+	client := &artifactClient{t: t, baseURL: server.URL(), token: token}
+
+	// the client reads the backend ids from the token
+	claims, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[1])
+	require.NoError(t, err)
+	assert.Contains(t, string(claims), "Actions.Results:run-1:build")
+
+	// camelCase field names, like protobuf-ts sends them
+	status, created := client.twirp("CreateArtifact", map[string]any{
+		"workflowRunBackendId":    "run-1",
+		"workflowJobRunBackendId": "build",
+		"name":                    "logs",
+		"version":                 4,
+	})
+	require.Equal(t, http.StatusOK, status, created)
+	uploadURL := created["signed_upload_url"].(string)
+
+	content := []byte("PK fake zip content")
+	blockA := base64.StdEncoding.EncodeToString([]byte("block-a"))
+	blockB := base64.StdEncoding.EncodeToString([]byte("block-b"))
+	client.put(uploadURL+"&comp=block&blockid="+blockA, content[:5])
+	client.put(uploadURL+"&comp=block&blockid="+blockB, content[5:])
+	client.put(uploadURL+"&comp=blocklist",
+		[]byte(`<?xml version="1.0" encoding="utf-8"?><BlockList><Latest>`+blockA+`</Latest><Latest>`+blockB+`</Latest></BlockList>`))
+
+	status, finalized := client.twirp("FinalizeArtifact", map[string]any{
+		"workflow_run_backend_id":     "run-1",
+		"workflow_job_run_backend_id": "build",
+		"name":                        "logs",
+		"size":                        "19",
+	})
+	require.Equal(t, http.StatusOK, status, finalized)
+	assert.Equal(t, "1", finalized["artifact_id"])
+
+	status, dup := client.twirp("CreateArtifact", map[string]any{"workflow_run_backend_id": "run-1", "name": "logs"})
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, "already_exists", dup["code"])
+
+	// another job of the same run sees it
+	otherToken, err := signer.Sign("run-1", "test")
+	require.NoError(t, err)
+	other := &artifactClient{t: t, baseURL: server.URL(), token: otherToken}
+	status, listed := other.twirp("ListArtifacts", map[string]any{
+		"workflow_run_backend_id": "run-1",
+		"name_filter":             "logs",
+	})
+	require.Equal(t, http.StatusOK, status, listed)
+	list := listed["artifacts"].([]any)
+	require.Len(t, list, 1)
+	assert.Equal(t, "logs", list[0].(map[string]any)["name"])
+	assert.Equal(t, "19", list[0].(map[string]any)["size"])
+
+	status, signed := other.twirp("GetSignedArtifactURL", map[string]any{"workflow_run_backend_id": "run-1", "name": "logs"})
+	require.Equal(t, http.StatusOK, status, signed)
+	resp, err := http.Get(signed["signed_url"].(string))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	got, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	resp, err = http.Get(server.URL() + "download/logs?sig=00")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestServerRejectsBadTokens(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	signer, err := runtimetoken.NewSigner()
+	require.NoError(t, err)
+	server := NewServer(store, signer)
+	require.NoError(t, server.Start(t.Context()))
+	defer server.Close()
+
+	otherSigner, err := runtimetoken.NewSigner()
+	require.NoError(t, err)
+	foreign, err := otherSigner.Sign("run-1", "build")
+	require.NoError(t, err)
+
+	client := &artifactClient{t: t, baseURL: server.URL(), token: foreign}
+	status, body := client.twirp("ListArtifacts", map[string]any{"workflow_run_backend_id": "run-1"})
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, "unauthenticated", body["code"])
+
+	token, err := signer.Sign("run-1", "build")
+	require.NoError(t, err)
+	client.token = token
+	status, body = client.twirp("ListArtifacts", map[string]any{"workflow_run_backend_id": "run-2"})
+	assert.Equal(t, http.StatusForbidden, status, body)
+}
@@ -0,0 +1,107 @@
+package artifacts
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path"
+
+	"github.com/samber/oops"
+)
+
+// File is a file to put in an artifact archive
+type File struct {
+	// Name is the slash separated path of the file inside the archive
+	Name string
+	// Path is the path of the file on disk
+	Path string
+}
+
+// WriteZip writes a zip archive with files to w
+func WriteZip(w io.Writer, files []File) error {
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		if err := addZipFile(zw, f); err != nil {
+			return oops.With("file", f.Path).Wrapf(err, "adding file to archive")
+		}
+	}
+	return oops.Wrap(zw.Close())
+}
+
+func addZipFile(zw *zip.Writer, f File) error {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = f.Name
+	header.Method = zip.Deflate
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(f.Path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = io.Copy(w, in)
+	return err
+}
+
+// ExtractZip extracts the zip archive in r into dest. Entries can't escape dest.
+func ExtractZip(r io.ReaderAt, size int64, dest string) error {
+	oopser := oops.With("dest", dest)
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return oopser.Wrapf(err, "reading zip archive")
+	}
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return oopser.Wrapf(err, "creating destination directory")
+	}
+	root, err := os.OpenRoot(dest)
+	if err != nil {
+		return oopser.Wrapf(err, "opening destination directory")
+	}
+	defer root.Close()
+
+	for _, zf := range zr.File {
+		if err := extractZipFile(root, zf); err != nil {
+			return oopser.With("file", zf.Name).Wrapf(err, "extracting file")
+		}
+	}
+	return nil
+}
+
+func extractZipFile(root *os.Root, zf *zip.File) error {
+	name := path.Clean(zf.Name)
+	if zf.FileInfo().IsDir() {
+		return root.MkdirAll(name, 0o755)
+	}
+	if dir := path.Dir(name); dir != "." {
+		if err := root.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	in, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	perm := zf.Mode().Perm()
+	if perm == 0 {
+		perm = 0o644
+	}
+	out, err := root.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,211 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/artifacts"
+)
+
+// UploadArtifact implements actions/upload-artifact with the local artifact store of the run.
+//
+// Supported inputs: name, path, if-no-files-found, overwrite, include-hidden-files.
+// Outputs: artifact-id, artifact-digest.
+func UploadArtifact(ctx context.Context, actx *Context) (Result, error) {
+	oopser := oops.FromContext(ctx).With("action", "upload-artifact")
+	if actx.Artifacts == nil {
+		return Result{}, oopser.Errorf("artifact storage is not available")
+	}
+
+	name := actx.Input("name", "artifact")
+	patterns := actx.InputList("path")
+	if len(patterns) == 0 {
+		return Result{}, oopser.Errorf("input path is required")
+	}
+	overwrite, err := actx.InputBool("overwrite", false)
+	if err != nil {
+		return Result{}, err
+	}
+	includeHidden, err := actx.InputBool("include-hidden-files", false)
+	if err != nil {
+		return Result{}, err
+	}
+
+	files, err := artifactFiles(actx.Workspace, expandHome(patterns, actx.Env), includeHidden)
+	if err != nil {
+		return Result{}, oopser.Wrapf(err, "finding files to upload")
+	}
+	if len(files) == 0 {
+		msg := fmt.Sprintf("No files were found with the provided path: %s. No artifacts will be uploaded.", strings.Join(patterns, ", "))
+		switch ifNoFiles := actx.Input("if-no-files-found", "warn"); ifNoFiles {
+		case "error":
+			return Result{}, oopser.New(msg)
+		case "warn":
+			fmt.Fprintf(actx.Console, "::warning::%s\n", msg)
+		case "ignore":
+		default:
+			return Result{}, oopser.Errorf("unknown value %q for input if-no-files-found", ifNoFiles)
+		}
+		return Result{}, nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(artifacts.WriteZip(pw, files))
+	}()
+	art, err := actx.Artifacts.Save(ctx, name, overwrite, pr)
+	if err != nil {
+		pr.CloseWithError(err)
+		return Result{}, oopser.Wrapf(err, "uploading artifact")
+	}
+	fmt.Fprintf(actx.Console, "Artifact %s has been successfully uploaded! Final size is %d bytes. Artifact ID is %d\n",
+		art.Name, art.Size, art.ID)
+
+	return Result{Outputs: map[string]string{
+		"artifact-id":     strconv.FormatInt(art.ID, 10),
+		"artifact-digest": strings.TrimPrefix(art.Digest, "sha256:"),
+	}}, nil
+}
+
+// DownloadArtifact implements actions/download-artifact with the local artifact store of the run.
+// Without a name, all artifacts (optionally filtered by pattern) are downloaded, each into a directory
+// named after it unless merge-multiple is set.
+//
+// Supported inputs: name, path, pattern, merge-multiple.
+// Outputs: download-path.
+func DownloadArtifact(ctx context.Context, actx *Context) (Result, error) {
+	oopser := oops.FromContext(ctx).With("action", "download-artifact")
+	if actx.Artifacts == nil {
+		return Result{}, oopser.Errorf("artifact storage is not available")
+	}
+
+	dest := actx.Input("path", actx.Workspace)
+	dest = expandHome([]string{dest}, actx.Env)[0]
+	if !filepath.IsAbs(dest) {
+		dest = filepath.Join(actx.Workspace, dest)
+	}
+	mergeMultiple, err := actx.InputBool("merge-multiple", false)
+	if err != nil {
+		return Result{}, err
+	}
+
+	name := actx.Input("name", "")
+	if name != "" {
+		if err := downloadArtifact(ctx, actx.Artifacts, name, dest); err != nil {
+			return Result{}, oopser.Wrapf(err, "downloading artifact")
+		}
+		fmt.Fprintf(actx.Console, "Artifact %s was downloaded to %s\n", name, dest)
+		return Result{Outputs: map[string]string{"download-path": dest}}, nil
+	}
+
+	all, err := actx.Artifacts.List(ctx)
+	if err != nil {
+		return Result{}, oopser.Wrapf(err, "listing artifacts")
+	}
+	pattern := actx.Input("pattern", "")
+	for _, art := range all {
+		if pattern != "" {
+			if ok, err := doublestar.Match(pattern, art.Name); err != nil {
+				return Result{}, oopser.With("pattern", pattern).Wrapf(err, "invalid pattern")
+			} else if !ok {
+				continue
+			}
+		}
+		artDest := dest
+		if !mergeMultiple {
+			artDest = filepath.Join(dest, art.Name)
+		}
+		if err := downloadArtifact(ctx, actx.Artifacts, art.Name, artDest); err != nil {
+			return Result{}, oopser.Wrapf(err, "downloading artifact")
+		}
+		fmt.Fprintf(actx.Console, "Artifact %s was downloaded to %s\n", art.Name, artDest)
+	}
+	return Result{Outputs: map[string]string{"download-path": dest}}, nil
+}
+
+func downloadArtifact(ctx context.Context, store *artifacts.Store, name, dest string) error {
+	f, art, err := store.Open(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return artifacts.ExtractZip(f, art.Size, dest)
+}
+
+// artifactFiles finds the files to upload. Like upstream, the files are stored relative to the least
+// common ancestor of the search paths.
+func artifactFiles(workspace string, patterns []string, includeHidden bool) ([]artifacts.File, error) {
+	paths, err := matchPaths(workspace, patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []string
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!") {
+			continue
+		}
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(workspace, p)
+		}
+		p = filepath.Clean(p)
+		base := p
+		if strings.ContainsAny(p, "*?[{") {
+			base, _ = doublestar.SplitPattern(filepath.ToSlash(p))
+			base = filepath.FromSlash(base)
+		} else if slices.Contains(paths, p) {
+			// not a glob. A file's root is its directory and a directory is its own root
+			base = filepath.Dir(p)
+		}
+		roots = append(roots, base)
+	}
+	root := commonAncestor(roots)
+
+	files := make([]artifacts.File, 0, len(paths))
+	for _, p := range paths {
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil, oops.Wrap(err)
+		}
+		if !includeHidden && isHidden(rel) {
+			continue
+		}
+		files = append(files, artifacts.File{Name: filepath.ToSlash(rel), Path: p})
+	}
+	return files, nil
+}
+
+func isHidden(rel string) bool {
+	for part := range strings.SplitSeq(filepath.ToSlash(rel), "/") {
+		if strings.HasPrefix(part, ".") && part != "." && part != ".." {
+			return true
+		}
+	}
+	return false
+}
+
+func commonAncestor(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	common := filepath.Clean(paths[0])
+	for _, p := range paths[1:] {
+		p = filepath.Clean(p)
+		for common != p && !strings.HasPrefix(p, common+string(filepath.Separator)) {
+			parent := filepath.Dir(common)
+			if parent == common {
+				break
+			}
+			common = parent
+		}
+	}
+	return common
+}
@@ -0,0 +1,73 @@
+package builtin
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/artifacts"
+)
+
+func TestArtifactRoundTrip(t *testing.T) {
+	store, err := artifacts.NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	up := newTestContext(t, map[string]string{
+		"name": "dist",
+		"path": "build/out/\n!build/out/*.log",
+	})
+	up.Artifacts = store
+	writeFile(t, up.Workspace, "build/out/app", "binary")
+	writeFile(t, up.Workspace, "build/out/docs/index.html", "<html>")
+	writeFile(t, up.Workspace, "build/out/build.log", "log")
+	writeFile(t, up.Workspace, "build/out/.env", "SECRET=1")
+
+	res, err := UploadArtifact(t.Context(), up)
+	require.NoError(t, err)
+	assert.Equal(t, "1", res.Outputs["artifact-id"])
+	assert.Len(t, res.Outputs["artifact-digest"], 64)
+
+	_, err = UploadArtifact(t.Context(), up)
+	assert.Error(t, err, "artifacts are immutable unless overwrite is set")
+
+	down := newTestContext(t, map[string]string{"name": "dist", "path": "got"})
+	down.Artifacts = store
+	res, err = DownloadArtifact(t.Context(), down)
+	require.NoError(t, err)
+	got := filepath.Join(down.Workspace, "got")
+	assert.Equal(t, got, res.Outputs["download-path"])
+	assert.Equal(t, "binary", readFile(t, filepath.Join(got, "app")))
+	assert.Equal(t, "<html>", readFile(t, filepath.Join(got, "docs", "index.html")))
+	assert.NoFileExists(t, filepath.Join(got, "build.log"))
+	assert.NoFileExists(t, filepath.Join(got, ".env"), "hidden files are excluded by default")
+}
+
+func TestDownloadAllArtifacts(t *testing.T) {
+	store, err := artifacts.NewStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, name := range []string{"linux", "darwin", "notes"} {
+		up := newTestContext(t, map[string]string{"name": name, "path": name + ".txt"})
+		up.Artifacts = store
+		writeFile(t, up.Workspace, name+".txt", name)
+		_, err := UploadArtifact(t.Context(), up)
+		require.NoError(t, err)
+	}
+
+	down := newTestContext(t, map[string]string{"pattern": "*n*x", "path": "all"})
+	down.Artifacts = store
+	_, err = DownloadArtifact(t.Context(), down)
+	require.NoError(t, err)
+	assert.Equal(t, "linux", readFile(t, filepath.Join(down.Workspace, "all", "linux", "linux.txt")))
+	assert.NoDirExists(t, filepath.Join(down.Workspace, "all", "notes"))
+
+	merged := newTestContext(t, map[string]string{"merge-multiple": "true"})
+	merged.Artifacts = store
+	_, err = DownloadArtifact(t.Context(), merged)
+	require.NoError(t, err)
+	for _, name := range []string{"linux", "darwin", "notes"} {
+		assert.Equal(t, name, readFile(t, filepath.Join(merged.Workspace, name+".txt")))
+	}
+}
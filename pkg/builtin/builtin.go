@@ -0,0 +1,161 @@
+// Package builtin contains native Go implementations of popular actions.
+// When a step `uses:` an action that has a builtin implementation for the requested version, the builtin
+// runs in-process instead of fetching and running the upstream action.
+package builtin
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/artifacts"
+	"github.com/drornir/better-actions/pkg/cache"
+	"github.com/drornir/better-actions/pkg/types"
+)
+
+// Action is a builtin implementation of an action
+type Action interface {
+	// Run executes the main step of the action. Inputs are already evaluated.
+	Run(ctx context.Context, actx *Context) (Result, error)
+}
+
+// ActionFunc adapts a function to [Action]
+type ActionFunc func(ctx context.Context, actx *Context) (Result, error)
+
+func (f ActionFunc) Run(ctx context.Context, actx *Context) (Result, error) {
+	return f(ctx, actx)
+}
+
+// Result is the outcome of running an [Action]
+type Result struct {
+	Outputs map[string]string
+	// Post is optional. It runs at the end of the job, only if all the steps of the job succeeded.
+	// The console of the step is closed by then, so Post gets its own.
+	Post func(ctx context.Context, console io.Writer) error
+}
+
+// Context is everything a builtin action has access to
+type Context struct {
+	// Uses is the original `uses:` value of the step
+	Uses string
+	// Inputs are the evaluated `with:` values of the step
+	Inputs map[string]string
+	// Workspace is GITHUB_WORKSPACE
+	Workspace string
+	// Env is the environment of the step
+	Env    map[string]string
+	GitHub types.GitHub
+	// RepoDir is the local repository the workflow runs for. It acts as the git remote of checkout.
+	RepoDir   string
+	Console   io.Writer
+	Cache     *cache.Store
+	Artifacts *artifacts.Store
+}
+
+// Input returns the input called name, or def if it's empty or missing
+func (c *Context) Input(name, def string) string {
+	if v := strings.TrimSpace(c.Inputs[name]); v != "" {
+		return v
+	}
+	return def
+}
+
+// InputBool parses the input called name as a boolean, or returns def if it's empty or missing
+func (c *Context) InputBool(name string, def bool) (bool, error) {
+	v := c.Input(name, "")
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, oops.With("input", name, "value", v).Wrapf(err, "input %s is not a boolean", name)
+	}
+	return b, nil
+}
+
+// InputList splits a multiline input into its non-empty lines
+func (c *Context) InputList(name string) []string {
+	var list []string
+	for line := range strings.SplitSeq(c.Inputs[name], "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			list = append(list, line)
+		}
+	}
+	return list
+}
+
+// Registry maps `uses:` references to builtin actions
+type Registry struct {
+	entries []registryEntry
+}
+
+type registryEntry struct {
+	name     string
+	versions versionRange
+	action   Action
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// DefaultRegistry returns a registry with all the builtin actions of bact
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.MustRegister("actions/checkout", ">=1 <6", ActionFunc(Checkout))
+	r.MustRegister("actions/cache", ">=1 <5", ActionFunc(Cache))
+	r.MustRegister("actions/cache/restore", ">=3 <5", ActionFunc(CacheRestore))
+	r.MustRegister("actions/cache/save", ">=3 <5", ActionFunc(CacheSave))
+	r.MustRegister("actions/upload-artifact", ">=1 <5", ActionFunc(UploadArtifact))
+	r.MustRegister("actions/download-artifact", ">=1 <5", ActionFunc(DownloadArtifact))
+	return r
+}
+
+// Register adds an action for name (owner/repo or owner/repo/path) at the versions in versionRange.
+// versionRange is a space separated list of constraints, like ">=2 <5".
+func (r *Registry) Register(name, versions string, action Action) error {
+	vr, err := parseVersionRange(versions)
+	if err != nil {
+		return oops.With("action", name).Wrapf(err, "parsing version range")
+	}
+	r.entries = append(r.entries, registryEntry{
+		name:     strings.ToLower(name),
+		versions: vr,
+		action:   action,
+	})
+	return nil
+}
+
+// MustRegister is like [Registry.Register] but panics on error
+func (r *Registry) MustRegister(name, versions string, action Action) {
+	if err := r.Register(name, versions, action); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup finds the builtin action for a `uses:` value like actions/checkout@v4.
+// Only version tags are matched. Branches and commit SHAs never resolve to a builtin.
+func (r *Registry) Lookup(uses string) (Action, bool) {
+	if r == nil {
+		return nil, false
+	}
+	name, ref, ok := strings.Cut(uses, "@")
+	if !ok {
+		return nil, false
+	}
+	v, ok := parseVersion(ref)
+	if !ok {
+		return nil, false
+	}
+	name = strings.ToLower(name)
+	for _, e := range r.entries {
+		if e.name == name && e.versions.contains(v) {
+			return e.action, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,109 @@
+package builtin
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryLookup(t *testing.T) {
+	r := DefaultRegistry()
+
+	for _, tc := range []struct {
+		uses  string
+		found bool
+	}{
+		{"actions/checkout@v4", true},
+		{"actions/checkout@v4.2.1", true},
+		{"Actions/Checkout@v5", true},
+		{"actions/checkout@v6", false},
+		{"actions/checkout@main", false},
+		{"actions/checkout@11bd71901bbe5b1630ceea73d27597364c9af683", false},
+		{"actions/checkout", false},
+		{"actions/cache@v4", true},
+		{"actions/cache/restore@v4", true},
+		{"actions/cache/save@v3.3.1", true},
+		{"actions/upload-artifact@v4", true},
+		{"actions/download-artifact@v3", true},
+		{"actions/setup-go@v5", false},
+	} {
+		_, found := r.Lookup(tc.uses)
+		assert.Equal(t, tc.found, found, tc.uses)
+	}
+}
+
+func TestVersionRange(t *testing.T) {
+	r, err := parseVersionRange(">=2.1 <4")
+	require.NoError(t, err)
+
+	for ref, want := range map[string]bool{
+		"v2":     false,
+		"v2.1":   true,
+		"v2.1.0": true,
+		"v3.9.9": true,
+		"v4":     false,
+	} {
+		v, ok := parseVersion(ref)
+		require.True(t, ok, ref)
+		assert.Equal(t, want, r.contains(v), ref)
+	}
+
+	_, err = parseVersionRange("~2")
+	assert.Error(t, err)
+	_, err = parseVersionRange("")
+	assert.Error(t, err)
+}
+
+// makeGitRepo creates a repository with files committed in one commit and returns its path and HEAD
+func makeGitRepo(t *testing.T, files map[string]string) (string, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	runGit := func(args ...string) string {
+		t.Helper()
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	runGit("init", "--quiet", "--initial-branch=main")
+	runGit("config", "user.name", "Octo Cat")
+	runGit("config", "user.email", "octo@example.com")
+	for name, content := range files {
+		writeFile(t, dir, name, content)
+	}
+	runGit("add", ".")
+	runGit("commit", "--quiet", "-m", "init")
+	return dir, runGit("rev-parse", "HEAD")
+}
+
+func newTestContext(t *testing.T, inputs map[string]string) *Context {
+	t.Helper()
+	return &Context{
+		Inputs:    inputs,
+		Workspace: t.TempDir(),
+		Env:       map[string]string{"HOME": t.TempDir()},
+		Console:   &bytes.Buffer{},
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+	require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(b)
+}
@@ -0,0 +1,344 @@
+package builtin
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/cache"
+	"github.com/drornir/better-actions/pkg/log"
+)
+
+// cacheCompression is part of the cache version, like in actions/cache
+const cacheCompression = "gzip"
+
+// Cache implements actions/cache: it restores an entry now and saves one at the end of the job
+// if the primary key wasn't an exact hit.
+//
+// Supported inputs: path, key, restore-keys, fail-on-cache-miss, lookup-only.
+// Outputs: cache-hit.
+func Cache(ctx context.Context, actx *Context) (Result, error) {
+	restored, err := restoreCache(ctx, actx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	res := Result{Outputs: map[string]string{
+		"cache-hit": strconv.FormatBool(restored.exactHit),
+	}}
+	if !restored.exactHit {
+		res.Post = func(ctx context.Context, console io.Writer) error {
+			postCtx := *actx
+			postCtx.Console = console
+			return saveCache(ctx, &postCtx, restored.primaryKey)
+		}
+	}
+	return res, nil
+}
+
+// CacheRestore implements actions/cache/restore.
+//
+// Supported inputs: path, key, restore-keys, fail-on-cache-miss, lookup-only.
+// Outputs: cache-hit, cache-primary-key, cache-matched-key.
+func CacheRestore(ctx context.Context, actx *Context) (Result, error) {
+	restored, err := restoreCache(ctx, actx)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Outputs: map[string]string{
+		"cache-hit":         strconv.FormatBool(restored.exactHit),
+		"cache-primary-key": restored.primaryKey,
+		"cache-matched-key": restored.matchedKey,
+	}}, nil
+}
+
+// CacheSave implements actions/cache/save.
+//
+// Supported inputs: path, key.
+func CacheSave(ctx context.Context, actx *Context) (Result, error) {
+	key := actx.Input("key", "")
+	if key == "" {
+		return Result{}, oops.FromContext(ctx).Errorf("input key is required")
+	}
+	return Result{}, saveCache(ctx, actx, key)
+}
+
+type cacheRestoreResult struct {
+	primaryKey string
+	matchedKey string
+	exactHit   bool
+}
+
+func restoreCache(ctx context.Context, actx *Context) (cacheRestoreResult, error) {
+	oopser := oops.FromContext(ctx).With("action", "cache")
+
+	res := cacheRestoreResult{primaryKey: actx.Input("key", "")}
+	if res.primaryKey == "" {
+		return res, oopser.Errorf("input key is required")
+	}
+	paths := actx.InputList("path")
+	if len(paths) == 0 {
+		return res, oopser.Errorf("input path is required")
+	}
+	if actx.Cache == nil {
+		return res, oopser.Errorf("cache is not available")
+	}
+	failOnMiss, err := actx.InputBool("fail-on-cache-miss", false)
+	if err != nil {
+		return res, err
+	}
+	lookupOnly, err := actx.InputBool("lookup-only", false)
+	if err != nil {
+		return res, err
+	}
+
+	entry, err := actx.Cache.Lookup(ctx, res.primaryKey, actx.InputList("restore-keys"), cache.Version(paths, cacheCompression))
+	if err != nil {
+		return res, oopser.Wrapf(err, "looking up cache")
+	}
+	if entry == nil {
+		if failOnMiss {
+			return res, oopser.Errorf("failed to restore cache entry. Exiting as fail-on-cache-miss is set. Input key: %s", res.primaryKey)
+		}
+		fmt.Fprintf(actx.Console, "Cache not found for input keys: %s\n", strings.Join(append([]string{res.primaryKey}, actx.InputList("restore-keys")...), ", "))
+		return res, nil
+	}
+	res.matchedKey = entry.Key
+	res.exactHit = entry.Key == res.primaryKey
+
+	if lookupOnly {
+		fmt.Fprintf(actx.Console, "Cache found and can be restored from key: %s\n", entry.Key)
+		return res, nil
+	}
+
+	f, err := actx.Cache.Open(ctx, entry)
+	if err != nil {
+		return res, err
+	}
+	defer f.Close()
+	if err := extractCacheArchive(f, actx.Workspace); err != nil {
+		return res, oopser.With("cache.key", entry.Key).Wrapf(err, "restoring cache")
+	}
+	fmt.Fprintf(actx.Console, "Cache restored from key: %s\n", entry.Key)
+	return res, nil
+}
+
+func saveCache(ctx context.Context, actx *Context, key string) error {
+	oopser := oops.FromContext(ctx).With("action", "cache", "cache.key", key)
+	paths := actx.InputList("path")
+	if len(paths) == 0 {
+		return oopser.Errorf("input path is required")
+	}
+	if actx.Cache == nil {
+		return oopser.Errorf("cache is not available")
+	}
+	version := cache.Version(paths, cacheCompression)
+
+	if existing, err := actx.Cache.Lookup(ctx, key, nil, version); err != nil {
+		return oopser.Wrapf(err, "looking up cache")
+	} else if existing != nil {
+		fmt.Fprintf(actx.Console, "Cache entry with key %s already exists, not saving\n", key)
+		return nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeCacheArchive(ctx, pw, actx.Workspace, expandHome(paths, actx.Env)))
+	}()
+	if _, err := actx.Cache.Save(ctx, key, version, pr); err != nil {
+		pr.CloseWithError(err)
+		return oopser.Wrapf(err, "saving cache")
+	}
+	fmt.Fprintf(actx.Console, "Cache saved with key: %s\n", key)
+	return nil
+}
+
+func expandHome(patterns []string, env map[string]string) []string {
+	home := env["HOME"]
+	if home == "" {
+		home, _ = os.UserHomeDir()
+	}
+	out := make([]string, len(patterns))
+	for i, p := range patterns {
+		neg := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+		if p == "~" || strings.HasPrefix(p, "~/") {
+			p = home + p[1:]
+		}
+		if neg {
+			p = "!" + p
+		}
+		out[i] = p
+	}
+	return out
+}
+
+// matchPaths resolves glob patterns relative to base. Patterns that start with ! exclude the matches
+// (and everything under them) of the previous patterns.
+func matchPaths(base string, patterns []string) ([]string, error) {
+	var included, excluded []string
+	for _, p := range patterns {
+		neg := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(base, p)
+		}
+		matches, err := doublestar.FilepathGlob(p)
+		if err != nil {
+			return nil, oops.With("pattern", p).Wrapf(err, "invalid path pattern")
+		}
+		if neg {
+			excluded = append(excluded, matches...)
+		} else {
+			included = append(included, matches...)
+		}
+	}
+
+	isExcluded := func(p string) bool {
+		for _, ex := range excluded {
+			if p == ex || strings.HasPrefix(p, ex+string(filepath.Separator)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	seen := make(map[string]bool)
+	var files []string
+	for _, root := range included {
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if isExcluded(p) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || seen[p] {
+				return nil
+			}
+			seen[p] = true
+			files = append(files, p)
+			return nil
+		})
+		if err != nil {
+			return nil, oops.With("path", root).Wrapf(err, "walking path")
+		}
+	}
+	return files, nil
+}
+
+// writeCacheArchive writes a tar.gz of the files matched by patterns. Files inside workspace are stored
+// relative to it, and others by their absolute path.
+func writeCacheArchive(ctx context.Context, w io.Writer, workspace string, patterns []string) error {
+	files, err := matchPaths(workspace, patterns)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		log.FromContext(ctx).W(ctx, "no files were found for the cache paths", "paths", patterns)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		name := f
+		if rel, err := filepath.Rel(workspace, f); err == nil && !strings.HasPrefix(rel, "..") {
+			name = rel
+		}
+		if err := addTarFile(tw, f, filepath.ToSlash(name)); err != nil {
+			return oops.With("file", f).Wrapf(err, "adding file to cache archive")
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return oops.Wrap(err)
+	}
+	return oops.Wrap(gz.Close())
+}
+
+func addTarFile(tw *tar.Writer, path, name string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	var link string
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// extractCacheArchive extracts an archive written by [writeCacheArchive]
+func extractCacheArchive(r io.Reader, workspace string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return oops.Wrapf(err, "reading gzip stream")
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return oops.Wrapf(err, "reading tar stream")
+		}
+		target := filepath.FromSlash(header.Name)
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(workspace, target)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return oops.Wrap(err)
+		}
+		switch header.Typeflag {
+		case tar.TypeSymlink:
+			os.Remove(target)
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return oops.With("file", target).Wrap(err)
+			}
+		case tar.TypeReg:
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, header.FileInfo().Mode().Perm())
+			if err != nil {
+				return oops.With("file", target).Wrap(err)
+			}
+			_, err = io.Copy(out, tr)
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return oops.With("file", target).Wrap(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package builtin
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/cache"
+)
+
+func TestCacheRoundTrip(t *testing.T) {
+	store, err := cache.NewStore(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	inputs := map[string]string{
+		"path":         "deps\n~/.tool-cache\n!deps/tmp",
+		"key":          "deps-linux-abc",
+		"restore-keys": "deps-linux-\ndeps-",
+	}
+
+	// first run: miss, then the post step saves
+	save := newTestContext(t, inputs)
+	save.Cache = store
+	writeFile(t, save.Workspace, "deps/lib.txt", "lib")
+	writeFile(t, save.Workspace, "deps/tmp/junk.txt", "junk")
+	writeFile(t, save.Env["HOME"], ".tool-cache/tool", "tool")
+
+	res, err := Cache(t.Context(), save)
+	require.NoError(t, err)
+	assert.Equal(t, "false", res.Outputs["cache-hit"])
+	require.NotNil(t, res.Post)
+	require.NoError(t, res.Post(t.Context(), save.Console))
+
+	// second run with the same key: exact hit and no post step
+	restore := newTestContext(t, inputs)
+	restore.Cache = store
+	restore.Env = save.Env
+	writeFile(t, save.Env["HOME"], ".tool-cache/tool", "changed")
+	res, err = Cache(t.Context(), restore)
+	require.NoError(t, err)
+	assert.Equal(t, "true", res.Outputs["cache-hit"])
+	assert.Nil(t, res.Post)
+	assert.Equal(t, "lib", readFile(t, filepath.Join(restore.Workspace, "deps", "lib.txt")))
+	assert.NoFileExists(t, filepath.Join(restore.Workspace, "deps", "tmp", "junk.txt"))
+	assert.Equal(t, "tool", readFile(t, filepath.Join(save.Env["HOME"], ".tool-cache", "tool")))
+
+	// a different key restores from the restore-keys prefix
+	prefixInputs := map[string]string{
+		"path":         inputs["path"],
+		"key":          "deps-linux-def",
+		"restore-keys": "deps-linux-",
+	}
+	partial := newTestContext(t, prefixInputs)
+	partial.Cache = store
+	res, err = CacheRestore(t.Context(), partial)
+	require.NoError(t, err)
+	assert.Equal(t, "false", res.Outputs["cache-hit"])
+	assert.Equal(t, "deps-linux-abc", res.Outputs["cache-matched-key"])
+	assert.Equal(t, "deps-linux-def", res.Outputs["cache-primary-key"])
+	assert.FileExists(t, filepath.Join(partial.Workspace, "deps", "lib.txt"))
+
+	// different paths means a different version, so nothing matches
+	other := newTestContext(t, map[string]string{"path": "other", "key": "deps-linux-abc", "fail-on-cache-miss": "true"})
+	other.Cache = store
+	_, err = CacheRestore(t.Context(), other)
+	assert.Error(t, err)
+}
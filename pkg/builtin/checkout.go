@@ -0,0 +1,190 @@
+package builtin
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/gitinfo"
+	"github.com/drornir/better-actions/pkg/log"
+)
+
+// Checkout implements actions/checkout.
+// The repository of the workflow is fetched from the local repository ([Context.RepoDir]) instead of
+// the server, so the commit must exist locally. Other repositories are cloned from the server.
+// When the workspace already is the local repository, or a worktree of it, checking out the repository of
+// the workflow does nothing, and checking out other repositories into it fails, so the local repository
+// isn't changed.
+//
+// Supported inputs: repository, ref, path, fetch-depth, fetch-tags, clean, submodules.
+// Outputs: ref, commit.
+func Checkout(ctx context.Context, actx *Context) (Result, error) {
+	logger := log.FromContext(ctx)
+	oopser := oops.FromContext(ctx).With("action", "checkout")
+
+	repository := actx.Input("repository", actx.GitHub.Repository)
+	isWorkflowRepo := strings.EqualFold(repository, actx.GitHub.Repository)
+
+	remote := actx.RepoDir
+	if !isWorkflowRepo {
+		serverURL := actx.GitHub.ServerURL
+		if serverURL == "" {
+			serverURL = "https://github.com"
+		}
+		remote = serverURL + "/" + repository + ".git"
+	} else if remote == "" {
+		return Result{}, oopser.Errorf("no local repository to check out from")
+	} else {
+		abs, err := filepath.Abs(remote)
+		if err != nil {
+			return Result{}, oopser.Wrapf(err, "resolving local repository path")
+		}
+		// the file:// scheme makes git honor --depth for local repositories
+		remote = "file://" + filepath.ToSlash(abs)
+	}
+
+	ref := actx.Input("ref", "")
+	if ref == "" && isWorkflowRepo {
+		ref = actx.GitHub.SHA
+		if ref == "" {
+			ref = actx.GitHub.Ref
+		}
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	dest := filepath.Join(actx.Workspace, actx.Input("path", "."))
+	if rel, err := filepath.Rel(actx.Workspace, dest); err != nil || strings.HasPrefix(rel, "..") {
+		return Result{}, oopser.With("path", actx.Inputs["path"]).Errorf("path must be inside the workspace")
+	}
+
+	depth, err := strconv.Atoi(actx.Input("fetch-depth", "1"))
+	if err != nil {
+		return Result{}, oopser.Wrapf(err, "input fetch-depth is not a number")
+	}
+	fetchTags, err := actx.InputBool("fetch-tags", false)
+	if err != nil {
+		return Result{}, err
+	}
+	clean, err := actx.InputBool("clean", true)
+	if err != nil {
+		return Result{}, err
+	}
+	submodules := actx.Input("submodules", "false")
+
+	fmt.Fprintf(actx.Console, "Checking out %s@%s into %s\n", repository, ref, dest)
+	logger.D(ctx, "checkout", "remote", remote, "ref", ref, "dest", dest, "fetchDepth", depth)
+
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return Result{}, oopser.Wrapf(err, "creating checkout directory")
+	}
+	git := func(args ...string) (string, error) {
+		return gitinfo.Git(ctx, dest, args...)
+	}
+
+	if _, err := os.Stat(filepath.Join(dest, ".git")); err != nil {
+		if _, err := git("init", "--quiet"); err != nil {
+			return Result{}, oopser.Wrapf(err, "initializing repository")
+		}
+		if _, err := git("remote", "add", "origin", remote); err != nil {
+			return Result{}, oopser.Wrapf(err, "adding remote")
+		}
+	} else if actx.RepoDir != "" && sharesRepository(ctx, dest, actx.RepoDir) {
+		if !isWorkflowRepo {
+			return Result{}, oopser.With("dest", dest).Errorf("can't check out %s into the local repository of the workflow", repository)
+		}
+		// the workspace is bound to the local repository or is a worktree of it, which the workflow
+		// runs with as it is
+		commit, err := git("rev-parse", "HEAD")
+		if err != nil {
+			return Result{}, oopser.Wrapf(err, "resolving checked out commit")
+		}
+		fmt.Fprintf(actx.Console, "%s is the local repository, leaving it as it is\n", dest)
+		return Result{
+			Outputs: map[string]string{
+				"ref":    actx.GitHub.Ref,
+				"commit": commit,
+			},
+		}, nil
+	}
+
+	fetchArgs := []string{"fetch", "--quiet", "--no-recurse-submodules", "--force"}
+	if depth > 0 {
+		fetchArgs = append(fetchArgs, "--depth", strconv.Itoa(depth))
+	}
+	// like upstream, the full history comes with all the tags
+	if fetchTags || depth == 0 {
+		fetchArgs = append(fetchArgs, "--tags")
+	} else {
+		fetchArgs = append(fetchArgs, "--no-tags")
+	}
+	// the remote is fetched by its URL, so fetching into an existing repository doesn't change its config
+	fetchArgs = append(fetchArgs, remote, ref)
+	if _, err := git(fetchArgs...); err != nil {
+		return Result{}, oopser.With("ref", ref).Wrapf(err, "fetching ref")
+	}
+	commit, err := git("rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return Result{}, oopser.Wrapf(err, "resolving fetched commit")
+	}
+
+	if clean {
+		if _, err := git("clean", "-ffdx"); err != nil {
+			return Result{}, oopser.Wrapf(err, "cleaning repository")
+		}
+	}
+
+	// like upstream, branches get a local branch and everything else is a detached checkout
+	outRef := ref
+	if branch, ok := strings.CutPrefix(ref, "refs/heads/"); ok {
+		_, err = git("checkout", "--quiet", "--force", "-B", branch, commit)
+	} else {
+		_, err = git("checkout", "--quiet", "--force", "--detach", commit)
+		if ref == actx.GitHub.SHA && actx.GitHub.Ref != "" {
+			outRef = actx.GitHub.Ref
+		}
+	}
+	if err != nil {
+		return Result{}, oopser.Wrapf(err, "checking out %s", commit)
+	}
+
+	if submodules == "true" || submodules == "recursive" {
+		args := []string{"submodule", "update", "--init", "--force"}
+		if submodules == "recursive" {
+			args = append(args, "--recursive")
+		}
+		if _, err := git(args...); err != nil {
+			return Result{}, oopser.Wrapf(err, "updating submodules")
+		}
+	}
+
+	return Result{
+		Outputs: map[string]string{
+			"ref":    outRef,
+			"commit": commit,
+		},
+	}, nil
+}
+
+// sharesRepository tells if dir is in a work tree of the repository of repoDir, which is repoDir itself or a
+// worktree of it
+func sharesRepository(ctx context.Context, dir, repoDir string) bool {
+	commonDir := func(dir string) string {
+		path, err := gitinfo.Git(ctx, dir, "rev-parse", "--path-format=absolute", "--git-common-dir")
+		if err != nil {
+			return ""
+		}
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return resolved
+		}
+		return path
+	}
+	common := commonDir(dir)
+	return common != "" && common == commonDir(repoDir)
+}
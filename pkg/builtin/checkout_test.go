@@ -0,0 +1,141 @@
+package builtin
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckout(t *testing.T) {
+	repo, sha := makeGitRepo(t, map[string]string{
+		"README.md":   "hello",
+		"src/main.go": "package main",
+	})
+
+	actx := newTestContext(t, map[string]string{"path": "code"})
+	actx.RepoDir = repo
+	actx.GitHub.Repository = "octo-org/hello"
+	actx.GitHub.SHA = sha
+	actx.GitHub.Ref = "refs/heads/main"
+
+	res, err := Checkout(t.Context(), actx)
+	require.NoError(t, err)
+
+	dest := filepath.Join(actx.Workspace, "code")
+	assert.Equal(t, "hello", readFile(t, filepath.Join(dest, "README.md")))
+	assert.Equal(t, "package main", readFile(t, filepath.Join(dest, "src", "main.go")))
+	assert.Equal(t, sha, res.Outputs["commit"])
+	assert.Equal(t, "refs/heads/main", res.Outputs["ref"])
+
+	out, err := exec.Command("git", "-C", dest, "rev-list", "--count", "HEAD").CombinedOutput()
+	require.NoError(t, err, string(out))
+	assert.Equal(t, "1", strings.TrimSpace(string(out)))
+
+	// checking out again into the same directory reuses the repository
+	writeFile(t, dest, "untracked.txt", "x")
+	_, err = Checkout(t.Context(), actx)
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dest, "untracked.txt"), "clean should remove untracked files")
+}
+
+func TestCheckoutBranchRef(t *testing.T) {
+	repo, sha := makeGitRepo(t, map[string]string{"a.txt": "a"})
+
+	actx := newTestContext(t, map[string]string{"ref": "refs/heads/main"})
+	actx.RepoDir = repo
+	actx.GitHub.Repository = "octo-org/hello"
+
+	res, err := Checkout(t.Context(), actx)
+	require.NoError(t, err)
+	assert.Equal(t, sha, res.Outputs["commit"])
+
+	out, err := exec.Command("git", "-C", actx.Workspace, "branch", "--show-current").CombinedOutput()
+	require.NoError(t, err, string(out))
+	assert.Equal(t, "main", strings.TrimSpace(string(out)))
+}
+
+func TestCheckoutTags(t *testing.T) {
+	testCases := []struct {
+		name   string
+		inputs map[string]string
+		tags   bool
+	}{
+		{name: "default", inputs: map[string]string{}, tags: false},
+		{name: "fetch-tags", inputs: map[string]string{"fetch-tags": "true"}, tags: true},
+		{name: "full history", inputs: map[string]string{"fetch-depth": "0"}, tags: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo, sha := makeGitRepo(t, map[string]string{"a.txt": "a"})
+			out, err := exec.Command("git", "-C", repo, "tag", "v1.0.0").CombinedOutput()
+			require.NoError(t, err, string(out))
+
+			actx := newTestContext(t, tc.inputs)
+			actx.RepoDir = repo
+			actx.GitHub.Repository = "octo-org/hello"
+			actx.GitHub.SHA = sha
+
+			_, err = Checkout(t.Context(), actx)
+			require.NoError(t, err)
+
+			out, err = exec.Command("git", "-C", actx.Workspace, "tag", "--list").CombinedOutput()
+			require.NoError(t, err, string(out))
+			if tc.tags {
+				assert.Equal(t, "v1.0.0", strings.TrimSpace(string(out)))
+			} else {
+				assert.Empty(t, strings.TrimSpace(string(out)))
+			}
+		})
+	}
+}
+
+func TestCheckoutPathOutsideWorkspace(t *testing.T) {
+	actx := newTestContext(t, map[string]string{"path": "../escape"})
+	actx.RepoDir = t.TempDir()
+	_, err := Checkout(t.Context(), actx)
+	assert.Error(t, err)
+}
+
+func TestCheckoutIntoLocalRepository(t *testing.T) {
+	repo, sha := makeGitRepo(t, map[string]string{"a.txt": "a", ".gitignore": ".env\n"})
+	runGit := func(dir string, args ...string) string {
+		t.Helper()
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	runGit(repo, "remote", "add", "origin", "https://github.com/octo-org/hello.git")
+	worktree := filepath.Join(t.TempDir(), "worktree")
+	runGit(repo, "worktree", "add", "--quiet", "--detach", worktree, "HEAD")
+
+	for name, workspace := range map[string]string{"bind": repo, "worktree": worktree} {
+		t.Run(name, func(t *testing.T) {
+			writeFile(t, workspace, ".env", "TOKEN=x")
+			writeFile(t, workspace, "untracked.txt", "x")
+
+			actx := newTestContext(t, map[string]string{"ref": "refs/heads/main"})
+			actx.Workspace = workspace
+			actx.RepoDir = repo
+			actx.GitHub.Repository = "octo-org/hello"
+			actx.GitHub.Ref = "refs/heads/main"
+
+			res, err := Checkout(t.Context(), actx)
+			require.NoError(t, err)
+			assert.Equal(t, sha, res.Outputs["commit"])
+			assert.Equal(t, "refs/heads/main", res.Outputs["ref"])
+			assert.FileExists(t, filepath.Join(workspace, ".env"), "ignored files are kept")
+			assert.FileExists(t, filepath.Join(workspace, "untracked.txt"), "untracked files are kept")
+			assert.Equal(t, "https://github.com/octo-org/hello.git", runGit(repo, "remote", "get-url", "origin"))
+			assert.Equal(t, "main", runGit(repo, "branch", "--show-current"))
+
+			actx.Inputs = map[string]string{"repository": "octo-org/other"}
+			_, err = Checkout(t.Context(), actx)
+			assert.Error(t, err, "other repositories can't be checked out into the local repository")
+			assert.Equal(t, "https://github.com/octo-org/hello.git", runGit(repo, "remote", "get-url", "origin"))
+		})
+	}
+}
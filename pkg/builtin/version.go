@@ -0,0 +1,97 @@
+package builtin
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/samber/oops"
+)
+
+// version is a parsed version tag like v4, v4.1 or v4.1.2. Missing components are zero.
+type version [3]int
+
+// parseVersion parses a git ref that looks like a version tag. It returns false for refs that are not
+// version tags (branches, commit SHAs).
+func parseVersion(ref string) (version, bool) {
+	ref = strings.TrimPrefix(ref, "v")
+	parts := strings.Split(ref, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return version{}, false
+	}
+	var v version
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return version{}, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+func (v version) compare(o version) int {
+	for i := range v {
+		if v[i] != o[i] {
+			if v[i] < o[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionRange is a conjunction of comparisons, written as space separated constraints, e.g ">=2 <5"
+type versionRange []versionConstraint
+
+type versionConstraint struct {
+	op string
+	v  version
+}
+
+func parseVersionRange(s string) (versionRange, error) {
+	var r versionRange
+	for field := range strings.FieldsSeq(s) {
+		op := strings.TrimRight(field, "0123456789.v")
+		switch op {
+		case ">=", "<=", ">", "<", "=", "":
+		default:
+			return nil, oops.With("range", s).Errorf("unknown operator %q in version range", op)
+		}
+		v, ok := parseVersion(strings.TrimPrefix(field, op))
+		if !ok {
+			return nil, oops.With("range", s).Errorf("invalid version %q in version range", field)
+		}
+		if op == "" {
+			op = "="
+		}
+		r = append(r, versionConstraint{op: op, v: v})
+	}
+	if len(r) == 0 {
+		return nil, oops.Errorf("version range is empty")
+	}
+	return r, nil
+}
+
+func (r versionRange) contains(v version) bool {
+	for _, c := range r {
+		cmp := v.compare(c.v)
+		var ok bool
+		switch c.op {
+		case ">=":
+			ok = cmp >= 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case "<":
+			ok = cmp < 0
+		case "=":
+			ok = cmp == 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
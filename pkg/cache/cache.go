@@ -0,0 +1,373 @@
+// Package cache is a local, persistent implementation of the GitHub Actions cache.
+// Entries are immutable archives identified by a key and a version. Lookups follow the GitHub rules:
+// the primary key and then every restore key is tried as an exact key and then as a prefix, preferring the
+// most recently created entry.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/log"
+)
+
+// Entry is the metadata of a cache entry
+type Entry struct {
+	Key            string    `json:"key"`
+	Version        string    `json:"version"`
+	Size           int64     `json:"size"`
+	CreatedAt      time.Time `json:"createdAt"`
+	LastAccessedAt time.Time `json:"lastAccessedAt"`
+}
+
+// versionSalt is appended to the version components by @actions/cache
+const versionSalt = "1.0"
+
+// Version computes the version of a cache entry the same way actions/cache does: entries saved with
+// different paths or compression methods never match each other.
+func Version(paths []string, compression string) string {
+	components := append(append([]string(nil), paths...), compression, versionSalt)
+	sum := sha256.Sum256([]byte(strings.Join(components, "|")))
+	return hex.EncodeToString(sum[:])
+}
+
+// ID identifies the entry in the store
+func (e *Entry) ID() string {
+	return entryID(e.Key, e.Version)
+}
+
+// Store keeps cache entries in a directory. It is safe for concurrent use within a process.
+// When the total size of the entries exceeds the max size, the least recently used entries are evicted.
+type Store struct {
+	dir     string
+	maxSize int64
+	mu      sync.Mutex
+
+	reservations map[int64]*reservation
+	nextID       int64
+}
+
+// reservation is an entry that is being uploaded in chunks
+type reservation struct {
+	key     string
+	version string
+	file    *os.File
+}
+
+// NewStore returns a Store that keeps its entries in dir, creating dir if needed.
+// maxSize is the total size in bytes the entries may take. Zero means unlimited.
+func NewStore(dir string, maxSize int64) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, oops.With("dir", dir).Wrapf(err, "creating cache directory")
+	}
+	return &Store{
+		dir:          dir,
+		maxSize:      maxSize,
+		reservations: make(map[int64]*reservation),
+	}, nil
+}
+
+// Dir is the directory the entries are stored in
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Lookup finds the entry that matches primaryKey or one of restoreKeys for version.
+// It returns nil if nothing matches.
+func (s *Store) Lookup(ctx context.Context, primaryKey string, restoreKeys []string, version string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	var candidates []Entry
+	for _, e := range entries {
+		if e.Version == version {
+			candidates = append(candidates, e)
+		}
+	}
+
+	for _, key := range append([]string{primaryKey}, restoreKeys...) {
+		var best *Entry
+		for _, e := range candidates {
+			if e.Key == key {
+				return &e, nil
+			}
+			if strings.HasPrefix(e.Key, key) && (best == nil || e.CreatedAt.After(best.CreatedAt)) {
+				best = &e
+			}
+		}
+		if best != nil {
+			return best, nil
+		}
+	}
+	return nil, nil
+}
+
+// Open opens the archive of e for reading and marks it as recently used
+func (s *Store) Open(ctx context.Context, e *Entry) (*os.File, error) {
+	oopser := oops.FromContext(ctx).With("cache.key", e.Key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.archivePath(e.Key, e.Version))
+	if err != nil {
+		return nil, oopser.Wrapf(err, "opening cache archive")
+	}
+	e.LastAccessedAt = time.Now().UTC()
+	if err := s.writeMeta(*e); err != nil {
+		log.FromContext(ctx).W(ctx, "failed to update cache entry access time", "error", err)
+	}
+	return f, nil
+}
+
+// OpenID is like [Store.Open] for the entry with the given [Entry.ID]
+func (s *Store) OpenID(ctx context.Context, id string) (*os.File, *Entry, error) {
+	s.mu.Lock()
+	e, err := s.readMeta(filepath.Join(s.dir, id+".json"))
+	s.mu.Unlock()
+	if err != nil {
+		return nil, nil, oops.FromContext(ctx).With("cache.id", id).Wrapf(err, "cache entry not found")
+	}
+	f, err := s.Open(ctx, &e)
+	return f, &e, err
+}
+
+// Save stores the archive read from r under key and version. Entries are immutable, so saving an
+// existing key and version fails.
+func (s *Store) Save(ctx context.Context, key, version string, r io.Reader) (*Entry, error) {
+	oopser := oops.FromContext(ctx).With("cache.key", key)
+	if key == "" {
+		return nil, oopser.Errorf("cache key is empty")
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".save-*")
+	if err != nil {
+		return nil, oopser.Wrapf(err, "creating temporary file")
+	}
+	defer os.Remove(tmp.Name())
+	size, err := io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, oopser.Wrapf(err, "writing cache archive")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.existsLocked(key, version) {
+		return nil, oopser.Errorf("cache entry with key %q already exists", key)
+	}
+	e, err := s.commitLocked(ctx, key, version, tmp.Name(), size)
+	if err != nil {
+		return nil, oopser.Wrap(err)
+	}
+	return e, nil
+}
+
+// Reserve starts a chunked upload of an entry, which is finished by [Store.Commit].
+// It fails if the entry exists or is already reserved.
+func (s *Store) Reserve(ctx context.Context, key, version string) (int64, error) {
+	oopser := oops.FromContext(ctx).With("cache.key", key)
+	if key == "" {
+		return 0, oopser.Errorf("cache key is empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.existsLocked(key, version) {
+		return 0, oopser.Errorf("cache entry with key %q already exists", key)
+	}
+	for _, r := range s.reservations {
+		if r.key == key && r.version == version {
+			return 0, oopser.Errorf("cache entry with key %q is already being uploaded", key)
+		}
+	}
+	f, err := os.CreateTemp(s.dir, ".reserve-*")
+	if err != nil {
+		return 0, oopser.Wrapf(err, "creating temporary file")
+	}
+	s.nextID++
+	s.reservations[s.nextID] = &reservation{key: key, version: version, file: f}
+	return s.nextID, nil
+}
+
+// Upload writes a chunk of a reserved entry at offset
+func (s *Store) Upload(ctx context.Context, id int64, offset int64, r io.Reader) error {
+	oopser := oops.FromContext(ctx).With("cache.id", id)
+	s.mu.Lock()
+	res := s.reservations[id]
+	s.mu.Unlock()
+	if res == nil {
+		return oopser.Errorf("cache reservation %d not found", id)
+	}
+	// chunks of the same reservation are written concurrently at different offsets
+	_, err := io.Copy(io.NewOffsetWriter(res.file, offset), r)
+	return oopser.Wrapf(err, "writing cache chunk")
+}
+
+// Commit finishes the upload of a reserved entry. size is the expected total size.
+func (s *Store) Commit(ctx context.Context, id int64, size int64) (*Entry, error) {
+	oopser := oops.FromContext(ctx).With("cache.id", id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := s.reservations[id]
+	if res == nil {
+		return nil, oopser.Errorf("cache reservation %d not found", id)
+	}
+	delete(s.reservations, id)
+	defer os.Remove(res.file.Name())
+
+	info, err := res.file.Stat()
+	if err != nil {
+		res.file.Close()
+		return nil, oopser.Wrap(err)
+	}
+	if err := res.file.Close(); err != nil {
+		return nil, oopser.Wrap(err)
+	}
+	if size >= 0 && info.Size() != size {
+		return nil, oopser.Errorf("cache size mismatch: expected %d bytes, got %d", size, info.Size())
+	}
+	e, err := s.commitLocked(ctx, res.key, res.version, res.file.Name(), info.Size())
+	if err != nil {
+		return nil, oopser.With("cache.key", res.key).Wrap(err)
+	}
+	return e, nil
+}
+
+// Close aborts the uploads that were reserved and never committed
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, res := range s.reservations {
+		res.file.Close()
+		os.Remove(res.file.Name())
+		delete(s.reservations, id)
+	}
+	return nil
+}
+
+func (s *Store) existsLocked(key, version string) bool {
+	_, err := os.Stat(s.metaPath(key, version))
+	return err == nil
+}
+
+// commitLocked moves the archive at tmpPath into place, writes the metadata and evicts old entries
+func (s *Store) commitLocked(ctx context.Context, key, version, tmpPath string, size int64) (*Entry, error) {
+	if err := os.Rename(tmpPath, s.archivePath(key, version)); err != nil {
+		return nil, oops.Wrapf(err, "moving cache archive into place")
+	}
+	now := time.Now().UTC()
+	e := Entry{Key: key, Version: version, Size: size, CreatedAt: now, LastAccessedAt: now}
+	if err := s.writeMeta(e); err != nil {
+		return nil, oops.Wrapf(err, "writing cache entry metadata")
+	}
+	log.FromContext(ctx).D(ctx, "saved cache entry", "cache.key", key, "cache.size", size)
+
+	if err := s.evictLocked(ctx); err != nil {
+		log.FromContext(ctx).W(ctx, "failed to evict cache entries", "error", err)
+	}
+	return &e, nil
+}
+
+// evictLocked deletes the least recently used entries until the total size fits in the max size
+func (s *Store) evictLocked(ctx context.Context) error {
+	if s.maxSize <= 0 {
+		return nil
+	}
+	entries, err := s.list()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	slices.SortFunc(entries, func(a, b Entry) int { return a.LastAccessedAt.Compare(b.LastAccessedAt) })
+	for _, e := range entries {
+		if total <= s.maxSize {
+			break
+		}
+		if err := os.Remove(s.metaPath(e.Key, e.Version)); err != nil {
+			return oops.With("cache.key", e.Key).Wrapf(err, "deleting cache entry metadata")
+		}
+		if err := os.Remove(s.archivePath(e.Key, e.Version)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return oops.With("cache.key", e.Key).Wrapf(err, "deleting cache archive")
+		}
+		total -= e.Size
+		log.FromContext(ctx).D(ctx, "evicted cache entry", "cache.key", e.Key, "cache.size", e.Size)
+	}
+	return nil
+}
+
+func (s *Store) list() ([]Entry, error) {
+	metas, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, oops.Wrap(err)
+	}
+	entries := make([]Entry, 0, len(metas))
+	for _, m := range metas {
+		e, err := s.readMeta(m)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (s *Store) readMeta(path string) (Entry, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	var e Entry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return Entry{}, oops.With("file", path).Wrapf(err, "parsing cache entry metadata")
+	}
+	return e, nil
+}
+
+func (s *Store) writeMeta(e Entry) error {
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return oops.Wrap(err)
+	}
+	return oops.Wrap(os.WriteFile(s.metaPath(e.Key, e.Version), b, 0o644))
+}
+
+// entryID is a file name safe identifier of a key and version
+func entryID(key, version string) string {
+	sum := sha256.Sum256([]byte(version + "\x00" + key))
+	return hex.EncodeToString(sum[:16])
+}
+
+func (s *Store) archivePath(key, version string) string {
+	return filepath.Join(s.dir, entryID(key, version)+".tar.gz")
+}
+
+func (s *Store) metaPath(key, version string) string {
+	return filepath.Join(s.dir, entryID(key, version)+".json")
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	store, err := NewStore(t.TempDir(), 0)
+	require.NoError(t, err)
+	version := Version([]string{"node_modules"}, "gzip")
+
+	for _, key := range []string{"npm-linux-aaa", "npm-linux-bbb", "npm-darwin-ccc"} {
+		_, err := store.Save(t.Context(), key, version, strings.NewReader(key))
+		require.NoError(t, err)
+		time.Sleep(time.Millisecond) // distinct creation times
+	}
+	_, err = store.Save(t.Context(), "npm-linux-aaa", version, strings.NewReader("again"))
+	assert.Error(t, err, "entries are immutable")
+
+	lookup := func(primary string, restoreKeys ...string) string {
+		t.Helper()
+		e, err := store.Lookup(t.Context(), primary, restoreKeys, version)
+		require.NoError(t, err)
+		if e == nil {
+			return ""
+		}
+		f, err := store.Open(t.Context(), e)
+		require.NoError(t, err)
+		defer f.Close()
+		b, err := io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, e.Key, string(b))
+		return e.Key
+	}
+
+	assert.Equal(t, "npm-linux-aaa", lookup("npm-linux-aaa", "npm-"))
+	assert.Equal(t, "npm-linux-bbb", lookup("npm-linux"), "the primary key matches as a prefix too")
+	assert.Equal(t, "npm-linux-bbb", lookup("npm-linux", "npm-darwin-"), "the primary key is tried before restore keys")
+	assert.Equal(t, "", lookup("npm-windows"))
+	assert.Equal(t, "npm-linux-bbb", lookup("npm-linux-zzz", "npm-linux-"), "newest prefix match wins")
+	assert.Equal(t, "npm-darwin-ccc", lookup("npm-linux-zzz", "npm-darwin-", "npm-linux-"), "restore keys are tried in order")
+
+	e, err := store.Lookup(t.Context(), "npm-linux-aaa", nil, Version([]string{"other"}, "gzip"))
+	require.NoError(t, err)
+	assert.Nil(t, e, "entries of other versions never match")
+}
+
+func TestEviction(t *testing.T) {
+	store, err := NewStore(t.TempDir(), 25)
+	require.NoError(t, err)
+	version := Version([]string{"dist"}, "gzip")
+
+	save := func(key string) {
+		t.Helper()
+		_, err := store.Save(t.Context(), key, version, strings.NewReader(strings.Repeat("x", 10)))
+		require.NoError(t, err)
+		time.Sleep(time.Millisecond) // distinct access times
+	}
+	exists := func(key string) bool {
+		t.Helper()
+		e, err := store.Lookup(t.Context(), key, nil, version)
+		require.NoError(t, err)
+		return e != nil
+	}
+
+	save("a")
+	save("b")
+	// reading a makes b the least recently used entry
+	e, err := store.Lookup(t.Context(), "a", nil, version)
+	require.NoError(t, err)
+	f, err := store.Open(t.Context(), e)
+	require.NoError(t, err)
+	f.Close()
+	time.Sleep(time.Millisecond)
+
+	save("c")
+	assert.True(t, exists("a"))
+	assert.False(t, exists("b"), "least recently used entry is evicted")
+	assert.True(t, exists("c"))
+}
+
+func TestParseSize(t *testing.T) {
+	for in, want := range map[string]int64{
+		"":       0,
+		"1024":   1024,
+		"500MB":  500e6,
+		"10 GiB": 10 << 30,
+		"1.5g":   3 << 29,
+	} {
+		got, err := ParseSize(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	_, err := ParseSize("lots")
+	assert.Error(t, err)
+}
@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/log"
+	"github.com/drornir/better-actions/pkg/runtimetoken"
+)
+
+// apiPrefix is the path of the cache service that @actions/cache calls through ACTIONS_CACHE_URL
+const apiPrefix = "/_apis/artifactcache/"
+
+// Server is an in-process implementation of the cache service of the runner
+// (the REST API under ACTIONS_CACHE_URL): lookup, reserve, chunked upload and commit.
+type Server struct {
+	store  *Store
+	signer *runtimetoken.Signer
+
+	http    *http.Server
+	baseURL string
+}
+
+// NewServer creates a server for the entries in store that accepts the tokens of signer.
+// Call [Server.Start] to serve.
+func NewServer(store *Store, signer *runtimetoken.Signer) *Server {
+	return &Server{store: store, signer: signer}
+}
+
+// Start listens on a random port of the loopback interface and serves in the background
+func (s *Server) Start(ctx context.Context) error {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return oops.FromContext(ctx).Wrapf(err, "listening for cache service")
+	}
+	s.baseURL = "http://" + l.Addr().String() + "/"
+	s.http = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return context.WithoutCancel(ctx) },
+	}
+	go func() {
+		if err := s.http.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.FromContext(ctx).E(ctx, "cache service stopped", "error", err)
+		}
+	}()
+	log.FromContext(ctx).D(ctx, "cache service started", "url", s.baseURL)
+	return nil
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+	if s.http == nil {
+		return nil
+	}
+	return oops.Wrap(s.http.Close())
+}
+
+// URL is the value of ACTIONS_CACHE_URL. It ends with a slash.
+func (s *Server) URL() string {
+	return s.baseURL
+}
+
+// Handler is the http handler of the server
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+apiPrefix+"cache", s.authorized(s.handleLookup))
+	mux.HandleFunc("POST "+apiPrefix+"caches", s.authorized(s.handleReserve))
+	mux.HandleFunc("PATCH "+apiPrefix+"caches/{id}", s.authorized(s.handleUpload))
+	mux.HandleFunc("POST "+apiPrefix+"caches/{id}", s.authorized(s.handleCommit))
+	mux.HandleFunc("GET "+apiPrefix+"archive/{id}", s.handleDownload)
+	return mux
+}
+
+func (s *Server) authorized(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := s.signer.VerifyRequest(r); err != nil {
+			writeError(w, r, http.StatusUnauthorized, err)
+			return
+		}
+		h(w, r)
+	}
+}
+
+type errorBody struct {
+	Message string `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	log.FromContext(r.Context()).D(r.Context(), "cache service error", "path", r.URL.Path, "status", status, "error", err)
+	writeJSON(w, status, errorBody{Message: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// handleLookup finds an entry. keys is a comma separated list: the primary key followed by the restore keys.
+func (s *Server) handleLookup(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	keys := strings.Split(query.Get("keys"), ",")
+	version := query.Get("version")
+	if len(keys) == 0 || keys[0] == "" || version == "" {
+		writeError(w, r, http.StatusBadRequest, oops.Errorf("keys and version are required"))
+		return
+	}
+
+	e, err := s.store.Lookup(r.Context(), keys[0], keys[1:], version)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if e == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"cacheKey":        e.Key,
+		"cacheVersion":    e.Version,
+		"scope":           "refs/heads/local",
+		"creationTime":    e.CreatedAt.Format(time.RFC3339),
+		"archiveLocation": s.signedURL("archive/" + e.ID()),
+	})
+}
+
+func (s *Server) handleReserve(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Key       string `json:"key"`
+		Version   string `json:"version"`
+		CacheSize int64  `json:"cacheSize"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, oops.Wrapf(err, "invalid request body"))
+		return
+	}
+	if s.store.maxSize > 0 && req.CacheSize > s.store.maxSize {
+		writeError(w, r, http.StatusBadRequest,
+			oops.Errorf("cache size of %d bytes is over the %d bytes limit", req.CacheSize, s.store.maxSize))
+		return
+	}
+	id, err := s.store.Reserve(r.Context(), req.Key, req.Version)
+	if err != nil {
+		writeError(w, r, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"cacheId": id})
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, oops.Wrapf(err, "invalid cache id"))
+		return
+	}
+	offset, err := parseContentRangeStart(r.Header.Get("Content-Range"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.store.Upload(r.Context(), id, offset, r.Body); err != nil {
+		writeError(w, r, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleCommit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, oops.Wrapf(err, "invalid cache id"))
+		return
+	}
+	var req struct {
+		Size int64 `json:"size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, oops.Wrapf(err, "invalid request body"))
+		return
+	}
+	if _, err := s.store.Commit(r.Context(), id, req.Size); err != nil {
+		writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	sig, err := hex.DecodeString(r.URL.Query().Get("sig"))
+	if err != nil || !s.signer.CheckMAC(r.URL.EscapedPath(), sig) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	f, e, err := s.store.OpenID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "cache entry not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, e.ID()+".tar.gz", e.CreatedAt, f)
+}
+
+// signedURL returns an absolute url for p with a signature, so downloads need no token
+func (s *Server) signedURL(p string) string {
+	return s.baseURL + strings.TrimPrefix(apiPrefix, "/") + p +
+		"?sig=" + hex.EncodeToString(s.signer.MAC(apiPrefix+p))
+}
+
+// parseContentRangeStart parses the start offset of a header like "bytes 0-1023/*"
+func parseContentRangeStart(header string) (int64, error) {
+	rng, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, oops.With("Content-Range", header).Errorf("invalid Content-Range header")
+	}
+	start, _, ok := strings.Cut(rng, "-")
+	if !ok {
+		return 0, oops.With("Content-Range", header).Errorf("invalid Content-Range header")
+	}
+	offset, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return 0, oops.With("Content-Range", header).Wrapf(err, "invalid Content-Range header")
+	}
+	return offset, nil
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/runtimetoken"
+)
+
+// cacheClient does what the upstream @actions/cache client does
+type cacheClient struct {
+	t       *testing.T
+	baseURL string
+	token   string
+}
+
+func (c *cacheClient) do(method, path string, header http.Header, body []byte) (int, []byte) {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.baseURL+"_apis/artifactcache/"+path, bytes.NewReader(body))
+	require.NoError(c.t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(c.t, err)
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	require.NoError(c.t, err)
+	return resp.StatusCode, out
+}
+
+func (c *cacheClient) save(key, version string, content []byte, chunkSize int) {
+	c.t.Helper()
+	reserveBody, _ := json.Marshal(map[string]any{"key": key, "version": version, "cacheSize": len(content)})
+	status, body := c.do(http.MethodPost, "caches", http.Header{"Content-Type": {"application/json"}}, reserveBody)
+	require.Equal(c.t, http.StatusCreated, status, string(body))
+	var reserved struct {
+		CacheID int64 `json:"cacheId"`
+	}
+	require.NoError(c.t, json.Unmarshal(body, &reserved))
+
+	// upload the chunks in reverse order, the server must place them by their range
+	for start := (len(content) - 1) / chunkSize * chunkSize; start >= 0; start -= chunkSize {
+		end := min(start+chunkSize, len(content))
+		header := http.Header{
+			"Content-Type":  {"application/octet-stream"},
+			"Content-Range": {fmt.Sprintf("bytes %d-%d/*", start, end-1)},
+		}
+		status, body := c.do(http.MethodPatch, fmt.Sprintf("caches/%d", reserved.CacheID), header, content[start:end])
+		require.Equal(c.t, http.StatusNoContent, status, string(body))
+	}
+
+	commitBody, _ := json.Marshal(map[string]any{"size": len(content)})
+	status, body = c.do(http.MethodPost, fmt.Sprintf("caches/%d", reserved.CacheID), nil, commitBody)
+	require.Equal(c.t, http.StatusNoContent, status, string(body))
+}
+
+// restore returns the key and archive content of the matched entry, or "" and nil on a miss
+func (c *cacheClient) restore(version string, keys string) (string, []byte) {
+	c.t.Helper()
+	status, body := c.do(http.MethodGet, "cache?"+url.Values{"keys": {keys}, "version": {version}}.Encode(), nil, nil)
+	if status == http.StatusNoContent {
+		return "", nil
+	}
+	require.Equal(c.t, http.StatusOK, status, string(body))
+	var entry struct {
+		CacheKey        string `json:"cacheKey"`
+		ArchiveLocation string `json:"archiveLocation"`
+	}
+	require.NoError(c.t, json.Unmarshal(body, &entry))
+
+	// the archive location is fetched without the token
+	resp, err := http.Get(entry.ArchiveLocation)
+	require.NoError(c.t, err)
+	defer resp.Body.Close()
+	require.Equal(c.t, http.StatusOK, resp.StatusCode)
+	content, err := io.ReadAll(resp.Body)
+	require.NoError(c.t, err)
+	return entry.CacheKey, content
+}
+
+func TestServerSaveAndRestore(t *testing.T) {
+	store, err := NewStore(t.TempDir(), 0)
+	require.NoError(t, err)
+	defer store.Close()
+	signer, err := runtimetoken.NewSigner()
+	require.NoError(t, err)
+	server := NewServer(store, signer)
+	require.NoError(t, server.Start(t.Context()))
+	defer server.Close()
+
+	token, err := signer.Sign("run-1", "build")
+	require.NoError(t, err)
+	client := &cacheClient{t: t, baseURL: server.URL(), token: token}
+	version := Version([]string{"~/.npm"}, "zstd")
+
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	client.save("npm-linux-aaa", version, content, 64)
+
+	key, restored := client.restore(version, "npm-linux-aaa")
+	assert.Equal(t, "npm-linux-aaa", key)
+	assert.Equal(t, content, restored)
+
+	key, _ = client.restore(version, "npm-linux-bbb,npm-linux-")
+	assert.Equal(t, "npm-linux-aaa", key, "restore keys match by prefix")
+
+	key, _ = client.restore(Version([]string{"~/.npm"}, "gzip"), "npm-linux-aaa")
+	assert.Empty(t, key, "a different compression is a different version")
+
+	reserveBody, _ := json.Marshal(map[string]any{"key": "npm-linux-aaa", "version": version})
+	status, _ := client.do(http.MethodPost, "caches", nil, reserveBody)
+	assert.Equal(t, http.StatusConflict, status, "entries are immutable")
+
+	client.token = "invalid"
+	status, _ = client.do(http.MethodGet, "cache?keys=npm-linux-aaa&version="+version, nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
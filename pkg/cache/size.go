@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/samber/oops"
+)
+
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"tib", 1 << 40}, {"gib", 1 << 30}, {"mib", 1 << 20}, {"kib", 1 << 10},
+	{"tb", 1e12}, {"gb", 1e9}, {"mb", 1e6}, {"kb", 1e3},
+	{"t", 1 << 40}, {"g", 1 << 30}, {"m", 1 << 20}, {"k", 1 << 10},
+	{"b", 1},
+}
+
+// ParseSize parses a human readable size like 500MB, 10GiB or 1024 into bytes.
+// The empty string is parsed as zero.
+func ParseSize(s string) (int64, error) {
+	trimmed := strings.ToLower(strings.TrimSpace(s))
+	if trimmed == "" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if num, ok := strings.CutSuffix(trimmed, unit.suffix); ok {
+			trimmed = strings.TrimSpace(num)
+			multiplier = unit.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(trimmed, 64)
+	if err != nil || n < 0 {
+		return 0, oops.With("size", s).Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
@@ -0,0 +1,330 @@
+package concurrency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/samber/oops"
+)
+
+// Groups coordinates concurrency groups between processes through files in Dir.
+// A group runs one run at a time and keeps at most one pending run: a run that joins the group
+// cancels the run that was pending before it, and with cancel-in-progress the running one too.
+//
+// Each run in a group has a ticket, which is a set of files in the directory of the group:
+//
+//	<ticket>.json    the run and its state, pending or running
+//	<ticket>.lock    locked by the process of the run for as long as the run is in the group
+//	<ticket>.cancel  exists once a newer run cancelled the run
+//
+// A ticket whose lock isn't held belongs to a process that died, and is removed.
+// mutex.lock serializes the changes to the tickets of a group.
+type Groups struct {
+	Dir string
+	// PollInterval is how often runs check whether they may start or were cancelled. Defaults to a second.
+	PollInterval time.Duration
+}
+
+// Request is a run that joins a group
+type Request struct {
+	Group string
+	// CancelInProgress cancels the run of the group that is already running
+	CancelInProgress bool
+	// Label describes the run to the other runs of the group
+	Label string
+	// OnWait is called, if not nil, when the run has to wait for another run of the group
+	OnWait func()
+}
+
+// CancelledError is the error of runs that a newer run in their group cancelled.
+// It is a [context.Canceled].
+type CancelledError struct {
+	Group string
+	// By is the label of the run that cancelled this one
+	By string
+}
+
+func (e *CancelledError) Error() string {
+	return "cancelled by concurrency group " + e.Group
+}
+
+func (e *CancelledError) Is(target error) bool {
+	return target == context.Canceled
+}
+
+const (
+	ticketPending = "pending"
+	ticketRunning = "running"
+
+	ticketExt = ".json"
+	lockExt   = ".lock"
+	cancelExt = ".cancel"
+	mutexFile = "mutex.lock"
+	groupFile = "group"
+)
+
+type ticket struct {
+	ID       string    `json:"-"`
+	Label    string    `json:"label"`
+	State    string    `json:"state"`
+	QueuedAt time.Time `json:"queued_at"`
+}
+
+// ticketSeq makes the tickets of runs that join at the same time in the same process unique
+var ticketSeq atomic.Uint64
+
+// Join adds a run to the group of req and waits until the run may start, a newer run cancels it,
+// or ctx is done.
+// Once the run starts, the returned context is cancelled with a [*CancelledError] cause if a newer run
+// cancels it. release must be called when the run is done, to let the next run of the group start.
+func (g *Groups) Join(ctx context.Context, req Request) (_ context.Context, release func(), _ error) {
+	oopser := oops.With("concurrency.group", req.Group)
+	if req.Group == "" {
+		return nil, nil, oopser.Errorf("concurrency group is empty")
+	}
+	dir := g.groupDir(req.Group)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, nil, oopser.Wrapf(err, "creating concurrency group directory")
+	}
+	if err := os.WriteFile(filepath.Join(dir, groupFile), []byte(req.Group+"\n"), 0o644); err != nil {
+		return nil, nil, oopser.Wrapf(err, "writing concurrency group name")
+	}
+
+	t := &ticket{
+		ID:       fmt.Sprintf("%020d-%d-%d", time.Now().UnixNano(), os.Getpid(), ticketSeq.Add(1)),
+		Label:    req.Label,
+		State:    ticketPending,
+		QueuedAt: time.Now(),
+	}
+	var lockFile *os.File
+	err := withMutex(dir, func() error {
+		others, err := liveTickets(dir, "")
+		if err != nil {
+			return err
+		}
+		lockFile, err = os.OpenFile(filepath.Join(dir, t.ID+lockExt), os.O_CREATE|os.O_RDWR, 0o644)
+		if err != nil {
+			return oops.Wrapf(err, "creating ticket lock")
+		}
+		if err := lock(lockFile); err != nil {
+			lockFile.Close()
+			return oops.Wrapf(err, "locking ticket")
+		}
+		if err := writeTicket(dir, t); err != nil {
+			return err
+		}
+		for _, other := range others {
+			if other.State == ticketPending || req.CancelInProgress {
+				if err := os.WriteFile(filepath.Join(dir, other.ID+cancelExt), []byte(req.Label), 0o644); err != nil {
+					return oops.With("ticket", other.ID).Wrapf(err, "cancelling run %s", other.Label)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if lockFile != nil {
+			removeTicket(dir, t.ID, lockFile)
+		}
+		return nil, nil, oopser.Wrapf(err, "joining concurrency group")
+	}
+	leave := func() {
+		withMutex(dir, func() error {
+			removeTicket(dir, t.ID, lockFile)
+			return nil
+		})
+	}
+
+	ticker := time.NewTicker(g.pollInterval())
+	defer ticker.Stop()
+	waited := false
+	for {
+		started := false
+		err := withMutex(dir, func() error {
+			if cancelled, by := isCancelled(dir, t.ID); cancelled {
+				return &CancelledError{Group: req.Group, By: by}
+			}
+			others, err := liveTickets(dir, t.ID)
+			if err != nil {
+				return err
+			}
+			for _, other := range others {
+				if other.State == ticketRunning {
+					return nil
+				}
+			}
+			// the pending runs that joined before this one were cancelled by it, so it's next
+			t.State = ticketRunning
+			started = true
+			return writeTicket(dir, t)
+		})
+		if err != nil {
+			leave()
+			return nil, nil, oopser.Wrap(err)
+		}
+		if started {
+			break
+		}
+		if !waited && req.OnWait != nil {
+			req.OnWait()
+		}
+		waited = true
+		select {
+		case <-ctx.Done():
+			leave()
+			return nil, nil, oopser.Wrapf(context.Cause(ctx), "waiting for concurrency group")
+		case <-ticker.C:
+		}
+	}
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		ticker := time.NewTicker(g.pollInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			if cancelled, by := isCancelled(dir, t.ID); cancelled {
+				cancel(&CancelledError{Group: req.Group, By: by})
+				return
+			}
+		}
+	}()
+	var releaseOnce sync.Once
+	release = func() {
+		releaseOnce.Do(func() {
+			cancel(nil)
+			<-watchDone
+			leave()
+		})
+	}
+	return runCtx, release, nil
+}
+
+func (g *Groups) pollInterval() time.Duration {
+	if g.PollInterval <= 0 {
+		return time.Second
+	}
+	return g.PollInterval
+}
+
+// groupDir is the directory of a group. Group names are hashed since they may contain any character.
+func (g *Groups) groupDir(group string) string {
+	sum := sha256.Sum256([]byte(group))
+	return filepath.Join(g.Dir, hex.EncodeToString(sum[:8]))
+}
+
+// withMutex calls fn while holding the mutex of the group in dir
+func withMutex(dir string, fn func() error) error {
+	f, err := os.OpenFile(filepath.Join(dir, mutexFile), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return oops.Wrapf(err, "opening concurrency group mutex")
+	}
+	defer f.Close()
+	if err := lock(f); err != nil {
+		return oops.Wrapf(err, "locking concurrency group mutex")
+	}
+	defer unlock(f)
+	return fn()
+}
+
+// liveTickets returns the tickets of the group in dir except self, ordered by the time they joined
+// (ticket ids start with it).
+// It removes the tickets of runs whose process died.
+func liveTickets(dir, self string) ([]*ticket, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, oops.Wrapf(err, "listing tickets")
+	}
+	var tickets []*ticket
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ticketExt)
+		if !ok || id == self {
+			continue
+		}
+		alive, err := isAlive(dir, id)
+		if err != nil {
+			return nil, err
+		}
+		if !alive {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, oops.With("ticket", id).Wrapf(err, "reading ticket")
+		}
+		t := &ticket{ID: id}
+		if err := json.Unmarshal(content, t); err != nil {
+			return nil, oops.With("ticket", id).Wrapf(err, "parsing ticket")
+		}
+		tickets = append(tickets, t)
+	}
+	return tickets, nil
+}
+
+// isAlive reports whether the process of the ticket id still holds its lock, and removes the ticket if not
+func isAlive(dir, id string) (bool, error) {
+	f, err := os.OpenFile(filepath.Join(dir, id+lockExt), os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return false, oops.With("ticket", id).Wrapf(err, "opening ticket lock")
+	}
+	locked, err := tryLock(f)
+	if err != nil {
+		f.Close()
+		return false, oops.With("ticket", id).Wrapf(err, "checking ticket lock")
+	}
+	if !locked {
+		f.Close()
+		return true, nil
+	}
+	removeTicket(dir, id, f)
+	return false, nil
+}
+
+func writeTicket(dir string, t *ticket) error {
+	content, err := json.Marshal(t)
+	if err != nil {
+		return oops.Wrap(err)
+	}
+	// written and renamed, so other processes never read a partial ticket
+	tmp := filepath.Join(dir, t.ID+ticketExt+".tmp")
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return oops.Wrapf(err, "writing ticket")
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, t.ID+ticketExt)); err != nil {
+		return oops.Wrapf(err, "writing ticket")
+	}
+	return nil
+}
+
+// removeTicket removes the files of the ticket id, whose lock is held through lockFile
+func removeTicket(dir, id string, lockFile *os.File) {
+	os.Remove(filepath.Join(dir, id+ticketExt))
+	os.Remove(filepath.Join(dir, id+cancelExt))
+	unlock(lockFile)
+	lockFile.Close()
+	os.Remove(filepath.Join(dir, id+lockExt))
+}
+
+// isCancelled reports whether a newer run cancelled the ticket id, and the label of that run
+func isCancelled(dir, id string) (bool, string) {
+	by, err := os.ReadFile(filepath.Join(dir, id+cancelExt))
+	if err != nil {
+		return false, ""
+	}
+	return true, string(by)
+}
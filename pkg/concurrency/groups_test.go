@@ -0,0 +1,125 @@
+package concurrency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupsQueue(t *testing.T) {
+	groups := &Groups{Dir: t.TempDir(), PollInterval: 5 * time.Millisecond}
+	ctx := t.Context()
+
+	_, releaseFirst, err := groups.Join(ctx, Request{Group: "deploy", Label: "first"})
+	require.NoError(t, err)
+
+	type joined struct {
+		ctx     context.Context
+		release func()
+		err     error
+	}
+	join := func(label string) (<-chan joined, <-chan struct{}) {
+		result := make(chan joined, 1)
+		waiting := make(chan struct{})
+		go func() {
+			ctx, release, err := groups.Join(ctx, Request{Group: "deploy", Label: label, OnWait: func() { close(waiting) }})
+			result <- joined{ctx, release, err}
+		}()
+		return result, waiting
+	}
+
+	second, secondWaiting := join("second")
+	<-secondWaiting
+	third, thirdWaiting := join("third")
+	<-thirdWaiting
+
+	// the third run replaces the second as the pending run
+	res := <-second
+	var cancelled *CancelledError
+	require.ErrorAs(t, res.err, &cancelled)
+	assert.Equal(t, "deploy", cancelled.Group)
+	assert.Equal(t, "third", cancelled.By)
+	assert.ErrorIs(t, res.err, context.Canceled)
+	assert.Contains(t, res.err.Error(), "cancelled by concurrency group deploy")
+
+	select {
+	case <-third:
+		t.Fatal("third run started while the first one runs")
+	case <-time.After(50 * time.Millisecond):
+	}
+	releaseFirst()
+	res = <-third
+	require.NoError(t, res.err)
+	res.release()
+}
+
+func TestGroupsCancelInProgress(t *testing.T) {
+	groups := &Groups{Dir: t.TempDir(), PollInterval: 5 * time.Millisecond}
+
+	runCtx, releaseFirst, err := groups.Join(t.Context(), Request{Group: "deploy", Label: "first"})
+	require.NoError(t, err)
+	defer releaseFirst()
+
+	// a different group doesn't wait
+	_, releaseOther, err := groups.Join(t.Context(), Request{Group: "other", Label: "other"})
+	require.NoError(t, err)
+	releaseOther()
+
+	started := make(chan error, 1)
+	go func() {
+		_, release, err := groups.Join(t.Context(), Request{Group: "deploy", Label: "second", CancelInProgress: true})
+		if err == nil {
+			release()
+		}
+		started <- err
+	}()
+
+	select {
+	case <-runCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("running run wasn't cancelled")
+	}
+	var cancelled *CancelledError
+	require.True(t, errors.As(context.Cause(runCtx), &cancelled))
+	assert.Equal(t, "second", cancelled.By)
+
+	// the second run waits until the cancelled run is done
+	select {
+	case <-started:
+		t.Fatal("second run started before the cancelled run released the group")
+	case <-time.After(50 * time.Millisecond):
+	}
+	releaseFirst()
+	require.NoError(t, <-started)
+}
+
+func TestGroupsStaleTicket(t *testing.T) {
+	groups := &Groups{Dir: t.TempDir(), PollInterval: 5 * time.Millisecond}
+	dir := groups.groupDir("deploy")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	// a running ticket of a process that died, so nothing holds its lock
+	content, err := json.Marshal(ticket{Label: "dead", State: ticketRunning})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000001-1-1"+ticketExt), content, 0o644))
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	_, release, err := groups.Join(ctx, Request{Group: "deploy", Label: "alive"})
+	require.NoError(t, err)
+	release()
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{groupFile, mutexFile}, names)
+}
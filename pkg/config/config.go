@@ -4,12 +4,90 @@ import "sync"
 
 type (
 	Config struct {
-		Log LogConfig `flag:"log" json:"log"`
+		Log          LogConfig          `flag:"log" json:"log"`
+		Workspace    WorkspaceConfig    `flag:"workspace" json:"workspace"`
+		State        StateConfig        `flag:"state" json:"state"`
+		Cache        CacheConfig        `flag:"cache" json:"cache"`
+		Runner       RunnerConfig       `flag:"runner" json:"runner"`
+		Env          EnvConfig          `flag:"env" json:"env"`
+		Secrets      SecretsConfig      `flag:"secrets" json:"secrets"`
+		Environments EnvironmentsConfig `flag:"environments" json:"environments"`
+		Injection    InjectionConfig    `flag:"injection" json:"injection"`
+		Expressions  ExpressionsConfig  `flag:"expressions" json:"expressions"`
 	}
 	LogConfig struct {
 		Level  string `flag:"level" json:"level"`
 		Format string `flag:"format" json:"format"`
 	}
+	// WorkspaceConfig configures how the workspace of a job is populated
+	WorkspaceConfig struct {
+		// Mode is one of empty, copy, bind, worktree, clone
+		Mode string `flag:"mode" json:"mode"`
+		// Source is the repository to populate the workspace from. Defaults to the repository of the workflow.
+		Source string `flag:"source" json:"source"`
+	}
+	// StateConfig configures where bact keeps data between runs
+	StateConfig struct {
+		// Dir holds run directories (artifacts) and the cache. Defaults to a bact directory in the user cache dir.
+		Dir string `flag:"dir" json:"dir"`
+	}
+	// CacheConfig configures the local cache service
+	CacheConfig struct {
+		// Dir holds the cache entries. Defaults to a cache directory in the state dir.
+		Dir string `flag:"dir" json:"dir"`
+		// MaxSize is the total size of the cache entries (e.g 10GB) before the least recently used are evicted.
+		// Empty means unlimited.
+		MaxSize string `flag:"max-size" json:"max-size"`
+	}
+	// RunnerConfig configures the machine-wide directories of the runner
+	RunnerConfig struct {
+		// ToolCache is RUNNER_TOOL_CACHE, where setup actions keep downloaded tools.
+		// Defaults to a tool-cache directory in the state dir.
+		ToolCache string `flag:"tool-cache" json:"tool-cache"`
+	}
+	// EnvConfig configures which host environment variables steps see
+	EnvConfig struct {
+		// Policy is one of allowlist (the default), inherit, empty
+		Policy string `flag:"policy" json:"policy"`
+		// Allowlist is a comma separated list of patterns (e.g PATH,HOME,LC_*) of the variables the
+		// allowlist policy passes. Empty means a default list of user and locale variables.
+		Allowlist string `flag:"allowlist" json:"allowlist"`
+	}
+	// SecretsConfig configures where the secrets context comes from.
+	// Secrets passed with --secrets override the ones of the providers.
+	SecretsConfig struct {
+		// Providers is a comma separated list of the providers to fetch secrets from, in order of precedence:
+		// dotenv, dir, env, command, encrypted. Each is configured by the field of the same name.
+		Providers string `flag:"providers" json:"providers"`
+		// Dotenv is the path of a dotenv file of secrets
+		Dotenv string `flag:"dotenv" json:"dotenv"`
+		// Dir is a directory with a file per secret, like the ones Kubernetes and Docker mount
+		Dir string `flag:"dir" json:"dir"`
+		// Env is the prefix of the environment variables that are secrets. Defaults to BACT_SECRET_.
+		Env string `flag:"env" json:"env"`
+		// Command is a command line that prints the secrets as a JSON object
+		Command string `flag:"command" json:"command"`
+		// Encrypted is the path of a dotenv file with encrypted values, created with bact secrets encrypt
+		Encrypted string `flag:"encrypted" json:"encrypted"`
+		// KeyFile is the key that decrypts Encrypted, created with bact secrets keygen
+		KeyFile string `flag:"key-file" json:"key-file"`
+	}
+	// EnvironmentsConfig configures the deployment environments jobs target with `environment:`
+	EnvironmentsConfig struct {
+		// File is a YAML file that defines the vars, secrets and protection rules of every environment
+		File string `flag:"file" json:"file"`
+	}
+	// InjectionConfig configures bact check-injection
+	InjectionConfig struct {
+		// Severity of script injections, error (the default) or warning. Only errors fail the check.
+		Severity string `flag:"severity" json:"severity"`
+	}
+	// ExpressionsConfig configures the functions expressions may call
+	ExpressionsConfig struct {
+		// Extensions enables the better-actions functions GitHub doesn't have, like fromYAML and toLower.
+		// Workflows that call them only run with bact.
+		Extensions bool `flag:"extensions" json:"extensions"`
+	}
 )
 
 var (
@@ -0,0 +1,172 @@
+// Package gitinfo reads metadata of a local git checkout by running the git cli.
+package gitinfo
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/samber/oops"
+)
+
+// Info is the metadata of a git checkout that is relevant to a workflow run
+type Info struct {
+	// Root is the top level directory of the work tree
+	Root string
+	// SHA is the commit HEAD points to
+	SHA string
+	// Ref is the fully formed ref HEAD points to (e.g refs/heads/main). Empty when HEAD is detached.
+	Ref string
+	// RefName is the short name of Ref (e.g main)
+	RefName string
+	// RefType is either "branch" or "tag". Empty when HEAD is detached.
+	RefType string
+	// CommitCount is the number of commits reachable from HEAD
+	CommitCount int
+	// Actor is the GitHub user name (git config github.user) or the git user name if it is missing
+	Actor string
+	// Remote is the parsed url of the "origin" remote (or the first remote). nil if there are no remotes.
+	Remote *Remote
+}
+
+// Remote is a git remote that follows the GitHub convention of <server>/<owner>/<repo>
+type Remote struct {
+	// URL is the remote url as it appears in the git config
+	URL string
+	// ServerURL is the web url of the server (e.g https://github.com)
+	ServerURL string
+	// Owner is the owner of the repository (user or organization)
+	Owner string
+	// Name is the name of the repository without the owner
+	Name string
+}
+
+// Repository returns <owner>/<repo>
+func (r *Remote) Repository() string {
+	if r == nil || r.Owner == "" {
+		return ""
+	}
+	return r.Owner + "/" + r.Name
+}
+
+// Read collects the Info of the git work tree that contains dir.
+// Returns nil without an error if dir is not inside a work tree, or if git is not installed.
+func Read(ctx context.Context, dir string) (*Info, error) {
+	oopser := oops.FromContext(ctx).With("dir", dir)
+
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, nil
+	}
+
+	inside, err := Git(ctx, dir, "rev-parse", "--is-inside-work-tree")
+	if err != nil || inside != "true" {
+		return nil, nil
+	}
+	root, err := Git(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, oopser.Wrapf(err, "finding work tree root")
+	}
+
+	info := &Info{Root: root}
+
+	// an empty repository has no HEAD yet
+	if sha, err := Git(ctx, dir, "rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		info.SHA = sha
+		count, err := Git(ctx, dir, "rev-list", "--count", "HEAD")
+		if err != nil {
+			return nil, oopser.Wrapf(err, "counting commits")
+		}
+		info.CommitCount, err = strconv.Atoi(count)
+		if err != nil {
+			return nil, oopser.Wrapf(err, "parsing commit count %q", count)
+		}
+	}
+
+	if ref, err := Git(ctx, dir, "symbolic-ref", "--quiet", "HEAD"); err == nil {
+		info.Ref = ref
+		info.RefName = strings.TrimPrefix(ref, "refs/heads/")
+		info.RefType = "branch"
+	} else if info.SHA != "" {
+		// detached HEAD. If it points exactly at a tag, treat it like GitHub does for tag pushes
+		if tag, err := Git(ctx, dir, "describe", "--tags", "--exact-match", "HEAD"); err == nil {
+			info.Ref = "refs/tags/" + tag
+			info.RefName = tag
+			info.RefType = "tag"
+		}
+	}
+
+	for _, key := range []string{"github.user", "user.name"} {
+		if actor, err := Git(ctx, dir, "config", "--get", key); err == nil && actor != "" {
+			info.Actor = actor
+			break
+		}
+	}
+	if info.Actor == "" {
+		info.Actor = os.Getenv("USER")
+	}
+
+	remoteURL, err := Git(ctx, dir, "remote", "get-url", "origin")
+	if err != nil {
+		remotes, rerr := Git(ctx, dir, "remote")
+		if rerr == nil && remotes != "" {
+			first, _, _ := strings.Cut(remotes, "\n")
+			remoteURL, err = Git(ctx, dir, "remote", "get-url", first)
+		}
+	}
+	if err == nil && remoteURL != "" {
+		info.Remote = ParseRemoteURL(remoteURL)
+	}
+
+	return info, nil
+}
+
+// ParseRemoteURL parses the common forms of git remote urls:
+//
+//	https://github.com/owner/repo.git
+//	git@github.com:owner/repo.git
+//	ssh://git@github.com:22/owner/repo
+//
+// If the owner and repository name can't be found, only URL is set.
+func ParseRemoteURL(remoteURL string) *Remote {
+	remote := &Remote{URL: remoteURL}
+
+	var host, repoPath string
+	if u, err := url.Parse(remoteURL); err == nil && u.Scheme != "" && u.Host != "" {
+		host = u.Hostname()
+		repoPath = u.Path
+	} else if at := strings.Index(remoteURL, "@"); at != -1 && strings.Contains(remoteURL[at:], ":") {
+		// scp-like syntax: [user@]host:path
+		hostAndPath := remoteURL[at+1:]
+		host, repoPath, _ = strings.Cut(hostAndPath, ":")
+	} else {
+		return remote
+	}
+
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	idx := strings.LastIndex(repoPath, "/")
+	if host == "" || idx <= 0 {
+		return remote
+	}
+	remote.ServerURL = "https://" + host
+	remote.Owner = repoPath[:idx]
+	remote.Name = repoPath[idx+1:]
+	return remote
+}
+
+// Git runs the git cli with args in dir and returns its trimmed stdout
+func Git(ctx context.Context, dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", oops.
+			With("git.args", args, "git.stderr", strings.TrimSpace(stderr.String())).
+			Wrapf(err, "running git")
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,84 @@
+package gitinfo
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRemoteURL(t *testing.T) {
+	tests := []struct {
+		url       string
+		serverURL string
+		repo      string
+	}{
+		{"https://github.com/drornir/better-actions.git", "https://github.com", "drornir/better-actions"},
+		{"https://github.com/drornir/better-actions", "https://github.com", "drornir/better-actions"},
+		{"git@github.com:drornir/better-actions.git", "https://github.com", "drornir/better-actions"},
+		{"ssh://git@ghe.example.com:2222/org/sub/repo.git", "https://ghe.example.com", "org/sub/repo"},
+		{"/home/me/src/repo", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			remote := ParseRemoteURL(tt.url)
+			assert.Equal(t, tt.url, remote.URL)
+			assert.Equal(t, tt.serverURL, remote.ServerURL)
+			assert.Equal(t, tt.repo, remote.Repository())
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir := t.TempDir()
+	runGit := func(args ...string) string {
+		t.Helper()
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(out)
+	}
+	runGit("init", "--quiet", "--initial-branch=trunk")
+	runGit("config", "user.name", "Octo Cat")
+	runGit("config", "user.email", "octo@example.com")
+	runGit("config", "github.user", "octocat")
+	runGit("remote", "add", "origin", "git@github.com:octo-org/hello.git")
+	runGit("commit", "--quiet", "--allow-empty", "-m", "first")
+	runGit("commit", "--quiet", "--allow-empty", "-m", "second")
+
+	info, err := Read(t.Context(), dir)
+	require.NoError(t, err)
+	require.NotNil(t, info)
+
+	assert.Len(t, info.SHA, 40)
+	assert.Equal(t, "refs/heads/trunk", info.Ref)
+	assert.Equal(t, "trunk", info.RefName)
+	assert.Equal(t, "branch", info.RefType)
+	assert.Equal(t, 2, info.CommitCount)
+	assert.Equal(t, "octocat", info.Actor)
+	require.NotNil(t, info.Remote)
+	assert.Equal(t, "octo-org/hello", info.Remote.Repository())
+
+	runGit("tag", "v1.0.0")
+	runGit("checkout", "--quiet", "--detach", "v1.0.0")
+	info, err = Read(t.Context(), dir)
+	require.NoError(t, err)
+	assert.Equal(t, "refs/tags/v1.0.0", info.Ref)
+	assert.Equal(t, "tag", info.RefType)
+
+	notRepo, err := Read(t.Context(), t.TempDir())
+	require.NoError(t, err)
+	assert.Nil(t, notRepo)
+}
+
+func TestReadWithoutGit(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	info, err := Read(t.Context(), t.TempDir())
+	require.NoError(t, err)
+	assert.Nil(t, info)
+}
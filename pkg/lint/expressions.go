@@ -0,0 +1,33 @@
+package lint
+
+import (
+	"gopkg.in/yaml.v3"
+
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+// expressionPosition returns the line and column in the file of an expression error of the schema,
+// which is reported at the node of the expression with the offset of the problem in its value
+func (l *linter) expressionPosition(root *yaml.Node, se *yamls.SchemaError) (line, column int) {
+	node := scalarAt(root, se.Line, se.Column)
+	if node == nil || se.Offset < 0 || se.Offset > len(node.Value) {
+		return se.Line, se.Column
+	}
+	return yamls.ValuePosition(node, se.Offset, l.lines)
+}
+
+// scalarAt returns the scalar node under node that starts at line and column, or nil
+func scalarAt(node *yaml.Node, line, column int) *yaml.Node {
+	if node.Kind == yaml.ScalarNode {
+		if node.Line == line && node.Column == column {
+			return node
+		}
+		return nil
+	}
+	for _, child := range node.Content {
+		if found := scalarAt(child, line, column); found != nil {
+			return found
+		}
+	}
+	return nil
+}
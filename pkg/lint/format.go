@@ -0,0 +1,154 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/samber/oops"
+)
+
+// Format is an output format of diagnostics
+type Format string
+
+const (
+	FormatText  Format = "text"
+	FormatJSON  Format = "json"
+	FormatSARIF Format = "sarif"
+)
+
+// ParseFormat parses the name of a [Format]
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatText, FormatJSON, FormatSARIF:
+		return f, nil
+	case "":
+		return FormatText, nil
+	}
+	return "", oops.Errorf("unknown lint format %q, expected text, json or sarif", s)
+}
+
+// Write writes diagnostics to w in format
+func Write(w io.Writer, format Format, diagnostics []Diagnostic) error {
+	switch format {
+	case FormatJSON:
+		if diagnostics == nil {
+			// an empty array rather than null
+			diagnostics = []Diagnostic{}
+		}
+		return writeJSON(w, diagnostics)
+	case FormatSARIF:
+		return writeJSON(w, toSARIF(diagnostics))
+	default:
+		for _, d := range diagnostics {
+			if _, err := fmt.Fprintln(w, d); err != nil {
+				return oops.Wrap(err)
+			}
+			if d.Fix != "" {
+				if _, err := fmt.Fprintf(w, "  to fix, %s\n", d.Fix); err != nil {
+					return oops.Wrap(err)
+				}
+			}
+		}
+		return nil
+	}
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return oops.Wrap(enc.Encode(v))
+}
+
+// The subset of SARIF 2.1.0 that code scanning tools read.
+// Reference: https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID               string       `json:"id"`
+		ShortDescription sarifMessage `json:"shortDescription"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           sarifRegion           `json:"region"`
+	}
+	sarifArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn"`
+	}
+)
+
+func toSARIF(diagnostics []Diagnostic) sarifLog {
+	driver := sarifDriver{
+		Name:           "bact",
+		InformationURI: "https://github.com/drornir/better-actions",
+	}
+	ruleIDs := make([]string, 0, len(Rules))
+	for id := range Rules {
+		ruleIDs = append(ruleIDs, id)
+	}
+	slices.Sort(ruleIDs)
+	for _, id := range ruleIDs {
+		driver.Rules = append(driver.Rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: Rules[id]}})
+	}
+
+	results := make([]sarifResult, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		text := d.Message
+		if d.Fix != "" {
+			text += ". To fix, " + d.Fix
+		}
+		results = append(results, sarifResult{
+			RuleID:  d.Rule,
+			Level:   string(d.Severity),
+			Message: sarifMessage{Text: text},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: filepathToURI(d.File)},
+				Region:           sarifRegion{StartLine: d.Line, StartColumn: d.Column},
+			}}},
+		})
+	}
+	return sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}
+}
+
+// filepathToURI turns a path into the relative URI reference SARIF expects
+func filepathToURI(path string) string {
+	return strings.ReplaceAll(path, "\\", "/")
+}
@@ -0,0 +1,301 @@
+package lint
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/samber/oops"
+	"gopkg.in/yaml.v3"
+
+	"github.com/drornir/better-actions/pkg/runner/expr"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+// untrustedPaths are the paths of the github context whose values whoever triggers a workflow controls,
+// like the title of their pull request or the name of their branch. * is any property or index.
+var untrustedPaths = [][]string{
+	{"github", "head_ref"},
+	{"github", "event", "issue", "title"},
+	{"github", "event", "issue", "body"},
+	{"github", "event", "pull_request", "title"},
+	{"github", "event", "pull_request", "body"},
+	{"github", "event", "pull_request", "head", "ref"},
+	{"github", "event", "pull_request", "head", "label"},
+	{"github", "event", "pull_request", "head", "repo", "default_branch"},
+	{"github", "event", "comment", "body"},
+	{"github", "event", "review", "body"},
+	{"github", "event", "review_comment", "body"},
+	{"github", "event", "discussion", "title"},
+	{"github", "event", "discussion", "body"},
+	{"github", "event", "pages", "*", "page_name"},
+	{"github", "event", "commits", "*", "message"},
+	{"github", "event", "commits", "*", "author", "email"},
+	{"github", "event", "commits", "*", "author", "name"},
+	{"github", "event", "head_commit", "message"},
+	{"github", "event", "head_commit", "author", "email"},
+	{"github", "event", "head_commit", "author", "name"},
+	{"github", "event", "head_commit", "committer", "email"},
+	{"github", "event", "head_commit", "committer", "name"},
+	{"github", "event", "workflow_run", "head_branch"},
+	{"github", "event", "workflow_run", "head_commit", "message"},
+	{"github", "event", "workflow_run", "head_commit", "author", "email"},
+	{"github", "event", "workflow_run", "head_commit", "author", "name"},
+	{"github", "event", "workflow_run", "pull_requests", "*", "head", "ref"},
+}
+
+// CheckInjectionFile checks the workflow file at path for script injections
+func CheckInjectionFile(path string, severity Severity) ([]Diagnostic, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, oops.With("path", path).Wrapf(err, "reading workflow file")
+	}
+	return CheckInjection(path, content, severity), nil
+}
+
+// CheckInjection finds values that whoever triggers the workflow file in path controls, like the title of
+// a pull request, and that expressions interpolate into scripts: the run of steps and the script of
+// actions/github-script, directly or through env variables the scripts read with `${{ env.NAME }}`.
+// Anything in such a value is code the script runs. Each diagnostic has a fix that passes the value in an
+// env variable instead, which the script reads as data.
+// The diagnostics are reported with severity, and sorted by position.
+func CheckInjection(path string, content []byte, severity Severity) []Diagnostic {
+	l := newLinter(path, content)
+	_, root := l.parse(content)
+	if root == nil {
+		return l.diagnostics
+	}
+
+	workflowEnv := taintedEnv(nil, mappingValue(root, "env"))
+	forEachMapping(mappingValue(root, "jobs"), func(_ string, _, job *yaml.Node) {
+		jobEnv := taintedEnv(workflowEnv, mappingValue(job, "env"))
+		steps := mappingValue(job, "steps")
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range steps.Content {
+			env := taintedEnv(jobEnv, mappingValue(step, "env"))
+			if run := mappingValue(step, "run"); run != nil && run.Kind == yaml.ScalarNode {
+				l.checkScript(run, env, severity, false)
+			}
+			uses := mappingValue(step, "uses")
+			if uses != nil && strings.HasPrefix(strings.ToLower(uses.Value), "actions/github-script@") {
+				if script := mappingValue(mappingValue(step, "with"), "script"); script != nil && script.Kind == yaml.ScalarNode {
+					l.checkScript(script, env, severity, true)
+				}
+			}
+		}
+	})
+	return l.sorted()
+}
+
+// taint is an untrusted value that an expression interpolates
+type taint struct {
+	// Path is what the expression accesses, like github.head_ref or env.TITLE
+	Path string
+	// Source is the untrusted path the value comes from, which is Path unless it comes through env
+	Source string
+	// Offset is where the access is in the expression
+	Offset int
+}
+
+// checkScript reports the untrusted values the expressions of the script in node interpolate.
+// javaScript is for the scripts of actions/github-script, that read env variables from process.env.
+func (l *linter) checkScript(node *yaml.Node, env map[string]string, severity Severity, javaScript bool) {
+	forEachExpression(node.Value, func(offset int, parsed expr.Node) {
+		for _, t := range tainted(parsed, env) {
+			line, column := yamls.ValuePosition(node, offset+t.Offset, l.lines)
+			var message, fix string
+			if t.Source == t.Path {
+				name := envName(t.Path)
+				message = fmt.Sprintf("%s is controlled by whoever triggers the workflow, and is interpolated into the script", t.Path)
+				fix = fmt.Sprintf("pass it in the env of the step, `%s: ${{ %s }}`, and use %s instead", name, t.Path, readEnv(name, javaScript))
+			} else {
+				name := strings.TrimPrefix(t.Path, "env.")
+				message = fmt.Sprintf("%s holds %s, which is controlled by whoever triggers the workflow, and is interpolated into the script", t.Path, t.Source)
+				fix = fmt.Sprintf("use %s instead, which the script reads from the environment", readEnv(name, javaScript))
+			}
+			l.diagnostics = append(l.diagnostics, Diagnostic{
+				File:     l.file,
+				Line:     line,
+				Column:   column,
+				Severity: severity,
+				Rule:     RuleScriptInjection,
+				Message:  message,
+				Fix:      fix,
+			})
+		}
+	})
+}
+
+// readEnv returns how scripts read the env variable name
+func readEnv(name string, javaScript bool) string {
+	if javaScript {
+		return "process.env." + name
+	}
+	return `"$` + name + `"`
+}
+
+// taintedEnv returns the env variables of parent and of the env mapping node whose values are untrusted,
+// by name, with the untrusted paths they hold
+func taintedEnv(parent map[string]string, node *yaml.Node) map[string]string {
+	env := make(map[string]string, len(parent))
+	for name, source := range parent {
+		env[name] = source
+	}
+	forEachMapping(node, func(name string, _, value *yaml.Node) {
+		delete(env, name)
+		if value.Kind != yaml.ScalarNode {
+			return
+		}
+		forEachExpression(value.Value, func(_ int, parsed expr.Node) {
+			if ts := tainted(parsed, env); len(ts) > 0 {
+				env[name] = ts[0].Source
+			}
+		})
+	})
+	return env
+}
+
+// forEachExpression calls fn with every `${{ }}` in value that parses, and its offset in value
+func forEachExpression(value string, fn func(offset int, parsed expr.Node)) {
+	offset := 0
+	for {
+		i := strings.Index(value[offset:], "${{")
+		if i == -1 {
+			return
+		}
+		offset += i + len("${{")
+		lexer := expr.NewExprLexer(value[offset:])
+		parsed, perr := expr.NewParser().Parse(lexer)
+		if perr != nil {
+			return
+		}
+		fn(offset, parsed)
+		offset += lexer.Offset()
+	}
+}
+
+// tainted returns the untrusted values that the value of the expression node may contain
+func tainted(node expr.Node, env map[string]string) []taint {
+	switch n := node.(type) {
+	case *expr.VariableNode, *expr.ObjectDerefNode, *expr.ArrayDerefNode, *expr.IndexAccessNode:
+		path := accessPath(n)
+		if len(path) == 0 {
+			return nil
+		}
+		if path[0] == "env" && len(path) > 1 {
+			for name, source := range env {
+				if strings.EqualFold(name, path[1]) {
+					return []taint{{Path: "env." + name, Source: source, Offset: n.Token().Offset}}
+				}
+			}
+			return nil
+		}
+		if isUntrusted(path) {
+			source := accessSource(n)
+			return []taint{{Path: source, Source: source, Offset: n.Token().Offset}}
+		}
+		return nil
+	case *expr.LogicalOpNode:
+		// && and || evaluate to one of their operands
+		return append(tainted(n.Left, env), tainted(n.Right, env)...)
+	case *expr.FuncCallNode:
+		switch strings.ToLower(n.Callee) {
+		case "contains", "startswith", "endswith", "hashfiles", "success", "failure", "cancelled", "always":
+			return nil
+		}
+		var ts []taint
+		for _, arg := range n.Args {
+			ts = append(ts, tainted(arg, env)...)
+		}
+		return ts
+	default:
+		// literals, comparisons and ! evaluate to values that aren't untrusted
+		return nil
+	}
+}
+
+// accessPath returns the lower cased segments of property accesses like github.event.commits[0].message,
+// with * for indexes that aren't string literals, or nil for other expressions
+func accessPath(node expr.Node) []string {
+	switch n := node.(type) {
+	case *expr.VariableNode:
+		return []string{strings.ToLower(n.Name)}
+	case *expr.ObjectDerefNode:
+		if receiver := accessPath(n.Receiver); receiver != nil {
+			return append(receiver, strings.ToLower(n.Property))
+		}
+	case *expr.ArrayDerefNode:
+		if receiver := accessPath(n.Receiver); receiver != nil {
+			return append(receiver, "*")
+		}
+	case *expr.IndexAccessNode:
+		operand := accessPath(n.Operand)
+		if operand == nil {
+			return nil
+		}
+		if s, ok := n.Index.(*expr.StringNode); ok {
+			return append(operand, strings.ToLower(s.Value))
+		}
+		return append(operand, "*")
+	}
+	return nil
+}
+
+// accessSource returns the source of property accesses like github.event.commits[0].message
+func accessSource(node expr.Node) string {
+	switch n := node.(type) {
+	case *expr.VariableNode:
+		return n.Name
+	case *expr.ObjectDerefNode:
+		return accessSource(n.Receiver) + "." + n.Property
+	case *expr.ArrayDerefNode:
+		return accessSource(n.Receiver) + ".*"
+	case *expr.IndexAccessNode:
+		switch index := n.Index.(type) {
+		case *expr.IntNode:
+			return fmt.Sprintf("%s[%d]", accessSource(n.Operand), index.Value)
+		case *expr.StringNode:
+			return fmt.Sprintf("%s['%s']", accessSource(n.Operand), index.Value)
+		default:
+			return fmt.Sprintf("%s[%s]", accessSource(n.Operand), accessSource(index))
+		}
+	default:
+		return node.Token().Value
+	}
+}
+
+// isUntrusted reports whether path is an untrusted value, in one, or an object that contains one
+func isUntrusted(path []string) bool {
+	for _, untrusted := range untrustedPaths {
+		matches := true
+		for i := 0; i < len(path) && i < len(untrusted); i++ {
+			if untrusted[i] != "*" && path[i] != "*" && untrusted[i] != path[i] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// envName suggests the name of an env variable for the value of path, from its last properties
+func envName(path string) string {
+	var segments []string
+	for _, segment := range strings.Split(path, ".") {
+		if segment != "*" && segment != "github" && segment != "event" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) > 2 {
+		segments = segments[len(segments)-2:]
+	}
+	return strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToUpper(strings.Join(segments, "_")), "_"), "_")
+}
@@ -0,0 +1,86 @@
+package lint
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const injectableWorkflow = `on: pull_request
+env:
+  TITLE: ${{ github.event.pull_request.title }}
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo "${{ github.event.pull_request.title }}" ${{ github.event.pull_request.number }}
+      - run: |
+          echo ${{ env.TITLE }}
+          echo ${{ toJSON(github.event.commits[0].message) }} ${{ contains(github.head_ref, 'x') }}
+      - uses: actions/github-script@v7
+        with:
+          script: console.log("${{ github.head_ref }}")
+      - env:
+          REF: ${{ github.head_ref }}
+        run: echo "$REF" "$TITLE"
+      - run: |
+          if true; then
+            echo ${{ github.head_ref }}
+          fi
+`
+
+func TestCheckInjection(t *testing.T) {
+	diagnostics := CheckInjection("wf.yaml", []byte(injectableWorkflow), SeverityWarning)
+
+	type found struct {
+		Line, Column int
+		Message, Fix string
+	}
+	var got []found
+	for _, d := range diagnostics {
+		assert.Equal(t, SeverityWarning, d.Severity)
+		assert.Equal(t, RuleScriptInjection, d.Rule)
+		got = append(got, found{d.Line, d.Column, d.Message, d.Fix})
+	}
+	assert.Equal(t, []found{
+		{
+			8, 24,
+			"github.event.pull_request.title is controlled by whoever triggers the workflow, and is interpolated into the script",
+			"pass it in the env of the step, `PULL_REQUEST_TITLE: ${{ github.event.pull_request.title }}`, and use \"$PULL_REQUEST_TITLE\" instead",
+		},
+		{
+			10, 20,
+			"env.TITLE holds github.event.pull_request.title, which is controlled by whoever triggers the workflow, and is interpolated into the script",
+			"use \"$TITLE\" instead, which the script reads from the environment",
+		},
+		{
+			11, 27,
+			"github.event.commits[0].message is controlled by whoever triggers the workflow, and is interpolated into the script",
+			"pass it in the env of the step, `COMMITS_0_MESSAGE: ${{ github.event.commits[0].message }}`, and use \"$COMMITS_0_MESSAGE\" instead",
+		},
+		{
+			14, 36,
+			"github.head_ref is controlled by whoever triggers the workflow, and is interpolated into the script",
+			"pass it in the env of the step, `HEAD_REF: ${{ github.head_ref }}`, and use process.env.HEAD_REF instead",
+		},
+		{
+			20, 22,
+			"github.head_ref is controlled by whoever triggers the workflow, and is interpolated into the script",
+			"pass it in the env of the step, `HEAD_REF: ${{ github.head_ref }}`, and use \"$HEAD_REF\" instead",
+		},
+	}, got)
+}
+
+func TestWriteFix(t *testing.T) {
+	diagnostics := CheckInjection("wf.yaml", []byte(injectableWorkflow), SeverityError)
+	require.NotEmpty(t, diagnostics)
+
+	var out bytes.Buffer
+	require.NoError(t, Write(&out, FormatText, diagnostics[:1]))
+	assert.Equal(t, "wf.yaml:8:24: error: github.event.pull_request.title is controlled by whoever triggers the workflow, "+
+		"and is interpolated into the script [script-injection]\n"+
+		"  to fix, pass it in the env of the step, `PULL_REQUEST_TITLE: ${{ github.event.pull_request.title }}`, "+
+		"and use \"$PULL_REQUEST_TITLE\" instead\n", out.String())
+}
@@ -0,0 +1,251 @@
+// Package lint finds the problems in workflow files without running them
+package lint
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/samber/oops"
+	"gopkg.in/yaml.v3"
+
+	"github.com/drornir/better-actions/pkg/runner/expr"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+// Severity of a [Diagnostic]
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// ParseSeverity parses the name of a [Severity]
+func ParseSeverity(s string) (Severity, error) {
+	switch sev := Severity(strings.ToLower(s)); sev {
+	case SeverityError, SeverityWarning:
+		return sev, nil
+	case "":
+		return SeverityError, nil
+	}
+	return "", oops.Errorf("unknown severity %q, expected error or warning", s)
+}
+
+// The rules that diagnostics come from
+const (
+	// RuleSyntax is for files that aren't valid YAML
+	RuleSyntax = "syntax"
+	// RuleSchema is for workflows that don't match the workflow schema, checked in strict mode
+	RuleSchema = "schema"
+	// RuleExpression is for `${{ }}` expressions that don't parse, call unknown functions with the wrong
+	// number of arguments or access unknown contexts
+	RuleExpression = "expression"
+	// RuleDuplicateStepID is for step ids that are used more than once in a job
+	RuleDuplicateStepID = "duplicate-step-id"
+	// RuleUnknownNeeds is for jobs that need jobs that don't exist
+	RuleUnknownNeeds = "unknown-needs"
+	// RuleUnknownProperty is for expressions that access properties, like step ids or outputs, that don't exist.
+	// It is checked by [Typecheck].
+	RuleUnknownProperty = "unknown-property"
+	// RuleConstantComparison is for comparisons in expressions that are always false, or always true.
+	// It is checked by [Typecheck].
+	RuleConstantComparison = "constant-comparison"
+	// RuleScriptInjection is for values that whoever triggers the workflow controls, interpolated into scripts.
+	// It is checked by [CheckInjection].
+	RuleScriptInjection = "script-injection"
+)
+
+// Rules describes every rule
+var Rules = map[string]string{
+	RuleSyntax:             "The file must be valid YAML",
+	RuleSchema:             "The workflow must match the workflow schema",
+	RuleExpression:         "Expressions must parse, call known functions with the right arguments and access known contexts",
+	RuleDuplicateStepID:    "Step ids must be unique in their job",
+	RuleUnknownNeeds:       "Jobs may only need jobs of the same workflow",
+	RuleUnknownProperty:    "Expressions may only access the contexts, steps, needs, inputs, matrix keys and outputs that exist where they are",
+	RuleConstantComparison: "Comparisons must be able to be both true and false",
+	RuleScriptInjection:    "Scripts must read values that whoever triggers the workflow controls from env variables, not interpolate them",
+}
+
+// Diagnostic is a problem at a position in a file
+type Diagnostic struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Severity Severity `json:"severity"`
+	Rule     string   `json:"rule"`
+	Message  string   `json:"message"`
+	// Fix suggests how to fix the problem, if there is a suggestion
+	Fix string `json:"fix,omitempty"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s [%s]", d.File, d.Line, d.Column, d.Severity, d.Message, d.Rule)
+}
+
+// LintFile lints the workflow file at path, see [Lint]
+func LintFile(path string, functions expr.FunctionStore) ([]Diagnostic, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, oops.With("path", path).Wrapf(err, "reading workflow file")
+	}
+	return Lint(path, content, functions), nil
+}
+
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// Lint lints the content of the workflow file in path. Expressions may call functions, which are
+// [expr.DefaultFunctions] if it's nil. The diagnostics are sorted by position.
+func Lint(path string, content []byte, functions expr.FunctionStore) []Diagnostic {
+	l := newLinter(path, content)
+	_, root := l.parse(content)
+	if root == nil {
+		return l.diagnostics
+	}
+
+	// the schema checks expressions with the runner's parser and functions, so they run like they lint
+	if _, err := yamls.ReadWorkflowWithFunctions(bytes.NewReader(content), true, functions); err != nil {
+		schemaErrs := yamls.SchemaErrors(err)
+		if len(schemaErrs) == 0 {
+			l.report(root.Line, root.Column, RuleSchema, "%s", err)
+		}
+		for _, se := range schemaErrs {
+			if se.Expression {
+				line, column := l.expressionPosition(root, se)
+				l.report(line, column, RuleExpression, "%s", se.Message)
+				continue
+			}
+			l.report(se.Line, se.Column, RuleSchema, "%s", se.Message)
+		}
+	}
+
+	jobs := mappingValue(root, "jobs")
+	l.checkStepIDs(jobs)
+	l.checkNeeds(jobs)
+
+	return l.sorted()
+}
+
+type linter struct {
+	file        string
+	lines       []string
+	diagnostics []Diagnostic
+}
+
+func newLinter(path string, content []byte) *linter {
+	return &linter{file: path, lines: yamls.ReadLines(content)}
+}
+
+// parse returns the document in content and its root node, or reports why there is none and returns a nil root
+func (l *linter) parse(content []byte) (*yaml.Node, *yaml.Node) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		line, msg := 1, err.Error()
+		if m := yamlErrorLine.FindStringSubmatch(msg); m != nil {
+			line, _ = strconv.Atoi(m[1])
+			msg = msg[len(m[0]):]
+		}
+		l.report(line, 1, RuleSyntax, "%s", msg)
+		return nil, nil
+	}
+	if len(doc.Content) == 0 {
+		l.report(1, 1, RuleSyntax, "the file is empty")
+		return nil, nil
+	}
+	return &doc, doc.Content[0]
+}
+
+// sorted returns the diagnostics sorted by position
+func (l *linter) sorted() []Diagnostic {
+	slices.SortStableFunc(l.diagnostics, func(a, b Diagnostic) int {
+		return cmp.Or(cmp.Compare(a.Line, b.Line), cmp.Compare(a.Column, b.Column))
+	})
+	return l.diagnostics
+}
+
+func (l *linter) report(line, column int, rule, format string, args ...any) {
+	l.diagnostics = append(l.diagnostics, Diagnostic{
+		File:     l.file,
+		Line:     line,
+		Column:   column,
+		Severity: SeverityError,
+		Rule:     rule,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// checkStepIDs reports step ids that are used by an earlier step of the same job
+func (l *linter) checkStepIDs(jobs *yaml.Node) {
+	forEachMapping(jobs, func(jobName string, _, job *yaml.Node) {
+		seen := make(map[string]*yaml.Node)
+		steps := mappingValue(job, "steps")
+		if steps == nil || steps.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, step := range steps.Content {
+			id := mappingValue(step, "id")
+			if id == nil || id.Kind != yaml.ScalarNode || id.Value == "" {
+				continue
+			}
+			if first, ok := seen[id.Value]; ok {
+				l.report(id.Line, id.Column, RuleDuplicateStepID,
+					"step id %q of job %s is already used at line %d", id.Value, jobName, first.Line)
+				continue
+			}
+			seen[id.Value] = id
+		}
+	})
+}
+
+// checkNeeds reports needs of jobs that don't exist
+func (l *linter) checkNeeds(jobs *yaml.Node) {
+	names := make(map[string]bool)
+	forEachMapping(jobs, func(jobName string, _, _ *yaml.Node) {
+		names[jobName] = true
+	})
+	forEachMapping(jobs, func(jobName string, _, job *yaml.Node) {
+		needs := mappingValue(job, "needs")
+		if needs == nil {
+			return
+		}
+		items := []*yaml.Node{needs}
+		if needs.Kind == yaml.SequenceNode {
+			items = needs.Content
+		}
+		for _, need := range items {
+			if need.Kind != yaml.ScalarNode || names[need.Value] {
+				continue
+			}
+			l.report(need.Line, need.Column, RuleUnknownNeeds, "job %s needs unknown job %s", jobName, need.Value)
+		}
+	})
+}
+
+// mappingValue returns the value of key in the mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// forEachMapping calls fn with every key and value of the mapping node, if it is one
+func forEachMapping(node *yaml.Node, fn func(key string, keyNode, value *yaml.Node)) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		fn(node.Content[i].Value, node.Content[i], node.Content[i+1])
+	}
+}
@@ -0,0 +1,163 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/runner/expr"
+)
+
+const badWorkflow = `on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    foo: bar
+    steps:
+      - id: checkout
+        run: echo "${{ github.sha }}"
+      - id: checkout
+        if: ${{ bogus(1) }}
+        run: |
+          echo ${{ toJSON(1, 2) }}
+  test:
+    needs: [build, deploy]
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo hi
+`
+
+func TestLint(t *testing.T) {
+	diagnostics := Lint("wf.yaml", []byte(badWorkflow), nil)
+
+	type found struct {
+		Line, Column int
+		Rule         string
+	}
+	var got []found
+	for _, d := range diagnostics {
+		assert.Equal(t, "wf.yaml", d.File)
+		assert.Equal(t, SeverityError, d.Severity)
+		got = append(got, found{d.Line, d.Column, d.Rule})
+	}
+	assert.Equal(t, []found{
+		{5, 5, RuleSchema},
+		{9, 13, RuleDuplicateStepID},
+		{10, 17, RuleExpression},
+		{12, 20, RuleExpression},
+		{14, 20, RuleUnknownNeeds},
+	}, got)
+	assert.Equal(t, "unknown property foo", diagnostics[0].Message)
+	assert.Equal(t, `step id "checkout" of job build is already used at line 7`, diagnostics[1].Message)
+	assert.Equal(t, "job test needs unknown job deploy", diagnostics[4].Message)
+}
+
+func TestLintClean(t *testing.T) {
+	diagnostics := Lint("wf.yaml", []byte(`on: push
+env:
+  ${{ insert }}: ${{ fromJSON('{"A":"1"}') }}
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - id: version
+        run: echo "version=1" >> "$GITHUB_OUTPUT"
+      - if: ${{ success() && steps.version.outputs.version == '1' }}
+        run: echo ${{ format('{0}', hashFiles('**/go.sum')) }}
+  test:
+    needs: build
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo ${{ needs.build.result }}
+`), nil)
+	assert.Empty(t, diagnostics)
+}
+
+func TestLintSyntax(t *testing.T) {
+	diagnostics := Lint("wf.yaml", []byte("on: push\njobs:\n  build: [\n"), nil)
+	require.Len(t, diagnostics, 1)
+	assert.Equal(t, RuleSyntax, diagnostics[0].Rule)
+	assert.Equal(t, 3, diagnostics[0].Line)
+}
+
+// expression problems are reported where they are in the value, not at the start of the value
+func TestLintExpressionPositions(t *testing.T) {
+	diagnostics := Lint("wf.yaml", []byte(`on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: "${{ toJSON(1, 2) }} ${{ nope.x }}"
+      - run: |
+          echo ${{ hashFiles() }}
+      - run: echo ${{ github.sha
+`), nil)
+
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, d.String())
+	}
+	require.Len(t, got, 4)
+	assert.Equal(t, []string{
+		"wf.yaml:6:19: error: too many parameters for toJSON expected <= 1 got 2 [expression]",
+		"wf.yaml:6:39: error: unknown variable access nope [expression]",
+		"wf.yaml:8:20: error: missing parameters for hashFiles expected >= 1 got 0 [expression]",
+	}, got[:3])
+	assert.Contains(t, got[3], "wf.yaml:9:")
+	assert.Contains(t, got[3], "failed to parse")
+}
+
+func TestWrite(t *testing.T) {
+	diagnostics := Lint("wf.yaml", []byte(badWorkflow), nil)
+
+	var out bytes.Buffer
+	require.NoError(t, Write(&out, FormatJSON, diagnostics))
+	var decoded []Diagnostic
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, diagnostics, decoded)
+
+	out.Reset()
+	require.NoError(t, Write(&out, FormatJSON, nil))
+	assert.Equal(t, "[]\n", out.String())
+
+	out.Reset()
+	require.NoError(t, Write(&out, FormatSARIF, diagnostics))
+	var sarif sarifLog
+	require.NoError(t, json.Unmarshal(out.Bytes(), &sarif))
+	assert.Equal(t, "2.1.0", sarif.Version)
+	require.Len(t, sarif.Runs, 1)
+	assert.Len(t, sarif.Runs[0].Tool.Driver.Rules, len(Rules))
+	require.Len(t, sarif.Runs[0].Results, len(diagnostics))
+	first := sarif.Runs[0].Results[0]
+	assert.Equal(t, RuleSchema, first.RuleID)
+	assert.Equal(t, "error", first.Level)
+	assert.Equal(t, "wf.yaml", first.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Equal(t, sarifRegion{StartLine: 5, StartColumn: 5}, first.Locations[0].PhysicalLocation.Region)
+
+	out.Reset()
+	require.NoError(t, Write(&out, FormatText, diagnostics[:1]))
+	assert.Equal(t, "wf.yaml:5:5: error: unknown property foo [schema]\n", out.String())
+
+	_, err := ParseFormat("xml")
+	assert.Error(t, err)
+}
+
+// expressions may call the functions that the workflow runs with
+func TestLintFunctions(t *testing.T) {
+	workflow := []byte(`on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo ${{ toLower(github.ref) }}
+`)
+	diagnostics := Lint("wf.yaml", workflow, nil)
+	require.Len(t, diagnostics, 1)
+	assert.Equal(t, RuleExpression, diagnostics[0].Rule)
+	assert.Contains(t, diagnostics[0].Message, "toLower")
+
+	assert.Empty(t, Lint("wf.yaml", workflow, expr.ExtendedFunctions()))
+}
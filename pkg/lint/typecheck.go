@@ -0,0 +1,232 @@
+package lint
+
+import (
+	"context"
+	"maps"
+	"os"
+	"strings"
+
+	"github.com/samber/oops"
+	"gopkg.in/yaml.v3"
+
+	"github.com/drornir/better-actions/pkg/runner/expr"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+// TypecheckFile type checks the expressions of the workflow file at path
+func TypecheckFile(ctx context.Context, path string) ([]Diagnostic, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, oops.With("path", path).Wrapf(err, "reading workflow file")
+	}
+	return Typecheck(ctx, path, content), nil
+}
+
+// Typecheck infers the types of the expressions of the workflow file in path from the shape of the workflow
+// where they are: the steps with ids before them, the jobs their job needs and their outputs, the inputs of
+// the workflow and the matrix of their job. It reports accessing properties that don't exist, with the
+// names they are likely typos of, and comparisons that are always false or always true.
+// The diagnostics are sorted by position.
+func Typecheck(ctx context.Context, path string, content []byte) []Diagnostic {
+	l := newLinter(path, content)
+	_, root := l.parse(content)
+	if root == nil {
+		return l.diagnostics
+	}
+
+	contexts := expr.ContextTypes()
+	// the types of the steps and needs contexts with any id, to make types with the ids of the workflow from
+	stepType, needType := contexts["steps"].Elem, contexts["needs"].Elem
+	contexts["inputs"] = inputsType(root)
+	contexts["steps"] = expr.TypeObject(nil)
+	contexts["needs"] = expr.TypeObject(nil)
+	contexts["matrix"] = expr.TypeObject(nil)
+	jobs := mappingValue(root, "jobs")
+	forEachMapping(root, func(key string, _, value *yaml.Node) {
+		if key != "jobs" {
+			l.typecheck(value, contexts, false)
+		}
+	})
+
+	forEachMapping(jobs, func(_ string, _, job *yaml.Node) {
+		jobContexts := maps.Clone(contexts)
+		jobContexts["needs"] = needsType(needType, jobs, job)
+		jobContexts["matrix"] = matrixType(ctx, job)
+		steps := mappingValue(job, "steps")
+		var stepNodes []*yaml.Node
+		if steps != nil && steps.Kind == yaml.SequenceNode {
+			stepNodes = steps.Content
+		}
+		// the job's outputs and everything after its steps see all of them
+		jobContexts["steps"] = stepsType(stepType, stepNodes)
+		forEachMapping(job, func(key string, _, value *yaml.Node) {
+			if key != "steps" {
+				l.typecheck(value, jobContexts, key == "if")
+			}
+		})
+		for i, step := range stepNodes {
+			stepContexts := maps.Clone(jobContexts)
+			stepContexts["steps"] = stepsType(stepType, stepNodes[:i])
+			forEachMapping(step, func(key string, _, value *yaml.Node) {
+				l.typecheck(value, stepContexts, key == "if")
+			})
+		}
+	})
+	return l.sorted()
+}
+
+// typecheck type checks the expressions in the values under node. isIf is for the value of an if,
+// which is an expression even without `${{ }}`.
+func (l *linter) typecheck(node *yaml.Node, contexts map[string]*expr.Type, isIf bool) {
+	if node.Kind != yaml.ScalarNode {
+		for i, child := range node.Content {
+			// keys are names, or insert directives
+			if node.Kind == yaml.MappingNode && i%2 == 0 {
+				continue
+			}
+			l.typecheck(child, contexts, false)
+		}
+		return
+	}
+
+	checker := &expr.TypeChecker{Contexts: contexts}
+	check := func(offset int, parsed expr.Node) {
+		_, errs := checker.Check(parsed)
+		for _, te := range errs {
+			line, column := yamls.ValuePosition(node, offset+te.Offset, l.lines)
+			rule := RuleUnknownProperty
+			if te.Comparison {
+				rule = RuleConstantComparison
+			}
+			l.report(line, column, rule, "%s", te.Message)
+		}
+	}
+
+	if isIf && !strings.Contains(node.Value, "${{") {
+		// lint reports expressions that don't parse
+		if parsed, perr := expr.NewParser().Parse(expr.NewExprLexer(node.Value + "}}")); perr == nil {
+			check(0, parsed)
+		}
+		return
+	}
+	forEachExpression(node.Value, check)
+}
+
+// inputsType is the type of the inputs of the workflow_dispatch and workflow_call triggers of the workflow
+func inputsType(root *yaml.Node) *expr.Type {
+	props := make(map[string]*expr.Type)
+	on := mappingValue(root, "on")
+	if on == nil {
+		return expr.TypeObject(props)
+	}
+	wf := &yamls.Workflow{RawOn: *on}
+	if dispatch := wf.WorkflowDispatchConfig(); dispatch != nil {
+		for name, input := range dispatch.Inputs {
+			t := inputType(input.Type)
+			if input.Type == "choice" && len(input.Options) > 0 {
+				t = expr.TypeString(input.Options...)
+			}
+			props[name] = t
+		}
+	}
+	if on.Kind == yaml.MappingNode && mappingValue(on, "workflow_call") != nil {
+		for name, input := range wf.WorkflowCallConfig().Inputs {
+			props[name] = expr.MergeTypes(props[name], inputType(input.Type))
+		}
+	}
+	return expr.TypeObject(props)
+}
+
+func inputType(inputType string) *expr.Type {
+	switch inputType {
+	case "boolean":
+		return expr.TypeBool()
+	case "number":
+		return expr.TypeNumber()
+	default:
+		return expr.TypeString()
+	}
+}
+
+// needsType is the type of the needs context of job, from the results and outputs of the jobs it needs.
+// needType is the type of any job in the needs context.
+func needsType(needType *expr.Type, jobs, job *yaml.Node) *expr.Type {
+	props := make(map[string]*expr.Type)
+	names := []*yaml.Node{mappingValue(job, "needs")}
+	if names[0] == nil {
+		return expr.TypeObject(props)
+	}
+	if names[0].Kind == yaml.SequenceNode {
+		names = names[0].Content
+	}
+	for _, name := range names {
+		needed := mappingValue(jobs, name.Value)
+		if name.Kind != yaml.ScalarNode || needed == nil {
+			continue
+		}
+		outputs := expr.TypeMap(expr.TypeString())
+		// the outputs of reusable workflows aren't known here
+		if mappingValue(needed, "uses") == nil {
+			outputs = expr.TypeObject(nil)
+			forEachMapping(mappingValue(needed, "outputs"), func(output string, _, _ *yaml.Node) {
+				outputs.Props[output] = expr.TypeString()
+			})
+		}
+		props[name.Value] = withProperty(needType, "outputs", outputs)
+	}
+	return expr.TypeObject(props)
+}
+
+// stepsType is the type of the steps context after steps ran. stepType is the type of any step in it.
+func stepsType(stepType *expr.Type, steps []*yaml.Node) *expr.Type {
+	props := make(map[string]*expr.Type)
+	for _, step := range steps {
+		id := mappingValue(step, "id")
+		if id == nil || id.Kind != yaml.ScalarNode || id.Value == "" || strings.Contains(id.Value, "${{") {
+			continue
+		}
+		props[id.Value] = stepType
+	}
+	return expr.TypeObject(props)
+}
+
+// matrixType is the type of the matrix context of job, with the keys and values of its combinations
+func matrixType(ctx context.Context, node *yaml.Node) *expr.Type {
+	var job yamls.Job
+	if err := node.Decode(&job); err != nil || job.Strategy == nil || job.Strategy.RawMatrix.Kind == 0 {
+		return expr.TypeObject(nil)
+	}
+	if job.Matrix() == nil {
+		// the matrix comes from an expression
+		return expr.TypeMap(nil)
+	}
+	combinations, err := job.GetMatrixes(ctx)
+	if err != nil {
+		return expr.TypeMap(nil)
+	}
+	var matrix *expr.Type
+	for _, combination := range combinations {
+		matrix = expr.MergeTypes(matrix, expr.TypeOfValue(combination))
+	}
+	if matrix == nil || matrix.Kind != expr.TypeKindObject {
+		return expr.TypeObject(nil)
+	}
+	for _, t := range matrix.Props {
+		// values from expressions can be anything
+		for _, v := range t.Values {
+			if strings.Contains(v, "${{") {
+				t.Values = nil
+				break
+			}
+		}
+	}
+	return matrix
+}
+
+// withProperty returns a copy of the object type t with the property name of type prop
+func withProperty(t *expr.Type, name string, prop *expr.Type) *expr.Type {
+	copied := *t
+	copied.Props = maps.Clone(t.Props)
+	copied.Props[name] = prop
+	return &copied
+}
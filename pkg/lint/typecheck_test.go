@@ -0,0 +1,63 @@
+package lint
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypecheck(t *testing.T) {
+	diagnostics := Typecheck(context.Background(), "wf.yaml", []byte(`on:
+  workflow_dispatch:
+    inputs:
+      deploy:
+        type: boolean
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    strategy:
+      matrix:
+        os: [linux, windows]
+    outputs:
+      version: ${{ steps.version.outputs.version }}
+    steps:
+      - run: echo ${{ steps.version.outputs.version }}
+      - id: version
+        run: echo "version=1" >> "$GITHUB_OUTPUT"
+      - if: steps.verison.outputs.version == '1' && matrix.os == 'macos'
+        run: echo ${{ matrix.arch }} ${{ inputs.deploy == 'true' }}
+  test:
+    needs: build
+    if: needs.build.result == 'success'
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo ${{ needs.build.outputs.verson }}
+`))
+
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, d.String())
+	}
+	assert.Equal(t, []string{
+		// a step only sees the steps before it
+		"wf.yaml:15:23: error: steps has no property version [unknown-property]",
+		"wf.yaml:18:13: error: steps has no property verison, did you mean version? [unknown-property]",
+		"wf.yaml:18:53: error: comparison is always false, matrix.os is one of 'linux' | 'windows' [constant-comparison]",
+		"wf.yaml:19:23: error: matrix has no property arch [unknown-property]",
+		"wf.yaml:19:42: error: comparison is always false, inputs.deploy is a boolean, so it is compared as a number, and 'true' is not a number [constant-comparison]",
+		"wf.yaml:25:23: error: needs.build.outputs has no property verson, did you mean version? [unknown-property]",
+	}, got)
+}
+
+func TestTypecheckExamples(t *testing.T) {
+	files, err := filepath.Glob("../../examples/workflows/*.yaml")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, files)
+	for _, file := range files {
+		diagnostics, err := TypecheckFile(context.Background(), file)
+		assert.NoError(t, err)
+		assert.Empty(t, diagnostics, file)
+	}
+}
@@ -0,0 +1,89 @@
+package repl
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/drornir/better-actions/pkg/runner/expr"
+)
+
+// statusFunctions are the functions the evaluator implements itself, which aren't in function stores
+var statusFunctions = []string{"success", "failure", "cancelled", "always"}
+
+// Complete returns the completions of the path of contexts, like github.event.pull_request, or the name of
+// a function, that ends at the end of line. start is where the completed text begins in line, and each
+// completion replaces line[start:].
+func Complete(line string, contexts expr.JSObject, functions expr.FunctionStore) (start int, completions []string) {
+	start = len(line)
+	for start > 0 && isPathByte(line[start-1]) {
+		start--
+	}
+	word := line[start:]
+	if word == "" || !isIdentifierStart(word[0]) {
+		return start, nil
+	}
+
+	receiver, partial, isProperty := cutLast(word, ".")
+	if !isProperty {
+		for name := range contexts {
+			if strings.HasPrefix(name, strings.ToLower(partial)) {
+				completions = append(completions, name)
+			}
+		}
+		names := append([]string(nil), statusFunctions...)
+		for _, f := range functions {
+			names = append(names, f.Name)
+		}
+		for _, name := range names {
+			if strings.HasPrefix(strings.ToLower(name), strings.ToLower(partial)) {
+				completions = append(completions, name+"(")
+			}
+		}
+		sort.Strings(completions)
+		return start, completions
+	}
+
+	object, ok := lookupObject(contexts, strings.Split(receiver, "."))
+	if !ok {
+		return start, nil
+	}
+	for name := range object {
+		if strings.HasPrefix(name, strings.ToLower(partial)) {
+			completions = append(completions, receiver+"."+name)
+		}
+	}
+	sort.Strings(completions)
+	return start, completions
+}
+
+// lookupObject returns the object at path in contexts. Paths with * or through values that aren't objects
+// have no object.
+func lookupObject(contexts expr.JSObject, path []string) (expr.JSObject, bool) {
+	object := contexts
+	for _, segment := range path {
+		value, ok := object[strings.ToLower(segment)]
+		if !ok || !value.Object.IsPresent {
+			return nil, false
+		}
+		object = value.Object.Value
+	}
+	return object, true
+}
+
+// cutLast slices s around the last sep, or returns s as after when there is no sep
+func cutLast(s, sep string) (before, after string, found bool) {
+	i := strings.LastIndex(s, sep)
+	if i == -1 {
+		return "", s, false
+	}
+	return s[:i], s[i+len(sep):], true
+}
+
+// isPathByte reports whether c can be in property accesses like steps.setup-node.outputs
+func isPathByte(c byte) bool {
+	return isIdentifierStart(c) || c >= '0' && c <= '9' || c == '-' || c == '.'
+}
+
+func isIdentifierStart(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
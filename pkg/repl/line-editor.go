@@ -0,0 +1,229 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// errInterrupted is returned by readLine when the user presses Ctrl-C
+var errInterrupted = errors.New("interrupted")
+
+// completeFunc returns the completions of the end of line, which replace line[start:]
+type completeFunc func(line string) (start int, completions []string)
+
+// lineEditor reads lines from a terminal in raw mode, with history and tab completion.
+// It understands the keys of readline that are enough for expressions: moving with the arrows,
+// Ctrl-A, Ctrl-E, Ctrl-B and Ctrl-F, deleting with Backspace, Delete, Ctrl-U and Ctrl-K, and browsing the
+// history with the arrows, Ctrl-P and Ctrl-N.
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	prompt   string
+	complete completeFunc
+	history  []string
+
+	line   []rune
+	cursor int
+}
+
+func newLineEditor(in io.Reader, out io.Writer, prompt string, complete completeFunc) *lineEditor {
+	return &lineEditor{
+		in:       bufio.NewReader(in),
+		out:      out,
+		prompt:   prompt,
+		complete: complete,
+	}
+}
+
+// readLine reads a line. It returns io.EOF when the user presses Ctrl-D on an empty line.
+func (e *lineEditor) readLine() (string, error) {
+	e.line = e.line[:0]
+	e.cursor = 0
+	historyIdx := len(e.history)
+	// the line the user was editing before browsing the history
+	var editing []rune
+
+	e.redraw()
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			line := string(e.line)
+			if strings.TrimSpace(line) != "" && (len(e.history) == 0 || e.history[len(e.history)-1] != line) {
+				e.history = append(e.history, line)
+			}
+			return line, nil
+		case ctrl('C'):
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case ctrl('D'):
+			if len(e.line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.delete()
+		case '\t':
+			e.completeWord()
+		case 127, ctrl('H'):
+			if e.cursor > 0 {
+				e.cursor--
+				e.delete()
+			}
+		case ctrl('A'):
+			e.cursor = 0
+		case ctrl('E'):
+			e.cursor = len(e.line)
+		case ctrl('B'):
+			e.left()
+		case ctrl('F'):
+			e.right()
+		case ctrl('U'):
+			e.line = append(e.line[:0], e.line[e.cursor:]...)
+			e.cursor = 0
+		case ctrl('K'):
+			e.line = e.line[:e.cursor]
+		case ctrl('P'):
+			historyIdx, editing = e.browse(historyIdx, historyIdx-1, editing)
+		case ctrl('N'):
+			historyIdx, editing = e.browse(historyIdx, historyIdx+1, editing)
+		case '\x1b':
+			switch e.escapeSequence() {
+			case "[A":
+				historyIdx, editing = e.browse(historyIdx, historyIdx-1, editing)
+			case "[B":
+				historyIdx, editing = e.browse(historyIdx, historyIdx+1, editing)
+			case "[C":
+				e.right()
+			case "[D":
+				e.left()
+			case "[H", "[1~":
+				e.cursor = 0
+			case "[F", "[4~":
+				e.cursor = len(e.line)
+			case "[3~":
+				e.delete()
+			}
+		default:
+			if r < ' ' {
+				continue
+			}
+			e.insert([]rune{r})
+		}
+		e.redraw()
+	}
+}
+
+// escapeSequence reads the rest of a sequence that starts with ESC, like "[A" of the up arrow
+func (e *lineEditor) escapeSequence() string {
+	sb := strings.Builder{}
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return sb.String()
+		}
+		sb.WriteRune(r)
+		// sequences end with a letter or ~, and their first character is [ or O
+		if sb.Len() > 1 && (r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r == '~') {
+			return sb.String()
+		}
+	}
+}
+
+// browse replaces the line with the entry to of the history, when there is one. The entry after the
+// last one is the line the user was editing.
+func (e *lineEditor) browse(from, to int, editing []rune) (int, []rune) {
+	if to < 0 || to > len(e.history) {
+		return from, editing
+	}
+	if from == len(e.history) {
+		editing = append([]rune(nil), e.line...)
+	}
+	if to == len(e.history) {
+		e.line = append(e.line[:0], editing...)
+	} else {
+		e.line = append(e.line[:0], []rune(e.history[to])...)
+	}
+	e.cursor = len(e.line)
+	return to, editing
+}
+
+// completeWord replaces the word before the cursor with its completion, or with the longest prefix of its
+// completions, and lists the completions when there is nothing to add
+func (e *lineEditor) completeWord() {
+	if e.complete == nil {
+		return
+	}
+	before := string(e.line[:e.cursor])
+	start, completions := e.complete(before)
+	if len(completions) == 0 {
+		return
+	}
+	common := completions[0]
+	for _, completion := range completions[1:] {
+		common = commonPrefix(common, completion)
+	}
+	if len(completions) == 1 || len(common) > len(before)-start {
+		e.replaceBeforeCursor(utf8.RuneCountInString(before[start:]), common)
+		return
+	}
+	fmt.Fprint(e.out, "\r\n"+strings.Join(completions, "  ")+"\r\n")
+}
+
+func (e *lineEditor) replaceBeforeCursor(n int, text string) {
+	e.cursor -= n
+	e.line = append(e.line[:e.cursor], e.line[e.cursor+n:]...)
+	e.insert([]rune(text))
+}
+
+func (e *lineEditor) insert(rs []rune) {
+	e.line = append(e.line[:e.cursor], append(rs, e.line[e.cursor:]...)...)
+	e.cursor += len(rs)
+}
+
+// delete deletes the character under the cursor
+func (e *lineEditor) delete() {
+	if e.cursor < len(e.line) {
+		e.line = append(e.line[:e.cursor], e.line[e.cursor+1:]...)
+	}
+}
+
+func (e *lineEditor) left() {
+	if e.cursor > 0 {
+		e.cursor--
+	}
+}
+
+func (e *lineEditor) right() {
+	if e.cursor < len(e.line) {
+		e.cursor++
+	}
+}
+
+// redraw writes the prompt and the line over the current line of the terminal, and moves the cursor back
+// to its position
+func (e *lineEditor) redraw() {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.prompt, string(e.line))
+	if back := len(e.line) - e.cursor; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+func ctrl(c rune) rune {
+	return c & 0x1f
+}
+
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
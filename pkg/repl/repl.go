@@ -0,0 +1,162 @@
+// Package repl evaluates expressions interactively, to debug the `if` of jobs and steps and the templates of
+// workflows without running them.
+package repl
+
+import (
+	"bufio"
+	"context"
+	"encoding/json/jsontext"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/runner/expr"
+)
+
+const prompt = "> "
+
+const help = `Enter an expression, with or without ${{ }}, to print its value and type.
+  :if <condition>    evaluate the if of a job or a step, where success() is implied
+  :ast <expression>  print the parse tree of the expression
+  :help              print this help
+  :quit              exit, like Ctrl-D
+Tab completes the paths of the contexts and the names of functions.
+`
+
+// REPL reads expressions and prints their values
+type REPL struct {
+	Evaluator *expr.Evaluator
+	// Contexts is the object of the contexts the evaluator evaluates in, whose paths are completed
+	Contexts expr.JSObject
+	// Functions are the functions the evaluator calls, whose names are completed
+	Functions expr.FunctionStore
+
+	In  io.Reader
+	Out io.Writer
+}
+
+// Run reads and evaluates expressions until the input ends, the user quits or ctx is done.
+// Expressions that fail print their errors. When In is a terminal, lines are edited in raw mode with
+// history and tab completion.
+func (r *REPL) Run(ctx context.Context) error {
+	readLine := r.lineReader()
+	fmt.Fprint(r.Out, "Evaluate expressions, :help for help\n")
+	for ctx.Err() == nil {
+		line, err := readLine()
+		if errors.Is(err, errInterrupted) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return oops.Wrapf(err, "reading input")
+		}
+		if quit := r.eval(line); quit {
+			return nil
+		}
+	}
+	return context.Cause(ctx)
+}
+
+// lineReader returns how to read lines from In: the line editor for terminals, and lines as they are for
+// pipes and files
+func (r *REPL) lineReader() func() (string, error) {
+	if f, ok := r.In.(*os.File); ok && isTerminal(int(f.Fd())) {
+		editor := newLineEditor(f, r.Out, prompt, func(line string) (int, []string) {
+			return Complete(line, r.Contexts, r.Functions)
+		})
+		return func() (string, error) {
+			restore, err := makeRaw(int(f.Fd()))
+			if err != nil {
+				return "", err
+			}
+			defer restore()
+			return editor.readLine()
+		}
+	}
+
+	scanner := bufio.NewScanner(r.In)
+	return func() (string, error) {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", io.EOF
+		}
+		return scanner.Text(), nil
+	}
+}
+
+// eval runs the command or evaluates the expression in line, and reports whether the user quits
+func (r *REPL) eval(line string) (quit bool) {
+	line = strings.TrimSpace(line)
+	command, arg, _ := strings.Cut(line, " ")
+	switch command {
+	case "":
+	case ":quit", ":q", ":exit":
+		return true
+	case ":help":
+		fmt.Fprint(r.Out, help)
+	case ":if":
+		passed, err := r.Evaluator.EvaluateCondition(arg)
+		if err != nil {
+			fmt.Fprintf(r.Out, "error: %v\n", err)
+			return false
+		}
+		fmt.Fprintln(r.Out, passed)
+	case ":ast":
+		parsed, err := ParseExpression(arg)
+		if err != nil {
+			fmt.Fprintf(r.Out, "error: %v\n", err)
+			return false
+		}
+		fmt.Fprint(r.Out, expr.VisualizeAST(parsed))
+	default:
+		if strings.HasPrefix(command, ":") {
+			fmt.Fprintf(r.Out, "unknown command %s, :help for help\n", command)
+			return false
+		}
+		value, err := r.Evaluator.EvaluateValue(line)
+		if err != nil {
+			fmt.Fprintf(r.Out, "error: %v\n", err)
+			return false
+		}
+		fmt.Fprintln(r.Out, Describe(value))
+	}
+	return false
+}
+
+// Describe formats value as indented JSON followed by its type, like `"octocat" (string)`
+func Describe(value expr.JSValue) string {
+	encoded, err := value.MarshalJSON()
+	if err != nil {
+		return fmt.Sprintf("%#v", value)
+	}
+	formatted := jsontext.Value(encoded)
+	// sorts the properties of objects
+	if err := formatted.Canonicalize(); err != nil {
+		return fmt.Sprintf("%#v", value)
+	}
+	if err := formatted.Indent(jsontext.WithIndent("  ")); err != nil {
+		return fmt.Sprintf("%#v", value)
+	}
+	return fmt.Sprintf("%s (%s)", formatted, value.Type())
+}
+
+// ParseExpression parses an expression, with or without `${{ }}` around it
+func ParseExpression(expression string) (expr.Node, error) {
+	expression = strings.TrimSpace(expression)
+	if inner, ok := strings.CutPrefix(expression, "${{"); ok && strings.HasSuffix(inner, "}}") {
+		expression = strings.TrimSuffix(inner, "}}")
+	}
+	parsed, perr := expr.NewParser().Parse(expr.NewExprLexer(expression + "}}"))
+	if perr != nil {
+		return nil, oops.Wrapf(perr, "parsing expression %s", expression)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,178 @@
+package repl
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/runner/expr"
+)
+
+func testContext(t *testing.T) *expr.EvalContext {
+	t.Helper()
+	event, err := expr.UnmarshalFromGo(map[string]any{
+		"pull_request": map[string]any{"number": 7, "head": map[string]any{"ref": "feature"}},
+		"pusher":       map[string]any{"name": "octocat"},
+	})
+	require.NoError(t, err)
+	evalContext := &expr.EvalContext{Env: map[string]string{"NODE_ENV": "test"}}
+	evalContext.Github.Actor = "octocat"
+	evalContext.Github.EventName = "pull_request"
+	evalContext.Github.Event = event.Object.Value
+	evalContext.Job.Status = "success"
+	return evalContext
+}
+
+func testREPL(t *testing.T, in io.Reader) (*REPL, *bytes.Buffer) {
+	t.Helper()
+	evalContext := testContext(t)
+	evaluator, err := expr.NewEvaluator(evalContext)
+	require.NoError(t, err)
+	contexts, err := expr.UnmarshalFromGo(*evalContext)
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	return &REPL{
+		Evaluator: evaluator,
+		Contexts:  contexts.Object.Value,
+		Functions: expr.DefaultFunctions(),
+		In:        in,
+		Out:       out,
+	}, out
+}
+
+func TestComplete(t *testing.T) {
+	r, _ := testREPL(t, nil)
+	testCases := []struct {
+		line        string
+		start       int
+		completions []string
+	}{
+		{"git", 0, []string{"github"}},
+		{"github.ev", 0, []string{"github.event", "github.event_name", "github.event_path"}},
+		{"github.event.p", 0, []string{"github.event.pull_request", "github.event.pusher"}},
+		{"github.event.pull_request.he", 0, []string{"github.event.pull_request.head"}},
+		{"GitHub.Event.Pusher.", 0, []string{"GitHub.Event.Pusher.name"}},
+		{"env.NODE", 0, []string{"env.node_env"}},
+		{"x && github.event.pull_request.head.r", 5, []string{"github.event.pull_request.head.ref"}},
+		{"fromJSON(github.acto", 9, []string{"github.actor", "github.actor_id"}},
+		{"toJ", 0, []string{"toJSON("}},
+		{"succ", 0, []string{"success("}},
+		{"github.event.pull_request.number.", 0, nil},
+		{"github.*.", 8, nil},
+		{"nothing.", 0, nil},
+		{"'a' == ", 7, nil},
+		{"", 0, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.line, func(t *testing.T) {
+			start, completions := Complete(tc.line, r.Contexts, r.Functions)
+			assert.Equal(t, tc.start, start)
+			assert.Equal(t, tc.completions, completions)
+		})
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	r, _ := testREPL(t, nil)
+	complete := func(line string) (int, []string) {
+		return Complete(line, r.Contexts, r.Functions)
+	}
+	testCases := []struct {
+		name  string
+		keys  string
+		lines []string
+	}{
+		{"typing", "github.actor\r", []string{"github.actor"}},
+		{"completes the only completion", "github.event.pull\t.number\r", []string{"github.event.pull_request.number"}},
+		{"completes the common prefix", "github.event_\t\r", []string{"github.event_"}},
+		{"completes the common prefix then lists", "github.event.pu\t\t\r", []string{"github.event.pu"}},
+		{"backspace", "github.actot\x7fr\r", []string{"github.actor"}},
+		{"moves the cursor", "ithub\x01g\x05.actor\x1b[D\x1b[D\x1b[Cx\r", []string{"github.actoxr"}},
+		{"deletes", "abc\x1b[D\x1b[D\x1b[3~\r", []string{"ac"}},
+		{"kills", "abc\x1b[D\x15\rabc\x1b[D\x0b\r", []string{"c", "ab"}},
+		{"history", "first\rsecond\r\x1b[A\x1b[A\r\x10\r\x10\x0e\r", []string{"first", "second", "first", "first", ""}},
+		{"history keeps the edited line", "first\redit\x1b[A\x1b[B\r", []string{"first", "edit"}},
+		{"interrupt", "abc\x03def\r", []string{"def"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			editor := newLineEditor(strings.NewReader(tc.keys+"\x04"), io.Discard, prompt, complete)
+			var lines []string
+			for {
+				line, err := editor.readLine()
+				if err == errInterrupted {
+					continue
+				}
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				lines = append(lines, line)
+			}
+			assert.Equal(t, tc.lines, lines)
+		})
+	}
+}
+
+func TestLineEditorListsCompletions(t *testing.T) {
+	r, _ := testREPL(t, nil)
+	out := &bytes.Buffer{}
+	editor := newLineEditor(strings.NewReader("github.event.p\t\t\r"), out, prompt, func(line string) (int, []string) {
+		return Complete(line, r.Contexts, r.Functions)
+	})
+	line, err := editor.readLine()
+	require.NoError(t, err)
+	assert.Equal(t, "github.event.pu", line)
+	assert.Contains(t, out.String(), "\r\ngithub.event.pull_request  github.event.pusher\r\n")
+}
+
+func TestRun(t *testing.T) {
+	input := strings.Join([]string{
+		"github.actor",
+		"${{ github.event.pull_request.number }}",
+		"pr-${{ github.event.pull_request.number }}",
+		"github.event.pull_request.head",
+		"github.event.nothing",
+		":if github.event_name == 'pull_request'",
+		":if failure()",
+		":ast !a",
+		"github.",
+		":nope",
+		":quit",
+		"github.actor",
+	}, "\n")
+	r, out := testREPL(t, strings.NewReader(input))
+	require.NoError(t, r.Run(t.Context()))
+
+	lines := strings.Split(out.String(), "\n")
+	require.Greater(t, len(lines), 1)
+	assert.Equal(t, strings.Join([]string{
+		`"octocat" (string)`,
+		`7 (number)`,
+		`"pr-7" (string)`,
+		"{",
+		`  "ref": "feature"`,
+		"} (object)",
+		"null (undefined)",
+		"true",
+		"false",
+		"*expr.NotOpNode !",
+		"  *expr.VariableNode a",
+		lines[12],
+		"unknown command :nope, :help for help",
+		"",
+	}, "\n"), strings.Join(lines[1:], "\n"))
+	assert.True(t, strings.HasPrefix(lines[12], "error: "), lines[12])
+}
+
+func TestDescribe(t *testing.T) {
+	value, err := expr.UnmarshalFromGo(map[string]any{"b": []any{1, "two", nil}, "a": true})
+	require.NoError(t, err)
+	assert.Equal(t, "{\n  \"a\": true,\n  \"b\": [\n    1,\n    \"two\",\n    null\n  ]\n} (object)", Describe(value))
+	assert.Equal(t, `3 (int)`, Describe(expr.JSValue{Int: expr.Some(int64(3))}))
+	assert.Equal(t, `null (null)`, Describe(expr.JSValue{Null: expr.Some(struct{}{})}))
+}
@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package repl
+
+import "github.com/samber/oops"
+
+// isTerminal reports whether fd is a terminal. Without raw mode there is no line editing, so the REPL reads
+// lines like it does from a pipe.
+func isTerminal(int) bool {
+	return false
+}
+
+func makeRaw(int) (restore func() error, err error) {
+	return nil, oops.Errorf("raw terminal mode isn't supported on this platform")
+}
@@ -0,0 +1,131 @@
+package runner
+
+import "slices"
+
+// acMatcher is an Aho-Corasick automaton: it finds the occurrences of many patterns in a single pass over
+// a text, one byte at a time, which also makes it usable on streams.
+// State 0 is the root, the state of "nothing matched yet".
+type acMatcher struct {
+	// rootNext are the transitions of the root, which is visited the most
+	rootNext [256]int32
+	edges    [][]acEdge
+	fail     []int32
+	// depth is the length of the prefix of a pattern that a state represents
+	depth []int32
+	// longest is the length of the longest pattern that is a suffix of the state, or 0
+	longest []int32
+}
+
+type acEdge struct {
+	b  byte
+	to int32
+}
+
+func newACMatcher(patterns []string) *acMatcher {
+	m := &acMatcher{
+		edges:   [][]acEdge{nil},
+		fail:    []int32{0},
+		depth:   []int32{0},
+		longest: []int32{0},
+	}
+
+	// build the trie
+	for _, p := range patterns {
+		if p == "" {
+			continue
+		}
+		state := int32(0)
+		for i := range len(p) {
+			to, ok := m.child(state, p[i])
+			if !ok {
+				to = int32(len(m.edges))
+				m.edges = append(m.edges, nil)
+				m.fail = append(m.fail, 0)
+				m.depth = append(m.depth, m.depth[state]+1)
+				m.longest = append(m.longest, 0)
+				// edges are sorted by byte for child
+				at, _ := slices.BinarySearchFunc(m.edges[state], p[i], compareEdge)
+				m.edges[state] = slices.Insert(m.edges[state], at, acEdge{b: p[i], to: to})
+			}
+			state = to
+		}
+		m.longest[state] = int32(len(p))
+	}
+
+	// compute the failure links breadth first, so the links of shallower states are ready when they're needed
+	queue := make([]int32, 0, len(m.edges))
+	for _, e := range m.edges[0] {
+		queue = append(queue, e.to)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		m.longest[state] = max(m.longest[state], m.longest[m.fail[state]])
+		for _, e := range m.edges[state] {
+			f := m.fail[state]
+			for {
+				if to, ok := m.child(f, e.b); ok && to != e.to {
+					m.fail[e.to] = to
+					break
+				}
+				if f == 0 {
+					break
+				}
+				f = m.fail[f]
+			}
+			queue = append(queue, e.to)
+		}
+	}
+
+	for _, e := range m.edges[0] {
+		m.rootNext[e.b] = e.to
+	}
+	return m
+}
+
+func (m *acMatcher) child(state int32, b byte) (int32, bool) {
+	edges := m.edges[state]
+	if len(edges) > 8 {
+		i, ok := slices.BinarySearchFunc(edges, b, compareEdge)
+		if !ok {
+			return 0, false
+		}
+		return edges[i].to, true
+	}
+	for _, e := range edges {
+		if e.b == b {
+			return e.to, true
+		}
+	}
+	return 0, false
+}
+
+func compareEdge(e acEdge, b byte) int {
+	return int(e.b) - int(b)
+}
+
+// next returns the state after reading b in state
+func (m *acMatcher) next(state int32, b byte) int32 {
+	for state != 0 {
+		if to, ok := m.child(state, b); ok {
+			return to
+		}
+		state = m.fail[state]
+	}
+	return m.rootNext[b]
+}
+
+// acSpan is a range [start, end) of a text
+type acSpan struct {
+	start, end int
+}
+
+// addSpan adds s to spans, which are sorted and don't overlap or touch, merging it with the spans it overlaps.
+// s must not end before the last span.
+func addSpan(spans []acSpan, s acSpan) []acSpan {
+	for len(spans) > 0 && s.start <= spans[len(spans)-1].end {
+		s.start = min(s.start, spans[len(spans)-1].start)
+		spans = spans[:len(spans)-1]
+	}
+	return append(spans, s)
+}
@@ -0,0 +1,133 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/samber/oops"
+)
+
+const (
+	approvalPendingExt  = ".pending"
+	approvalDecisionExt = ".decision"
+
+	approvalApproved = "approved"
+	approvalRejected = "rejected"
+)
+
+// ApprovalRequest is a job that waits for approval to deploy to a protected environment
+type ApprovalRequest struct {
+	// Run is the [WorkflowState.Run] of the run
+	Run         string    `json:"run"`
+	Job         string    `json:"job"`
+	Environment string    `json:"environment"`
+	RequestedAt time.Time `json:"requested_at"`
+	// RunDir is the [WorkflowState.RunDir] of the run
+	RunDir string `json:"-"`
+}
+
+// Approver decides whether jobs may deploy to environments that require approval
+type Approver interface {
+	// Approve blocks until the deployment is approved (true) or rejected (false), or ctx is done
+	Approve(ctx context.Context, req ApprovalRequest) (bool, error)
+}
+
+// FileApprover records pending approvals in the run directory and waits for [DecideApproval]
+// (bact workflow approve) to record a decision next to them
+type FileApprover struct {
+	// PollInterval is how often the decision is checked. Defaults to a second.
+	PollInterval time.Duration
+}
+
+func (a FileApprover) Approve(ctx context.Context, req ApprovalRequest) (bool, error) {
+	dir := approvalsDir(req.RunDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return false, oops.Wrapf(err, "creating approvals directory")
+	}
+	content, err := json.Marshal(req)
+	if err != nil {
+		return false, oops.Wrap(err)
+	}
+	pending := filepath.Join(dir, req.Job+approvalPendingExt)
+	decision := filepath.Join(dir, req.Job+approvalDecisionExt)
+	// a decision left from an earlier attempt isn't for this request
+	os.Remove(decision)
+	if err := os.WriteFile(pending, content, 0o644); err != nil {
+		return false, oops.Wrapf(err, "recording pending approval")
+	}
+	defer os.Remove(pending)
+
+	interval := a.PollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		content, err := os.ReadFile(decision)
+		switch {
+		case err == nil:
+			os.Remove(decision)
+			return strings.TrimSpace(string(content)) == approvalApproved, nil
+		case !errors.Is(err, fs.ErrNotExist):
+			return false, oops.Wrapf(err, "reading approval decision")
+		}
+		select {
+		case <-ctx.Done():
+			return false, oops.Wrapf(ctx.Err(), "waiting for approval")
+		case <-ticker.C:
+		}
+	}
+}
+
+// PendingApprovals lists the jobs of the run in runDir that wait for approval
+func PendingApprovals(runDir string) ([]ApprovalRequest, error) {
+	matches, err := filepath.Glob(filepath.Join(approvalsDir(runDir), "*"+approvalPendingExt))
+	if err != nil {
+		return nil, oops.Wrap(err)
+	}
+	requests := make([]ApprovalRequest, 0, len(matches))
+	for _, path := range matches {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			// the job was decided on since the glob
+			continue
+		}
+		var req ApprovalRequest
+		if err := json.Unmarshal(content, &req); err != nil {
+			return nil, oops.With("path", path).Wrapf(err, "reading pending approval")
+		}
+		req.RunDir = runDir
+		requests = append(requests, req)
+	}
+	return requests, nil
+}
+
+// DecideApproval approves or rejects the deployment of job in the run in runDir, which must be waiting for it
+func DecideApproval(runDir, job string, approve bool) error {
+	dir := approvalsDir(runDir)
+	if job == "" || job != filepath.Base(job) {
+		return oops.With("job", job).Errorf("invalid job name %q", job)
+	}
+	if _, err := os.Stat(filepath.Join(dir, job+approvalPendingExt)); err != nil {
+		return oops.With("job", job).Errorf("job %s is not waiting for approval", job)
+	}
+	decision := approvalRejected
+	if approve {
+		decision = approvalApproved
+	}
+	if err := os.WriteFile(filepath.Join(dir, job+approvalDecisionExt), []byte(decision+"\n"), 0o644); err != nil {
+		return oops.Wrapf(err, "recording approval decision")
+	}
+	return nil
+}
+
+func approvalsDir(runDir string) string {
+	return filepath.Join(runDir, "approvals")
+}
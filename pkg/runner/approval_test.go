@@ -0,0 +1,120 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+func TestFileApprover(t *testing.T) {
+	runDir := t.TempDir()
+	approver := FileApprover{PollInterval: 5 * time.Millisecond}
+	req := ApprovalRequest{Run: "1", Job: "deploy", Environment: "production", RunDir: runDir}
+
+	assert.Error(t, DecideApproval(runDir, "deploy", true), "nothing is waiting yet")
+
+	for _, approve := range []bool{true, false} {
+		decided := make(chan error, 1)
+		go func() {
+			for {
+				pending, err := PendingApprovals(runDir)
+				if err == nil && len(pending) == 1 {
+					assert.Equal(t, "production", pending[0].Environment)
+					decided <- DecideApproval(runDir, pending[0].Job, approve)
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}()
+		approved, err := approver.Approve(t.Context(), req)
+		require.NoError(t, err)
+		require.NoError(t, <-decided)
+		assert.Equal(t, approve, approved)
+
+		pending, err := PendingApprovals(runDir)
+		require.NoError(t, err)
+		assert.Empty(t, pending, "the request is removed once decided")
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	_, err := approver.Approve(ctx, req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.Error(t, DecideApproval(runDir, "../deploy", true))
+}
+
+func TestProtectionRulesAllowsRef(t *testing.T) {
+	assert.True(t, ProtectionRules{}.allowsRef("anything"))
+	rules := ProtectionRules{Branches: []string{"main", "release/*"}}
+	assert.True(t, rules.allowsRef("main"))
+	assert.True(t, rules.allowsRef("release/1.0"))
+	assert.False(t, rules.allowsRef("release/1.0/hotfix"))
+	assert.False(t, rules.allowsRef("feature/x"))
+}
+
+func TestJobTimeoutStartsAfterWaitTimer(t *testing.T) {
+	wf, err := yamls.ReadWorkflow(strings.NewReader(`
+on: push
+jobs:
+  deploy:
+    runs-on: ubuntu-latest
+    environment: production
+    timeout-minutes: 0.005
+    steps:
+      - run: echo deployed
+`), false)
+	require.NoError(t, err)
+
+	console := &bytes.Buffer{}
+	r := New(console, EnvFromMap(map[string]string{"PATH": os.Getenv("PATH")}))
+	r.Environments = map[string]*Environment{
+		// longer than the 300ms timeout of the job
+		"production": {Name: "production", Protection: ProtectionRules{WaitTimer: 500 * time.Millisecond}},
+	}
+	_, err = r.RunWorkflow(t.Context(), wf, &types.WorkflowContexts{})
+	require.NoError(t, err, console.String())
+	assert.Contains(t, console.String(), "deployed")
+}
+
+func TestEnvironmentURLIsRecorded(t *testing.T) {
+	wf, err := yamls.ReadWorkflow(strings.NewReader(`
+on: push
+jobs:
+  deploy:
+    runs-on: ubuntu-latest
+    environment:
+      name: production
+      url: ${{ steps.release.outputs.url }}
+    steps:
+      - id: release
+        run: echo "url=https://example.com/v1" >> "$GITHUB_OUTPUT"
+`), false)
+	require.NoError(t, err)
+
+	console := &bytes.Buffer{}
+	r := New(console, EnvFromMap(map[string]string{"PATH": os.Getenv("PATH")}))
+	r.RepoDir = t.TempDir()
+	r.StateDir = t.TempDir()
+	wfState, err := r.RunWorkflow(t.Context(), wf, &types.WorkflowContexts{})
+	require.NoError(t, err, console.String())
+
+	record, err := ReadRunRecord(RunDir(r.StateDir, wfState.Run))
+	require.NoError(t, err)
+	assert.Equal(t, "production", record.Jobs["deploy"].Environment)
+	assert.Equal(t, "https://example.com/v1", record.Jobs["deploy"].EnvironmentURL)
+
+	graph, err := WorkflowGraph(t.Context(), wf, record)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/v1", graph.Nodes[0].EnvironmentURL)
+	assert.Contains(t, graph.Nodes[0].labelLines(), "https://example.com/v1")
+}
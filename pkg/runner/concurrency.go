@@ -0,0 +1,70 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/concurrency"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+// joinConcurrencyGroup waits for the turn of a workflow or a job (what) in its concurrency group, if it has one.
+// The returned context is cancelled when a newer run in the group cancels this one.
+// release must be called when the run is done.
+func (r *Runner) joinConcurrencyGroup(
+	ctx context.Context,
+	what string,
+	config *yamls.Concurrency,
+	p MakeExprContextParams,
+) (_ context.Context, release func(), _ error) {
+	if config == nil {
+		return ctx, func() {}, nil
+	}
+	evaluator, err := newEvaluator(ctx, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	group, err := evaluator.EvaluateTemplate(config.Group)
+	if err != nil {
+		return nil, nil, oops.Wrapf(p.Workflow.errorAt(config.GroupNode(), err), "evaluating concurrency group")
+	}
+	cancelInProgress, err := evaluateBool(evaluator, config.CancelInProgress)
+	if err != nil {
+		return nil, nil, oops.Wrapf(p.Workflow.errorAt(config.CancelInProgressNode(), err), "evaluating cancel-in-progress")
+	}
+
+	var console io.Writer
+	if p.Job != nil {
+		console = p.Job.Console
+	} else {
+		console = r.Console
+	}
+	return r.concurrencyGroups().Join(ctx, concurrency.Request{
+		Group:            group,
+		CancelInProgress: cancelInProgress,
+		Label:            fmt.Sprintf("%s of run %s", what, p.Workflow.Run),
+		OnWait: func() {
+			fmt.Fprintf(console, "%s: waiting for concurrency group %s\n", what, group)
+		},
+	})
+}
+
+func (r *Runner) concurrencyGroups() *concurrency.Groups {
+	if r != nil && r.ConcurrencyGroups != nil {
+		return r.ConcurrencyGroups
+	}
+	var dir string
+	if r != nil {
+		dir = r.StateDir
+	}
+	if dir == "" {
+		// still shared by all the bact processes on the machine
+		dir = filepath.Join(os.TempDir(), "bact")
+	}
+	return &concurrency.Groups{Dir: filepath.Join(dir, "concurrency")}
+}
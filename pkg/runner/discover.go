@@ -0,0 +1,129 @@
+package runner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/log"
+	"github.com/drornir/better-actions/pkg/runner/expr"
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+// WorkflowsDir is the directory, relative to the repository root, that holds the workflow files
+const WorkflowsDir = ".github/workflows"
+
+// DiscoveredWorkflow is a workflow file that was found in a repository
+type DiscoveredWorkflow struct {
+	Path     string
+	Workflow *yamls.Workflow
+	// Err is why the workflow file couldn't be read. Workflow is nil then, and running it fails.
+	Err error
+}
+
+// DisplayName is the name of the workflow if it has one, or the file name otherwise.
+func (d DiscoveredWorkflow) DisplayName() string {
+	if d.Workflow != nil && d.Workflow.Name != "" {
+		return d.Workflow.Name
+	}
+	return filepath.Base(d.Path)
+}
+
+// DiscoverWorkflows reads every `*.yml` and `*.yaml` file in the workflows directory of repoRoot
+// and returns the ones that are triggered by event. The result is sorted by path.
+// Files that can't be read or parsed are returned too, with their [DiscoveredWorkflow.Err], since whether
+// they are triggered by event isn't known. Like on GitHub, they fail without failing the other workflows.
+// The branch and tag filters of event match the ref of the github context, which is derived from the git
+// checkout of repoRoot with the non-empty values of github taking precedence, like in a run.
+// The expressions of the workflows may call functions, or the default ones if it's nil.
+func DiscoverWorkflows(
+	ctx context.Context,
+	repoRoot, event string,
+	github *types.GitHub,
+	functions expr.FunctionStore,
+) ([]DiscoveredWorkflow, error) {
+	logger := log.FromContext(ctx)
+	oopser := oops.FromContext(ctx).With("repoRoot", repoRoot, "event", event)
+
+	ref, err := triggerRef(ctx, repoRoot, event, github)
+	if err != nil {
+		return nil, oopser.Wrap(err)
+	}
+
+	dir := filepath.Join(repoRoot, WorkflowsDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, oopser.Wrapf(err, "reading workflows directory")
+	}
+
+	var discovered []DiscoveredWorkflow
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if ext != ".yml" && ext != ".yaml" {
+			continue
+		}
+
+		wfPath := filepath.Join(dir, entry.Name())
+		wf, err := readWorkflowFile(wfPath, functions)
+		if err != nil {
+			logger.D(ctx, "invalid workflow file", "workflowFile", wfPath, "error", err)
+			discovered = append(discovered, DiscoveredWorkflow{
+				Path: wfPath,
+				Err:  oopser.With("workflowFile", wfPath).Wrapf(err, "reading workflow"),
+			})
+			continue
+		}
+
+		triggered, err := wf.TriggeredBy(ctx, event, ref)
+		if err != nil {
+			discovered = append(discovered, DiscoveredWorkflow{Path: wfPath, Err: oopser.With("workflowFile", wfPath).Wrap(err)})
+			continue
+		}
+		if !triggered {
+			logger.D(ctx, "skipping workflow not triggered by event", "workflowFile", wfPath)
+			continue
+		}
+		discovered = append(discovered, DiscoveredWorkflow{Path: wfPath, Workflow: wf})
+	}
+
+	slices.SortFunc(discovered, func(a, b DiscoveredWorkflow) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return discovered, nil
+}
+
+// triggerRef returns the ref the branch and tag filters of event match: the base branch of pull requests, if
+// it's known, and the ref of the github context otherwise
+func triggerRef(ctx context.Context, repoRoot, event string, github *types.GitHub) (string, error) {
+	gh, err := newGithubContext(ctx, repoRoot, &yamls.Workflow{}, github)
+	if err != nil {
+		return "", oops.Wrapf(err, "creating github context")
+	}
+	if strings.HasPrefix(event, "pull_request") && gh.BaseRef != "" {
+		return "refs/heads/" + strings.TrimPrefix(gh.BaseRef, "refs/heads/"), nil
+	}
+	return gh.Ref, nil
+}
+
+func readWorkflowFile(wfPath string, functions expr.FunctionStore) (*yamls.Workflow, error) {
+	f, err := os.Open(wfPath)
+	if err != nil {
+		return nil, oops.Wrapf(err, "opening workflow file")
+	}
+	defer f.Close()
+
+	wf, err := yamls.ReadWorkflowWithFunctions(f, false, functions)
+	if err != nil {
+		return nil, oops.Wrapf(err, "parsing workflow file")
+	}
+	wf.File = wfPath
+	return wf, nil
+}
@@ -0,0 +1,78 @@
+package runner
+
+import (
+	"maps"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/samber/oops"
+)
+
+// EnvPolicy controls which variables of the host environment the steps of a workflow see
+type EnvPolicy string
+
+const (
+	// EnvPolicyAllowlist passes only the host variables that match the allowlist patterns
+	EnvPolicyAllowlist EnvPolicy = "allowlist"
+	// EnvPolicyInherit passes the whole host environment
+	EnvPolicyInherit EnvPolicy = "inherit"
+	// EnvPolicyEmpty passes nothing from the host environment
+	EnvPolicyEmpty EnvPolicy = "empty"
+)
+
+var allEnvPolicies = []EnvPolicy{EnvPolicyAllowlist, EnvPolicyInherit, EnvPolicyEmpty}
+
+// DefaultEnvAllowlist are the host variables that [EnvPolicyAllowlist] passes by default.
+// They describe the user and the locale rather than the project, so they don't make builds differ.
+var DefaultEnvAllowlist = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "TMPDIR", "TZ", "LANG", "LANGUAGE", "LC_*",
+}
+
+// ParseEnvPolicy parses s into an EnvPolicy. The empty string is parsed as [EnvPolicyAllowlist].
+func ParseEnvPolicy(s string) (EnvPolicy, error) {
+	if s == "" {
+		return EnvPolicyAllowlist, nil
+	}
+	p := EnvPolicy(strings.ToLower(s))
+	if !slices.Contains(allEnvPolicies, p) {
+		return "", oops.With("policy", s, "allowed", allEnvPolicies).Errorf("unknown env policy %q", s)
+	}
+	return p, nil
+}
+
+// hostEnv returns the variables of the host environment that r's policy lets through
+func (r *Runner) hostEnv() map[string]string {
+	return filterEnv(EnvFromOS()(), r.EnvPolicy, r.EnvAllowlist)
+}
+
+// filterEnv applies policy to env. patterns are matched with [path.Match] against the variable names,
+// and default to [DefaultEnvAllowlist]. An empty policy is [EnvPolicyAllowlist].
+func filterEnv(env map[string]string, policy EnvPolicy, patterns []string) map[string]string {
+	switch policy {
+	case EnvPolicyInherit:
+		return maps.Clone(env)
+	case EnvPolicyEmpty:
+		return map[string]string{}
+	}
+
+	if patterns == nil {
+		patterns = DefaultEnvAllowlist
+	}
+	filtered := make(map[string]string)
+	for name, value := range env {
+		key := name
+		if runtime.GOOS == "windows" {
+			// variable names are case insensitive on windows (e.g Path)
+			key = strings.ToUpper(name)
+		}
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, key); ok {
+				filtered[name] = value
+				break
+			}
+		}
+	}
+	return filtered
+}
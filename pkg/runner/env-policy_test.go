@@ -0,0 +1,88 @@
+package runner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+func TestFilterEnv(t *testing.T) {
+	host := map[string]string{
+		"PATH":           "/usr/bin",
+		"HOME":           "/home/octocat",
+		"LC_ALL":         "C.UTF-8",
+		"AWS_SECRET_KEY": "hunter2",
+	}
+
+	assert.Equal(t, host, filterEnv(host, EnvPolicyInherit, nil))
+	assert.Empty(t, filterEnv(host, EnvPolicyEmpty, nil))
+	assert.Equal(t, map[string]string{
+		"PATH":   "/usr/bin",
+		"HOME":   "/home/octocat",
+		"LC_ALL": "C.UTF-8",
+	}, filterEnv(host, EnvPolicyAllowlist, nil))
+	assert.Equal(t, map[string]string{
+		"AWS_SECRET_KEY": "hunter2",
+	}, filterEnv(host, "", []string{"AWS_*"}), "the empty policy is the allowlist")
+
+	_, err := ParseEnvPolicy("some")
+	assert.Error(t, err)
+	p, err := ParseEnvPolicy("Inherit")
+	require.NoError(t, err)
+	assert.Equal(t, EnvPolicyInherit, p)
+}
+
+func TestStepsSeeOnlyTheComputedEnv(t *testing.T) {
+	const wfYAML = `
+on: push
+env:
+  FROM_WORKFLOW: wf
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: |
+          echo "FROM_HOST=${BACT_TEST_FROM_HOST:-unset}"
+          echo "FROM_RUNNER=$FROM_RUNNER"
+          echo "FROM_WORKFLOW=$FROM_WORKFLOW"
+`
+	t.Setenv("BACT_TEST_FROM_HOST", "leaked")
+
+	run := func(t *testing.T, policy EnvPolicy, allowlist []string) string {
+		t.Helper()
+		wf, err := yamls.ReadWorkflow(strings.NewReader(wfYAML), false)
+		require.NoError(t, err)
+		console := &bytes.Buffer{}
+		r := New(console, EnvFromMap(map[string]string{"FROM_RUNNER": "runner"}))
+		r.RepoDir = t.TempDir()
+		r.EnvPolicy = policy
+		r.EnvAllowlist = allowlist
+		_, err = r.RunWorkflow(t.Context(), wf, &types.WorkflowContexts{})
+		require.NoError(t, err, console.String())
+		return console.String()
+	}
+
+	for _, tc := range []struct {
+		policy    EnvPolicy
+		allowlist []string
+		fromHost  string
+	}{
+		{EnvPolicyAllowlist, nil, "unset"},
+		{EnvPolicyAllowlist, []string{"PATH", "BACT_TEST_*"}, "leaked"},
+		{EnvPolicyInherit, nil, "leaked"},
+		{EnvPolicyEmpty, nil, "unset"},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			out := run(t, tc.policy, tc.allowlist)
+			assert.Contains(t, out, "FROM_HOST="+tc.fromHost)
+			assert.Contains(t, out, "FROM_RUNNER=runner")
+			assert.Contains(t, out, "FROM_WORKFLOW=wf")
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/secrets"
+)
+
+// Environment is a deployment environment that jobs target with `environment:`
+type Environment struct {
+	Name string
+	// Vars are added to the vars context of the jobs that target the environment
+	Vars map[string]string
+	// SecretProviders are the secrets of the environment, in order of precedence.
+	// They override the secrets of the run.
+	SecretProviders []secrets.Provider
+	Protection      ProtectionRules
+}
+
+// ProtectionRules must pass before a job that targets an environment runs
+type ProtectionRules struct {
+	// RequiredApproval makes jobs wait for [Runner.Approver]
+	RequiredApproval bool
+	// WaitTimer delays jobs, after they are approved
+	WaitTimer time.Duration
+	// Branches are glob patterns (e.g main, release/*) of the branches and tags that may deploy.
+	// Empty means any.
+	Branches []string
+}
+
+// JobEnvironment is the environment a job deployed to
+type JobEnvironment struct {
+	Name string
+	// URL is the evaluated `environment.url` of the job
+	URL string
+}
+
+// enterEnvironment passes the protection rules of the environment the job targets, if any,
+// and loads its secrets and vars
+func (j *Job) enterEnvironment(ctx context.Context) error {
+	j.secrets = j.Workflow.Secrets
+	j.vars = j.Workflow.Vars
+	target := j.Config.DeploymentEnvironment()
+	if target == nil {
+		return nil
+	}
+
+	evaluator, err := newEvaluator(ctx, MakeExprContextParams{Workflow: j.Workflow})
+	if err != nil {
+		return err
+	}
+	name, err := evaluator.EvaluateTemplate(target.Name)
+	if err != nil {
+		return oops.Wrapf(j.Workflow.errorAt(target.NameNode(), err), "evaluating environment name")
+	}
+	if name == "" {
+		return oops.Errorf("environment name is empty")
+	}
+	oopser := oops.With("environment", name)
+
+	env := &Environment{Name: name}
+	if defined, ok := j.Workflow.runner.environments()[name]; ok {
+		env = defined
+	}
+
+	ref := j.Workflow.GitHub.RefName
+	if !env.Protection.allowsRef(ref) {
+		return oopser.Errorf("%s %q is not allowed to deploy to environment %s", j.Workflow.GitHub.RefType, ref, name)
+	}
+
+	envSecrets, err := secrets.Resolve(ctx, env.SecretProviders...)
+	if err != nil {
+		return oopser.Wrapf(err, "resolving environment secrets")
+	}
+	j.secrets = maps.Clone(j.Workflow.Secrets)
+	if j.secrets == nil {
+		j.secrets = make(map[string]string)
+	}
+	maps.Copy(j.secrets, envSecrets)
+	j.vars = maps.Clone(j.Workflow.Vars)
+	if j.vars == nil {
+		j.vars = make(map[string]string)
+	}
+	maps.Copy(j.vars, env.Vars)
+
+	if env.Protection.RequiredApproval {
+		run := j.Workflow.Run
+		fmt.Fprintf(j.Console, "job %s: waiting for approval to deploy to %s. Approve with: bact workflow approve %s %s\n",
+			j.Name, name, run, j.Name)
+		approved, err := j.Workflow.runner.approver().Approve(ctx, ApprovalRequest{
+			Run:         run,
+			Job:         j.Name,
+			Environment: name,
+			RequestedAt: time.Now(),
+			RunDir:      j.Workflow.RunDir,
+		})
+		if err != nil {
+			return oopser.Wrapf(err, "waiting for approval")
+		}
+		if !approved {
+			return oopser.Errorf("deployment to environment %s was rejected", name)
+		}
+		fmt.Fprintf(j.Console, "job %s: deployment to %s approved\n", j.Name, name)
+	}
+
+	if env.Protection.WaitTimer > 0 {
+		fmt.Fprintf(j.Console, "job %s: waiting %s before deploying to %s\n", j.Name, env.Protection.WaitTimer, name)
+		select {
+		case <-ctx.Done():
+			return oopser.Wrapf(ctx.Err(), "waiting for the wait timer")
+		case <-time.After(env.Protection.WaitTimer):
+		}
+	}
+
+	j.Environment = &JobEnvironment{Name: name}
+	j.environmentURL = target.URL
+	return nil
+}
+
+// resolveEnvironmentURL evaluates the url of the environment of the job, which may use the outputs of its steps
+func (j *Job) resolveEnvironmentURL(ctx context.Context) error {
+	if j.Environment == nil || j.environmentURL == "" {
+		return nil
+	}
+	evaluator, err := newEvaluator(ctx, MakeExprContextParams{Workflow: j.Workflow, Job: j})
+	if err != nil {
+		return err
+	}
+	url, err := evaluator.EvaluateTemplate(j.environmentURL)
+	if err != nil {
+		return oops.Wrapf(j.Workflow.errorAt(j.Config.ValueNode("environment", "url"), err), "evaluating environment url")
+	}
+	j.Environment.URL = url
+	if url != "" {
+		fmt.Fprintf(j.Console, "job %s: deployed to %s at %s\n", j.Name, j.Environment.Name, url)
+	}
+	return nil
+}
+
+func (p ProtectionRules) allowsRef(ref string) bool {
+	if len(p.Branches) == 0 {
+		return true
+	}
+	for _, pattern := range p.Branches {
+		if ok, _ := doublestar.Match(pattern, ref); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Runner) environments() map[string]*Environment {
+	if r == nil {
+		return nil
+	}
+	return r.Environments
+}
+
+func (r *Runner) approver() Approver {
+	if r == nil || r.Approver == nil {
+		return FileApprover{}
+	}
+	return r.Approver
+}
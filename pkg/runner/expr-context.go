@@ -1,9 +1,14 @@
 package runner
 
 import (
+	"context"
 	"maps"
 
+	"github.com/samber/oops"
+	"gopkg.in/yaml.v3"
+
 	"github.com/drornir/better-actions/pkg/runner/expr"
+	"github.com/drornir/better-actions/pkg/types"
 )
 
 type MakeExprContextParams struct {
@@ -18,7 +23,11 @@ func MakeExprContext(p MakeExprContextParams) (*expr.EvalContext, error) {
 	if p.Step != nil {
 		env = p.Step.Env
 	} else if p.Job != nil {
-		env = p.Job.StepsEnvCopy()
+		env = maps.Clone(p.Job.InitialEnv)
+		if env == nil {
+			env = map[string]string{}
+		}
+		maps.Copy(env, p.Job.StepsEnvCopy())
 	} else if p.Workflow != nil {
 		env = maps.Clone(p.Workflow.Env)
 	} else if p.GlobalEnv != nil {
@@ -27,58 +36,91 @@ func MakeExprContext(p MakeExprContextParams) (*expr.EvalContext, error) {
 		env = map[string]string{}
 	}
 
+	var github types.GitHub
+	var runner expr.RunnerContext
+	if p.Job != nil {
+		github = p.Job.github
+		runner = p.Job.runner
+	} else if p.Workflow != nil {
+		github = p.Workflow.GitHub
+	}
+	secrets := expr.SecretsContext{}
+	vars := map[string]string{}
+	steps := expr.StepsContext{}
+	job := expr.JobContext{}
+	needs := map[string]expr.NeedsContext{}
+	if p.Job != nil {
+		if p.Job.secrets != nil {
+			secrets = maps.Clone(p.Job.secrets)
+		}
+		if p.Job.vars != nil {
+			vars = maps.Clone(p.Job.vars)
+		}
+		if p.Job.needs != nil {
+			needs = p.Job.needs
+		}
+		steps = p.Job.stepsContext()
+		job.Status = string(p.Job.jobStatus())
+	} else if p.Workflow != nil {
+		if p.Workflow.Secrets != nil {
+			secrets = maps.Clone(p.Workflow.Secrets)
+		}
+		if p.Workflow.Vars != nil {
+			vars = maps.Clone(p.Workflow.Vars)
+		}
+	}
+
+	githubContext, err := githubToExprContext(github)
+	if err != nil {
+		return nil, oops.Wrapf(err, "creating github context")
+	}
+
 	return &expr.EvalContext{
-		Github: expr.GithubContext{
-			Action:            "",
-			ActionPath:        "",
-			ActionRef:         "",
-			ActionRepository:  "",
-			ActionStatus:      "",
-			Actor:             "",
-			ActorID:           "",
-			APIURL:            "",
-			BaseRef:           "",
-			Env:               "",
-			Event:             expr.JSObject{},
-			EventName:         "",
-			EventPath:         "",
-			GraphQLURL:        "",
-			HeadRef:           "",
-			Job:               "",
-			Path:              "",
-			Ref:               "",
-			RefName:           "",
-			RefProtected:      false,
-			RefType:           "",
-			Repository:        "",
-			RepositoryID:      "",
-			RepositoryOwner:   "",
-			RepositoryOwnerID: "",
-			RepositoryURL:     "",
-			RetentionDays:     "",
-			RunID:             "",
-			RunNumber:         "",
-			RunAttempt:        "",
-			SecretSource:      "",
-			ServerURL:         "",
-			Sha:               "",
-			Token:             "",
-			TriggeringActor:   "",
-			Workflow:          "",
-			WorkflowRef:       "",
-			WorkflowSha:       "",
-			Workspace:         "",
-		},
+		Github:   githubContext,
 		Env:      env,
-		Job:      expr.JobContext{},
+		Job:      job,
 		Jobs:     expr.JobsContext{},
-		Steps:    expr.StepsContext{},
-		Runner:   expr.RunnerContext{},
-		Secrets:  expr.SecretsContext{},
-		Vars:     map[string]string{},
+		Steps:    steps,
+		Runner:   runner,
+		Secrets:  secrets,
+		Vars:     vars,
 		Strategy: expr.StrategyContext{},
 		Matrix:   expr.JSObject{},
-		Needs:    map[string]expr.NeedsContext{},
+		Needs:    needs,
 		Inputs:   expr.JSObject{},
 	}, nil
 }
+
+// newEvaluator returns an evaluator of expressions in the context p makes, that call the functions of
+// the runner. It compiles templates with the cache of the workflow, if there is one.
+func newEvaluator(ctx context.Context, p MakeExprContextParams) (*expr.Evaluator, error) {
+	exprContext, err := MakeExprContext(p)
+	if err != nil {
+		return nil, oops.Wrapf(err, "creating expression context")
+	}
+	workflow := p.Workflow
+	if workflow == nil && p.Job != nil {
+		workflow = p.Job.Workflow
+	}
+	var functions expr.FunctionStore
+	if workflow != nil && workflow.runner != nil {
+		functions = workflow.runner.Functions
+	}
+	evaluator, err := expr.NewEvaluatorWithFunctions(ctx, exprContext, functions)
+	if err != nil {
+		return nil, err
+	}
+	if workflow != nil {
+		evaluator.Templates = workflow.templates
+	}
+	return evaluator, nil
+}
+
+// errorAt locates err at the value node of the workflow file, like the `if` of a step, when the workflow was
+// read from a file. See [yamls.Workflow.ErrorAt].
+func (w *WorkflowState) errorAt(node *yaml.Node, err error) error {
+	if w == nil || w.Config == nil {
+		return err
+	}
+	return w.Config.ErrorAt(node, err)
+}
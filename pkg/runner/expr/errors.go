@@ -22,3 +22,18 @@ func (e *ParseError) Error() string {
 func (e *ParseError) String() string {
 	return e.Error()
 }
+
+// ExpressionError is an error of one of the expressions of a template or a condition. Offset is where the error
+// is in the template, in bytes: where parsing failed, or where the expression that failed to evaluate starts.
+type ExpressionError struct {
+	Offset int
+	Err    error
+}
+
+func (e *ExpressionError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExpressionError) Unwrap() error {
+	return e.Err
+}
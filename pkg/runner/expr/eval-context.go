@@ -59,6 +59,8 @@ type GithubContext struct {
 	EventName string `json:"event_name"`
 	// EventPath is the path to the file on the runner that contains the full event webhook payload.
 	EventPath string `json:"event_path"`
+	// Environment is the deployment environment the job targets. This is a better-actions extension.
+	Environment string `json:"environment"`
 	// GraphQLURL is the URL of the GitHub GraphQL API.
 	GraphQLURL string `json:"graphql_url"`
 	// HeadRef is the head_ref or source branch of the pull request in a workflow run.
@@ -74,7 +76,7 @@ type GithubContext struct {
 	// RefProtected is true if branch protections or rulesets are configured for the ref.
 	RefProtected bool `json:"ref_protected"`
 	// RefType is the type of ref that triggered the workflow run (branch or tag).
-	RefType string `json:"ref_type"`
+	RefType string `json:"ref_type" values:"branch,tag"`
 	// Repository is the owner and repository name (e.g., octocat/Hello-World).
 	Repository string `json:"repository"`
 	// RepositoryID is the ID of the repository.
@@ -118,7 +120,7 @@ type NeedsContext struct {
 	// Outputs contains the set of outputs of the job.
 	Outputs map[string]string `json:"outputs"`
 	// Result is the result of the job (success, failure, cancelled, or skipped).
-	Result string `json:"result"`
+	Result string `json:"result" values:"success,failure,cancelled,skipped"`
 }
 
 // JobContext contains information about the currently running job.
@@ -130,7 +132,7 @@ type JobContext struct {
 	// Services contains information about the service containers created for a job.
 	Services map[string]JobContextService `json:"services"`
 	// Status is the current status of the job (success, failure, or cancelled).
-	Status string `json:"status"`
+	Status string `json:"status" values:"success,failure,cancelled"`
 }
 
 // JobContextContainer contains information about a container in a job.
@@ -157,7 +159,7 @@ type JobsContext map[string]JobsContextEntry
 // JobsContextEntry represents the result and outputs of a job in a reusable workflow.
 type JobsContextEntry struct {
 	// Result is the result of the job (success, failure, cancelled, or skipped).
-	Result string `json:"result"`
+	Result string `json:"result" values:"success,failure,cancelled,skipped"`
 	// Outputs contains the set of outputs of the job.
 	Outputs map[string]string `json:"outputs"`
 }
@@ -170,9 +172,9 @@ type StepsContextEntry struct {
 	// Outputs contains the set of outputs defined for the step.
 	Outputs map[string]string `json:"outputs"`
 	// Conclusion is the result of a completed step after continue-on-error is applied.
-	Conclusion string `json:"conclusion"`
+	Conclusion string `json:"conclusion" values:"success,failure,cancelled,skipped"`
 	// Outcome is the result of a completed step before continue-on-error is applied.
-	Outcome string `json:"outcome"`
+	Outcome string `json:"outcome" values:"success,failure,cancelled,skipped"`
 }
 
 // RunnerContext contains information about the runner that is executing the current job.
@@ -2,6 +2,7 @@ package expr
 
 import (
 	"cmp"
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -13,31 +14,39 @@ import (
 )
 
 type LowLevelEvaluator struct {
+	// ContextObject, when it isn't nil, holds the contexts instead of the EvalContext of the evaluator
 	ContextObject JSObject
 	Functions     FunctionStore
+	// Context is passed to the functions expressions call. nil means [context.Background].
+	Context context.Context
+	// Call is passed to the functions expressions call, with the name they are called by
+	Call CallContext
+
+	lazy *lazyContext
 }
 
+// NewLowLevelEvaluator returns an evaluator of expressions in evalContext. The contexts are converted to
+// JSValues when expressions first access them.
 func NewLowLevelEvaluator(evalContext *EvalContext, funcs FunctionStore) (*LowLevelEvaluator, error) {
-	contextObject, err := jsObjectFromEvalContext(evalContext)
-	if err != nil {
-		return nil, oops.Wrapf(err, "failed to parse EvalContext")
+	if evalContext == nil {
+		return nil, oops.New("EvalContext is nil")
 	}
 	return &LowLevelEvaluator{
-		ContextObject: contextObject,
-		Functions:     funcs,
+		Functions: funcs,
+		Call: CallContext{
+			Workspace: evalContext.Github.Workspace,
+			Job:       evalContext.Github.Job,
+		},
+		lazy: newLazyContext(evalContext),
 	}, nil
 }
 
-func jsObjectFromEvalContext(evalContext *EvalContext) (JSObject, error) {
-	jso, err := UnmarshalFromGo(*evalContext)
-	if err != nil {
-		return JSObject{}, err
-	}
-	if !jso.Object.IsPresent {
-		return JSObject{}, oops.New("EvalContext did not contain an object")
+// context returns the value of the context name
+func (e *LowLevelEvaluator) context(name string) (JSValue, error) {
+	if e.ContextObject != nil || e.lazy == nil {
+		return e.ContextObject.Access(JSPathSegment{String: Some(name)})
 	}
-
-	return jso.Object.Value, nil
+	return e.lazy.get(name)
 }
 
 func (e *LowLevelEvaluator) Evaluate(expression Node) (JSValue, error) {
@@ -48,6 +57,13 @@ func (e *LowLevelEvaluator) Evaluate(expression Node) (JSValue, error) {
 		if err != nil {
 			return JSValue{}, oops.Wrapf(err, "failed to evaluate access path")
 		}
+		if variable, ok := receiverNode.(*VariableNode); ok && e.ContextObject == nil && e.lazy != nil {
+			evaluated, err := e.lazy.access(variable.Name, jspath)
+			if err != nil {
+				return JSValue{}, oops.Wrapf(err, "failed to access path %s on %s", jspath.GoString(), variable.Name)
+			}
+			return evaluated, nil
+		}
 		receiver, err := e.Evaluate(receiverNode)
 		if err != nil {
 			return JSValue{}, oops.Wrapf(err, "failed to evaluate receiver of dereference")
@@ -59,7 +75,7 @@ func (e *LowLevelEvaluator) Evaluate(expression Node) (JSValue, error) {
 		return evaluated, nil
 
 	case *VariableNode:
-		v, err := e.ContextObject.Access(JSPathSegment{String: Some(expr.Name)})
+		v, err := e.context(expr.Name)
 		if err != nil {
 			return JSValue{}, err
 		}
@@ -197,8 +213,11 @@ func (e *LowLevelEvaluator) evaluateAccessPath(expression Node) (root Node, p JS
 }
 
 func (e *LowLevelEvaluator) evaluateFunctionCall(expr *FuncCallNode) (JSValue, error) {
-	if slices.Contains([]string{"success", "always", "cancelled", "failure"}, strings.ToLower(expr.Callee)) {
-		return e.evaluateStatusFunction(expr.Callee)
+	if err := e.Functions.CheckCall(expr); err != nil {
+		return JSValue{}, err
+	}
+	if IsStatusFunction(expr.Callee) {
+		return e.evaluateStatusFunction(expr)
 	}
 
 	args := make([]JSValue, len(expr.Args))
@@ -210,12 +229,17 @@ func (e *LowLevelEvaluator) evaluateFunctionCall(expr *FuncCallNode) (JSValue, e
 		args[i] = value
 	}
 
-	fn, ok := e.Functions[strings.ToLower(expr.Callee)]
-	if !ok {
-		return JSValue{}, oops.Errorf("function %s not found", expr.Callee)
+	ctx := e.Context
+	if ctx == nil {
+		ctx = context.Background()
 	}
-
-	v, err := fn(args...)
+	if err := ctx.Err(); err != nil {
+		return JSValue{}, oops.Wrapf(context.Cause(ctx), "calling %s", expr.Callee)
+	}
+	call := e.Call
+	call.Callee = expr.Callee
+	fn, _ := e.Functions.Get(expr.Callee)
+	v, err := fn(ctx, &call, args...)
 	if err != nil {
 		argsTypes := make([]string, len(args))
 		for i, arg := range args {
@@ -227,8 +251,65 @@ func (e *LowLevelEvaluator) evaluateFunctionCall(expr *FuncCallNode) (JSValue, e
 	return v, nil
 }
 
-func (e *LowLevelEvaluator) evaluateStatusFunction(callee string) (JSValue, error) {
-	panic("unimplemented")
+// IsStatusFunction reports whether name is one of success, failure, cancelled and always
+func IsStatusFunction(name string) bool {
+	_, ok := statusFunctions[strings.ToLower(name)]
+	return ok
+}
+
+// evaluateStatusFunction evaluates success(), failure(), cancelled() and always().
+// In a step they check the status of the job (job.status). In the `if` of a job, where there is no
+// job.status, they check the results of the jobs it needs, or of the ones passed as arguments.
+func (e *LowLevelEvaluator) evaluateStatusFunction(expr *FuncCallNode) (JSValue, error) {
+	callee := strings.ToLower(expr.Callee)
+	if callee == "always" {
+		return JSValue{Boolean: Some(true)}, nil
+	}
+
+	job, _ := e.context("job")
+	jobStatus, _ := job.Access(JSPathSegment{String: Some("status")})
+	if jobStatus.String.IsPresent && jobStatus.String.Value != "" {
+		if len(expr.Args) > 0 {
+			return JSValue{}, oops.Errorf("%s() takes job names only in the if of a job", expr.Callee)
+		}
+		return JSValue{Boolean: Some(jobStatus.String.Value == callee)}, nil
+	}
+
+	needs, _ := e.context("needs")
+	names := make([]string, 0, len(expr.Args))
+	for i, arg := range expr.Args {
+		value, err := e.Evaluate(arg)
+		if err != nil {
+			return JSValue{}, oops.Wrapf(err, "failed to evaluate argument %d", i)
+		}
+		name, err := castToString(value)
+		if err != nil {
+			return JSValue{}, oops.Wrapf(err, "argument %d of %s() is not a job name", i, expr.Callee)
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 && needs.Object.IsPresent {
+		for name := range needs.Object.Value {
+			names = append(names, name)
+		}
+	}
+
+	var results []string
+	for _, name := range names {
+		result, err := needs.Access(JSPathSegment{String: Some(name)}, JSPathSegment{String: Some("result")})
+		if err != nil || !result.String.IsPresent {
+			return JSValue{}, oops.Errorf("%s() refers to job %s, which is not in needs", expr.Callee, name)
+		}
+		results = append(results, result.String.Value)
+	}
+	switch callee {
+	case "success":
+		return JSValue{Boolean: Some(!slices.ContainsFunc(results, func(r string) bool { return r != "success" }))}, nil
+	case "failure":
+		return JSValue{Boolean: Some(slices.Contains(results, "failure"))}, nil
+	default: // cancelled
+		return JSValue{Boolean: Some(slices.Contains(results, "cancelled"))}, nil
+	}
 }
 
 // compareJSValues compares two JSValues and returns an integer indicating their order.
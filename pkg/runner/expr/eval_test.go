@@ -140,7 +140,7 @@ func TestEvaluate(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.expr, func(t *testing.T) {
-			evaluator, err := expr.NewLowLevelEvaluator(prContext(t), expr.DefaultFunctions)
+			evaluator, err := expr.NewLowLevelEvaluator(prContext(t), expr.DefaultFunctions())
 			if !assert.NoErrorf(t, err, "initializing evaluator") {
 				return
 			}
@@ -169,8 +169,32 @@ func TestEvaluate(t *testing.T) {
 	}
 }
 
+func TestEvaluateTemplate(t *testing.T) {
+	testCases := []struct {
+		template string
+		expected string
+	}{
+		{"no expressions", "no expressions"},
+		{"${{ github.actor }}", "octocat"},
+		{"deps-${{ github.actor }}-v1", "deps-octocat-v1"},
+		{"${{ github.job }}/${{ github.run_number }}", "build/15"},
+		{"ünïcode ${{ github.actor }} ✓", "ünïcode octocat ✓"},
+		{"$$ ${{ 'a' }}", "$$ a"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.template, func(t *testing.T) {
+			evaluator, err := expr.NewEvaluator(prContext(t))
+			require.NoError(t, err)
+			result, err := evaluator.EvaluateTemplate(tc.template)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
 // mustJSObject converts a map[string]any to expr.JSObject, failing the test on error.
-func mustJSObject(t *testing.T, m map[string]any) expr.JSObject {
+func mustJSObject(t testing.TB, m map[string]any) expr.JSObject {
 	t.Helper()
 	var obj expr.JSObject
 	err := obj.UnmarshalFromGoMap(m)
@@ -179,7 +203,7 @@ func mustJSObject(t *testing.T, m map[string]any) expr.JSObject {
 }
 
 // prContext returns a realistic EvalContext for a pull request workflow run.
-func prContext(t *testing.T) *expr.EvalContext {
+func prContext(t testing.TB) *expr.EvalContext {
 	t.Helper()
 	return &expr.EvalContext{
 		Github: expr.GithubContext{
@@ -323,3 +347,55 @@ func prContext(t *testing.T) *expr.EvalContext {
 		}),
 	}
 }
+
+func TestEvaluateCondition(t *testing.T) {
+	stepContext := func(status string) *expr.EvalContext {
+		return &expr.EvalContext{Job: expr.JobContext{Status: status}, Env: map[string]string{"DEPLOY": "yes"}}
+	}
+	jobContext := func(results map[string]string) *expr.EvalContext {
+		needs := make(map[string]expr.NeedsContext, len(results))
+		for name, result := range results {
+			needs[name] = expr.NeedsContext{Result: result}
+		}
+		return &expr.EvalContext{Needs: needs}
+	}
+
+	testCases := []struct {
+		name      string
+		context   *expr.EvalContext
+		condition string
+		expected  bool
+	}{
+		{"empty succeeded", stepContext("success"), "", true},
+		{"empty failed", stepContext("failure"), "", false},
+		{"implicit success", stepContext("success"), "env.DEPLOY == 'yes'", true},
+		{"implicit success when failed", stepContext("failure"), "env.DEPLOY == 'yes'", false},
+		{"wrapped", stepContext("success"), "${{ env.DEPLOY == 'no' }}", false},
+		{"always when failed", stepContext("failure"), "always()", true},
+		{"failure when failed", stepContext("failure"), "failure() && env.DEPLOY == 'yes'", true},
+		{"failure when succeeded", stepContext("success"), "failure()", false},
+		{"cancelled", stepContext("cancelled"), "cancelled()", true},
+		{"no needs", jobContext(nil), "", true},
+		{"needs succeeded", jobContext(map[string]string{"a": "success", "b": "success"}), "", true},
+		{"need failed", jobContext(map[string]string{"a": "success", "b": "failure"}), "", false},
+		{"need skipped", jobContext(map[string]string{"a": "skipped"}), "success()", false},
+		{"failure of need", jobContext(map[string]string{"a": "success", "b": "failure"}), "failure()", true},
+		{"success of a named need", jobContext(map[string]string{"a": "success", "b": "failure"}), "success('a')", true},
+		{"failure of a named need", jobContext(map[string]string{"a": "success", "b": "failure"}), "failure('a')", false},
+		{"cancelled need", jobContext(map[string]string{"a": "cancelled"}), "cancelled()", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			evaluator, err := expr.NewEvaluator(tc.context)
+			require.NoError(t, err)
+			got, err := evaluator.EvaluateCondition(tc.condition)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+
+	evaluator, err := expr.NewEvaluator(jobContext(map[string]string{"a": "success"}))
+	require.NoError(t, err)
+	_, err = evaluator.EvaluateCondition("success('missing')")
+	assert.Error(t, err, "a job that isn't needed")
+}
@@ -4,6 +4,7 @@
 package expr
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -213,14 +214,28 @@ The `!wasseq` check prevents the code from accidentally flattening arrays that y
 */
 
 type Evaluator struct {
+	// Templates caches the templates and conditions the evaluator compiles. nil compiles them on every call.
+	Templates *TemplateCache
+
 	ll *LowLevelEvaluator
 }
 
+// NewEvaluator returns an evaluator of expressions in evalContext that call the functions of GitHub Actions
 func NewEvaluator(evalContext *EvalContext) (*Evaluator, error) {
-	ll, err := NewLowLevelEvaluator(evalContext, DefaultFunctions)
+	return NewEvaluatorWithFunctions(context.Background(), evalContext, nil)
+}
+
+// NewEvaluatorWithFunctions returns an evaluator of expressions in evalContext that call functions,
+// or the functions of GitHub Actions if it's nil. ctx is passed to the functions.
+func NewEvaluatorWithFunctions(ctx context.Context, evalContext *EvalContext, functions FunctionStore) (*Evaluator, error) {
+	if functions == nil {
+		functions = defaultFunctions
+	}
+	ll, err := NewLowLevelEvaluator(evalContext, functions)
 	if err != nil {
 		return nil, err
 	}
+	ll.Context = ctx
 	return &Evaluator{
 		ll: ll,
 	}, nil
@@ -228,47 +243,70 @@ func NewEvaluator(evalContext *EvalContext) (*Evaluator, error) {
 
 // EvaluateTemplate evaluates a string that might contain expressions surrounded by `${{ }}`
 func (e *Evaluator) EvaluateTemplate(template string) (string, error) {
-	const dollarDollar = "\x00DOLOAR_DOLLAR\x00"
-	escapedTemplate := strings.ReplaceAll(template, "$$", dollarDollar)
 	if !strings.Contains(template, "${{") {
 		return template, nil
 	}
+	compiled, err := e.Templates.Template(template)
+	if err != nil {
+		return "", err
+	}
+	return e.EvaluateCompiledTemplate(compiled)
+}
 
-	asRunes := []rune(escapedTemplate)
+// EvaluateCompiledTemplate evaluates a template compiled with [CompileTemplate]
+func (e *Evaluator) EvaluateCompiledTemplate(template *CompiledTemplate) (string, error) {
+	if len(template.parts) == 1 && template.parts[0].expr == nil {
+		return template.parts[0].text, nil
+	}
 	result := strings.Builder{}
-	for {
-		openingIdx := strings.Index(string(asRunes), "${{")
-		if openingIdx == -1 {
-			result.WriteString(string(asRunes))
-			break
-		}
-		asRunes = asRunes[openingIdx+len("${{"):]
-		closingIdx := strings.Index(string(asRunes), "}}")
-		if closingIdx == -1 {
-			return "", oops.Errorf("can't find closing braces for ${{%s", string(asRunes))
+	for _, part := range template.parts {
+		if part.expr == nil {
+			result.WriteString(part.text)
+			continue
 		}
-		// note the parser expects the closing }}
-		expr, rest := string(asRunes[:closingIdx+len("}}")]), asRunes[closingIdx+len("}}"):]
-		asRunes = rest
-
-		expr = strings.ReplaceAll(expr, dollarDollar, "$$")
-		parsed, perr := NewParser().Parse(NewExprLexer(expr))
-		if perr != nil {
-			return "", oops.Wrapf(perr, "parsing expression ${{%s", expr)
-		}
-		evaled, err := e.ll.Evaluate(parsed)
+		evaled, err := e.ll.Evaluate(part.expr)
 		if err != nil {
-			return "", oops.Wrapf(err, "evaluating expression ${{%s", expr)
+			return "", &ExpressionError{Offset: part.offset, Err: oops.Wrapf(err, "evaluating expression ${{%s", part.text)}
 		}
 		coerced, err := castToString(evaled)
 		if err != nil {
-			return "", oops.Wrapf(err, "coercing expression to string ${{%s", expr)
+			return "", &ExpressionError{Offset: part.offset, Err: oops.Wrapf(err, "coercing expression to string ${{%s", part.text)}
 		}
 		result.WriteString(coerced)
 	}
+	return result.String(), nil
+}
 
-	final := strings.ReplaceAll(result.String(), dollarDollar, "$$")
-	return final, nil
+// EvaluatePartialTemplate evaluates the expressions of template that known accepts, and keeps the others as they
+// are in template, in their `${{ }}`. It shows templates whose expressions depend on values that aren't known yet.
+func (e *Evaluator) EvaluatePartialTemplate(template string, known func(Node) bool) (string, error) {
+	if !strings.Contains(template, "${{") {
+		return template, nil
+	}
+	compiled, err := e.Templates.Template(template)
+	if err != nil {
+		return "", err
+	}
+	result := strings.Builder{}
+	for _, part := range compiled.parts {
+		switch {
+		case part.expr == nil:
+			result.WriteString(part.text)
+		case !known(part.expr):
+			result.WriteString("${{" + part.text)
+		default:
+			evaled, err := e.ll.Evaluate(part.expr)
+			if err != nil {
+				return "", &ExpressionError{Offset: part.offset, Err: oops.Wrapf(err, "evaluating expression ${{%s", part.text)}
+			}
+			coerced, err := castToString(evaled)
+			if err != nil {
+				return "", &ExpressionError{Offset: part.offset, Err: oops.Wrapf(err, "coercing expression to string ${{%s", part.text)}
+			}
+			result.WriteString(coerced)
+		}
+	}
+	return result.String(), nil
 }
 
 // EvaluateExpression evaluates a string that might be an expression or a template. Used in e.g 'if'.
@@ -279,3 +317,57 @@ func (e *Evaluator) EvaluateExpression(expressionOrTemplate string) (string, err
 
 	return e.EvaluateTemplate(expressionOrTemplate)
 }
+
+// EvaluateValue evaluates an expression, with or without `${{ }}`, to its value.
+// Templates with text around their expressions evaluate to the string EvaluateTemplate returns.
+func (e *Evaluator) EvaluateValue(expressionOrTemplate string) (JSValue, error) {
+	trimmed := strings.TrimSpace(expressionOrTemplate)
+	if !strings.Contains(trimmed, "${{") {
+		trimmed = fmt.Sprintf("${{ %s }}", trimmed)
+	}
+	compiled, err := e.Templates.Template(trimmed)
+	if err != nil {
+		return JSValue{}, err
+	}
+	if len(compiled.parts) == 1 && compiled.parts[0].expr != nil {
+		evaled, err := e.ll.Evaluate(compiled.parts[0].expr)
+		if err != nil {
+			return JSValue{}, &ExpressionError{Offset: compiled.parts[0].offset, Err: oops.Wrapf(err, "evaluating expression ${{%s", compiled.parts[0].text)}
+		}
+		return evaled, nil
+	}
+	result, err := e.EvaluateCompiledTemplate(compiled)
+	if err != nil {
+		return JSValue{}, err
+	}
+	return JSValue{String: Some(result)}, nil
+}
+
+// EvaluateCondition evaluates the `if` of a job or a step. Like in GitHub, a condition that doesn't call
+// a status function only passes when success() does, as if it was `success() && (condition)`.
+// An empty condition is success().
+func (e *Evaluator) EvaluateCondition(condition string) (bool, error) {
+	compiled, err := e.Templates.Condition(condition)
+	if err != nil {
+		return false, err
+	}
+	return e.EvaluateCompiledCondition(compiled)
+}
+
+// EvaluateCompiledCondition evaluates a condition compiled with [CompileCondition]
+func (e *Evaluator) EvaluateCompiledCondition(condition *CompiledCondition) (bool, error) {
+	if !condition.callsStatus {
+		succeeded, err := e.ll.Evaluate(&FuncCallNode{Callee: "success", tok: condition.expr.Token()})
+		if err != nil {
+			return false, &ExpressionError{Offset: condition.offset, Err: oops.Wrapf(err, "evaluating condition %s", condition.Source)}
+		}
+		if !succeeded.toBool() {
+			return false, nil
+		}
+	}
+	evaled, err := e.ll.Evaluate(condition.expr)
+	if err != nil {
+		return false, &ExpressionError{Offset: condition.offset, Err: oops.Wrapf(err, "evaluating condition %s", condition.Source)}
+	}
+	return evaled.toBool(), nil
+}
@@ -0,0 +1,181 @@
+package expr
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/samber/oops"
+	"gopkg.in/yaml.v3"
+)
+
+// extensionFunctions are the better-actions functions. Workflows that call them don't run on GitHub.
+var extensionFunctions = sync.OnceValue(func() FunctionStore {
+	fs := FunctionStore{}
+	fs.Add("fromYAML", 1, 1, funcFromYAML)
+	fs.Add("toLower", 1, 1, funcToLower)
+	fs.Add("replace", 3, 3, funcReplace)
+	fs.Add("split", 2, 2, funcSplit)
+	fs.Add("keys", 1, 1, funcKeys)
+	fs.Add("length", 1, 1, funcLength)
+	fs.Add("coalesce", 1, math.MaxInt, funcCoalesce)
+	for name, f := range fs {
+		f.Extension = true
+		fs[name] = f
+	}
+	return fs
+})
+
+// ExtendedFunctions returns a new store with the functions of GitHub Actions and the better-actions extensions:
+// fromYAML, toLower, replace, split, keys, length and coalesce.
+// GitHub doesn't have the extensions, so workflows that call them only run with bact.
+func ExtendedFunctions() FunctionStore {
+	fs := DefaultFunctions()
+	for name, f := range extensionFunctions() {
+		fs[name] = f
+	}
+	return fs
+}
+
+// funcFromYAML implements the fromYAML(value) extension.
+// Returns the value of the YAML document in value, like fromJSON does for JSON.
+func funcFromYAML(_ context.Context, _ *CallContext, args ...JSValue) (JSValue, error) {
+	yamlStr, err := castToString(args[0])
+	if err != nil {
+		return JSValue{}, oops.Wrapf(err, "fromYAML: cannot cast value to string")
+	}
+
+	var goValue any
+	if err := yaml.Unmarshal([]byte(yamlStr), &goValue); err != nil {
+		return JSValue{}, oops.Wrapf(err, "fromYAML: failed to parse YAML")
+	}
+
+	result, err := UnmarshalFromGo(fromYAMLValue(goValue))
+	if err != nil {
+		return JSValue{}, oops.Wrapf(err, "fromYAML: failed to convert to JSValue")
+	}
+	return result, nil
+}
+
+// fromYAMLValue converts the values YAML decodes that JSON doesn't have, like mappings with keys that
+// aren't strings and timestamps, to the ones it has
+func fromYAMLValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = fromYAMLValue(value)
+		}
+		return v
+	case map[any]any:
+		converted := make(map[string]any, len(v))
+		for key, value := range v {
+			converted[fmt.Sprint(key)] = fromYAMLValue(value)
+		}
+		return converted
+	case []any:
+		for i, value := range v {
+			v[i] = fromYAMLValue(value)
+		}
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return v
+	}
+}
+
+// funcToLower implements the toLower(value) extension.
+// Returns value cast to a string, in lower case.
+func funcToLower(_ context.Context, _ *CallContext, args ...JSValue) (JSValue, error) {
+	str, err := castToString(args[0])
+	if err != nil {
+		return JSValue{}, oops.Wrapf(err, "toLower: cannot cast value to string")
+	}
+	return JSValue{String: Some(strings.ToLower(str))}, nil
+}
+
+// funcReplace implements the replace(value, old, new) extension.
+// Returns value with every occurrence of old replaced by new. This function is case sensitive.
+func funcReplace(_ context.Context, _ *CallContext, args ...JSValue) (JSValue, error) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		str, err := castToString(arg)
+		if err != nil {
+			return JSValue{}, oops.Wrapf(err, "replace: cannot cast argument %d to string", i)
+		}
+		strs[i] = str
+	}
+	return JSValue{String: Some(strings.ReplaceAll(strs[0], strs[1], strs[2]))}, nil
+}
+
+// funcSplit implements the split(value, separator) extension.
+// Returns the array of the parts of value between the occurrences of separator.
+func funcSplit(_ context.Context, _ *CallContext, args ...JSValue) (JSValue, error) {
+	str, err := castToString(args[0])
+	if err != nil {
+		return JSValue{}, oops.Wrapf(err, "split: cannot cast value to string")
+	}
+	separator, err := castToString(args[1])
+	if err != nil {
+		return JSValue{}, oops.Wrapf(err, "split: cannot cast separator to string")
+	}
+
+	parts := strings.Split(str, separator)
+	arr := make(JSArray, len(parts))
+	for i, part := range parts {
+		arr[i] = JSValue{String: Some(part)}
+	}
+	return JSValue{Array: Some(arr)}, nil
+}
+
+// funcKeys implements the keys(object) extension.
+// Returns the sorted array of the property names of object.
+func funcKeys(_ context.Context, _ *CallContext, args ...JSValue) (JSValue, error) {
+	if !args[0].Object.IsPresent {
+		return JSValue{}, oops.Errorf("keys: argument must be an object, got %#v", args[0])
+	}
+
+	names := make([]string, 0, len(args[0].Object.Value))
+	for name := range args[0].Object.Value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	arr := make(JSArray, len(names))
+	for i, name := range names {
+		arr[i] = JSValue{String: Some(name)}
+	}
+	return JSValue{Array: Some(arr)}, nil
+}
+
+// funcLength implements the length(value) extension.
+// Returns the number of characters of strings, elements of arrays and properties of objects.
+func funcLength(_ context.Context, _ *CallContext, args ...JSValue) (JSValue, error) {
+	v := args[0]
+	switch {
+	case v.String.IsPresent:
+		return JSValue{Int: Some(int64(utf8.RuneCountInString(v.String.Value)))}, nil
+	case v.Array.IsPresent:
+		return JSValue{Int: Some(int64(len(v.Array.Value)))}, nil
+	case v.Object.IsPresent:
+		return JSValue{Int: Some(int64(len(v.Object.Value)))}, nil
+	default:
+		return JSValue{}, oops.Errorf("length: argument must be a string, an array or an object, got %#v", v)
+	}
+}
+
+// funcCoalesce implements the coalesce(value, ...) extension.
+// Returns the first value that isn't null or an empty string, or null if there is none.
+func funcCoalesce(_ context.Context, _ *CallContext, args ...JSValue) (JSValue, error) {
+	for _, arg := range args {
+		if arg.Null.IsPresent || arg.Undefined.IsPresent || (arg.String.IsPresent && arg.String.Value == "") {
+			continue
+		}
+		return arg, nil
+	}
+	return JSValue{Null: Some(struct{}{})}, nil
+}
@@ -0,0 +1,93 @@
+package expr_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/runner/expr"
+)
+
+func TestExtendedFunctions(t *testing.T) {
+	evaluator, err := expr.NewEvaluatorWithFunctions(t.Context(), prContext(t), expr.ExtendedFunctions())
+	require.NoError(t, err)
+
+	testCases := []struct {
+		expr     string
+		expected string
+		wantErr  string
+	}{
+		{expr: "fromYAML('a: 1\nb: [x, y]').a", expected: "1"},
+		{expr: "toJSON(fromYAML('a: 1\nb: [x, y]').b)", expected: "[\n  \"x\",\n  \"y\"\n]"},
+		{expr: "fromYAML('1: one')['1']", expected: "one"},
+		{expr: "fromYAML('a: [')", wantErr: "fromYAML: failed to parse YAML"},
+		{expr: "toLower(github.repository_owner)", expected: "octocat"},
+		{expr: "toLower('MiXeD')", expected: "mixed"},
+		{expr: "replace(github.head_ref, '/', '-')", expected: "feature-awesome"},
+		{expr: "join(split('a,b,c', ','), ' ')", expected: "a b c"},
+		{expr: "join(keys(matrix), ',')", expected: "node-version,os"},
+		{expr: "keys('a')", wantErr: "keys: argument must be an object"},
+		{expr: "length('ünï')", expected: "3"},
+		{expr: "length(split('a,b', ','))", expected: "2"},
+		{expr: "length(matrix)", expected: "2"},
+		{expr: "length(1)", wantErr: "length: argument must be a string, an array or an object"},
+		{expr: "coalesce(null, '', env.MISSING, vars.APP_NAME, 'default')", expected: "hello-world"},
+		{expr: "coalesce(null, false)", expected: "false"},
+		{expr: "coalesce(null) == null", expected: "true"},
+		// the functions of GitHub are still there
+		{expr: "format('{0}!', toLower('HI'))", expected: "hi!"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			result, err := evaluator.EvaluateExpression(tc.expr)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+
+	for name, f := range expr.ExtendedFunctions() {
+		_, isDefault := expr.DefaultFunctions()[name]
+		assert.Equal(t, !isDefault, f.Extension, "function %s", f.Name)
+	}
+}
+
+func TestExtendedFunctionsAreOptIn(t *testing.T) {
+	evaluator, err := expr.NewEvaluator(prContext(t))
+	require.NoError(t, err)
+	_, err = evaluator.EvaluateExpression("toLower('A')")
+	assert.ErrorContains(t, err, "unknown function call toLower, it is a better-actions extension that isn't enabled")
+}
+
+func TestCallContext(t *testing.T) {
+	var got expr.CallContext
+	functions := expr.DefaultFunctions()
+	functions.Add("where", 0, 0, func(ctx context.Context, call *expr.CallContext, _ ...expr.JSValue) (expr.JSValue, error) {
+		got = *call
+		return expr.JSValue{String: expr.Some(call.Workspace)}, nil
+	})
+	// the store of the evaluator is its own
+	_, ok := expr.DefaultFunctions().Get("where")
+	assert.False(t, ok)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	evaluator, err := expr.NewEvaluatorWithFunctions(ctx, prContext(t), functions)
+	require.NoError(t, err)
+	result, err := evaluator.EvaluateTemplate("${{ WHERE() }}")
+	require.NoError(t, err)
+	assert.Equal(t, "/home/runner/work/hello-world/hello-world", result)
+	assert.Equal(t, expr.CallContext{
+		Callee:    "WHERE",
+		Workspace: "/home/runner/work/hello-world/hello-world",
+		Job:       "build",
+	}, got)
+
+	cancel()
+	_, err = evaluator.EvaluateTemplate("${{ where() }}")
+	assert.ErrorIs(t, err, context.Canceled)
+}
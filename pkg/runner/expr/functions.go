@@ -1,11 +1,13 @@
 package expr
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json/jsontext"
 	"encoding/json/v2"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -18,34 +20,100 @@ import (
 
 type (
 	// Function is a wrapper around the non-status (aka normal) functions
-	// you can call from templates.
-	Function      func(args ...JSValue) (JSValue, error)
-	FunctionStore map[string]Function
+	// you can call from templates. ctx is canceled when the run is, and carries its logger.
+	Function func(ctx context.Context, call *CallContext, args ...JSValue) (JSValue, error)
+	// FunctionStore holds functions by their lower cased name, with the number of arguments they take.
+	// The same store is used to validate expressions and to evaluate them, so they agree.
+	FunctionStore map[string]StoredFunction
 )
 
-var DefaultFunctions = FunctionStore{}
-
-func init() {
-	DefaultFunctions.Add("contains", funcContains)
-	DefaultFunctions.Add("startsWith", funcStartsWith)
-	DefaultFunctions.Add("endsWith", funcEndsWith)
-	DefaultFunctions.Add("format", funcFormat)
-	DefaultFunctions.Add("join", funcJoin)
-	DefaultFunctions.Add("toJSON", funcToJSON)
-	DefaultFunctions.Add("fromJSON", funcFromJSON)
-	DefaultFunctions.Add("hashFiles", funcHashFiles)
+// CallContext is what a [Function] knows about the expression that calls it
+type CallContext struct {
+	// Callee is the name the function is called by
+	Callee string
+	// Workspace is the directory of the files of the job, github.workspace. hashFiles matches files in it.
+	Workspace string
+	// Job is the id of the job the expression is evaluated for, github.job. It is empty outside of jobs.
+	Job string
 }
 
-func (fs FunctionStore) Add(name string, f Function) {
-	fs[strings.ToLower(name)] = f
+// StoredFunction is a [Function] of a [FunctionStore]
+type StoredFunction struct {
+	// Name is the name the function was added with
+	Name    string
+	Func    Function
+	MinArgs int
+	// MaxArgs is [math.MaxInt] for functions that take any number of arguments
+	MaxArgs int
+	// Extension is set for the better-actions functions that GitHub doesn't have, see [ExtendedFunctions]
+	Extension bool
+}
+
+// defaultFunctions are the functions of evaluators and schemas that aren't given a [FunctionStore].
+// They must not be modified.
+var defaultFunctions = DefaultFunctions()
+
+// DefaultFunctions returns a new store with the functions of GitHub Actions.
+// Embedders may add their own functions to it, and pass it to [NewEvaluatorWithFunctions].
+func DefaultFunctions() FunctionStore {
+	fs := FunctionStore{}
+	fs.Add("contains", 2, 2, funcContains)
+	fs.Add("startsWith", 2, 2, funcStartsWith)
+	fs.Add("endsWith", 2, 2, funcEndsWith)
+	fs.Add("format", 1, math.MaxInt, funcFormat)
+	fs.Add("join", 1, 2, funcJoin)
+	fs.Add("toJSON", 1, 1, funcToJSON)
+	fs.Add("fromJSON", 1, 1, funcFromJSON)
+	fs.Add("hashFiles", 1, math.MaxInt, funcHashFiles)
+	return fs
+}
+
+// statusFunctions are the arities of the status functions, which the evaluator implements itself
+var statusFunctions = FunctionStore{
+	"success":   {Name: "success", MaxArgs: math.MaxInt},
+	"failure":   {Name: "failure", MaxArgs: math.MaxInt},
+	"cancelled": {Name: "cancelled", MaxArgs: math.MaxInt},
+	"always":    {Name: "always"},
+}
+
+// Add adds f as name, taking between minArgs and maxArgs arguments
+func (fs FunctionStore) Add(name string, minArgs, maxArgs int, f Function) {
+	fs[strings.ToLower(name)] = StoredFunction{Name: name, Func: f, MinArgs: minArgs, MaxArgs: maxArgs}
 }
 
 func (fs FunctionStore) Get(name string) (Function, bool) {
+	f, ok := fs[strings.ToLower(name)]
+	return f.Func, ok
+}
+
+// Lookup returns the function name of the store, or the status function name
+func (fs FunctionStore) Lookup(name string) (StoredFunction, bool) {
+	if f, ok := statusFunctions[strings.ToLower(name)]; ok {
+		return f, true
+	}
 	f, ok := fs[strings.ToLower(name)]
 	return f, ok
 }
 
-func funcTODOUnimplemented(_ ...JSValue) (JSValue, error) {
+// CheckCall checks that call calls a function of the store, or a status function,
+// with the number of arguments it takes
+func (fs FunctionStore) CheckCall(call *FuncCallNode) error {
+	f, ok := fs.Lookup(call.Callee)
+	if !ok {
+		if _, ok := extensionFunctions()[strings.ToLower(call.Callee)]; ok {
+			return oops.Errorf("unknown function call %s, it is a better-actions extension that isn't enabled", call.Callee)
+		}
+		return oops.Errorf("unknown function call %s", call.Callee)
+	}
+	if args := len(call.Args); args < f.MinArgs {
+		return oops.Errorf("missing parameters for %s expected >= %v got %v", call.Callee, f.MinArgs, args)
+	} else if args > f.MaxArgs {
+		return oops.Errorf("too many parameters for %s expected <= %v got %v", call.Callee, f.MaxArgs, args)
+	}
+	return nil
+}
+
+func funcTODOUnimplemented(_ context.Context, _ *CallContext, _ ...JSValue) (JSValue, error) {
 	return JSValue{}, oops.Errorf("function is not implemented")
 }
 
@@ -91,7 +159,7 @@ func castToString(v JSValue) (string, error) {
 // If search is an array, returns true if item is an element in the array.
 // If search is a string, returns true if item is a substring.
 // This function is not case sensitive.
-func funcContains(args ...JSValue) (JSValue, error) {
+func funcContains(_ context.Context, _ *CallContext, args ...JSValue) (JSValue, error) {
 	if len(args) < 2 {
 		return JSValue{}, oops.Errorf("contains requires 2 arguments, got %d", len(args))
 	}
@@ -162,7 +230,7 @@ func equalJSValues(a, b JSValue) bool {
 // funcStartsWith implements the startsWith(searchString, searchValue) function.
 // Returns true when searchString starts with searchValue.
 // This function is not case sensitive. Casts values to a string.
-func funcStartsWith(args ...JSValue) (JSValue, error) {
+func funcStartsWith(_ context.Context, _ *CallContext, args ...JSValue) (JSValue, error) {
 	if len(args) < 2 {
 		return JSValue{}, oops.Errorf("startsWith requires 2 arguments, got %d", len(args))
 	}
@@ -184,7 +252,7 @@ func funcStartsWith(args ...JSValue) (JSValue, error) {
 // funcEndsWith implements the endsWith(searchString, searchValue) function.
 // Returns true if searchString ends with searchValue.
 // This function is not case sensitive. Casts values to a string.
-func funcEndsWith(args ...JSValue) (JSValue, error) {
+func funcEndsWith(_ context.Context, _ *CallContext, args ...JSValue) (JSValue, error) {
 	if len(args) < 2 {
 		return JSValue{}, oops.Errorf("endsWith requires 2 arguments, got %d", len(args))
 	}
@@ -207,7 +275,7 @@ func funcEndsWith(args ...JSValue) (JSValue, error) {
 // Replaces values in the string, with the variable replaceValueN.
 // Variables in the string are specified using the {N} syntax, where N is an integer.
 // Escape curly braces using double braces.
-func funcFormat(args ...JSValue) (JSValue, error) {
+func funcFormat(_ context.Context, _ *CallContext, args ...JSValue) (JSValue, error) {
 	if len(args) < 1 {
 		return JSValue{}, oops.Errorf("format requires at least 1 argument, got %d", len(args))
 	}
@@ -274,7 +342,7 @@ func funcFormat(args ...JSValue) (JSValue, error) {
 // All values in array are concatenated into a string.
 // If optionalSeparator is provided, it is inserted between the concatenated values.
 // Otherwise, the default separator ',' is used. Casts values to a string.
-func funcJoin(args ...JSValue) (JSValue, error) {
+func funcJoin(_ context.Context, _ *CallContext, args ...JSValue) (JSValue, error) {
 	if len(args) < 1 {
 		return JSValue{}, oops.Errorf("join requires at least 1 argument, got %d", len(args))
 	}
@@ -317,7 +385,7 @@ func funcJoin(args ...JSValue) (JSValue, error) {
 
 // funcToJSON implements the toJSON(value) function.
 // Returns a pretty-print JSON representation of value.
-func funcToJSON(args ...JSValue) (JSValue, error) {
+func funcToJSON(_ context.Context, _ *CallContext, args ...JSValue) (JSValue, error) {
 	if len(args) < 1 {
 		return JSValue{}, oops.Errorf("toJSON requires 1 argument, got %d", len(args))
 	}
@@ -332,7 +400,7 @@ func funcToJSON(args ...JSValue) (JSValue, error) {
 
 // funcFromJSON implements the fromJSON(value) function.
 // Returns a JSON object or JSON data type for value.
-func funcFromJSON(args ...JSValue) (JSValue, error) {
+func funcFromJSON(_ context.Context, _ *CallContext, args ...JSValue) (JSValue, error) {
 	if len(args) < 1 {
 		return JSValue{}, oops.Errorf("fromJSON requires 1 argument, got %d", len(args))
 	}
@@ -355,25 +423,17 @@ func funcFromJSON(args ...JSValue) (JSValue, error) {
 	return result, nil
 }
 
-// hashFilesWorkspace is the base directory for hashFiles.
-// It can be overridden for testing or by setting GITHUB_WORKSPACE.
-var hashFilesWorkspace = ""
-
 // funcHashFiles implements the hashFiles(path) function.
 // Returns a single hash for the set of files that matches the path pattern.
 // You can provide a single path pattern or multiple path patterns.
-// The path is relative to the GITHUB_WORKSPACE directory.
-func funcHashFiles(args ...JSValue) (JSValue, error) {
+// The path is relative to the workspace of the call, or to the current directory if it has none.
+func funcHashFiles(ctx context.Context, call *CallContext, args ...JSValue) (JSValue, error) {
 	if len(args) < 1 {
 		return JSValue{}, oops.Errorf("hashFiles requires at least 1 argument, got %d", len(args))
 	}
 
-	workspace := hashFilesWorkspace
-	if workspace == "" {
-		workspace = os.Getenv("GITHUB_WORKSPACE")
-	}
+	workspace := call.Workspace
 	if workspace == "" {
-		// Default to current directory if GITHUB_WORKSPACE is not set
 		var err error
 		workspace, err = os.Getwd()
 		if err != nil {
@@ -392,7 +452,7 @@ func funcHashFiles(args ...JSValue) (JSValue, error) {
 	}
 
 	// Find all matching files
-	matchedFiles, err := matchFilesWithPatterns(workspace, patterns)
+	matchedFiles, err := matchFilesWithPatterns(ctx, workspace, patterns)
 	if err != nil {
 		return JSValue{}, oops.Wrapf(err, "hashFiles: error matching files")
 	}
@@ -427,7 +487,7 @@ func funcHashFiles(args ...JSValue) (JSValue, error) {
 
 // matchFilesWithPatterns finds all files matching the given glob patterns.
 // Patterns starting with ! are exclusion patterns.
-func matchFilesWithPatterns(workspace string, patterns []string) ([]string, error) {
+func matchFilesWithPatterns(ctx context.Context, workspace string, patterns []string) ([]string, error) {
 	included := make(map[string]bool)
 	excluded := make(map[string]bool)
 
@@ -448,7 +508,7 @@ func matchFilesWithPatterns(workspace string, patterns []string) ([]string, erro
 
 		// For ** patterns, we need to do a recursive walk
 		if strings.Contains(pattern, "**") {
-			matches, err = doubleStarGlob(workspace, pattern)
+			matches, err = doubleStarGlob(ctx, workspace, pattern)
 			if err != nil {
 				return nil, oops.Wrapf(err, "error in recursive glob: %s", pattern)
 			}
@@ -484,7 +544,7 @@ func matchFilesWithPatterns(workspace string, patterns []string) ([]string, erro
 }
 
 // doubleStarGlob handles ** glob patterns by walking the directory tree
-func doubleStarGlob(workspace, pattern string) ([]string, error) {
+func doubleStarGlob(ctx context.Context, workspace, pattern string) ([]string, error) {
 	var matches []string
 
 	// Convert ** pattern to a regex
@@ -495,6 +555,9 @@ func doubleStarGlob(workspace, pattern string) ([]string, error) {
 	}
 
 	err = filepath.Walk(workspace, func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
 		if err != nil {
 			return nil // Skip files we can't access
 		}
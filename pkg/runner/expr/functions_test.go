@@ -1,6 +1,7 @@
 package expr_test
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -102,10 +103,10 @@ func TestFuncContains(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			fn, ok := expr.DefaultFunctions.Get("contains")
+			fn, ok := expr.DefaultFunctions().Get("contains")
 			require.True(t, ok, "contains function should exist")
 
-			result, err := fn(tc.args...)
+			result, err := fn(t.Context(), &expr.CallContext{}, tc.args...)
 			if tc.wantErr {
 				assert.Error(t, err)
 				return
@@ -176,10 +177,10 @@ func TestFuncStartsWith(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			fn, ok := expr.DefaultFunctions.Get("startsWith")
+			fn, ok := expr.DefaultFunctions().Get("startsWith")
 			require.True(t, ok, "startsWith function should exist")
 
-			result, err := fn(tc.args...)
+			result, err := fn(t.Context(), &expr.CallContext{}, tc.args...)
 			if tc.wantErr {
 				assert.Error(t, err)
 				return
@@ -250,10 +251,10 @@ func TestFuncEndsWith(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			fn, ok := expr.DefaultFunctions.Get("endsWith")
+			fn, ok := expr.DefaultFunctions().Get("endsWith")
 			require.True(t, ok, "endsWith function should exist")
 
-			result, err := fn(tc.args...)
+			result, err := fn(t.Context(), &expr.CallContext{}, tc.args...)
 			if tc.wantErr {
 				assert.Error(t, err)
 				return
@@ -336,10 +337,10 @@ func TestFuncFormat(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			fn, ok := expr.DefaultFunctions.Get("format")
+			fn, ok := expr.DefaultFunctions().Get("format")
 			require.True(t, ok, "format function should exist")
 
-			result, err := fn(tc.args...)
+			result, err := fn(t.Context(), &expr.CallContext{}, tc.args...)
 			if tc.wantErr {
 				assert.Error(t, err)
 				return
@@ -425,10 +426,10 @@ func TestFuncJoin(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			fn, ok := expr.DefaultFunctions.Get("join")
+			fn, ok := expr.DefaultFunctions().Get("join")
 			require.True(t, ok, "join function should exist")
 
-			result, err := fn(tc.args...)
+			result, err := fn(t.Context(), &expr.CallContext{}, tc.args...)
 			if tc.wantErr {
 				assert.Error(t, err)
 				return
@@ -505,10 +506,10 @@ func TestFuncToJSON(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			fn, ok := expr.DefaultFunctions.Get("toJSON")
+			fn, ok := expr.DefaultFunctions().Get("toJSON")
 			require.True(t, ok, "toJSON function should exist")
 
-			result, err := fn(tc.args...)
+			result, err := fn(t.Context(), &expr.CallContext{}, tc.args...)
 			if tc.wantErr {
 				assert.Error(t, err)
 				return
@@ -634,10 +635,10 @@ func TestFuncFromJSON(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			fn, ok := expr.DefaultFunctions.Get("fromJSON")
+			fn, ok := expr.DefaultFunctions().Get("fromJSON")
 			require.True(t, ok, "fromJSON function should exist")
 
-			result, err := fn(tc.args...)
+			result, err := fn(t.Context(), &expr.CallContext{}, tc.args...)
 			if tc.wantErr {
 				assert.Error(t, err)
 				return
@@ -677,12 +678,8 @@ func TestFuncHashFiles(t *testing.T) {
 		require.NoError(t, err)
 	}
 
-	// Set the workspace for testing
-	originalWorkspace := os.Getenv("GITHUB_WORKSPACE")
-	t.Cleanup(func() {
-		os.Setenv("GITHUB_WORKSPACE", originalWorkspace)
-	})
-	os.Setenv("GITHUB_WORKSPACE", tmpDir)
+	// hashFiles matches files in the workspace of the call
+	call := &expr.CallContext{Callee: "hashFiles", Workspace: tmpDir}
 
 	testCases := []struct {
 		name              string
@@ -746,10 +743,10 @@ func TestFuncHashFiles(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			fn, ok := expr.DefaultFunctions.Get("hashFiles")
+			fn, ok := expr.DefaultFunctions().Get("hashFiles")
 			require.True(t, ok, "hashFiles function should exist")
 
-			result, err := fn(tc.args...)
+			result, err := fn(t.Context(), call, tc.args...)
 			if tc.wantErr {
 				assert.Error(t, err)
 				return
@@ -770,13 +767,13 @@ func TestFuncHashFiles(t *testing.T) {
 
 			if tc.expectConsistent {
 				// Run again to verify consistency
-				result2, err := fn(tc.args...)
+				result2, err := fn(t.Context(), call, tc.args...)
 				require.NoError(t, err)
 				assert.Equal(t, result.String.Value, result2.String.Value, "hash should be consistent")
 			}
 
 			if tc.compareWithSecond != nil {
-				result2, err := fn(tc.compareWithSecond...)
+				result2, err := fn(t.Context(), call, tc.compareWithSecond...)
 				require.NoError(t, err)
 				assert.NotEqual(t, result.String.Value, result2.String.Value, "different files should produce different hashes")
 			}
@@ -801,9 +798,44 @@ func TestFunctionStoreCaseInsensitive(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			fn, ok := expr.DefaultFunctions.Get(tc.funcName)
+			fn, ok := expr.DefaultFunctions().Get(tc.funcName)
 			assert.True(t, ok, "function %s should be found", tc.funcName)
 			assert.NotNil(t, fn)
 		})
 	}
 }
+
+// calls are checked against the arity of the store before they run, like when workflows are validated
+func TestFunctionStoreCheckCall(t *testing.T) {
+	functions := expr.FunctionStore{}
+	functions.Add("double", 1, 1, func(_ context.Context, _ *expr.CallContext, args ...expr.JSValue) (expr.JSValue, error) {
+		return expr.JSValue{Int: expr.Some(2 * args[0].Int.Value)}, nil
+	})
+	evaluator, err := expr.NewLowLevelEvaluator(prContext(t), functions)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: "DOUBLE(21)"},
+		{expr: "always()"},
+		{expr: "double(1, 2)", wantErr: "too many parameters for double expected <= 1 got 2"},
+		{expr: "double()", wantErr: "missing parameters for double expected >= 1 got 0"},
+		{expr: "always(1)", wantErr: "too many parameters for always expected <= 0 got 1"},
+		{expr: "toJSON(1)", wantErr: "unknown function call toJSON"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			ast, parseErr := expr.NewParser().Parse(expr.NewExprLexer(tc.expr + "}}"))
+			require.Nil(t, parseErr)
+
+			_, err := evaluator.Evaluate(ast)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
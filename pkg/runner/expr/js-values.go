@@ -317,6 +317,7 @@ func (j *JSValue) UnmarshalFromGo(value any) error {
 
 		mapkeys := rv.MapKeys()
 		if len(mapkeys) == 0 {
+			j.Object = Some(o)
 			return nil
 		}
 		mapValue := make(map[string]any)
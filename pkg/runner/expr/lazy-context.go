@@ -0,0 +1,173 @@
+package expr
+
+import (
+	"encoding"
+	"encoding/json/v2"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/samber/oops"
+)
+
+// contextFields are the indexes of the fields of EvalContext, by the names of their contexts
+var contextFields = sync.OnceValue(func() map[string]int {
+	t := reflect.TypeFor[EvalContext]()
+	fields := make(map[string]int, t.NumField())
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		fields[strings.ToLower(name)] = i
+	}
+	return fields
+})
+
+// lazyContext converts the values of the contexts of an EvalContext to JSValues the first time an expression
+// accesses them. Only the value at the path an expression accesses is converted, so that evaluating
+// `${{ github.ref }}` doesn't convert the event payload in the github context.
+type lazyContext struct {
+	evalContext *EvalContext
+
+	mu sync.Mutex
+	// values are the converted values, by the context and the properties of their paths
+	values map[string]JSValue
+}
+
+func newLazyContext(evalContext *EvalContext) *lazyContext {
+	return &lazyContext{
+		evalContext: evalContext,
+		values:      make(map[string]JSValue),
+	}
+}
+
+// get returns the context name, or undefined if there is no such context
+func (c *lazyContext) get(name string) (JSValue, error) {
+	return c.access(name, nil)
+}
+
+// access returns the value at path in the context name. The properties that path starts with are looked up
+// in the Go values of the context, and only the value they reach is converted, which is then accessed with
+// the rest of path. The result is the same as converting the whole context.
+func (c *lazyContext) access(name string, path JSPath) (JSValue, error) {
+	i, ok := contextFields()[name]
+	if !ok {
+		return JSValue{Undefined: Some(struct{}{})}.Access(path...)
+	}
+	v := reflect.ValueOf(c.evalContext).Elem().Field(i)
+	key := name
+	n := 0
+	for ; n < len(path); n++ {
+		next, ok := jsonProperty(v, path[n])
+		if !ok {
+			break
+		}
+		v = next
+		// the names of properties can have dots, but not NULs
+		key += "\x00" + path[n].String.Value
+	}
+
+	c.mu.Lock()
+	value, ok := c.values[key]
+	c.mu.Unlock()
+	if !ok {
+		var err error
+		value, err = convertJSONValue(v)
+		if err != nil {
+			return JSValue{}, oops.Wrapf(err, "converting context %s", name)
+		}
+		c.mu.Lock()
+		c.values[key] = value
+		c.mu.Unlock()
+	}
+	return value.Access(path[n:]...)
+}
+
+// convertJSONValue converts v like [UnmarshalFromGo] converts the EvalContext v is in: through its JSON, with the
+// keys of objects lower cased
+func convertJSONValue(v reflect.Value) (JSValue, error) {
+	encoded, err := json.Marshal(v.Interface())
+	if err != nil {
+		return JSValue{}, oops.Wrapf(err, "marshalling")
+	}
+	var decoded any
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return JSValue{}, oops.Wrapf(err, "unmarshalling")
+	}
+	return UnmarshalFromGo(decoded)
+}
+
+var (
+	jsonMarshalerType   = reflect.TypeFor[json.Marshaler]()
+	jsonMarshalerToType = reflect.TypeFor[json.MarshalerTo]()
+	textMarshalerType   = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// jsonProperty returns the value of v that is the property segment of the JSON of v, converted like
+// [convertJSONValue] does. It's false when the JSON of v isn't an object whose properties are values of v,
+// like when v marshals itself, or when the property can't be told apart by the value alone, like the
+// properties of omitempty fields or keys that are the same lower cased.
+func jsonProperty(v reflect.Value, segment JSPathSegment) (reflect.Value, bool) {
+	if !segment.String.IsPresent {
+		return reflect.Value{}, false
+	}
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	t := v.Type()
+	for _, marshaler := range []reflect.Type{jsonMarshalerType, jsonMarshalerToType, textMarshalerType} {
+		if t.Implements(marshaler) || reflect.PointerTo(t).Implements(marshaler) {
+			return reflect.Value{}, false
+		}
+	}
+
+	name := segment.String.Value
+	switch v.Kind() {
+	case reflect.Struct:
+		var property reflect.Value
+		for i := range t.NumField() {
+			field := t.Field(i)
+			if field.Anonymous {
+				// embedded fields are inlined
+				return reflect.Value{}, false
+			}
+			tag := field.Tag.Get("json")
+			if !field.IsExported() || tag == "-" {
+				continue
+			}
+			fieldName, options, _ := strings.Cut(tag, ",")
+			if fieldName == "" {
+				fieldName = field.Name
+			}
+			if strings.ToLower(fieldName) != name {
+				continue
+			}
+			if options != "" || property.IsValid() {
+				return reflect.Value{}, false
+			}
+			property = v.Field(i)
+		}
+		return property, property.IsValid()
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return reflect.Value{}, false
+		}
+		var property reflect.Value
+		for iter := v.MapRange(); iter.Next(); {
+			if strings.ToLower(iter.Key().String()) != name {
+				continue
+			}
+			if property.IsValid() {
+				return reflect.Value{}, false
+			}
+			property = iter.Value()
+		}
+		return property, property.IsValid()
+	default:
+		return reflect.Value{}, false
+	}
+}
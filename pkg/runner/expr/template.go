@@ -0,0 +1,163 @@
+package expr
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/samber/oops"
+)
+
+// CompiledTemplate is a template whose `${{ }}` expressions are parsed, to evaluate it many times.
+// See [Evaluator.EvaluateCompiledTemplate].
+type CompiledTemplate struct {
+	Source string
+	parts  []templatePart
+}
+
+// templatePart is text of the template, or one of its expressions with its source
+type templatePart struct {
+	text string
+	expr Node
+	// offset is where the `${{` of the expression is in the template
+	offset int
+}
+
+// CompileTemplate parses the expressions surrounded by `${{ }}` in template.
+// Errors are [*ExpressionError]s, with the offset of the error in template.
+func CompileTemplate(template string) (*CompiledTemplate, error) {
+	const dollarDollar = "\x00DOLOAR_DOLLAR\x00"
+	compiled := &CompiledTemplate{Source: template}
+	if !strings.Contains(template, "${{") {
+		compiled.parts = []templatePart{{text: template}}
+		return compiled, nil
+	}
+	// sourceLen is the length of s before replacing $$ with dollarDollar
+	sourceLen := func(s string) int {
+		return len(s) - strings.Count(s, dollarDollar)*(len(dollarDollar)-len("$$"))
+	}
+
+	rest := strings.ReplaceAll(template, "$$", dollarDollar)
+	// offset is where rest starts in template
+	offset := 0
+	for {
+		openingIdx := strings.Index(rest, "${{")
+		if openingIdx == -1 {
+			compiled.addText(strings.ReplaceAll(rest, dollarDollar, "$$"))
+			break
+		}
+		compiled.addText(strings.ReplaceAll(rest[:openingIdx], dollarDollar, "$$"))
+		offset += sourceLen(rest[:openingIdx])
+		exprOffset := offset
+		rest = rest[openingIdx+len("${{"):]
+		offset += len("${{")
+		closingIdx := strings.Index(rest, "}}")
+		if closingIdx == -1 {
+			return nil, &ExpressionError{Offset: exprOffset, Err: oops.Errorf("can't find closing braces for ${{%s", rest)}
+		}
+		// note the parser expects the closing }}
+		expr := strings.ReplaceAll(rest[:closingIdx+len("}}")], dollarDollar, "$$")
+		rest = rest[closingIdx+len("}}"):]
+
+		parsed, perr := NewParser().Parse(NewExprLexer(expr))
+		if perr != nil {
+			return nil, &ExpressionError{Offset: offset + perr.Offset, Err: oops.Wrapf(perr, "parsing expression ${{%s", expr)}
+		}
+		compiled.parts = append(compiled.parts, templatePart{text: expr, expr: parsed, offset: exprOffset})
+		offset += len(expr)
+	}
+	return compiled, nil
+}
+
+func (t *CompiledTemplate) addText(text string) {
+	if text != "" {
+		t.parts = append(t.parts, templatePart{text: text})
+	}
+}
+
+// CompiledCondition is the parsed `if` of a job or a step, to evaluate it many times.
+// See [Evaluator.EvaluateCompiledCondition].
+type CompiledCondition struct {
+	Source string
+	expr   Node
+	// callsStatus is set when the condition calls a status function, so success() isn't implied
+	callsStatus bool
+	// offset is where the expression is in Source
+	offset int
+}
+
+// CompileCondition parses the `if` of a job or a step, which is an expression with or without `${{ }}`.
+// An empty condition is success(). Errors are [*ExpressionError]s, with the offset of the error in condition.
+func CompileCondition(condition string) (*CompiledCondition, error) {
+	source := condition
+	condition = strings.TrimSpace(condition)
+	offset := strings.Index(source, condition)
+	if inner, ok := strings.CutPrefix(condition, "${{"); ok && strings.HasSuffix(inner, "}}") && !strings.Contains(inner, "${{") {
+		condition = strings.TrimSuffix(inner, "}}")
+		offset += len("${{")
+	}
+	if strings.TrimSpace(condition) == "" {
+		condition = "success()"
+		offset = 0
+	}
+
+	parsed, perr := NewParser().Parse(NewExprLexer(condition + "}}"))
+	if perr != nil {
+		return nil, &ExpressionError{Offset: offset + perr.Offset, Err: oops.Wrapf(perr, "parsing condition %s", condition)}
+	}
+	compiled := &CompiledCondition{Source: source, expr: parsed, offset: offset + len(condition) - len(strings.TrimLeft(condition, " \t\n"))}
+	VisitExprNode(parsed, func(node, _ Node, entering bool) {
+		if call, ok := node.(*FuncCallNode); ok && entering && IsStatusFunction(call.Callee) {
+			compiled.callsStatus = true
+		}
+	})
+	return compiled, nil
+}
+
+// Node is the parsed expression of the condition, without the success() it implies
+func (c *CompiledCondition) Node() Node {
+	return c.expr
+}
+
+// TemplateCache keeps the templates and conditions it compiled, to compile each of them once.
+// The runner keeps one per workflow, shared by the evaluators of its jobs and steps.
+// A nil *TemplateCache compiles on every call.
+type TemplateCache struct {
+	templates  sync.Map // map[string]*CompiledTemplate
+	conditions sync.Map // map[string]*CompiledCondition
+}
+
+func NewTemplateCache() *TemplateCache {
+	return &TemplateCache{}
+}
+
+// Template returns template compiled, from the cache if it was compiled before
+func (c *TemplateCache) Template(template string) (*CompiledTemplate, error) {
+	if c == nil {
+		return CompileTemplate(template)
+	}
+	if compiled, ok := c.templates.Load(template); ok {
+		return compiled.(*CompiledTemplate), nil
+	}
+	compiled, err := CompileTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+	c.templates.Store(template, compiled)
+	return compiled, nil
+}
+
+// Condition returns condition compiled, from the cache if it was compiled before
+func (c *TemplateCache) Condition(condition string) (*CompiledCondition, error) {
+	if c == nil {
+		return CompileCondition(condition)
+	}
+	if compiled, ok := c.conditions.Load(condition); ok {
+		return compiled.(*CompiledCondition), nil
+	}
+	compiled, err := CompileCondition(condition)
+	if err != nil {
+		return nil, err
+	}
+	c.conditions.Store(condition, compiled)
+	return compiled, nil
+}
@@ -0,0 +1,316 @@
+package expr_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/runner/expr"
+)
+
+func TestCompileTemplate(t *testing.T) {
+	evaluator, err := expr.NewEvaluator(prContext(t))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		template string
+		expected string
+	}{
+		{"", ""},
+		{"no expressions", "no expressions"},
+		{"${{ github.actor }}", "octocat"},
+		{"deps-${{ github.actor }}-v1-${{ matrix.os }}", "deps-octocat-v1-ubuntu-latest"},
+		{"$$ ${{ 'a' }} $$", "$$ a $$"},
+		{"$${{ 'a' }}", "$${{ 'a' }}"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.template, func(t *testing.T) {
+			compiled, err := expr.CompileTemplate(tc.template)
+			require.NoError(t, err)
+			assert.Equal(t, tc.template, compiled.Source)
+			for range 2 {
+				result, err := evaluator.EvaluateCompiledTemplate(compiled)
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, result)
+			}
+		})
+	}
+
+	_, err = expr.CompileTemplate("a ${{ github.actor")
+	assert.ErrorContains(t, err, "can't find closing braces")
+	_, err = expr.CompileTemplate("a ${{ github. }}")
+	assert.ErrorContains(t, err, "parsing expression")
+}
+
+func TestExpressionErrorOffsets(t *testing.T) {
+	evaluator, err := expr.NewEvaluator(prContext(t))
+	require.NoError(t, err)
+
+	offset := func(t *testing.T, err error) int {
+		t.Helper()
+		var exprErr *expr.ExpressionError
+		require.ErrorAs(t, err, &exprErr)
+		return exprErr.Offset
+	}
+
+	_, err = expr.CompileTemplate("a ${{ github.actor")
+	assert.Equal(t, 2, offset(t, err), "unclosed expressions are at their ${{")
+	_, err = expr.CompileTemplate("a ${{ github. }}")
+	assert.Equal(t, 14, offset(t, err), "parse errors are at the token")
+	_, err = expr.CompileTemplate("$$ ${{ 1 }} $$ ${{ ) }}")
+	assert.Equal(t, 19, offset(t, err), "$$ counts as two bytes")
+
+	_, err = evaluator.EvaluateTemplate("ok ${{ github.actor }} ${{ fromJSON('{') }}")
+	assert.Equal(t, 23, offset(t, err), "evaluation errors are at the ${{ of the expression")
+
+	_, err = expr.CompileCondition("  ${{ github.actor == ) }}")
+	assert.Equal(t, 22, offset(t, err))
+	_, err = evaluator.EvaluateCondition("${{   fromJSON('{') }}")
+	assert.Equal(t, 6, offset(t, err), "evaluation errors are at the condition")
+	_, err = evaluator.EvaluateCondition(" fromJSON('{')")
+	assert.Equal(t, 1, offset(t, err))
+}
+
+func TestTemplateCache(t *testing.T) {
+	cache := expr.NewTemplateCache()
+	first, err := cache.Template("${{ github.actor }}")
+	require.NoError(t, err)
+	second, err := cache.Template("${{ github.actor }}")
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	condition, err := cache.Condition("github.actor == 'octocat'")
+	require.NoError(t, err)
+	again, err := cache.Condition("github.actor == 'octocat'")
+	require.NoError(t, err)
+	assert.Same(t, condition, again)
+
+	_, err = cache.Template("${{ ) }}")
+	assert.Error(t, err)
+
+	evaluator, err := expr.NewEvaluator(prContext(t))
+	require.NoError(t, err)
+	evaluator.Templates = cache
+	result, err := evaluator.EvaluateTemplate("${{ github.actor }}")
+	require.NoError(t, err)
+	assert.Equal(t, "octocat", result)
+	passed, err := evaluator.EvaluateCondition("github.actor == 'octocat'")
+	require.NoError(t, err)
+	assert.True(t, passed)
+
+	// a nil cache compiles on every call
+	var none *expr.TemplateCache
+	first, err = none.Template("${{ github.actor }}")
+	require.NoError(t, err)
+	second, err = none.Template("${{ github.actor }}")
+	require.NoError(t, err)
+	assert.NotSame(t, first, second)
+}
+
+func TestEvaluateValue(t *testing.T) {
+	evaluator, err := expr.NewEvaluator(prContext(t))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		expression string
+		expected   any
+	}{
+		{"github.actor", "octocat"},
+		{"${{ github.event.pull_request.user.id }}", float64(583231)},
+		{"  ${{ github.ref_protected }} ", false},
+		{"github.event.pull_request.head.ref == 'feature/awesome'", true},
+		{"${{ matrix.os }}-${{ github.actor }}", "ubuntu-latest-octocat"},
+		{"fromJSON('[1, 2]')", []any{float64(1), float64(2)}},
+		{"nothing", nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expression, func(t *testing.T) {
+			value, err := evaluator.EvaluateValue(tc.expression)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, value.GoValue())
+		})
+	}
+
+	_, err = evaluator.EvaluateValue("github.")
+	assert.ErrorContains(t, err, "parsing expression")
+}
+
+func TestEvaluatePartialTemplate(t *testing.T) {
+	evaluator, err := expr.NewEvaluator(prContext(t))
+	require.NoError(t, err)
+	known := func(node expr.Node) bool {
+		unknown := false
+		expr.VisitExprNode(node, func(node, _ expr.Node, entering bool) {
+			if v, ok := node.(*expr.VariableNode); ok && entering && v.Name == "steps" {
+				unknown = true
+			}
+		})
+		return !unknown
+	}
+
+	evaled, err := evaluator.EvaluatePartialTemplate("echo ${{ github.actor }} ${{steps.build.outputs.tag}} $${{ matrix.os }}", known)
+	require.NoError(t, err)
+	assert.Equal(t, "echo octocat ${{steps.build.outputs.tag}} $${{ matrix.os }}", evaled)
+
+	_, err = evaluator.EvaluatePartialTemplate("${{ fromJSON('{') }}", known)
+	var exprErr *expr.ExpressionError
+	require.ErrorAs(t, err, &exprErr)
+	assert.Equal(t, 0, exprErr.Offset)
+}
+
+// TestLazyContext checks that the values the evaluator converts when expressions access them are the same
+// as converting the whole EvalContext
+func TestLazyContext(t *testing.T) {
+	evalContext := prContext(t)
+	whole, err := expr.UnmarshalFromGo(*evalContext)
+	require.NoError(t, err)
+	eager, err := expr.NewLowLevelEvaluator(evalContext, expr.DefaultFunctions())
+	require.NoError(t, err)
+	eager.ContextObject = whole.Object.Value
+	lazy, err := expr.NewLowLevelEvaluator(evalContext, expr.DefaultFunctions())
+	require.NoError(t, err)
+
+	expressions := []string{
+		"github",
+		"github.ref",
+		"github['REF']",
+		"github.event",
+		"github.event.pull_request.head.ref",
+		"github.event.pull_request.user.id",
+		"github.event.pull_request.*.ref",
+		"github.event['pull_request'].head",
+		"github.ref_protected",
+		"github.nothing",
+		"env",
+		"env.NODE_ENV",
+		"env.nothing",
+		"job",
+		"jobs",
+		"steps.setup-node.outputs",
+		"steps.*.outcome",
+		"runner.os",
+		"secrets.NPM_TOKEN",
+		"vars",
+		"strategy.job-total",
+		"matrix",
+		"needs.lint.result",
+		"needs.lint.outputs",
+		"inputs.deploy",
+		"nothing",
+		"success()",
+		"github.ref.nothing",
+		"github.nothing.nothing",
+		"nothing.nothing",
+	}
+	for _, expression := range expressions {
+		t.Run(expression, func(t *testing.T) {
+			parsed, parseErr := expr.NewParser().Parse(expr.NewExprLexer(expression + "}}"))
+			require.Nil(t, parseErr)
+			expected, expectedErr := eager.Evaluate(parsed)
+			actual, err := lazy.Evaluate(parsed)
+			if expectedErr != nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, expected.GoValue(), actual.GoValue())
+		})
+	}
+}
+
+// benchmarkContext is the context of a push with many commits, whose event payload is large
+func benchmarkContext(b *testing.B) *expr.EvalContext {
+	evalContext := prContext(b)
+	commits := make([]any, 0, 200)
+	for i := range 200 {
+		commits = append(commits, map[string]any{
+			"id":      fmt.Sprintf("%040d", i),
+			"message": strings.Repeat("a commit message ", 20),
+			"author":  map[string]any{"name": "octocat", "email": "octocat@github.com"},
+		})
+	}
+	value, err := expr.UnmarshalFromGo(commits)
+	require.NoError(b, err)
+	evalContext.Github.Event["commits"] = value
+	return evalContext
+}
+
+// BenchmarkEvaluateTemplate compares parsing the expressions of a template every time it is evaluated,
+// like evaluators without a cache do, to parsing them once
+func BenchmarkEvaluateTemplate(b *testing.B) {
+	const template = "${{ matrix.os }}-node-${{ matrix.node-version }}-${{ format('{0}/{1}', github.repository, github.sha) }}"
+	for _, cache := range []*expr.TemplateCache{nil, expr.NewTemplateCache()} {
+		name := "parsed every time"
+		if cache != nil {
+			name = "compiled once"
+		}
+		b.Run(name, func(b *testing.B) {
+			evaluator, err := expr.NewEvaluator(prContext(b))
+			require.NoError(b, err)
+			evaluator.Templates = cache
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := evaluator.EvaluateTemplate(template); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkNewEvaluator compares converting the whole context when making an evaluator, which converts the
+// large event payload, to converting only the values the template accesses
+func BenchmarkNewEvaluator(b *testing.B) {
+	const template = "${{ env.NODE_ENV }}-${{ matrix.os }}"
+	evalContext := benchmarkContext(b)
+	for _, whole := range []bool{true, false} {
+		name := "accessed values"
+		if whole {
+			name = "whole context"
+		}
+		b.Run(name, func(b *testing.B) {
+			cache := expr.NewTemplateCache()
+			b.ReportAllocs()
+			for b.Loop() {
+				if whole {
+					if _, err := expr.UnmarshalFromGo(*evalContext); err != nil {
+						b.Fatal(err)
+					}
+				}
+				evaluator, err := expr.NewEvaluator(evalContext)
+				if err != nil {
+					b.Fatal(err)
+				}
+				evaluator.Templates = cache
+				if _, err := evaluator.EvaluateTemplate(template); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkContextAccess compares accessing the whole github context, which converts the large event payload,
+// to accessing properties of it, which converts only their values
+func BenchmarkContextAccess(b *testing.B) {
+	evalContext := benchmarkContext(b)
+	for _, expression := range []string{"github", "github.ref", "github.event.pull_request.head.ref"} {
+		b.Run(expression, func(b *testing.B) {
+			parsed, parseErr := expr.NewParser().Parse(expr.NewExprLexer(expression + "}}"))
+			require.Nil(b, parseErr)
+			b.ReportAllocs()
+			for b.Loop() {
+				evaluator, err := expr.NewLowLevelEvaluator(evalContext, expr.DefaultFunctions())
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := evaluator.Evaluate(parsed); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
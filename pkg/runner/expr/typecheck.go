@@ -0,0 +1,296 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TypeChecker infers the types of expressions from the types of the contexts they access,
+// and reports what is certainly wrong in them before they run: accessing properties that don't exist,
+// and comparisons whose result is known in advance.
+type TypeChecker struct {
+	// Contexts are the types of the contexts, by name
+	Contexts map[string]*Type
+}
+
+// TypeError is a problem the [TypeChecker] found in an expression
+type TypeError struct {
+	// Offset is the byte offset of the problem in the expression
+	Offset int
+	// Comparison is set for comparisons that are always false or always true
+	Comparison bool
+	Message    string
+}
+
+func (e *TypeError) Error() string {
+	return e.Message
+}
+
+// Check returns the type of the expression node, and the problems in it
+func (c *TypeChecker) Check(node Node) (*Type, []*TypeError) {
+	tc := &typeCheck{contexts: c.Contexts}
+	t := tc.check(node)
+	return t, tc.errors
+}
+
+type typeCheck struct {
+	contexts map[string]*Type
+	errors   []*TypeError
+}
+
+func (c *typeCheck) errorf(node Node, format string, args ...any) {
+	c.errors = append(c.errors, &TypeError{Offset: node.Token().Offset, Message: fmt.Sprintf(format, args...)})
+}
+
+// functionTypes are the types of the values the functions return. Other functions return any.
+var functionTypes = map[string]func() *Type{
+	"contains":   TypeBool,
+	"startswith": TypeBool,
+	"endswith":   TypeBool,
+	"success":    TypeBool,
+	"failure":    TypeBool,
+	"cancelled":  TypeBool,
+	"always":     TypeBool,
+	"format":     func() *Type { return TypeString() },
+	"join":       func() *Type { return TypeString() },
+	"tojson":     func() *Type { return TypeString() },
+	"hashfiles":  func() *Type { return TypeString() },
+	// the better-actions extensions
+	"tolower": func() *Type { return TypeString() },
+	"replace": func() *Type { return TypeString() },
+	"split":   func() *Type { return TypeArray(TypeString()) },
+	"keys":    func() *Type { return TypeArray(TypeString()) },
+	"length":  TypeNumber,
+}
+
+func (c *typeCheck) check(node Node) *Type {
+	switch n := node.(type) {
+	case *VariableNode:
+		for name, t := range c.contexts {
+			if strings.EqualFold(name, n.Name) {
+				return t
+			}
+		}
+		names := make([]string, 0, len(c.contexts))
+		for name := range c.contexts {
+			names = append(names, name)
+		}
+		c.errorf(n, "unknown context %s%s", n.Name, didYouMean(n.Name, names))
+		return TypeAny()
+	case *NullNode:
+		return TypeNull()
+	case *BoolNode:
+		return TypeBool()
+	case *IntNode, *FloatNode:
+		return TypeNumber()
+	case *StringNode:
+		return TypeString(n.Value)
+	case *ObjectDerefNode:
+		return c.property(n, n.Receiver, c.check(n.Receiver), n.Property)
+	case *ArrayDerefNode:
+		receiver := c.check(n.Receiver)
+		switch receiver.Kind {
+		case TypeKindArray:
+			return receiver
+		case TypeKindObject:
+			var elem *Type
+			for _, t := range receiver.Props {
+				elem = MergeTypes(elem, t)
+			}
+			if !receiver.Strict {
+				elem = MergeTypes(elem, receiver.elem())
+			}
+			return TypeArray(elem)
+		default:
+			return TypeArray(nil)
+		}
+	case *IndexAccessNode:
+		operand := c.check(n.Operand)
+		index := c.check(n.Index)
+		if s, ok := n.Index.(*StringNode); ok {
+			return c.property(n, n.Operand, operand, s.Value)
+		}
+		switch {
+		case operand.Kind == TypeKindArray:
+			return operand.elem()
+		case operand.Kind == TypeKindObject && index.Kind != TypeKindNumber:
+			elem := operand.Elem
+			for _, t := range operand.Props {
+				elem = MergeTypes(elem, t)
+			}
+			if elem == nil {
+				return TypeAny()
+			}
+			return elem
+		default:
+			return TypeAny()
+		}
+	case *NotOpNode:
+		c.check(n.Operand)
+		return TypeBool()
+	case *CompareOpNode:
+		left, right := c.check(n.Left), c.check(n.Right)
+		c.compare(n, left, right)
+		return TypeBool()
+	case *LogicalOpNode:
+		// && and || evaluate to one of their operands
+		left, right := c.check(n.Left), c.check(n.Right)
+		if left.Kind != right.Kind {
+			return TypeAny()
+		}
+		return MergeTypes(left, right)
+	case *FuncCallNode:
+		for _, arg := range n.Args {
+			c.check(arg)
+		}
+		if t, ok := functionTypes[strings.ToLower(n.Callee)]; ok {
+			return t()
+		}
+		return TypeAny()
+	default:
+		return TypeAny()
+	}
+}
+
+// property returns the type of property name of the receiver of node, which has type receiver
+func (c *typeCheck) property(node, receiverNode Node, receiver *Type, name string) *Type {
+	switch receiver.Kind {
+	case TypeKindObject:
+		if t, ok := receiver.Property(name); ok {
+			return t
+		}
+		c.errorf(node, "%s has no property %s%s", describe(receiverNode), name, didYouMean(name, receiver.PropertyNames()))
+		return TypeAny()
+	case TypeKindArray:
+		// the property of every element, after a .*
+		if receiver.Elem == nil {
+			return TypeArray(nil)
+		}
+		return TypeArray(c.property(node, receiverNode, receiver.Elem, name))
+	case TypeKindAny:
+		return TypeAny()
+	default:
+		c.errorf(node, "%s is a %s and has no property %s", describe(receiverNode), receiver, name)
+		return TypeAny()
+	}
+}
+
+// compare reports comparisons whose result is known in advance, because the values can't be equal
+func (c *typeCheck) compare(node *CompareOpNode, left, right *Type) {
+	report := func(always bool, format string, args ...any) {
+		c.errors = append(c.errors, &TypeError{
+			Offset:     node.Token().Offset,
+			Comparison: true,
+			Message:    fmt.Sprintf("comparison is always %t, %s", always, fmt.Sprintf(format, args...)),
+		})
+	}
+
+	// strings are compared like the evaluator compares them, with their case
+	if node.Kind.IsEqualityOp() && left.Kind == TypeKindString && right.Kind == TypeKindString &&
+		len(left.Values) > 0 && len(right.Values) > 0 {
+		for _, l := range left.Values {
+			for _, r := range right.Values {
+				if l == r {
+					return
+				}
+			}
+		}
+		literal, other, otherNode := left, right, node.Right
+		if _, ok := node.Left.(*StringNode); !ok {
+			literal, other, otherNode = right, left, node.Left
+		}
+		if len(literal.Values) == 1 && len(other.Values) > 1 {
+			report(node.Kind == CompareOpNodeKindNotEq, "%s is one of %s", describe(otherNode), other)
+			return
+		}
+		report(node.Kind == CompareOpNodeKindNotEq, "%s can't be equal to %s", left, right)
+		return
+	}
+
+	// values of different types are compared as numbers, and comparisons with strings that aren't numbers
+	// are false, even !=
+	sides := []struct {
+		node Node
+		t    *Type
+	}{{node.Left, left}, {node.Right, right}}
+	for i, number := range sides {
+		text := sides[1-i].t
+		if (number.t.Kind != TypeKindBool && number.t.Kind != TypeKindNumber && number.t.Kind != TypeKindNull) ||
+			text.Kind != TypeKindString || len(text.Values) == 0 {
+			continue
+		}
+		for _, v := range text.Values {
+			if _, ok := coerceJSValueToNumber(JSValue{String: Some(v)}); ok {
+				return
+			}
+		}
+		report(false, "%s is a %s, so it is compared as a number, and %s is not a number", describe(number.node), number.t.Kind, text)
+		return
+	}
+}
+
+// describe returns the source of property access paths like steps.build.outputs, or "the value" for other expressions
+func describe(node Node) string {
+	switch n := node.(type) {
+	case *VariableNode:
+		return n.Name
+	case *ObjectDerefNode:
+		return describe(n.Receiver) + "." + n.Property
+	case *ArrayDerefNode:
+		return describe(n.Receiver) + ".*"
+	case *IndexAccessNode:
+		if s, ok := n.Index.(*StringNode); ok {
+			return fmt.Sprintf("%s['%s']", describe(n.Operand), s.Value)
+		}
+		return describe(n.Operand) + "[...]"
+	case *FuncCallNode:
+		return n.Callee + "(...)"
+	case *BoolNode, *NullNode, *IntNode, *FloatNode:
+		return n.Token().Value
+	default:
+		return "the value"
+	}
+}
+
+// didYouMean returns a suggestion of the name in names that name is likely a typo of, or ""
+func didYouMean(name string, names []string) string {
+	best, bestDistance := "", 0
+	for _, candidate := range names {
+		d := editDistance(strings.ToLower(name), strings.ToLower(candidate))
+		if d > 2 || d >= len(name) || (best != "" && d >= bestDistance) {
+			continue
+		}
+		best, bestDistance = candidate, d
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %s?", best)
+}
+
+// editDistance is the number of insertions, deletions, substitutions and swaps of adjacent characters
+// that turn a into b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
@@ -0,0 +1,111 @@
+package expr_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/runner/expr"
+)
+
+func TestTypeChecker(t *testing.T) {
+	contexts := expr.ContextTypes()
+	contexts["steps"] = expr.TypeObject(map[string]*expr.Type{"build": contexts["steps"].Elem})
+	contexts["inputs"] = expr.TypeObject(map[string]*expr.Type{
+		"deploy": expr.TypeBool(),
+		"target": expr.TypeString("staging", "production"),
+	})
+	checker := &expr.TypeChecker{Contexts: contexts}
+
+	testCases := []struct {
+		expr     string
+		wantType string
+		wantErrs []string
+	}{
+		{expr: "steps.build.outputs.x", wantType: "string"},
+		{expr: "steps.build.outcome", wantType: "'success' | 'failure' | 'cancelled' | 'skipped'"},
+		{expr: "github.event.pull_request.number", wantType: "any"},
+		{expr: "contains(github.ref, 'main')", wantType: "boolean"},
+		{expr: "inputs.target == 'staging'", wantType: "boolean"},
+		{expr: "inputs.deploy == 1", wantType: "boolean"},
+		{expr: "inputs.target || 'staging'", wantType: "'staging' | 'production'"},
+		{
+			expr:     "steps.biuld.outputs.x",
+			wantType: "any",
+			wantErrs: []string{"steps has no property biuld, did you mean build?"},
+		},
+		{
+			expr:     "github.shaa",
+			wantType: "any",
+			wantErrs: []string{"github has no property shaa, did you mean sha?"},
+		},
+		{
+			expr:     "github['nope']",
+			wantType: "any",
+			wantErrs: []string{"github has no property nope"},
+		},
+		{
+			expr:     "github.sha.length",
+			wantType: "any",
+			wantErrs: []string{"github.sha is a string and has no property length"},
+		},
+		{
+			expr:     "steps.build.outcome == 'succes'",
+			wantType: "boolean",
+			wantErrs: []string{"comparison is always false, steps.build.outcome is one of 'success' | 'failure' | 'cancelled' | 'skipped'"},
+		},
+		{
+			expr:     "inputs.target != 'prod'",
+			wantType: "boolean",
+			wantErrs: []string{"comparison is always true, inputs.target is one of 'staging' | 'production'"},
+		},
+		{
+			expr:     "inputs.deploy == 'true'",
+			wantType: "boolean",
+			wantErrs: []string{"comparison is always false, inputs.deploy is a boolean, so it is compared as a number, and 'true' is not a number"},
+		},
+		{
+			expr:     "matirx.os",
+			wantType: "any",
+			wantErrs: []string{"unknown context matirx, did you mean matrix?"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			ast, parseErr := expr.NewParser().Parse(expr.NewExprLexer(tc.expr + "}}"))
+			require.Nil(t, parseErr)
+
+			typ, errs := checker.Check(ast)
+			assert.Equal(t, tc.wantType, typ.String())
+			var messages []string
+			for _, err := range errs {
+				messages = append(messages, err.Message)
+			}
+			assert.Equal(t, tc.wantErrs, messages)
+		})
+	}
+}
+
+// the comparisons the type checker reports as constant evaluate like it says
+func TestTypeCheckerComparisons(t *testing.T) {
+	evaluator, err := expr.NewLowLevelEvaluator(&expr.EvalContext{
+		Inputs: expr.JSObject{"deploy": {Boolean: expr.Some(true)}},
+	}, expr.DefaultFunctions())
+	require.NoError(t, err)
+	checker := &expr.TypeChecker{Contexts: map[string]*expr.Type{
+		"inputs": expr.TypeObject(map[string]*expr.Type{"deploy": expr.TypeBool()}),
+	}}
+
+	for _, src := range []string{"inputs.deploy == 'true'", "inputs.deploy != 'true'", "'a' == 'A'"} {
+		ast, parseErr := expr.NewParser().Parse(expr.NewExprLexer(src + "}}"))
+		require.Nil(t, parseErr)
+
+		_, errs := checker.Check(ast)
+		require.Len(t, errs, 1, src)
+		result, err := evaluator.Evaluate(ast)
+		require.NoError(t, err)
+		assert.Contains(t, errs[0].Message, "always false", src)
+		assert.False(t, result.Boolean.Value, src)
+	}
+}
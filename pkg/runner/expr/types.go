@@ -0,0 +1,266 @@
+package expr
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// TypeKind is the kind of a [Type]
+type TypeKind int
+
+const (
+	// TypeKindAny is for values whose type isn't known before the expression runs
+	TypeKindAny TypeKind = iota
+	TypeKindNull
+	TypeKindBool
+	TypeKindNumber
+	TypeKindString
+	TypeKindObject
+	TypeKindArray
+)
+
+func (k TypeKind) String() string {
+	switch k {
+	case TypeKindNull:
+		return "null"
+	case TypeKindBool:
+		return "boolean"
+	case TypeKindNumber:
+		return "number"
+	case TypeKindString:
+		return "string"
+	case TypeKindObject:
+		return "object"
+	case TypeKindArray:
+		return "array"
+	default:
+		return "any"
+	}
+}
+
+// Type is the static type of a value, as far as it is known before the expression runs
+type Type struct {
+	Kind TypeKind
+	// Props are the known properties of objects
+	Props map[string]*Type
+	// Strict objects have no other properties than Props
+	Strict bool
+	// Elem is the type of the elements of arrays, and of the properties of objects that aren't in Props.
+	// nil means any.
+	Elem *Type
+	// Values are the only values a string may have, when they are known
+	Values []string
+}
+
+func TypeAny() *Type    { return &Type{Kind: TypeKindAny} }
+func TypeNull() *Type   { return &Type{Kind: TypeKindNull} }
+func TypeBool() *Type   { return &Type{Kind: TypeKindBool} }
+func TypeNumber() *Type { return &Type{Kind: TypeKindNumber} }
+
+// TypeString is a string that is one of values, or any string if there are none
+func TypeString(values ...string) *Type {
+	return &Type{Kind: TypeKindString, Values: values}
+}
+
+// TypeObject is an object that has exactly props
+func TypeObject(props map[string]*Type) *Type {
+	if props == nil {
+		props = make(map[string]*Type)
+	}
+	return &Type{Kind: TypeKindObject, Props: props, Strict: true}
+}
+
+// TypeMap is an object with any properties, whose values are elem
+func TypeMap(elem *Type) *Type {
+	return &Type{Kind: TypeKindObject, Elem: elem}
+}
+
+// TypeArray is an array of elem
+func TypeArray(elem *Type) *Type {
+	return &Type{Kind: TypeKindArray, Elem: elem}
+}
+
+// Property returns the type of the property name of objects. Like in expressions, names are case-insensitive.
+// It returns false for properties that strict objects don't have.
+func (t *Type) Property(name string) (*Type, bool) {
+	for prop, propType := range t.Props {
+		if strings.EqualFold(prop, name) {
+			return propType, true
+		}
+	}
+	if t.Strict {
+		return nil, false
+	}
+	return t.elem(), true
+}
+
+// PropertyNames returns the names of the known properties of objects, sorted
+func (t *Type) PropertyNames() []string {
+	names := make([]string, 0, len(t.Props))
+	for name := range t.Props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (t *Type) elem() *Type {
+	if t.Elem == nil {
+		return TypeAny()
+	}
+	return t.Elem
+}
+
+func (t *Type) String() string {
+	switch t.Kind {
+	case TypeKindString:
+		if len(t.Values) == 0 {
+			return "string"
+		}
+		quoted := make([]string, len(t.Values))
+		for i, v := range t.Values {
+			quoted[i] = fmt.Sprintf("'%s'", v)
+		}
+		return strings.Join(quoted, " | ")
+	case TypeKindObject:
+		var parts []string
+		for _, name := range t.PropertyNames() {
+			parts = append(parts, name+": "+t.Props[name].String())
+		}
+		if !t.Strict {
+			parts = append(parts, "*: "+t.elem().String())
+		}
+		return "{" + strings.Join(parts, "; ") + "}"
+	case TypeKindArray:
+		return "array<" + t.elem().String() + ">"
+	default:
+		return t.Kind.String()
+	}
+}
+
+// MergeTypes returns a type for values that are either of type a or of type b
+func MergeTypes(a, b *Type) *Type {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case a.Kind != b.Kind:
+		return TypeAny()
+	}
+	switch a.Kind {
+	case TypeKindString:
+		if len(a.Values) == 0 || len(b.Values) == 0 {
+			return TypeString()
+		}
+		values := slices.Clone(a.Values)
+		for _, v := range b.Values {
+			if !slices.Contains(values, v) {
+				values = append(values, v)
+			}
+		}
+		return TypeString(values...)
+	case TypeKindObject:
+		merged := &Type{Kind: TypeKindObject, Props: make(map[string]*Type), Strict: a.Strict && b.Strict}
+		for name, propType := range a.Props {
+			merged.Props[name] = propType
+		}
+		for name, propType := range b.Props {
+			merged.Props[name] = MergeTypes(merged.Props[name], propType)
+		}
+		if a.Elem != nil && b.Elem != nil {
+			merged.Elem = MergeTypes(a.Elem, b.Elem)
+		}
+		return merged
+	case TypeKindArray:
+		if a.Elem == nil || b.Elem == nil {
+			return TypeArray(nil)
+		}
+		return TypeArray(MergeTypes(a.Elem, b.Elem))
+	default:
+		return a
+	}
+}
+
+// TypeOfValue returns the type of a value decoded from YAML or JSON, like the values of a matrix
+func TypeOfValue(v any) *Type {
+	switch v := v.(type) {
+	case nil:
+		return TypeNull()
+	case bool:
+		return TypeBool()
+	case int, int64, uint64, float64:
+		return TypeNumber()
+	case string:
+		return TypeString(v)
+	case map[string]any:
+		props := make(map[string]*Type, len(v))
+		for name, value := range v {
+			props[name] = TypeOfValue(value)
+		}
+		return TypeObject(props)
+	case []any:
+		var elem *Type
+		for _, value := range v {
+			elem = MergeTypes(elem, TypeOfValue(value))
+		}
+		return TypeArray(elem)
+	default:
+		return TypeAny()
+	}
+}
+
+var jsValueType = reflect.TypeFor[JSValue]()
+
+// TypeOfGo returns the type of the JSON encoding of values of the Go type t.
+// The values of strings may be listed in a `values` struct tag, separated by commas.
+func TypeOfGo(t reflect.Type) *Type {
+	if t == jsValueType {
+		return TypeAny()
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return TypeOfGo(t.Elem())
+	case reflect.Bool:
+		return TypeBool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return TypeNumber()
+	case reflect.String:
+		return TypeString()
+	case reflect.Slice, reflect.Array:
+		return TypeArray(TypeOfGo(t.Elem()))
+	case reflect.Map:
+		return TypeMap(TypeOfGo(t.Elem()))
+	case reflect.Struct:
+		props := make(map[string]*Type)
+		for i := range t.NumField() {
+			field := t.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			props[name] = TypeOfGo(field.Type)
+			if values := field.Tag.Get("values"); values != "" && props[name].Kind == TypeKindString {
+				props[name].Values = strings.Split(values, ",")
+			}
+		}
+		return TypeObject(props)
+	default:
+		return TypeAny()
+	}
+}
+
+// ContextTypes returns the types of the contexts of expressions, by their names, as the runner fills them.
+// The types of contexts that depend on the workflow, like steps, needs, inputs and matrix,
+// may be refined by the caller.
+func ContextTypes() map[string]*Type {
+	return TypeOfGo(reflect.TypeFor[EvalContext]()).Props
+}
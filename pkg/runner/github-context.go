@@ -0,0 +1,195 @@
+package runner
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/gitinfo"
+	"github.com/drornir/better-actions/pkg/runner/expr"
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+const (
+	defaultServerURL  = "https://github.com"
+	defaultAPIURL     = "https://api.github.com"
+	defaultGraphQLURL = "https://api.github.com/graphql"
+)
+
+// newGithubContext builds the github context of a workflow run.
+// Values are derived from the git checkout that contains repoDir (if there is one), and every
+// non-empty value in override takes precedence over the derived ones.
+func newGithubContext(
+	ctx context.Context,
+	repoDir string,
+	wf *yamls.Workflow,
+	override *types.GitHub,
+) (types.GitHub, error) {
+	oopser := oops.FromContext(ctx).With("repoDir", repoDir)
+
+	gh := types.GitHub{
+		ServerURL:  defaultServerURL,
+		APIURL:     defaultAPIURL,
+		GraphQLURL: defaultGraphQLURL,
+		RunID:      strconv.FormatInt(time.Now().UnixMilli(), 10),
+		RunNumber:  "1",
+		RunAttempt: "1",
+	}
+
+	info, err := gitinfo.Read(ctx, repoDir)
+	if err != nil {
+		return types.GitHub{}, oopser.Wrapf(err, "reading git metadata")
+	}
+	if info != nil {
+		gh.SHA = info.SHA
+		gh.WorkflowSHA = info.SHA
+		gh.Ref = info.Ref
+		gh.RefName = info.RefName
+		gh.RefType = info.RefType
+		gh.Actor = info.Actor
+		gh.TriggeringActor = info.Actor
+		if info.CommitCount > 0 {
+			gh.RunNumber = strconv.Itoa(info.CommitCount)
+		}
+		if remote := info.Remote; remote != nil && remote.Owner != "" {
+			gh.Repository = remote.Repository()
+			gh.RepositoryOwner = remote.Owner
+			gh.RepositoryURL = "git://" + strings.TrimPrefix(remote.ServerURL, "https://") + "/" + remote.Repository() + ".git"
+			if remote.ServerURL != defaultServerURL {
+				// GitHub Enterprise Server layout
+				gh.ServerURL = remote.ServerURL
+				gh.APIURL = remote.ServerURL + "/api/v3"
+				gh.GraphQLURL = remote.ServerURL + "/api/graphql"
+			}
+		}
+	}
+
+	gh.Workflow = wf.Name
+	if wf.File != "" {
+		wfPath := wf.File
+		if info != nil {
+			if rel, err := filepath.Rel(info.Root, wf.File); err == nil {
+				wfPath = filepath.ToSlash(rel)
+			}
+		}
+		if gh.Workflow == "" {
+			gh.Workflow = wfPath
+		}
+		if gh.Repository != "" {
+			gh.WorkflowRef = gh.Repository + "/" + wfPath
+			if gh.Ref != "" {
+				gh.WorkflowRef += "@" + gh.Ref
+			}
+		}
+	}
+
+	if override != nil {
+		mergeGithubContext(&gh, *override)
+	}
+	return gh, nil
+}
+
+// mergeGithubContext copies every field of override that isn't the zero value into gh
+func mergeGithubContext(gh *types.GitHub, override types.GitHub) {
+	dst := reflect.ValueOf(gh).Elem()
+	src := reflect.ValueOf(override)
+	for i := range src.NumField() {
+		if !src.Field(i).IsZero() {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+}
+
+// githubToExprContext converts the github context to the shape used in expressions
+func githubToExprContext(gh types.GitHub) (expr.GithubContext, error) {
+	event := expr.JSObject{}
+	if gh.Event != nil {
+		if err := event.UnmarshalFromGoMap(gh.Event); err != nil {
+			return expr.GithubContext{}, oops.Wrapf(err, "converting github.event")
+		}
+	}
+
+	return expr.GithubContext{
+		Action:            gh.Action,
+		ActionPath:        gh.ActionPath,
+		ActionRef:         gh.ActionRef,
+		ActionRepository:  gh.ActionRepository,
+		ActionStatus:      gh.ActionStatus,
+		Actor:             gh.Actor,
+		ActorID:           gh.ActorID,
+		APIURL:            gh.APIURL,
+		BaseRef:           gh.BaseRef,
+		Env:               gh.Env,
+		Event:             event,
+		EventName:         gh.EventName,
+		EventPath:         gh.EventPath,
+		Environment:       gh.Environment,
+		GraphQLURL:        gh.GraphQLURL,
+		HeadRef:           gh.HeadRef,
+		Job:               gh.Job,
+		Path:              gh.Path,
+		Ref:               gh.Ref,
+		RefName:           gh.RefName,
+		RefProtected:      gh.RefProtected,
+		RefType:           gh.RefType,
+		Repository:        gh.Repository,
+		RepositoryID:      gh.RepositoryID,
+		RepositoryOwner:   gh.RepositoryOwner,
+		RepositoryOwnerID: gh.RepositoryOwnerID,
+		RepositoryURL:     gh.RepositoryURL,
+		RetentionDays:     gh.RetentionDays,
+		RunID:             gh.RunID,
+		RunNumber:         gh.RunNumber,
+		RunAttempt:        gh.RunAttempt,
+		SecretSource:      gh.SecretSource,
+		ServerURL:         gh.ServerURL,
+		Sha:               gh.SHA,
+		Token:             gh.Token,
+		TriggeringActor:   gh.TriggeringActor,
+		Workflow:          gh.Workflow,
+		WorkflowRef:       gh.WorkflowRef,
+		WorkflowSha:       gh.WorkflowSHA,
+		Workspace:         gh.Workspace,
+	}, nil
+}
+
+// githubDefaultEnv returns the default environment variables the GitHub runner exports to every step.
+// https://docs.github.com/en/actions/reference/workflows-and-actions/variables#default-environment-variables
+func githubDefaultEnv(gh types.GitHub) map[string]string {
+	return map[string]string{
+		"CI":                      "true",
+		"GITHUB_ACTIONS":          "true",
+		"GITHUB_ACTOR":            gh.Actor,
+		"GITHUB_ACTOR_ID":         gh.ActorID,
+		"GITHUB_API_URL":          gh.APIURL,
+		"GITHUB_BASE_REF":         gh.BaseRef,
+		"GITHUB_EVENT_NAME":       gh.EventName,
+		"GITHUB_EVENT_PATH":       gh.EventPath,
+		"GITHUB_GRAPHQL_URL":      gh.GraphQLURL,
+		"GITHUB_HEAD_REF":         gh.HeadRef,
+		"GITHUB_JOB":              gh.Job,
+		"GITHUB_REF":              gh.Ref,
+		"GITHUB_REF_NAME":         gh.RefName,
+		"GITHUB_REF_PROTECTED":    strconv.FormatBool(gh.RefProtected),
+		"GITHUB_REF_TYPE":         gh.RefType,
+		"GITHUB_REPOSITORY":       gh.Repository,
+		"GITHUB_REPOSITORY_ID":    gh.RepositoryID,
+		"GITHUB_REPOSITORY_OWNER": gh.RepositoryOwner,
+		"GITHUB_RETENTION_DAYS":   gh.RetentionDays,
+		"GITHUB_RUN_ATTEMPT":      gh.RunAttempt,
+		"GITHUB_RUN_ID":           gh.RunID,
+		"GITHUB_RUN_NUMBER":       gh.RunNumber,
+		"GITHUB_SERVER_URL":       gh.ServerURL,
+		"GITHUB_SHA":              gh.SHA,
+		"GITHUB_TRIGGERING_ACTOR": gh.TriggeringActor,
+		"GITHUB_WORKFLOW":         gh.Workflow,
+		"GITHUB_WORKFLOW_REF":     gh.WorkflowRef,
+		"GITHUB_WORKFLOW_SHA":     gh.WorkflowSHA,
+	}
+}
@@ -0,0 +1,237 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+// Graph is the jobs of a workflow and the needs between them. See [WorkflowGraph].
+type Graph struct {
+	Workflow string `json:"workflow"`
+	// Nodes are the jobs in the order they run
+	Nodes []GraphNode `json:"nodes"`
+	// Edges go from the jobs that are needed to the jobs that need them
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is a job of a workflow
+type GraphNode struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Matrix tells apart the combinations of the matrix of the job, like `18, ubuntu-latest`, if it has a matrix
+	Matrix []string `json:"matrix,omitempty"`
+	// Uses is the reusable workflow the job calls
+	Uses string `json:"uses,omitempty"`
+	// Result and DurationSeconds are of the job in the run that the graph shows, if it shows one
+	Result          JobResult `json:"result,omitempty"`
+	DurationSeconds float64   `json:"durationSeconds,omitzero"`
+	// EnvironmentURL is the evaluated `environment.url` of the job in the run, if it deployed to one
+	EnvironmentURL string `json:"environmentUrl,omitempty"`
+}
+
+// GraphEdge is a job that needs another
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// WorkflowGraph returns the graph of the jobs of wf. When record isn't nil, the nodes have the results and
+// durations of the jobs in that run of wf.
+func WorkflowGraph(ctx context.Context, wf *yamls.Workflow, record *RunRecord) (*Graph, error) {
+	order, err := jobOrder(wf.Jobs)
+	if err != nil {
+		return nil, oops.Wrapf(err, "invalid job dependencies")
+	}
+	graph := &Graph{Workflow: wf.Name, Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	for _, id := range order {
+		job := wf.Jobs[id]
+		node := GraphNode{ID: id, Name: id, Uses: job.Uses}
+		if job.Name != "" {
+			node.Name = job.Name
+		}
+		matrixes, err := job.GetMatrixes(ctx)
+		if err != nil {
+			return nil, oops.With("job", id).Wrapf(wf.ErrorAt(job.ValueNode("strategy", "matrix"), err), "expanding the matrix of job %s", id)
+		}
+		for _, matrix := range matrixes {
+			if len(matrix) > 0 {
+				node.Matrix = append(node.Matrix, matrixLabel(matrix))
+			}
+		}
+		if record != nil {
+			if jobRecord, ok := record.Jobs[id]; ok {
+				node.Result = jobRecord.Result
+				node.DurationSeconds = jobRecord.Duration().Seconds()
+				node.EnvironmentURL = jobRecord.EnvironmentURL
+			}
+		}
+		graph.Nodes = append(graph.Nodes, node)
+		for _, need := range job.Needs() {
+			graph.Edges = append(graph.Edges, GraphEdge{From: need, To: id})
+		}
+	}
+	return graph, nil
+}
+
+// matrixLabel tells a combination of a matrix apart by its values, like GitHub does in the names of jobs
+func matrixLabel(matrix map[string]any) string {
+	values := make([]string, 0, len(matrix))
+	for _, key := range slices.Sorted(maps.Keys(matrix)) {
+		values = append(values, fmt.Sprint(matrix[key]))
+	}
+	return strings.Join(values, ", ")
+}
+
+// resultColors are the colors of the nodes of jobs by their results
+var resultColors = map[JobResult]string{
+	JobResultSuccess:   "#b7e4c7",
+	JobResultFailure:   "#f5b7b1",
+	JobResultCancelled: "#d5d8dc",
+	JobResultSkipped:   "#f4f6f7",
+}
+
+// labelLines are the lines of the label of the node: its name, what it calls, how many jobs its matrix fans out
+// to, its result and where it deployed
+func (n GraphNode) labelLines() []string {
+	lines := []string{n.Name}
+	if n.Uses != "" {
+		lines = append(lines, "uses "+n.Uses)
+	}
+	if len(n.Matrix) > 0 {
+		lines = append(lines, fmt.Sprintf("matrix of %d jobs", len(n.Matrix)))
+	}
+	switch n.Result {
+	case "":
+	case JobResultSkipped:
+		lines = append(lines, string(n.Result))
+	default:
+		lines = append(lines, fmt.Sprintf("%s in %s", n.Result, formatDuration(time.Duration(n.DurationSeconds*float64(time.Second)))))
+	}
+	if n.EnvironmentURL != "" {
+		lines = append(lines, n.EnvironmentURL)
+	}
+	return lines
+}
+
+// formatDuration rounds d to what people care about in a run
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// sources are the nodes that the edges of the jobs that need n start from: the combinations of the matrix
+// of n fan in to them
+func (n GraphNode) sources(combinationID func(node GraphNode, i int) string, nodeID string) []string {
+	if len(n.Matrix) == 0 {
+		return []string{nodeID}
+	}
+	sources := make([]string, len(n.Matrix))
+	for i := range n.Matrix {
+		sources[i] = combinationID(n, i)
+	}
+	return sources
+}
+
+// WriteDOT writes the graph in the DOT language of Graphviz. Jobs with a matrix fan out to a node for each
+// combination of their matrix, and jobs that call reusable workflows are components.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	combinationID := func(n GraphNode, i int) string { return fmt.Sprintf("%s/%d", n.ID, i) }
+	nodes := make(map[string]GraphNode, len(g.Nodes))
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "digraph %s {\n", dotQuote(g.Workflow))
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=rounded];\n")
+	for _, n := range g.Nodes {
+		nodes[n.ID] = n
+		attrs := []string{"label=" + dotQuote(strings.Join(n.labelLines(), "\n"))}
+		if n.Uses != "" {
+			attrs = append(attrs, "shape=component")
+		}
+		if color, ok := resultColors[n.Result]; ok {
+			attrs = append(attrs, `style="rounded,filled"`, "fillcolor="+dotQuote(color))
+		}
+		fmt.Fprintf(b, "  %s [%s];\n", dotQuote(n.ID), strings.Join(attrs, ", "))
+		for i, combination := range n.Matrix {
+			fmt.Fprintf(b, "  %s [label=%s, style=\"rounded,dashed\"];\n", dotQuote(combinationID(n, i)), dotQuote(combination))
+			fmt.Fprintf(b, "  %s -> %s [style=dashed];\n", dotQuote(n.ID), dotQuote(combinationID(n, i)))
+		}
+	}
+	for _, e := range g.Edges {
+		for _, source := range nodes[e.From].sources(combinationID, e.From) {
+			fmt.Fprintf(b, "  %s -> %s;\n", dotQuote(source), dotQuote(e.To))
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return oops.Wrap(err)
+}
+
+// WriteMermaid writes the graph as a Mermaid flowchart, which GitHub renders in markdown.
+// It's drawn like [Graph.WriteDOT].
+func (g *Graph) WriteMermaid(w io.Writer) error {
+	// the IDs of jobs may not be valid Mermaid IDs, so nodes are numbered
+	ids := make(map[string]string, len(g.Nodes))
+	nodes := make(map[string]GraphNode, len(g.Nodes))
+	combinationID := func(n GraphNode, i int) string { return fmt.Sprintf("%s_%d", ids[n.ID], i) }
+	b := &strings.Builder{}
+	b.WriteString("flowchart LR\n")
+	for i, n := range g.Nodes {
+		ids[n.ID] = fmt.Sprintf("job%d", i)
+		nodes[n.ID] = n
+		label := mermaidQuote(n.labelLines())
+		if n.Uses != "" {
+			fmt.Fprintf(b, "  %s[[%s]]\n", ids[n.ID], label)
+		} else {
+			fmt.Fprintf(b, "  %s(%s)\n", ids[n.ID], label)
+		}
+		for i, combination := range n.Matrix {
+			fmt.Fprintf(b, "  %s(%s)\n", combinationID(n, i), mermaidQuote([]string{combination}))
+			fmt.Fprintf(b, "  %s -.-> %s\n", ids[n.ID], combinationID(n, i))
+		}
+	}
+	for _, e := range g.Edges {
+		for _, source := range nodes[e.From].sources(combinationID, ids[e.From]) {
+			fmt.Fprintf(b, "  %s --> %s\n", source, ids[e.To])
+		}
+	}
+	for _, result := range []JobResult{JobResultSuccess, JobResultFailure, JobResultCancelled, JobResultSkipped} {
+		var classed []string
+		for _, n := range g.Nodes {
+			if n.Result == result {
+				classed = append(classed, ids[n.ID])
+			}
+		}
+		if len(classed) > 0 {
+			fmt.Fprintf(b, "  classDef %s fill:%s\n", result, resultColors[result])
+			fmt.Fprintf(b, "  class %s %s\n", strings.Join(classed, ","), result)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return oops.Wrap(err)
+}
+
+// dotQuote quotes s as a DOT string, where \n breaks lines
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// mermaidQuote quotes lines as the label of a Mermaid node
+func mermaidQuote(lines []string) string {
+	escape := strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;")
+	escaped := make([]string, len(lines))
+	for i, line := range lines {
+		escaped[i] = escape.Replace(line)
+	}
+	return `"` + strings.Join(escaped, "<br/>") + `"`
+}
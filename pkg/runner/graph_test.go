@@ -0,0 +1,139 @@
+package runner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+const graphWorkflow = `name: CI
+on: push
+jobs:
+  lint:
+    name: Lint "all"
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo lint
+  test:
+    needs: lint
+    runs-on: ubuntu-latest
+    strategy:
+      matrix:
+        node: [18, 20]
+    steps:
+      - run: echo test
+  broken:
+    needs: lint
+    runs-on: ubuntu-latest
+    steps:
+      - run: exit 1
+  deploy:
+    needs: [test, broken]
+    uses: octo/repo/.github/workflows/deploy.yml@v1
+`
+
+func TestWorkflowGraph(t *testing.T) {
+	wf, err := yamls.ReadWorkflow(strings.NewReader(graphWorkflow), false)
+	require.NoError(t, err)
+
+	graph, err := WorkflowGraph(t.Context(), wf, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &Graph{
+		Workflow: "CI",
+		Nodes: []GraphNode{
+			{ID: "lint", Name: `Lint "all"`},
+			{ID: "test", Name: "test", Matrix: []string{"18", "20"}},
+			{ID: "broken", Name: "broken"},
+			{ID: "deploy", Name: "deploy", Uses: "octo/repo/.github/workflows/deploy.yml@v1"},
+		},
+		Edges: []GraphEdge{
+			{From: "lint", To: "test"},
+			{From: "lint", To: "broken"},
+			{From: "test", To: "deploy"},
+			{From: "broken", To: "deploy"},
+		},
+	}, graph)
+
+	dot := &bytes.Buffer{}
+	require.NoError(t, graph.WriteDOT(dot))
+	assert.Equal(t, `digraph "CI" {
+  rankdir=LR;
+  node [shape=box, style=rounded];
+  "lint" [label="Lint \"all\""];
+  "test" [label="test\nmatrix of 2 jobs"];
+  "test/0" [label="18", style="rounded,dashed"];
+  "test" -> "test/0" [style=dashed];
+  "test/1" [label="20", style="rounded,dashed"];
+  "test" -> "test/1" [style=dashed];
+  "broken" [label="broken"];
+  "deploy" [label="deploy\nuses octo/repo/.github/workflows/deploy.yml@v1", shape=component];
+  "lint" -> "test";
+  "lint" -> "broken";
+  "test/0" -> "deploy";
+  "test/1" -> "deploy";
+  "broken" -> "deploy";
+}
+`, dot.String())
+
+	mermaid := &bytes.Buffer{}
+	require.NoError(t, graph.WriteMermaid(mermaid))
+	assert.Equal(t, `flowchart LR
+  job0("Lint #quot;all#quot;")
+  job1("test<br/>matrix of 2 jobs")
+  job1_0("18")
+  job1 -.-> job1_0
+  job1_1("20")
+  job1 -.-> job1_1
+  job2("broken")
+  job3[["deploy<br/>uses octo/repo/.github/workflows/deploy.yml@v1"]]
+  job0 --> job1
+  job0 --> job2
+  job1_0 --> job3
+  job1_1 --> job3
+  job2 --> job3
+`, mermaid.String())
+}
+
+func TestWorkflowGraphOfRun(t *testing.T) {
+	wf, err := yamls.ReadWorkflow(strings.NewReader(graphWorkflow), false)
+	require.NoError(t, err)
+	wf.File = "ci.yml"
+	rnr := New(&bytes.Buffer{}, EnvFromEmpty())
+	rnr.RepoDir = t.TempDir()
+	rnr.StateDir = t.TempDir()
+
+	wfState, err := rnr.RunWorkflow(t.Context(), wf, &types.WorkflowContexts{})
+	require.Error(t, err, "broken fails")
+	record, err := ReadRunRecord(RunDir(rnr.StateDir, wfState.Run))
+	require.NoError(t, err)
+	assert.Equal(t, wfState.Run, record.Run)
+	assert.Equal(t, wfState.GitHub.RunID, record.RunID)
+	assert.Equal(t, "ci.yml", record.File)
+	assert.Equal(t, JobResultFailure, record.Jobs["broken"].Result)
+	assert.Equal(t, JobResultSkipped, record.Jobs["deploy"].Result)
+	assert.False(t, record.Jobs["lint"].FinishedAt.Before(record.Jobs["lint"].StartedAt))
+
+	graph, err := WorkflowGraph(t.Context(), wf, record)
+	require.NoError(t, err)
+	assert.Equal(t, JobResultSuccess, graph.Nodes[0].Result)
+	labels := graph.Nodes[2].labelLines()
+	require.Len(t, labels, 2)
+	assert.Equal(t, "broken", labels[0])
+	assert.True(t, strings.HasPrefix(labels[1], "failure in "), labels[1])
+
+	mermaid := &bytes.Buffer{}
+	require.NoError(t, graph.WriteMermaid(mermaid))
+	assert.Contains(t, mermaid.String(), "  job3[[\"deploy<br/>uses octo/repo/.github/workflows/deploy.yml@v1<br/>skipped\"]]\n")
+	assert.Contains(t, mermaid.String(), "  classDef failure fill:#f5b7b1\n  class job2 failure\n")
+	assert.Contains(t, mermaid.String(), "  classDef skipped fill:#f4f6f7\n  class job3 skipped\n")
+
+	dot := &bytes.Buffer{}
+	require.NoError(t, graph.WriteDOT(dot))
+	assert.Contains(t, dot.String(), `style="rounded,filled", fillcolor="#f5b7b1"`)
+}
@@ -0,0 +1,39 @@
+package runner
+
+// KeepJobRoot decides whether the root directory of a job (workspace, step files, event payload)
+// is kept on disk after the job is done
+type KeepJobRoot int
+
+const (
+	// KeepJobRootNever deletes the job root when the job is done. This is the default.
+	KeepJobRootNever KeepJobRoot = iota
+	// KeepJobRootOnFailure keeps the job root only if the job failed
+	KeepJobRootOnFailure
+	// KeepJobRootAlways keeps the job root regardless of the job result
+	KeepJobRootAlways
+)
+
+func (k KeepJobRoot) String() string {
+	switch k {
+	case KeepJobRootNever:
+		return "never"
+	case KeepJobRootOnFailure:
+		return "on-failure"
+	case KeepJobRootAlways:
+		return "always"
+	default:
+		return "unknown"
+	}
+}
+
+// shouldKeep reports whether the job root should be kept given the error the job finished with
+func (k KeepJobRoot) shouldKeep(jobErr error) bool {
+	switch k {
+	case KeepJobRootAlways:
+		return true
+	case KeepJobRootOnFailure:
+		return jobErr != nil
+	default:
+		return false
+	}
+}
@@ -0,0 +1,130 @@
+package runner
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/workspace"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+var jobRootKeptRe = regexp.MustCompile(`job root kept at (\S+)`)
+
+func TestKeepJobRoot(t *testing.T) {
+	const wfYAML = `
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: |
+          test -f "$GITHUB_WORKSPACE/hello.txt"
+          echo built > "$GITHUB_WORKSPACE/out.txt"
+          test "$FAIL" != "true"
+`
+	source := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(source, "hello.txt"), []byte("hello"), 0o644))
+
+	run := func(t *testing.T, keep KeepJobRoot, fail bool) (string, error) {
+		t.Helper()
+		wf, err := yamls.ReadWorkflow(strings.NewReader(wfYAML), false)
+		require.NoError(t, err)
+
+		console := &bytes.Buffer{}
+		r := New(console, EnvFromMap(map[string]string{
+			"PATH": os.Getenv("PATH"),
+			"FAIL": strconv.FormatBool(fail),
+		}))
+		r.RepoDir = source
+		r.Workspace = workspace.Options{Mode: workspace.ModeCopy, Source: source}
+		r.KeepJobRoot = keep
+		_, err = r.RunWorkflow(t.Context(), wf, &types.WorkflowContexts{})
+		return console.String(), err
+	}
+
+	t.Run("never", func(t *testing.T) {
+		out, err := run(t, KeepJobRootNever, true)
+		require.Error(t, err)
+		assert.NotRegexp(t, jobRootKeptRe, out)
+	})
+
+	t.Run("on failure", func(t *testing.T) {
+		out, err := run(t, KeepJobRootOnFailure, false)
+		require.NoError(t, err)
+		assert.NotRegexp(t, jobRootKeptRe, out)
+
+		out, err = run(t, KeepJobRootOnFailure, true)
+		require.Error(t, err)
+		m := jobRootKeptRe.FindStringSubmatch(out)
+		require.Len(t, m, 2, out)
+		t.Cleanup(func() { os.RemoveAll(m[1]) })
+		assert.FileExists(t, filepath.Join(m[1], "workspace", "out.txt"))
+	})
+
+	t.Run("always", func(t *testing.T) {
+		out, err := run(t, KeepJobRootAlways, false)
+		require.NoError(t, err)
+		m := jobRootKeptRe.FindStringSubmatch(out)
+		require.Len(t, m, 2, out)
+		t.Cleanup(func() { os.RemoveAll(m[1]) })
+		assert.FileExists(t, filepath.Join(m[1], "workspace", "hello.txt"))
+	})
+}
+
+func TestKeepJobRootWorktree(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	source := t.TempDir()
+	runGit := func(args ...string) string {
+		t.Helper()
+		out, err := exec.Command("git", append([]string{"-C", source}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+		return string(out)
+	}
+	runGit("init", "--quiet")
+	runGit("config", "user.name", "Octo Cat")
+	runGit("config", "user.email", "octo@example.com")
+	require.NoError(t, os.WriteFile(filepath.Join(source, "hello.txt"), []byte("hello"), 0o644))
+	runGit("add", ".")
+	runGit("commit", "--quiet", "-m", "first")
+
+	wf, err := yamls.ReadWorkflow(strings.NewReader(`
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: test -f "$GITHUB_WORKSPACE/hello.txt"
+`), false)
+	require.NoError(t, err)
+
+	console := &bytes.Buffer{}
+	r := New(console, EnvFromMap(map[string]string{"PATH": os.Getenv("PATH")}))
+	r.RepoDir = source
+	r.Workspace = workspace.Options{Mode: workspace.ModeWorktree, Source: source}
+	r.KeepJobRoot = KeepJobRootAlways
+	_, err = r.RunWorkflow(t.Context(), wf, &types.WorkflowContexts{})
+	require.NoError(t, err)
+
+	m := jobRootKeptRe.FindStringSubmatch(console.String())
+	require.Len(t, m, 2, console.String())
+	t.Cleanup(func() { os.RemoveAll(m[1]) })
+	ws := filepath.Join(m[1], "workspace")
+	assert.FileExists(t, filepath.Join(ws, "hello.txt"), "the worktree of a kept job root is kept")
+	assert.Contains(t, runGit("worktree", "list"), ws)
+
+	assert.Contains(t, console.String(), "git -C "+source+" worktree remove --force "+ws)
+	runGit("worktree", "remove", "--force", ws)
+	assert.NotContains(t, runGit("worktree", "list"), ws)
+}
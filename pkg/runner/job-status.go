@@ -0,0 +1,235 @@
+package runner
+
+import (
+	"context"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/runner/expr"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+// defaultJobTimeout is the timeout-minutes of jobs that don't set it, like in GitHub
+const defaultJobTimeout = 360 * time.Minute
+
+// JobResult is the result of a job, as jobs that need it see it in the needs context
+type JobResult string
+
+const (
+	JobResultSuccess   JobResult = "success"
+	JobResultFailure   JobResult = "failure"
+	JobResultCancelled JobResult = "cancelled"
+	JobResultSkipped   JobResult = "skipped"
+)
+
+// the outcomes and conclusions of steps in the steps context
+const (
+	stepOutcomeSuccess = "success"
+	stepOutcomeFailure = "failure"
+	stepOutcomeSkipped = "skipped"
+)
+
+// stepStatus is the result of a step before (outcome) and after (conclusion) continue-on-error is applied
+type stepStatus struct {
+	outcome    string
+	conclusion string
+}
+
+// Failed reports whether the job failed in a way that fails the workflow
+func (j *Job) Failed() bool {
+	if j.Result != JobResultFailure && j.Result != JobResultCancelled {
+		return false
+	}
+	return !j.continueOnError
+}
+
+// setStatus sets job.status, which the steps that follow see. A failed or cancelled job stays that way.
+func (j *Job) setStatus(status JobResult) {
+	j.stepStatusesLock.Lock()
+	defer j.stepStatusesLock.Unlock()
+	if j.status == JobResultSuccess || status == JobResultCancelled {
+		j.status = status
+	}
+}
+
+func (j *Job) setStepStatus(stepID string, status stepStatus) {
+	j.stepStatusesLock.Lock()
+	defer j.stepStatusesLock.Unlock()
+	j.stepStatuses[stepID] = status
+}
+
+func (j *Job) jobStatus() JobResult {
+	j.stepStatusesLock.RLock()
+	defer j.stepStatusesLock.RUnlock()
+	return j.status
+}
+
+// stepsContext is the steps context: the steps with an id that ran or were skipped so far
+func (j *Job) stepsContext() expr.StepsContext {
+	steps := expr.StepsContext{}
+	if j.Config == nil {
+		return steps
+	}
+	outputs := j.StepOutputsCopy()
+	j.stepStatusesLock.RLock()
+	defer j.stepStatusesLock.RUnlock()
+	for i, step := range j.Config.Steps {
+		stepID := makeStepID(i, step)
+		status, ok := j.stepStatuses[stepID]
+		if step.ID == "" || !ok {
+			continue
+		}
+		stepOutputs := outputs[stepID]
+		if stepOutputs == nil {
+			stepOutputs = map[string]string{}
+		}
+		steps[step.ID] = expr.StepsContextEntry{Outputs: stepOutputs, Outcome: status.outcome, Conclusion: status.conclusion}
+	}
+	return steps
+}
+
+// exprContextParams are the parameters of the expression context of a step of the job
+func (j *Job) exprContextParams(step *StepContext) MakeExprContextParams {
+	return MakeExprContextParams{Workflow: j.Workflow, Job: j, Step: step}
+}
+
+// evaluateIf evaluates the if of the job. The status functions in it check the results of the jobs it needs.
+func (j *Job) evaluateIf(ctx context.Context) (bool, error) {
+	evaluator, err := newEvaluator(ctx, MakeExprContextParams{Workflow: j.Workflow, Job: j})
+	if err != nil {
+		return false, err
+	}
+	run, err := evaluator.EvaluateCondition(j.Config.If.Value)
+	return run, j.Workflow.errorAt(j.Config.ValueNode("if"), err)
+}
+
+// evaluateStepIf evaluates the if of a step. The status functions in it check job.status.
+func (j *Job) evaluateStepIf(ctx context.Context, step *yamls.Step, stepContext *StepContext) (bool, error) {
+	evaluator, err := newEvaluator(ctx, j.exprContextParams(stepContext))
+	if err != nil {
+		return false, err
+	}
+	run, err := evaluator.EvaluateCondition(step.If.Value)
+	return run, j.Workflow.errorAt(step.ValueNode("if"), err)
+}
+
+// evaluateContinueOnError evaluates a continue-on-error value, which is a boolean or an expression
+func (j *Job) evaluateContinueOnError(ctx context.Context, raw string, p MakeExprContextParams) (bool, error) {
+	if raw == "" {
+		return false, nil
+	}
+	evaluator, err := newEvaluator(ctx, p)
+	if err != nil {
+		return false, err
+	}
+	return evaluateBool(evaluator, raw)
+}
+
+// evaluateBool evaluates a value that is a boolean or an expression. Empty is false.
+func evaluateBool(evaluator *expr.Evaluator, raw string) (bool, error) {
+	if raw == "" {
+		return false, nil
+	}
+	evaled, err := evaluator.EvaluateTemplate(raw)
+	if err != nil {
+		return false, err
+	}
+	value, err := strconv.ParseBool(strings.TrimSpace(evaled))
+	if err != nil {
+		return false, oops.Errorf("expected a boolean, got %q", evaled)
+	}
+	return value, nil
+}
+
+// evaluateTimeout evaluates a timeout-minutes value, which is a number or an expression.
+// Zero means there is no timeout.
+func (j *Job) evaluateTimeout(ctx context.Context, raw string, p MakeExprContextParams) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	evaluator, err := newEvaluator(ctx, p)
+	if err != nil {
+		return 0, err
+	}
+	evaled, err := evaluator.EvaluateTemplate(raw)
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.ParseFloat(strings.TrimSpace(evaled), 64)
+	if err != nil || minutes <= 0 {
+		return 0, oops.Errorf("timeout-minutes must be a positive number, got %q", evaled)
+	}
+	return time.Duration(minutes * float64(time.Minute)), nil
+}
+
+// timeout is the timeout-minutes of the job, or the default
+func (j *Job) timeout(ctx context.Context) (time.Duration, error) {
+	timeout, err := j.evaluateTimeout(ctx, j.Config.TimeoutMinutes, MakeExprContextParams{Workflow: j.Workflow, Job: j})
+	if err != nil || timeout > 0 {
+		return timeout, err
+	}
+	return defaultJobTimeout, nil
+}
+
+// evaluateEnv adds the env of the job, templated, to the env of the workflow the steps start with.
+// It's evaluated once the environment of the job is known, so it can use its secrets and vars.
+func (j *Job) evaluateEnv(ctx context.Context) error {
+	jobEnv := j.Config.Environment()
+	if len(jobEnv) == 0 {
+		return nil
+	}
+	evaluator, err := newEvaluator(ctx, MakeExprContextParams{Workflow: j.Workflow, Job: j})
+	if err != nil {
+		return err
+	}
+	env := maps.Clone(j.InitialEnv)
+	if env == nil {
+		env = make(map[string]string, len(jobEnv))
+	}
+	for k, v := range jobEnv {
+		evaled, err := evaluator.EvaluateTemplate(v)
+		if err != nil {
+			return oops.With("env", k).Wrapf(j.Workflow.errorAt(j.Config.ValueNode("env", k), err), "evaluating env var %s", k)
+		}
+		env[k] = evaled
+	}
+	j.InitialEnv = env
+	return nil
+}
+
+// evaluateOutputs evaluates the outputs of the job, which the jobs that need it see
+func (j *Job) evaluateOutputs(ctx context.Context) error {
+	if len(j.Config.Outputs) == 0 {
+		return nil
+	}
+	evaluator, err := newEvaluator(ctx, MakeExprContextParams{Workflow: j.Workflow, Job: j})
+	if err != nil {
+		return err
+	}
+	j.Outputs = make(map[string]string, len(j.Config.Outputs))
+	for k, v := range j.Config.Outputs {
+		evaled, err := evaluator.EvaluateTemplate(v)
+		if err != nil {
+			return oops.With("output", k).Wrapf(j.Workflow.errorAt(j.Config.ValueNode("outputs", k), err), "evaluating output %s", k)
+		}
+		j.Outputs[k] = evaled
+	}
+	return nil
+}
+
+// needsContext is the needs context of a job that needs the given jobs
+func needsContext(jobs []*Job) map[string]expr.NeedsContext {
+	needs := make(map[string]expr.NeedsContext, len(jobs))
+	for _, need := range jobs {
+		outputs := need.Outputs
+		if outputs == nil {
+			outputs = map[string]string{}
+		}
+		needs[need.Name] = expr.NeedsContext{Outputs: outputs, Result: string(need.Result)}
+	}
+	return needs
+}
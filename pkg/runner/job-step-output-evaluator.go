@@ -3,6 +3,7 @@ package runner
 import (
 	"context"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/samber/oops"
@@ -129,12 +130,52 @@ func (e *JobStepOutputEvaluator) processIssueCommand(ctx context.Context, comman
 	return nil
 }
 
+// PrintLine prints a line of the step output to the console. Lines of stderr are marked with [stderrMarker].
+// A partial line of one stream is ended before a line of the other stream is printed, so streams never
+// share a console line.
+func (e *JobStepOutputEvaluator) PrintLine(ctx context.Context, line OutputLine) error {
+	var text strings.Builder
+	continues := e.step.partialLine && e.step.partialStream == line.Stream
+	if e.step.partialLine && !continues {
+		text.WriteString("\n")
+	}
+	if !continues {
+		if r := e.job.Workflow.runner; r != nil && r.Timestamps {
+			text.WriteString(line.Time.UTC().Format(timestampFormat) + " ")
+		}
+		if line.Stream == OutputStreamStderr {
+			text.WriteString(stderrMarker)
+		}
+	}
+	text.WriteString(line.Text)
+	e.step.partialLine = line.Partial
+	e.step.partialStream = line.Stream
+	if !line.Partial {
+		text.WriteString("\n")
+	}
+	if _, err := io.WriteString(e.step.Console, text.String()); err != nil {
+		return oops.FromContext(ctx).Wrapf(err, "writing to step console")
+	}
+	return nil
+}
+
+// stderrMarker prefixes the lines a step writes to stderr on the console
+const stderrMarker = "[stderr] "
+
+// timestampFormat is the format of the timestamps GitHub prefixes log lines with
+const timestampFormat = "2006-01-02T15:04:05.0000000Z"
+
+// Print prints text that the runner generates (rather than the step) to the console
 func (e *JobStepOutputEvaluator) Print(ctx context.Context, text string) error {
-	text = e.job.secretsMasker.Mask(text)
 	textb := []byte(text)
 	if text == "" || text[len(text)-1] != '\n' {
 		textb = append(textb, '\n')
 	}
+	// the runner's text doesn't continue a partial line of the step
+	if e.step.partialLine {
+		textb = append([]byte{'\n'}, textb...)
+		e.step.partialLine = false
+	}
 
 	_, err := e.step.Console.Write(textb)
 	if err != nil {
@@ -2,6 +2,9 @@ package runner
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"maps"
 	"os"
@@ -10,12 +13,17 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/samber/oops"
 
+	"github.com/drornir/better-actions/pkg/concurrency"
 	"github.com/drornir/better-actions/pkg/ctxkit"
 	"github.com/drornir/better-actions/pkg/defers"
 	"github.com/drornir/better-actions/pkg/log"
+	"github.com/drornir/better-actions/pkg/runner/expr"
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/workspace"
 	"github.com/drornir/better-actions/pkg/yamls"
 )
 
@@ -28,6 +36,25 @@ type Job struct {
 	jobFilesRoot *os.Root
 	WorkspaceDir string
 	debugEnabled bool
+	github       types.GitHub
+	runner       expr.RunnerContext
+	keepJobRoot  bool
+	// secrets and vars are the ones of the workflow, with the ones of the environment of the job
+	secrets map[string]string
+	vars    map[string]string
+	// Environment is the deployment environment of the job, once it passed its protection rules
+	Environment    *JobEnvironment
+	environmentURL string
+	// Result is the result of the job once it's done
+	Result JobResult
+	// Outputs are the evaluated outputs of the job
+	Outputs         map[string]string
+	continueOnError bool
+	// StartedAt and FinishedAt are when the job started and finished running
+	StartedAt  time.Time
+	FinishedAt time.Time
+	// needs is the needs context: the results and outputs of the jobs this job needs
+	needs map[string]expr.NeedsContext
 
 	stepsEnvLock      sync.RWMutex
 	stepsEnv          map[string]string
@@ -39,92 +66,301 @@ type Job struct {
 	stepStates        map[string]map[string]string
 	stepSummariesLock sync.RWMutex
 	stepSummaries     map[string]string
+	stepStatusesLock  sync.RWMutex
+	stepStatuses      map[string]stepStatus
+	// status is job.status: success until a step fails
+	status JobResult
+
+	postStepsLock sync.Mutex
+	postSteps     []postStep
 
 	secretsMasker SecretsMasker
 }
 
+// postStep is the cleanup part of an action that runs after all the steps of the job
+type postStep struct {
+	name string
+	run  func(ctx context.Context, console io.Writer) error
+}
+
 func NewJob(name string, yaml *yamls.Job, wf *WorkflowState, console io.Writer) *Job {
+	github := wf.GitHub
+	github.Job = name
 	return &Job{
 		Name:       name,
 		Console:    console,
 		Config:     yaml,
 		InitialEnv: wf.Env,
 		Workflow:   wf,
+		github:     github,
+		secrets:    wf.Secrets,
+		vars:       wf.Vars,
 	}
 }
 
-func (j *Job) Run(ctx context.Context) error {
+func (j *Job) Run(ctx context.Context) (_err error) {
 	oopser := oops.FromContext(ctx).With("jobName", j.Name)
 	logger := log.FromContext(ctx).With("jobName", j.Name)
 
 	logger.D(ctx, "running job")
 
+	parentCtx := ctx
+	j.StartedAt = time.Now()
+	defer func() {
+		j.FinishedAt = time.Now()
+		if j.Result == JobResultSkipped {
+			return
+		}
+		switch {
+		case _err == nil:
+			j.Result = JobResultSuccess
+		case parentCtx.Err() != nil, j.jobStatus() == JobResultCancelled,
+			errors.Is(_err, context.Canceled), errors.Is(_err, context.DeadlineExceeded):
+			// cancelled, or timed out
+			j.Result = JobResultCancelled
+			var groupCancelled *concurrency.CancelledError
+			if errors.As(_err, &groupCancelled) {
+				fmt.Fprintf(j.Console, "job %s: %s\n", j.Name, groupCancelled)
+			}
+		default:
+			j.Result = JobResultFailure
+		}
+	}()
+
+	if parentCtx.Err() != nil {
+		return oopser.Wrapf(context.Cause(parentCtx), "workflow was cancelled")
+	}
+	run, err := j.evaluateIf(ctx)
+	if err != nil {
+		return oopser.Wrapf(err, "evaluating if")
+	}
+	if !run {
+		j.Result = JobResultSkipped
+		fmt.Fprintf(j.Console, "job %s: skipped\n", j.Name)
+		return nil
+	}
+
+	ctx, releaseGroup, err := j.Workflow.runner.joinConcurrencyGroup(ctx, "job "+j.Name, j.Config.Concurrency(), MakeExprContextParams{Workflow: j.Workflow, Job: j})
+	if err != nil {
+		return oopser.Wrapf(err, "joining concurrency group")
+	}
+	defer releaseGroup()
+
+	timeout, err := j.timeout(ctx)
+	if err != nil {
+		return oopser.Wrapf(j.Workflow.errorAt(j.Config.ValueNode("timeout-minutes"), err), "evaluating timeout-minutes")
+	}
+	j.continueOnError, err = j.evaluateContinueOnError(ctx, j.Config.RawContinueOnError, MakeExprContextParams{Workflow: j.Workflow, Job: j})
+	if err != nil {
+		return oopser.Wrapf(j.Workflow.errorAt(j.Config.ValueNode("continue-on-error"), err), "evaluating continue-on-error")
+	}
+
+	if err := j.enterEnvironment(ctx); err != nil {
+		return oopser.Wrapf(err, "entering environment")
+	}
+	// the timeout starts once the protection rules of the environment passed, like on GitHub
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := j.evaluateEnv(ctx); err != nil {
+		return oopser.Wrapf(err, "evaluating env")
+	}
+
 	jobCleanup, err := j.prepareJob(ctx, j.Name)
 	if err != nil {
 		return oopser.Wrapf(err, "preparing job")
 	}
-	defer jobCleanup()
+	defer func() {
+		if j.Workflow.runner != nil && j.Workflow.runner.KeepJobRoot.shouldKeep(_err) {
+			j.keepJobRoot = true
+			fmt.Fprintf(j.Console, "job %s: job root kept at %s\n", j.Name, j.jobFilesRoot.Name())
+			if ws := j.Workflow.workspace; ws.Mode == workspace.ModeWorktree {
+				fmt.Fprintf(j.Console, "job %s: remove its worktree with: git -C %s worktree remove --force %s\n", j.Name, ws.Source, j.WorkspaceDir)
+			}
+		}
+		jobCleanup()
+	}()
 
+	// stepsErr is the reason the job failed, if any of its steps did
+	var stepsErr error
 	for i, step := range j.Config.Steps {
+		step = step.ApplyRunDefaults(j.runDefaults()...)
 		ctx, logger, oopser := ctxkit.With(ctx,
 			"stepIndex", i,
 			"step.name", step.Name,
 			"step.ID", makeStepID(i, step),
 		)
-		logger.D(ctx, "running step")
+		if ctx.Err() != nil {
+			j.setStatus(JobResultCancelled)
+		}
 
 		stepContext, err := j.newStepContext(ctx, i, step)
 		if err != nil {
 			return oopser.Wrapf(err, "creating step context")
 		}
-		outEval := JobStepOutputEvaluator{
-			job:  j,
-			step: stepContext,
+
+		run, err := j.evaluateStepIf(ctx, step, stepContext)
+		if err != nil {
+			return oopser.Wrapf(err, "evaluating step if")
 		}
-		stepWriteTo := NewStepOutputInterpreter(&outEval)
-		stepWriteTo.Start(ctx)
-
-		var stepResult StepResult
-		runErr := func() error {
-			defer stepWriteTo.Close()
-			switch {
-			case step.Run != "":
-				sr := &StepRun{
-					Config:  step,
-					Context: stepContext,
-				}
-				res, err := sr.Run(ctx, stepWriteTo)
-				if err != nil {
-					return oopser.Wrapf(err, "executing step")
-				}
-				stepResult = res
-			case step.Uses != "":
-				// TODO
-				return oopser.New("'uses' is not implemented")
-			default:
-				return oopser.New("step is invalid: doesn't have 'run' or 'uses'")
-			}
-			return nil
-		}()
-		if runErr != nil {
-			return runErr
+		if !run {
+			logger.D(ctx, "skipping step")
+			j.setStepStatus(stepContext.StepID, stepStatus{outcome: stepOutcomeSkipped, conclusion: stepOutcomeSkipped})
+			continue
 		}
-		if stepWriteTo.Err() != nil {
-			return oopser.Wrapf(stepWriteTo.Err(), "processing step output")
+		logger.D(ctx, "running step")
+
+		stepResult, err := j.runStep(ctx, step, stepContext)
+		if err != nil {
+			return err
 		}
 
+		status := stepStatus{outcome: stepOutcomeSuccess, conclusion: stepOutcomeSuccess}
 		if stepResult.Status == StepStatusFailed {
-			// TODO this step failed but I need to check the conditions on the next steps and possibly move on
-			return oopser.
-				Wrapf(oops.New(stepResult.FailReason), "step failed")
+			status = stepStatus{outcome: stepOutcomeFailure, conclusion: stepOutcomeFailure}
+			continueOnError, err := j.evaluateContinueOnError(ctx, step.RawContinueOnError, j.exprContextParams(stepContext))
+			if err != nil {
+				return oopser.Wrapf(j.Workflow.errorAt(step.ValueNode("continue-on-error"), err), "evaluating continue-on-error")
+			}
+			if continueOnError {
+				status.conclusion = stepOutcomeSuccess
+				fmt.Fprintf(stepContext.Console, "step failed, continuing: %s\n", stepResult.FailReason)
+				stepContext.Console.Flush()
+			} else {
+				if ctx.Err() != nil {
+					j.setStatus(JobResultCancelled)
+				} else {
+					j.setStatus(JobResultFailure)
+				}
+				if stepsErr == nil && ctx.Err() != nil {
+					stepsErr = oopser.Wrapf(j.Workflow.errorAt(step.Node, context.Cause(ctx)), "step was cancelled")
+				} else if stepsErr == nil {
+					stepsErr = oopser.Wrapf(j.Workflow.errorAt(step.Node, oops.New(stepResult.FailReason)), "step failed")
+				}
+			}
 		}
+		j.setStepStatus(stepContext.StepID, status)
 
 		if err := j.loadWFCmdFilesAfterStep(ctx, stepContext); err != nil {
 			return oopser.Wrapf(err, "processing workflow command files")
 		}
-		// TODO
 	}
 
+	if err := j.resolveEnvironmentURL(ctx); err != nil {
+		return oopser.Wrapf(err, "resolving environment url")
+	}
+	if err := j.evaluateOutputs(ctx); err != nil {
+		return oopser.Wrapf(err, "evaluating outputs")
+	}
+	// post steps run only if the job succeeded, like actions that declare post-if: success()
+	if stepsErr == nil && ctx.Err() == nil {
+		if err := j.runPostSteps(ctx); err != nil {
+			return err
+		}
+	}
+	if stepsErr == nil && ctx.Err() != nil {
+		stepsErr = oopser.Wrapf(context.Cause(ctx), "job was cancelled")
+	}
+	return stepsErr
+}
+
+// runStep runs a step whose if passed. An error means the step couldn't be run, rather than that it failed.
+func (j *Job) runStep(ctx context.Context, step *yamls.Step, stepContext *StepContext) (StepResult, error) {
+	oopser := oops.FromContext(ctx)
+
+	timeout, err := j.evaluateTimeout(ctx, step.TimeoutMinutes, j.exprContextParams(stepContext))
+	if err != nil {
+		return StepResult{}, oopser.Wrapf(j.Workflow.errorAt(step.ValueNode("timeout-minutes"), err), "evaluating timeout-minutes")
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	outEval := JobStepOutputEvaluator{
+		job:  j,
+		step: stepContext,
+	}
+	stepWriteTo := NewStepOutputReader(&outEval)
+	stepWriteTo.Start(ctx)
+
+	var stepResult StepResult
+	runErr := func() error {
+		defer stepContext.Console.Flush()
+		defer stepWriteTo.Close()
+		switch {
+		case step.Run != "":
+			sr := &StepRun{
+				Config:  step,
+				Context: stepContext,
+				Job:     j,
+			}
+			res, err := sr.Run(ctx, stepWriteTo.Stdout(), stepWriteTo.Stderr())
+			if err != nil {
+				return oopser.Wrapf(err, "executing step")
+			}
+			stepResult = res
+		case step.Uses != "":
+			su := &StepUses{
+				Config:  step,
+				Context: stepContext,
+				Job:     j,
+			}
+			res, err := su.Run(ctx, stepWriteTo)
+			if err != nil {
+				return oopser.Wrapf(err, "executing step")
+			}
+			stepResult = res
+		default:
+			return oopser.New("step is invalid: doesn't have 'run' or 'uses'")
+		}
+		return nil
+	}()
+	if runErr != nil {
+		return StepResult{}, runErr
+	}
+	if stepWriteTo.Err() != nil {
+		return StepResult{}, oopser.Wrapf(stepWriteTo.Err(), "processing step output")
+	}
+	if stepResult.Status == StepStatusFailed && ctx.Err() != nil {
+		stepResult.FailReason = fmt.Sprintf("%s (%s)", stepResult.FailReason, context.Cause(ctx))
+	}
+	return stepResult, nil
+}
+
+// runDefaults are the defaults.run of the job and the workflow, by precedence
+func (j *Job) runDefaults() []yamls.RunDefaults {
+	defaults := []yamls.RunDefaults{j.Config.Defaults.Run}
+	if j.Workflow.Config != nil {
+		defaults = append(defaults, j.Workflow.Config.Defaults.Run)
+	}
+	return defaults
+}
+
+func (j *Job) addPostStep(name string, run func(ctx context.Context, console io.Writer) error) {
+	j.postStepsLock.Lock()
+	defer j.postStepsLock.Unlock()
+	j.postSteps = append(j.postSteps, postStep{name: name, run: run})
+}
+
+// runPostSteps runs the post steps in reverse order, like the GitHub runner.
+// It's called only when all the steps of the job succeeded.
+func (j *Job) runPostSteps(ctx context.Context) error {
+	j.postStepsLock.Lock()
+	posts := slices.Clone(j.postSteps)
+	j.postStepsLock.Unlock()
+
+	for _, post := range slices.Backward(posts) {
+		ctx, logger, oopser := ctxkit.With(ctx, "postStep", post.name)
+		logger.D(ctx, "running post step")
+		fmt.Fprintf(j.Console, "Post %s\n", post.name)
+		console := j.secretsMasker.NewWriter(j.Console)
+		err := post.run(ctx, console)
+		console.Flush()
+		if err != nil {
+			return oopser.Wrapf(err, "post step %s failed", post.name)
+		}
+	}
 	return nil
 }
 
@@ -153,12 +389,21 @@ func (j *Job) prepareJob(
 	j.stepOutputs = make(map[string]map[string]string)
 	j.stepStates = make(map[string]map[string]string)
 	j.stepSummaries = make(map[string]string)
+	j.stepStatuses = make(map[string]stepStatus)
+	j.status = JobResultSuccess
+	j.postSteps = nil
+	// before anything of the job can print them
+	j.secretsMasker.AddSecrets(slices.Collect(maps.Values(j.secrets))...)
 
 	jobRootPath, err := os.MkdirTemp(os.TempDir(), "bact-job-"+jobName+"-")
 	if err != nil {
 		return cleanup.Noop, oopser.Wrapf(err, "creating job root directory")
 	}
-	cleanup.Add(func() { os.RemoveAll(jobRootPath) })
+	cleanup.Add(func() {
+		if !j.keepJobRoot {
+			os.RemoveAll(jobRootPath)
+		}
+	})
 
 	jobRoot, err := os.OpenRoot(jobRootPath)
 	if err != nil {
@@ -173,9 +418,68 @@ func (j *Job) prepareJob(
 		cleanup.Run()
 		return cleanup.Noop, oopser.Wrapf(err, "creating workspace directory")
 	}
-	j.WorkspaceDir = path.Join(jobRootPath, "workspace")
+	workspaceDir, workspaceCleanup, err := workspace.Prepare(ctx, j.Workflow.workspace, path.Join(jobRootPath, "workspace"))
+	if err != nil {
+		cleanup.Run()
+		return cleanup.Noop, oopser.Wrapf(err, "populating workspace")
+	}
+	cleanup.Add(func() {
+		// a kept job root keeps its workspace, even when it's a git worktree
+		if !j.keepJobRoot {
+			workspaceCleanup()
+		}
+	})
+	j.WorkspaceDir = workspaceDir
 	j.stepsEnv["GITHUB_WORKSPACE"] = j.WorkspaceDir
 
+	j.github = j.Workflow.GitHub
+	j.github.Job = jobName
+	if j.Environment != nil {
+		j.github.Environment = j.Environment.Name
+	}
+	j.github.Workspace = j.WorkspaceDir
+	eventJSON, err := json.Marshal(j.github.Event)
+	if err != nil {
+		cleanup.Run()
+		return cleanup.Noop, oopser.Wrapf(err, "marshaling event payload")
+	}
+	if j.github.Event == nil {
+		eventJSON = []byte("{}")
+	}
+	if err := jobRoot.WriteFile("event.json", eventJSON, 0o644); err != nil {
+		cleanup.Run()
+		return cleanup.Noop, oopser.Wrapf(err, "writing event payload file")
+	}
+	j.github.EventPath = path.Join(jobRootPath, "event.json")
+	maps.Copy(j.stepsEnv, githubDefaultEnv(j.github))
+
+	// RUNNER_TEMP is emptied at the end of every job, even when the job root is kept
+	if err := jobRoot.Mkdir("temp", 0o755); err != nil {
+		cleanup.Run()
+		return cleanup.Noop, oopser.Wrapf(err, "creating runner temp directory")
+	}
+	tempDir := path.Join(jobRootPath, "temp")
+	cleanup.Add(func() { os.RemoveAll(tempDir) })
+	toolCacheDir, err := j.toolCacheDir(jobRootPath)
+	if err != nil {
+		cleanup.Run()
+		return cleanup.Noop, oopser.Wrapf(err, "creating tool cache directory")
+	}
+	j.debugEnabled = debugEnabled(j.InitialEnv)
+	j.runner = newRunnerContext(tempDir, toolCacheDir, j.debugEnabled)
+	maps.Copy(j.stepsEnv, runnerDefaultEnv(j.runner))
+
+	if services := j.Workflow.services; services != nil {
+		servicesEnv, err := services.jobEnv(j.github.RunID, jobName)
+		if err != nil {
+			cleanup.Run()
+			return cleanup.Noop, oopser.Wrapf(err, "creating environment of run services")
+		}
+		// the runtime token is a bearer token, the GitHub runner masks it too
+		j.secretsMasker.AddSecrets(servicesEnv["ACTIONS_RUNTIME_TOKEN"])
+		maps.Copy(j.stepsEnv, servicesEnv)
+	}
+
 	if err := jobRoot.Mkdir("steps", 0o755); err != nil {
 		cleanup.Run()
 		return cleanup.Noop, oopser.Wrapf(err, "creating steps directory")
@@ -184,6 +488,23 @@ func (j *Job) prepareJob(
 	return cleanup.Run, nil
 }
 
+// toolCacheDir creates and returns the tool cache directory of the job
+func (j *Job) toolCacheDir(jobRootPath string) (string, error) {
+	dir := path.Join(jobRootPath, "tool-cache")
+	if r := j.Workflow.runner; r != nil {
+		switch {
+		case r.ToolCacheDir != "":
+			dir = r.ToolCacheDir
+		case r.StateDir != "":
+			dir = path.Join(r.StateDir, "tool-cache")
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", oops.With("dir", dir).Wrap(err)
+	}
+	return dir, nil
+}
+
 func (j *Job) newStepContext(ctx context.Context, indexInJob int, step *yamls.Step) (*StepContext, error) {
 	oopser := oops.FromContext(ctx)
 	stpID := makeStepID(indexInJob, step)
@@ -225,7 +546,7 @@ func (j *Job) newStepContext(ctx context.Context, indexInJob int, step *yamls.St
 
 	return &StepContext{
 		StepID:       stpID,
-		Console:      j.Console,
+		Console:      j.secretsMasker.NewWriter(j.Console),
 		IndexInJob:   indexInJob,
 		WorkingDir:   wd,
 		WorkspaceDir: j.WorkspaceDir,
@@ -446,7 +767,7 @@ func (j *Job) loadStepSummaryWfCmdFile(ctx context.Context, stepCtx *StepContext
 	j.stepSummariesLock.Lock()
 	defer j.stepSummariesLock.Unlock()
 
-	j.stepSummaries[stepCtx.StepID] = summary
+	j.stepSummaries[stepCtx.StepID] = j.secretsMasker.Mask(summary)
 	logger.D(ctx, "captured step summary", "step.scriptID", stepCtx.StepID)
 	return nil
 }
@@ -0,0 +1,435 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+	"github.com/samber/oops"
+	"gopkg.in/yaml.v3"
+
+	"github.com/drornir/better-actions/pkg/ctxkit"
+	"github.com/drornir/better-actions/pkg/runner/expr"
+	"github.com/drornir/better-actions/pkg/secrets"
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+// Plan is what running a workflow would do, made without running any of its steps. See [Runner.PlanWorkflow].
+type Plan struct {
+	Workflow string `json:"workflow"`
+	File     string `json:"file,omitempty"`
+	// Jobs are in the order they run
+	Jobs []JobPlan `json:"jobs"`
+}
+
+// JobPlan is what a job would do
+type JobPlan struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Needs  []string `json:"needs,omitempty"`
+	RunsOn []string `json:"runsOn,omitempty"`
+	If     Decision `json:"if"`
+	// Uses is the reusable workflow the job calls instead of running steps
+	Uses string `json:"uses,omitempty"`
+	// Matrix are the combinations of the matrix of the job, which GitHub runs as separate jobs
+	Matrix []map[string]any `json:"matrix,omitempty"`
+	Steps  []StepPlan       `json:"steps,omitempty"`
+	// Unsupported are the parts of the job that bact doesn't run like GitHub does, and what it does instead
+	Unsupported []string `json:"unsupported,omitempty"`
+}
+
+// StepPlan is what a step would do
+type StepPlan struct {
+	Name string   `json:"name"`
+	ID   string   `json:"id,omitempty"`
+	If   Decision `json:"if"`
+	// Script is the content of the script file of a run step, with its expressions evaluated
+	Script string `json:"script,omitempty"`
+	// Command runs Script. The path of the script file is relative to the job root.
+	Command          []string `json:"command,omitempty"`
+	WorkingDirectory string   `json:"workingDirectory,omitempty"`
+	Uses             string   `json:"uses,omitempty"`
+	// Builtin is set for the actions that bact implements, which are the only ones it runs
+	Builtin bool              `json:"builtin,omitzero"`
+	With    map[string]string `json:"with,omitempty"`
+	// Unsupported is what bact does instead of running the step like GitHub does, if it can't
+	Unsupported string `json:"unsupported,omitempty"`
+}
+
+// DecisionResult is whether a job or a step runs
+type DecisionResult string
+
+const (
+	DecisionRun  DecisionResult = "run"
+	DecisionSkip DecisionResult = "skip"
+	// DecisionUnknown is the result of conditions that depend on what happens in the run
+	DecisionUnknown DecisionResult = "unknown"
+)
+
+// Decision is the evaluated `if` of a job or a step
+type Decision struct {
+	Condition string         `json:"condition,omitempty"`
+	Result    DecisionResult `json:"result"`
+	// Reason is what an unknown result depends on
+	Reason string `json:"reason,omitempty"`
+}
+
+func (d Decision) String() string {
+	if d.Reason != "" {
+		return fmt.Sprintf("%s (%s)", d.Result, d.Reason)
+	}
+	return string(d.Result)
+}
+
+// runtimeContexts are the contexts whose values are only known while the workflow runs
+var runtimeContexts = map[string]bool{"steps": true, "needs": true, "jobs": true, "job": true}
+
+// runtimeFunctions are the functions whose results are only known while the workflow runs.
+// success() isn't one of them, since plans assume that the jobs and steps before succeed.
+var runtimeFunctions = map[string]bool{"failure": true, "cancelled": true, "hashfiles": true}
+
+// runtimeDependency returns what the value of node depends on that is only known while the workflow runs,
+// like `steps`, or "" if it's known before
+func runtimeDependency(node expr.Node) string {
+	dependency := ""
+	expr.VisitExprNode(node, func(node, _ expr.Node, entering bool) {
+		if !entering || dependency != "" {
+			return
+		}
+		switch n := node.(type) {
+		case *expr.VariableNode:
+			if name := strings.ToLower(n.Name); runtimeContexts[name] {
+				dependency = "depends on " + name
+			}
+		case *expr.FuncCallNode:
+			if runtimeFunctions[strings.ToLower(n.Callee)] {
+				dependency = "depends on " + n.Callee + "()"
+			}
+		}
+	})
+	return dependency
+}
+
+// PlanWorkflow plans what running wf with r would do, without running any of its steps or jobs.
+// The `if` of jobs and steps and the templates of their values are evaluated when they can be before the run,
+// assuming that the jobs and steps before them succeed. Expressions that depend on what happens in the run,
+// like the outputs of steps, are kept as they are. Secrets are masked.
+// The plan is of what bact runs, and the parts of jobs that bact doesn't run like GitHub does are marked
+// unsupported, like matrixes, which bact doesn't expand.
+func (r *Runner) PlanWorkflow(ctx context.Context, wf *yamls.Workflow, wfContext *types.WorkflowContexts) (*Plan, error) {
+	ctx, _, oopser := ctxkit.With(ctx, "workflow", wf.Name)
+
+	repoDir, err := r.repoDir()
+	if err != nil {
+		return nil, oopser.Wrap(err)
+	}
+	github, err := newGithubContext(ctx, repoDir, wf, wfContext.GitHub)
+	if err != nil {
+		return nil, oopser.Wrapf(err, "creating github context")
+	}
+	secretValues, err := secrets.Resolve(ctx, r.SecretProviders...)
+	if err != nil {
+		return nil, oopser.Wrapf(err, "resolving secrets")
+	}
+	maps.Copy(secretValues, wfContext.Secrets)
+	// the secrets context only has masks, and the masker masks the values that get in from elsewhere
+	maskedSecrets := make(map[string]string, len(secretValues))
+	masker := &SecretsMasker{}
+	for name, value := range secretValues {
+		maskedSecrets[name] = maskReplacement
+		masker.AddSecrets(value)
+	}
+
+	wfState := &WorkflowState{
+		Name:    wf.Name,
+		Config:  wf,
+		Jobs:    make(map[string]*Job, len(wf.Jobs)),
+		Inputs:  wfContext.Inputs,
+		Secrets: maskedSecrets,
+		Vars:    wfContext.Vars,
+		GitHub:  github,
+		RepoDir: repoDir,
+
+		runner:    r,
+		templates: expr.NewTemplateCache(),
+	}
+	wfState.Env, err = r.workflowEnv(ctx, wfState)
+	if err != nil {
+		return nil, oopser.Wrap(err)
+	}
+
+	order, err := jobOrder(wf.Jobs)
+	if err != nil {
+		return nil, oopser.Wrapf(err, "invalid job dependencies")
+	}
+	plan := &Plan{Workflow: wf.Name, File: wf.File, Jobs: []JobPlan{}}
+	// results are the results of the jobs that are planned, for the jobs that need them
+	results := make(map[string]DecisionResult, len(order))
+	for _, id := range order {
+		planner := &jobPlanner{workflow: wfState, id: id, config: wf.Jobs[id], masker: masker}
+		jp, err := planner.plan(ctx, results)
+		if err != nil {
+			return nil, oopser.With("job", id).Wrapf(err, "planning job %s", id)
+		}
+		plan.Jobs = append(plan.Jobs, jp)
+		results[id] = jp.If.Result
+	}
+	return plan, nil
+}
+
+// jobPlanner plans a job of a workflow
+type jobPlanner struct {
+	workflow *WorkflowState
+	id       string
+	config   *yamls.Job
+	masker   *SecretsMasker
+}
+
+// plan plans the job like the runner runs it. results are the results of the jobs it needs.
+func (p *jobPlanner) plan(ctx context.Context, results map[string]DecisionResult) (JobPlan, error) {
+	j := NewJob(p.id, p.config, p.workflow, io.Discard)
+	j.needs = make(map[string]expr.NeedsContext, len(p.config.Needs()))
+	var unknownNeeds []string
+	for _, need := range p.config.Needs() {
+		result := JobResultSuccess
+		switch results[need] {
+		case DecisionSkip:
+			result = JobResultSkipped
+		case DecisionUnknown:
+			unknownNeeds = append(unknownNeeds, need)
+		}
+		j.needs[need] = expr.NeedsContext{Outputs: map[string]string{}, Result: string(result)}
+	}
+
+	jobEvaluator, err := newEvaluator(ctx, MakeExprContextParams{Workflow: p.workflow, Job: j})
+	if err != nil {
+		return JobPlan{}, err
+	}
+	jp := JobPlan{
+		ID:    p.id,
+		Name:  p.id,
+		Needs: p.config.Needs(),
+		Uses:  p.config.Uses,
+	}
+	matrixes, err := p.config.GetMatrixes(ctx)
+	if err != nil {
+		return JobPlan{}, p.workflow.errorAt(p.config.ValueNode("strategy", "matrix"), err)
+	}
+	if len(matrixes) > 1 || len(matrixes) == 1 && len(matrixes[0]) > 0 {
+		jp.Matrix = matrixes
+		jp.Unsupported = append(jp.Unsupported, fmt.Sprintf(
+			"bact doesn't expand matrixes: the job runs once instead of %d times, with empty matrix and strategy contexts",
+			len(matrixes)))
+	}
+	if p.config.Uses != "" {
+		jp.Unsupported = append(jp.Unsupported, "bact doesn't call reusable workflows: the job succeeds without running "+p.config.Uses)
+	}
+	if len(unknownNeeds) > 0 {
+		jp.If = Decision{Condition: p.config.If.Value, Result: DecisionUnknown, Reason: "depends on whether " + strings.Join(unknownNeeds, ", ") + " run"}
+	} else {
+		jp.If, err = p.decide(jobEvaluator, p.config.If.Value, p.config.ValueNode("if"))
+		if err != nil {
+			return JobPlan{}, oops.Wrapf(err, "evaluating if")
+		}
+	}
+
+	if p.config.Name != "" {
+		jp.Name, err = p.template(jobEvaluator, p.config.Name, p.config.ValueNode("name"))
+		if err != nil {
+			return JobPlan{}, oops.Wrapf(err, "evaluating name")
+		}
+	}
+	for _, label := range p.config.RunsOn() {
+		evaled, err := p.template(jobEvaluator, label, p.config.ValueNode("runs-on"))
+		if err != nil {
+			return JobPlan{}, oops.Wrapf(err, "evaluating runs-on")
+		}
+		if evaled != "" {
+			jp.RunsOn = append(jp.RunsOn, evaled)
+		}
+	}
+
+	env := maps.Clone(p.workflow.Env)
+	for k, v := range p.config.Environment() {
+		env[k], err = p.template(jobEvaluator, v, p.config.ValueNode("env", k))
+		if err != nil {
+			return JobPlan{}, oops.With("env", k).Wrapf(err, "evaluating env var %s", k)
+		}
+	}
+	j.InitialEnv = env
+
+	// like in a run, the status functions of steps check job.status, and those of the job the results of its needs
+	j.status = JobResultSuccess
+	for i, step := range p.config.Steps {
+		step = step.ApplyRunDefaults(j.runDefaults()...)
+		stepContext := &StepContext{IndexInJob: i, StepID: makeStepID(i, step), Env: maps.Clone(env)}
+		stepEvaluator, err := newEvaluator(ctx, MakeExprContextParams{Workflow: p.workflow, Job: j, Step: stepContext})
+		if err != nil {
+			return JobPlan{}, err
+		}
+		sp, err := p.planStep(stepEvaluator, step, stepContext)
+		if err != nil {
+			return JobPlan{}, oops.With("stepIndex", i).Wrapf(err, "planning step %s", step)
+		}
+		jp.Steps = append(jp.Steps, sp)
+	}
+	return jp, nil
+}
+
+// planStep plans a step, evaluating its expressions with evaluator
+func (p *jobPlanner) planStep(evaluator *expr.Evaluator, step *yamls.Step, stepContext *StepContext) (StepPlan, error) {
+	sp := StepPlan{
+		Name:             step.String(),
+		ID:               step.ID,
+		WorkingDirectory: step.WorkingDirectory,
+		Uses:             step.Uses,
+	}
+	var err error
+	sp.If, err = p.decide(evaluator, step.If.Value, step.ValueNode("if"))
+	if err != nil {
+		return StepPlan{}, oops.Wrapf(err, "evaluating if")
+	}
+
+	if step.Run != "" {
+		script, err := p.template(evaluator, step.Run, step.ValueNode("run"))
+		if err != nil {
+			return StepPlan{}, oops.Wrapf(err, "evaluating run")
+		}
+		bin, templateArgs, err := resolveShell(step)
+		if err != nil {
+			return StepPlan{}, err
+		}
+		scriptName, content := scriptFile(bin, script)
+		sp.Script = content
+		sp.Command = append([]string{bin}, scriptArgs(templateArgs, path.Join("steps", stepContext.StepID, scriptName))...)
+	}
+	if step.Uses != "" {
+		_, sp.Builtin = p.workflow.runner.Builtins.Lookup(step.Uses)
+		if !sp.Builtin {
+			sp.Unsupported = "bact only runs builtin actions: the run fails at this step"
+		}
+	}
+	for k, v := range step.With {
+		evaled, err := p.template(evaluator, v, step.ValueNode("with", k))
+		if err != nil {
+			return StepPlan{}, oops.With("input", k).Wrapf(err, "evaluating input %s", k)
+		}
+		if sp.With == nil {
+			sp.With = make(map[string]string, len(step.With))
+		}
+		sp.With[k] = evaled
+	}
+	return sp, nil
+}
+
+// decide evaluates the `if` of a job or a step, unless it depends on what happens in the run
+func (p *jobPlanner) decide(evaluator *expr.Evaluator, condition string, node *yaml.Node) (Decision, error) {
+	decision := Decision{Condition: condition}
+	compiled, err := p.workflow.templates.Condition(condition)
+	if err != nil {
+		return Decision{}, p.workflow.errorAt(node, err)
+	}
+	if dependency := runtimeDependency(compiled.Node()); dependency != "" {
+		decision.Result = DecisionUnknown
+		decision.Reason = dependency
+		return decision, nil
+	}
+	run, err := evaluator.EvaluateCompiledCondition(compiled)
+	if err != nil {
+		return Decision{}, p.workflow.errorAt(node, err)
+	}
+	decision.Result = DecisionSkip
+	if run {
+		decision.Result = DecisionRun
+	}
+	return decision, nil
+}
+
+// template evaluates the expressions of template that don't depend on what happens in the run, and masks secrets
+func (p *jobPlanner) template(evaluator *expr.Evaluator, template string, node *yaml.Node) (string, error) {
+	evaled, err := evaluator.EvaluatePartialTemplate(template, func(node expr.Node) bool {
+		return runtimeDependency(node) == ""
+	})
+	if err != nil {
+		return "", p.workflow.errorAt(node, err)
+	}
+	return p.masker.Mask(evaled), nil
+}
+
+// WriteText writes the plan for people to read
+func (p *Plan) WriteText(w io.Writer) error {
+	b := &strings.Builder{}
+	name := p.Workflow
+	if name == "" {
+		name = path.Base(p.File)
+	}
+	fmt.Fprintf(b, "workflow %s\n", name)
+	for _, jp := range p.Jobs {
+		fmt.Fprintf(b, "\njob %s: %s\n", jp.Name, jp.If)
+		if jp.Name != jp.ID {
+			fmt.Fprintf(b, "  id: %s\n", jp.ID)
+		}
+		if len(jp.Needs) > 0 {
+			fmt.Fprintf(b, "  needs: %s\n", strings.Join(jp.Needs, ", "))
+		}
+		if len(jp.RunsOn) > 0 {
+			fmt.Fprintf(b, "  runs-on: %s\n", strings.Join(jp.RunsOn, ", "))
+		}
+		if jp.If.Condition != "" {
+			fmt.Fprintf(b, "  if: %s\n", jp.If.Condition)
+		}
+		if jp.Uses != "" {
+			fmt.Fprintf(b, "  uses: %s\n", jp.Uses)
+		}
+		for _, matrix := range jp.Matrix {
+			fmt.Fprintf(b, "  matrix: %s\n", matrixLabel(matrix))
+		}
+		for _, unsupported := range jp.Unsupported {
+			fmt.Fprintf(b, "  unsupported: %s\n", unsupported)
+		}
+		for _, sp := range jp.Steps {
+			fmt.Fprintf(b, "  - %s: %s\n", firstLine(sp.Name), sp.If)
+			if sp.If.Condition != "" {
+				fmt.Fprintf(b, "    if: %s\n", sp.If.Condition)
+			}
+			if sp.WorkingDirectory != "" {
+				fmt.Fprintf(b, "    working-directory: %s\n", sp.WorkingDirectory)
+			}
+			if len(sp.Command) > 0 {
+				fmt.Fprintf(b, "    $ %s\n", shellquote.Join(sp.Command...))
+				for line := range strings.Lines(sp.Script) {
+					fmt.Fprintf(b, "    | %s\n", strings.TrimRight(line, "\r\n"))
+				}
+			}
+			if sp.Builtin {
+				fmt.Fprintf(b, "    uses: %s (builtin)\n", sp.Uses)
+			} else if sp.Uses != "" {
+				fmt.Fprintf(b, "    uses: %s\n", sp.Uses)
+			}
+			if sp.Unsupported != "" {
+				fmt.Fprintf(b, "    unsupported: %s\n", sp.Unsupported)
+			}
+			for _, k := range slices.Sorted(maps.Keys(sp.With)) {
+				fmt.Fprintf(b, "      %s: %s\n", k, sp.With[k])
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return oops.Wrap(err)
+}
+
+// firstLine is the first line of s, with an ellipsis when there are more, like the names of run steps
+// that don't have one
+func firstLine(s string) string {
+	first, rest, multiline := strings.Cut(strings.TrimRight(s, "\n"), "\n")
+	if multiline && rest != "" {
+		return first + " ..."
+	}
+	return first
+}
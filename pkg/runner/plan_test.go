@@ -0,0 +1,177 @@
+package runner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+const planWorkflow = `name: CI
+on: push
+env:
+  GREETING: hello
+jobs:
+  lint:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - name: Lint
+        run: echo ${{ env.GREETING }} ${{ secrets.TOKEN }}
+  test:
+    needs: lint
+    runs-on: ${{ matrix.os }}
+    strategy:
+      matrix:
+        os: [ubuntu-latest, macos-latest]
+        node: [18, 20]
+        exclude:
+          - os: macos-latest
+            node: 18
+    steps:
+      - uses: actions/setup-node@v4
+        with:
+          node-version: ${{ matrix.node }}
+          token: ${{ secrets.TOKEN }}
+      - id: build
+        shell: sh
+        run: echo "tag=v${{ matrix.node }}" >> "$GITHUB_OUTPUT"
+      - if: steps.build.outputs.tag == 'v20'
+        run: echo ${{ steps.build.outputs.tag }} ${{ strategy.job-index }}
+      - if: matrix.os == 'macos-latest'
+        run: echo mac
+  deploy:
+    needs: test
+    if: github.ref == 'refs/heads/nope'
+    uses: octo/repo/.github/workflows/deploy.yml@v1
+  notify:
+    needs: deploy
+    steps:
+      - run: echo skipped with deploy
+`
+
+func TestPlanWorkflow(t *testing.T) {
+	wf, err := yamls.ReadWorkflow(strings.NewReader(planWorkflow), false)
+	require.NoError(t, err)
+	wf.File = "ci.yml"
+	rnr := New(&bytes.Buffer{}, EnvFromEmpty())
+	rnr.RepoDir = t.TempDir()
+
+	plan, err := rnr.PlanWorkflow(t.Context(), wf, &types.WorkflowContexts{
+		GitHub:  &types.GitHub{Ref: "refs/heads/main"},
+		Secrets: map[string]string{"TOKEN": "s3cr3t"},
+	})
+	require.NoError(t, err)
+
+	var names []string
+	for _, jp := range plan.Jobs {
+		names = append(names, jp.Name)
+	}
+	assert.Equal(t, []string{"lint", "test", "deploy", "notify"}, names)
+
+	lint := plan.Jobs[0]
+	assert.Equal(t, DecisionRun, lint.If.Result)
+	assert.True(t, lint.Steps[0].Builtin)
+	assert.Empty(t, lint.Steps[0].Unsupported)
+	assert.Equal(t, "echo hello ***", lint.Steps[1].Script, "secrets are masked")
+
+	test := plan.Jobs[1]
+	assert.Empty(t, test.RunsOn, "matrix.os is empty")
+	assert.Equal(t, []string{"bact doesn't expand matrixes: the job runs once instead of 3 times, with empty matrix and strategy contexts"}, test.Unsupported)
+	assert.Equal(t, []map[string]any{
+		{"os": "ubuntu-latest", "node": 18},
+		{"os": "ubuntu-latest", "node": 20},
+		{"os": "macos-latest", "node": 20},
+	}, test.Matrix)
+	assert.False(t, test.Steps[0].Builtin)
+	assert.Equal(t, "bact only runs builtin actions: the run fails at this step", test.Steps[0].Unsupported)
+	assert.Equal(t, map[string]string{"node-version": "", "token": "***"}, test.Steps[0].With)
+	assert.Equal(t, `echo "tag=v" >> "$GITHUB_OUTPUT"`, test.Steps[1].Script)
+	assert.Equal(t, []string{"sh", "-e", "steps/1_build/script.sh"}, test.Steps[1].Command)
+	assert.Equal(t, Decision{Condition: "steps.build.outputs.tag == 'v20'", Result: DecisionUnknown, Reason: "depends on steps"}, test.Steps[2].If)
+	assert.Equal(t, "echo ${{ steps.build.outputs.tag }} 0", test.Steps[2].Script, "what the run decides is kept")
+	assert.Equal(t, DecisionSkip, test.Steps[3].If.Result)
+
+	assert.Equal(t, DecisionSkip, plan.Jobs[2].If.Result)
+	assert.Equal(t, "octo/repo/.github/workflows/deploy.yml@v1", plan.Jobs[2].Uses)
+	assert.Equal(t, []string{"bact doesn't call reusable workflows: the job succeeds without running octo/repo/.github/workflows/deploy.yml@v1"}, plan.Jobs[2].Unsupported)
+	assert.Equal(t, DecisionSkip, plan.Jobs[3].If.Result, "jobs that need skipped jobs are skipped")
+
+	out := &bytes.Buffer{}
+	require.NoError(t, plan.WriteText(out))
+	assert.Contains(t, out.String(), `
+job test: run
+  needs: lint
+  matrix: 18, ubuntu-latest
+  matrix: 20, ubuntu-latest
+  matrix: 20, macos-latest
+  unsupported: bact doesn't expand matrixes: the job runs once instead of 3 times, with empty matrix and strategy contexts
+  - actions/setup-node@v4: run
+    uses: actions/setup-node@v4
+    unsupported: bact only runs builtin actions: the run fails at this step
+`)
+	assert.Contains(t, out.String(), `
+  - echo "tag=v${{ matrix.node }}" >> "$GITHUB_OUTPUT": run
+    $ sh -e steps/1_build/script.sh
+    | echo "tag=v" >> "$GITHUB_OUTPUT"
+  - echo ${{ steps.build.outputs.tag }} ${{ strategy.job-index }}: unknown (depends on steps)
+    if: steps.build.outputs.tag == 'v20'
+`)
+}
+
+func TestPlanWorkflowMatchesRun(t *testing.T) {
+	wf, err := yamls.ReadWorkflow(strings.NewReader(`on: push
+jobs:
+  a:
+    runs-on: ubuntu-latest
+    strategy:
+      matrix:
+        os: [x, y]
+    steps:
+      - run: echo "ref=${{ github.ref }} os=${{ matrix.os }}"
+`), false)
+	require.NoError(t, err)
+	wfContext := &types.WorkflowContexts{GitHub: &types.GitHub{Ref: "refs/heads/main"}}
+	console := &bytes.Buffer{}
+	rnr := New(console, EnvFromEmpty())
+	rnr.RepoDir = t.TempDir()
+
+	plan, err := rnr.PlanWorkflow(t.Context(), wf, wfContext)
+	require.NoError(t, err)
+	require.Len(t, plan.Jobs, 1)
+	assert.Equal(t, `echo "ref=refs/heads/main os="`, plan.Jobs[0].Steps[0].Script)
+
+	_, err = rnr.RunWorkflow(t.Context(), wf, wfContext)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(console.String(), "ref=refs/heads/main os=\n"), console.String())
+}
+
+func TestPlanWorkflowUnknownNeeds(t *testing.T) {
+	wf, err := yamls.ReadWorkflow(strings.NewReader(`on: push
+jobs:
+  build:
+    if: failure()
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo build
+  publish:
+    needs: build
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo publish
+`), false)
+	require.NoError(t, err)
+	rnr := New(&bytes.Buffer{}, EnvFromEmpty())
+	rnr.RepoDir = t.TempDir()
+
+	plan, err := rnr.PlanWorkflow(t.Context(), wf, &types.WorkflowContexts{})
+	require.NoError(t, err)
+	require.Len(t, plan.Jobs, 2)
+	assert.Equal(t, Decision{Condition: "failure()", Result: DecisionUnknown, Reason: "depends on failure()"}, plan.Jobs[0].If)
+	assert.Equal(t, Decision{Result: DecisionUnknown, Reason: "depends on whether build run"}, plan.Jobs[1].If)
+}
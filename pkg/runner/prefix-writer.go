@@ -0,0 +1,79 @@
+package runner
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// LockedWriter serializes writes to an underlying writer so it can be shared between goroutines.
+type LockedWriter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func NewLockedWriter(w io.Writer) *LockedWriter {
+	return &LockedWriter{w: w}
+}
+
+func (l *LockedWriter) Write(p []byte) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.w.Write(p)
+}
+
+// PrefixWriter prepends a prefix to every line written to it.
+// Lines are written to the underlying writer in a single Write call only once they are complete,
+// so output of several PrefixWriters sharing a [LockedWriter] interleaves on line boundaries.
+// Call Flush to write a trailing partial line.
+type PrefixWriter struct {
+	lock   sync.Mutex
+	w      io.Writer
+	prefix []byte
+	buf    bytes.Buffer
+}
+
+func NewPrefixWriter(w io.Writer, prefix string) *PrefixWriter {
+	return &PrefixWriter{
+		w:      w,
+		prefix: []byte(prefix),
+	}
+}
+
+func (p *PrefixWriter) Write(b []byte) (int, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.buf.Write(b)
+	for {
+		idx := bytes.IndexByte(p.buf.Bytes(), '\n')
+		if idx == -1 {
+			return len(b), nil
+		}
+		line := p.buf.Next(idx + 1)
+		if err := p.writeLine(line); err != nil {
+			return len(b), err
+		}
+	}
+}
+
+// Flush writes any buffered partial line, terminated with a newline.
+func (p *PrefixWriter) Flush() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.buf.Len() == 0 {
+		return nil
+	}
+	line := append(p.buf.Bytes(), '\n')
+	p.buf.Reset()
+	return p.writeLine(line)
+}
+
+func (p *PrefixWriter) writeLine(line []byte) error {
+	out := make([]byte, 0, len(p.prefix)+len(line))
+	out = append(out, p.prefix...)
+	out = append(out, line...)
+	_, err := p.w.Write(out)
+	return err
+}
@@ -0,0 +1,111 @@
+package runner
+
+import (
+	"io"
+	"sync"
+)
+
+// ringBuffer is an in-memory pipe with a bounded capacity.
+// Writes block while the buffer is full and reads block while it is empty, so a fast writer is slowed down
+// to the pace of the reader instead of growing memory.
+type ringBuffer struct {
+	mu       sync.Mutex
+	notEmpty sync.Cond
+	notFull  sync.Cond
+
+	buf   []byte
+	start int
+	size  int
+
+	// writeClosed is set by Close. Reads return io.EOF once the buffer is drained.
+	writeClosed bool
+	// readErr is set by CloseRead. Writes fail with it.
+	readErr error
+}
+
+func newRingBuffer(capacity int) *ringBuffer {
+	b := &ringBuffer{buf: make([]byte, capacity)}
+	b.notEmpty.L = &b.mu
+	b.notFull.L = &b.mu
+	return b
+}
+
+// Write implements io.Writer. It blocks until all of p is in the buffer.
+func (b *ringBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	written := 0
+	for written < len(p) {
+		for b.size == len(b.buf) && b.readErr == nil && !b.writeClosed {
+			b.notFull.Wait()
+		}
+		if b.readErr != nil {
+			return written, b.readErr
+		}
+		if b.writeClosed {
+			return written, io.ErrClosedPipe
+		}
+		end := (b.start + b.size) % len(b.buf)
+		limit := len(b.buf)
+		if end < b.start {
+			limit = b.start
+		}
+		n := copy(b.buf[end:limit], p[written:])
+		if n == 0 {
+			// end wrapped around to the beginning
+			n = copy(b.buf[:b.start], p[written:])
+		}
+		b.size += n
+		written += n
+		b.notEmpty.Signal()
+	}
+	return written, nil
+}
+
+// Read implements io.Reader. It blocks until there is data or the write side is closed.
+func (b *ringBuffer) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for b.size == 0 && !b.writeClosed && b.readErr == nil {
+		b.notEmpty.Wait()
+	}
+	if b.readErr != nil {
+		return 0, b.readErr
+	}
+	if b.size == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, b.buf[b.start:min(b.start+b.size, len(b.buf))])
+	b.start = (b.start + n) % len(b.buf)
+	b.size -= n
+	if b.size == 0 {
+		b.start = 0
+	}
+	b.notFull.Signal()
+	return n, nil
+}
+
+// Close closes the write side. The data that was already written can still be read.
+func (b *ringBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.writeClosed = true
+	b.notEmpty.Broadcast()
+	b.notFull.Broadcast()
+	return nil
+}
+
+// CloseRead makes all current and future reads and writes fail with err, and discards the buffered data
+func (b *ringBuffer) CloseRead(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		err = io.ErrClosedPipe
+	}
+	b.readErr = err
+	b.start, b.size = 0, 0
+	b.notEmpty.Broadcast()
+	b.notFull.Broadcast()
+}
@@ -0,0 +1,82 @@
+package runner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/samber/oops"
+)
+
+const runRecordFile = "run.json"
+
+// RunRecord is what a run of a workflow did. It's kept in the run directory, for the commands that show runs
+// after they are done, like bact workflow graph.
+type RunRecord struct {
+	// Run is the [WorkflowState.Run] of the run, and RunID is its github.run_id
+	Run      string `json:"run"`
+	RunID    string `json:"run_id"`
+	Workflow string `json:"workflow"`
+	// File is the workflow file that ran
+	File string               `json:"file"`
+	Jobs map[string]JobRecord `json:"jobs"`
+}
+
+// JobRecord is the result of a job of a run
+type JobRecord struct {
+	Result     JobResult `json:"result"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Environment is the environment the job deployed to, and EnvironmentURL is its evaluated `environment.url`
+	Environment    string `json:"environment,omitempty"`
+	EnvironmentURL string `json:"environment_url,omitempty"`
+}
+
+// Duration is how long the job ran
+func (r JobRecord) Duration() time.Duration {
+	if r.StartedAt.IsZero() || r.FinishedAt.Before(r.StartedAt) {
+		return 0
+	}
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// writeRunRecord records the results of the jobs of the run of wfState in its run directory
+func writeRunRecord(wfState *WorkflowState) error {
+	record := RunRecord{
+		Run:      wfState.Run,
+		RunID:    wfState.GitHub.RunID,
+		Workflow: wfState.Name,
+		File:     wfState.Config.File,
+		Jobs:     make(map[string]JobRecord, len(wfState.Jobs)),
+	}
+	for name, j := range wfState.Jobs {
+		jobRecord := JobRecord{Result: j.Result, StartedAt: j.StartedAt, FinishedAt: j.FinishedAt}
+		if j.Environment != nil {
+			jobRecord.Environment = j.Environment.Name
+			jobRecord.EnvironmentURL = j.Environment.URL
+		}
+		record.Jobs[name] = jobRecord
+	}
+	content, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return oops.Wrap(err)
+	}
+	if err := os.WriteFile(filepath.Join(wfState.RunDir, runRecordFile), content, 0o644); err != nil {
+		return oops.Wrapf(err, "writing run record")
+	}
+	return nil
+}
+
+// ReadRunRecord reads the record of the run in runDir, see [RunDir]
+func ReadRunRecord(runDir string) (*RunRecord, error) {
+	content, err := os.ReadFile(filepath.Join(runDir, runRecordFile))
+	if err != nil {
+		return nil, oops.With("runDir", runDir).Wrapf(err, "reading run record")
+	}
+	var record RunRecord
+	if err := json.Unmarshal(content, &record); err != nil {
+		return nil, oops.With("runDir", runDir).Wrapf(err, "parsing run record")
+	}
+	return &record, nil
+}
@@ -0,0 +1,80 @@
+package runner
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/artifacts"
+	"github.com/drornir/better-actions/pkg/cache"
+	"github.com/drornir/better-actions/pkg/defers"
+	"github.com/drornir/better-actions/pkg/runtimetoken"
+)
+
+// runServices are the local replacements of the GitHub services a workflow run talks to
+type runServices struct {
+	signer         *runtimetoken.Signer
+	artifacts      *artifacts.Store
+	artifactServer *artifacts.Server
+	cache          *cache.Store
+	cacheServer    *cache.Server
+}
+
+// startRunServices creates the stores of a run and starts serving them over http
+func (r *Runner) startRunServices(ctx context.Context, runDir string) (_ *runServices, _cleanup func(), _err error) {
+	oopser := oops.FromContext(ctx)
+	cleanup := defers.Chain{}
+
+	signer, err := runtimetoken.NewSigner()
+	if err != nil {
+		return nil, cleanup.Noop, oopser.Wrapf(err, "creating runtime token signer")
+	}
+	s := &runServices{signer: signer}
+
+	s.artifacts, err = artifacts.NewStore(filepath.Join(runDir, "artifacts"))
+	if err != nil {
+		return nil, cleanup.Noop, oopser.Wrapf(err, "creating artifact store")
+	}
+	s.artifactServer = artifacts.NewServer(s.artifacts, signer)
+	if err := s.artifactServer.Start(ctx); err != nil {
+		return nil, cleanup.Noop, oopser.Wrapf(err, "starting artifact service")
+	}
+	cleanup.Add(func() { s.artifactServer.Close() })
+
+	cacheDir := r.CacheDir
+	switch {
+	case cacheDir != "":
+	case r.StateDir != "":
+		cacheDir = filepath.Join(r.StateDir, "cache")
+	default:
+		cacheDir = filepath.Join(runDir, "cache")
+	}
+	s.cache, err = cache.NewStore(cacheDir, r.CacheMaxSize)
+	if err != nil {
+		cleanup.Run()
+		return nil, cleanup.Noop, oopser.Wrapf(err, "creating cache store")
+	}
+	cleanup.Add(func() { s.cache.Close() })
+	s.cacheServer = cache.NewServer(s.cache, signer)
+	if err := s.cacheServer.Start(ctx); err != nil {
+		cleanup.Run()
+		return nil, cleanup.Noop, oopser.Wrapf(err, "starting cache service")
+	}
+	cleanup.Add(func() { s.cacheServer.Close() })
+
+	return s, cleanup.Run, nil
+}
+
+// jobEnv returns the environment variables that point the steps of a job to the services
+func (s *runServices) jobEnv(runID, jobName string) (map[string]string, error) {
+	token, err := s.signer.Sign(runID, jobName)
+	if err != nil {
+		return nil, oops.Wrapf(err, "creating runtime token")
+	}
+	return map[string]string{
+		"ACTIONS_RUNTIME_TOKEN": token,
+		"ACTIONS_RESULTS_URL":   s.artifactServer.URL(),
+		"ACTIONS_CACHE_URL":     s.cacheServer.URL(),
+	}, nil
+}
@@ -0,0 +1,94 @@
+package runner
+
+import (
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/drornir/better-actions/pkg/runner/expr"
+)
+
+// runnerEnvironment is the value of runner.environment. bact always runs on the user's own machine.
+const runnerEnvironment = "self-hosted"
+
+// runnerOS returns the operating system in the spelling of runner.os and RUNNER_OS
+func runnerOS() string {
+	switch runtime.GOOS {
+	case "linux":
+		return "Linux"
+	case "darwin":
+		return "macOS"
+	case "windows":
+		return "Windows"
+	default:
+		return runtime.GOOS
+	}
+}
+
+// runnerArch returns the architecture in the spelling of runner.arch and RUNNER_ARCH
+func runnerArch() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return "X64"
+	case "386":
+		return "X86"
+	case "arm64":
+		return "ARM64"
+	case "arm":
+		return "ARM"
+	default:
+		return strings.ToUpper(runtime.GOARCH)
+	}
+}
+
+// runnerName returns the value of runner.name and RUNNER_NAME
+func runnerName() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "bact"
+	}
+	return "bact-" + hostname
+}
+
+// newRunnerContext returns the runner context of a job that uses tempDir and toolCacheDir
+func newRunnerContext(tempDir, toolCacheDir string, debug bool) expr.RunnerContext {
+	rc := expr.RunnerContext{
+		Name:        runnerName(),
+		OS:          runnerOS(),
+		Arch:        runnerArch(),
+		Temp:        tempDir,
+		ToolCache:   toolCacheDir,
+		Environment: runnerEnvironment,
+	}
+	if debug {
+		rc.Debug = "1"
+	}
+	return rc
+}
+
+// runnerDefaultEnv returns the RUNNER_* environment variables the GitHub runner exports to every step
+func runnerDefaultEnv(rc expr.RunnerContext) map[string]string {
+	env := map[string]string{
+		"RUNNER_ARCH":        rc.Arch,
+		"RUNNER_ENVIRONMENT": rc.Environment,
+		"RUNNER_NAME":        rc.Name,
+		"RUNNER_OS":          rc.OS,
+		"RUNNER_TEMP":        rc.Temp,
+		"RUNNER_TOOL_CACHE":  rc.ToolCache,
+	}
+	if rc.Debug != "" {
+		env["RUNNER_DEBUG"] = rc.Debug
+	}
+	return env
+}
+
+// debugEnabled reports whether env turns on debug logging the way the GitHub runner does it,
+// with ACTIONS_STEP_DEBUG or ACTIONS_RUNNER_DEBUG (usually set as secrets or variables)
+func debugEnabled(env map[string]string) bool {
+	for _, name := range []string{"ACTIONS_STEP_DEBUG", "ACTIONS_RUNNER_DEBUG", "RUNNER_DEBUG"} {
+		if v := strings.ToLower(env[name]); v == "true" || v == "1" {
+			return true
+		}
+	}
+	return false
+}
@@ -5,19 +5,70 @@ import (
 	"maps"
 	"os"
 	"strings"
+
+	"github.com/drornir/better-actions/pkg/builtin"
+	"github.com/drornir/better-actions/pkg/concurrency"
+	"github.com/drornir/better-actions/pkg/runner/expr"
+	"github.com/drornir/better-actions/pkg/secrets"
+	"github.com/drornir/better-actions/pkg/workspace"
 )
 
 type TODO any
 
 type Runner struct {
 	Console io.Writer
-	Env     map[string]string
+	// Env is added to the environment of every step, on top of the host variables EnvPolicy lets through
+	Env map[string]string
+	// EnvPolicy controls which host environment variables steps see. Defaults to [EnvPolicyAllowlist].
+	EnvPolicy EnvPolicy
+	// EnvAllowlist are the patterns of host variables [EnvPolicyAllowlist] passes.
+	// nil means [DefaultEnvAllowlist].
+	EnvAllowlist []string
+	// RepoDir is a directory inside the git checkout the workflows run for.
+	// It is used to populate the github context. Defaults to the current working directory.
+	RepoDir string
+	// Workspace configures how the workspace of every job is populated.
+	// An empty Workspace.Source defaults to the root of the repository RepoDir is in.
+	Workspace workspace.Options
+	// KeepJobRoot controls whether job root directories are deleted when jobs are done
+	KeepJobRoot KeepJobRoot
+	// StateDir is where bact keeps data that outlives a job: run directories (artifacts) and the cache.
+	// If it's empty, every workflow run uses a temporary directory that is deleted when the run is done.
+	StateDir string
+	// CacheDir is where the cache entries are stored. Defaults to a directory in StateDir.
+	CacheDir string
+	// CacheMaxSize is the total size in bytes of the cache entries. Zero means unlimited.
+	CacheMaxSize int64
+	// ToolCacheDir is RUNNER_TOOL_CACHE, where setup actions keep the tools they download between runs.
+	// Defaults to a directory in StateDir, or to a directory in the job root if StateDir is empty.
+	ToolCacheDir string
+	// Timestamps prefixes every line of step output on the console with the time it was written
+	Timestamps bool
+	// SecretProviders are where the secrets context comes from, in order of precedence.
+	// They are fetched at the start of every workflow run, and the secrets passed to RunWorkflow override them.
+	SecretProviders []secrets.Provider
+	// Environments are the deployment environments jobs target with `environment:`, by name.
+	// Jobs may target environments that aren't defined, which have no vars, secrets or protection rules.
+	Environments map[string]*Environment
+	// Approver decides whether jobs may deploy to environments that require approval.
+	// Defaults to a [FileApprover].
+	Approver Approver
+	// ConcurrencyGroups coordinates the `concurrency:` groups of workflows and jobs, also with other bact processes.
+	// Defaults to a directory in StateDir, or in the temporary directory if StateDir is empty.
+	ConcurrencyGroups *concurrency.Groups
+	// Builtins are the native implementations of actions that `uses:` consults.
+	// Defaults to [builtin.DefaultRegistry].
+	Builtins *builtin.Registry
+	// Functions are the functions expressions may call. nil means [expr.DefaultFunctions].
+	// Workflows that call other functions must be read with them, see [yamls.ReadWorkflowWithFunctions].
+	Functions expr.FunctionStore
 }
 
 func New(console io.Writer, envFrom EnvFrom) *Runner {
 	return &Runner{
-		Console: console,
-		Env:     envFrom(),
+		Console:  console,
+		Env:      envFrom(),
+		Builtins: builtin.DefaultRegistry(),
 	}
 }
 
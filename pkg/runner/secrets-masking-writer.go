@@ -0,0 +1,140 @@
+package runner
+
+import (
+	"io"
+	"sync"
+)
+
+// MaskingWriter masks the secrets of a [SecretsMasker] in a stream before it reaches the underlying writer.
+// Secrets are masked even when they are split across writes or lines: bytes that may be the beginning of
+// a secret are held back until it is clear whether they are. Call Flush to write them when the stream ends.
+// Regexes added with [SecretsMasker.AddRegex] are matched in each chunk that is written to the underlying
+// writer, so unlike secrets they are not masked when a match is split across chunks.
+type MaskingWriter struct {
+	lock   sync.Mutex
+	masker *SecretsMasker
+	w      io.Writer
+
+	// matcher is the matcher state belongs to. When secrets are added the pending bytes are scanned again.
+	matcher *acMatcher
+	state   int32
+	// pending are the bytes that were not written to w yet
+	pending []byte
+	// spans are the secrets found in pending
+	spans []acSpan
+	// inMask is set when the last byte written to w was part of a secret, so a secret that continues in
+	// pending is not masked twice
+	inMask bool
+	out    []byte
+}
+
+// NewWriter returns a writer that masks the secrets of m, including the ones added after it is created
+func (m *SecretsMasker) NewWriter(w io.Writer) *MaskingWriter {
+	return &MaskingWriter{masker: m, w: w}
+}
+
+// Write implements io.Writer. It returns len(p) unless the underlying writer fails.
+func (w *MaskingWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if matcher := w.masker.currentMatcher(); matcher != w.matcher {
+		w.matcher = matcher
+		w.rescan()
+	}
+	if w.matcher == nil {
+		// no secrets, nothing to hold back
+		if err := w.flushLocked(); err != nil {
+			return 0, err
+		}
+		_, err := w.w.Write(w.masker.maskRegexes(p))
+		return len(p), err
+	}
+
+	for _, b := range p {
+		w.feed(b)
+	}
+	// no secret that is still being matched starts before this point
+	safe := len(w.pending) - int(w.matcher.depth[w.state])
+	return len(p), w.emit(safe)
+}
+
+// Flush writes the bytes that are held back
+func (w *MaskingWriter) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.flushLocked()
+}
+
+func (w *MaskingWriter) flushLocked() error {
+	err := w.emit(len(w.pending))
+	w.state = 0
+	return err
+}
+
+func (w *MaskingWriter) feed(b byte) {
+	w.pending = append(w.pending, b)
+	w.state = w.matcher.next(w.state, b)
+	if l := int(w.matcher.longest[w.state]); l > 0 {
+		end := len(w.pending)
+		w.spans = addSpan(w.spans, acSpan{start: max(0, end-l), end: end})
+	}
+}
+
+// rescan matches the pending bytes again with a new matcher
+func (w *MaskingWriter) rescan() {
+	pending := w.pending
+	w.pending = nil
+	w.spans = w.spans[:0]
+	w.state = 0
+	if w.matcher == nil {
+		w.pending = pending
+		return
+	}
+	for _, b := range pending {
+		w.feed(b)
+	}
+}
+
+// emit writes pending[:n] with the secrets in it masked, and keeps the rest pending
+func (w *MaskingWriter) emit(n int) error {
+	if n <= 0 {
+		return nil
+	}
+
+	out := w.out[:0]
+	pos := 0
+	kept := w.spans[:0]
+	for _, span := range w.spans {
+		if span.start >= n {
+			kept = append(kept, acSpan{start: span.start - n, end: span.end - n})
+			continue
+		}
+		if span.start > pos {
+			out = append(out, w.pending[pos:span.start]...)
+			w.inMask = false
+		}
+		if !w.inMask || span.start > 0 {
+			out = append(out, maskReplacement...)
+		}
+		w.inMask = true
+		pos = min(span.end, n)
+		if span.end > n {
+			// the rest of the secret is written (as part of this mask) later
+			kept = append(kept, acSpan{start: 0, end: span.end - n})
+		}
+	}
+	if pos < n {
+		out = append(out, w.pending[pos:n]...)
+		w.inMask = false
+	}
+	w.spans = kept
+	w.pending = w.pending[:copy(w.pending, w.pending[n:])]
+	w.out = out
+
+	if len(out) == 0 {
+		return nil
+	}
+	_, err := w.w.Write(w.masker.maskRegexes(out))
+	return err
+}
@@ -13,11 +13,19 @@ import (
 	"sync"
 )
 
+// maskReplacement is what a masked secret looks like
+const maskReplacement = "***"
+
+// SecretsMasker hides secrets in text. It matches all the registered strings at once with an
+// Aho-Corasick automaton, so its cost doesn't grow with the number of secrets.
+// Use [SecretsMasker.NewWriter] to mask a stream.
 type SecretsMasker struct {
 	lock sync.RWMutex
 
 	sensitiveStrings []string
 	sensitiveRegexes []*regexp.Regexp
+	// matcher matches sensitiveStrings. It is replaced whenever they change.
+	matcher *acMatcher
 }
 
 func (m *SecretsMasker) AddString(s ...string) {
@@ -54,6 +62,22 @@ func (m *SecretsMasker) AddString(s ...string) {
 			m.sensitiveStrings = append(m.sensitiveStrings[:i+1], after...)
 		}
 	}
+	m.matcher = newACMatcher(m.sensitiveStrings)
+}
+
+// AddSecrets adds the values of secrets. The lines of multi-line values are added too, so a step that
+// prints only some of the lines doesn't reveal them.
+func (m *SecretsMasker) AddSecrets(values ...string) {
+	var all []string
+	for _, value := range values {
+		all = append(all, value)
+		if strings.Contains(value, "\n") {
+			for line := range strings.Lines(value) {
+				all = append(all, strings.TrimRight(line, "\r\n"))
+			}
+		}
+	}
+	m.AddString(all...)
 }
 
 func (m *SecretsMasker) AddRegex(r ...*regexp.Regexp) {
@@ -71,20 +95,56 @@ func (m *SecretsMasker) AddRegex(r ...*regexp.Regexp) {
 	m.AddString(reAsStrings...)
 }
 
+// Mask returns s with all the secrets in it replaced
 func (m *SecretsMasker) Mask(s string) string {
 	m.lock.RLock()
 	defer m.lock.RUnlock()
 
-	for _, sens := range m.sensitiveStrings {
-		s = strings.ReplaceAll(s, sens, "***")
+	if m.matcher != nil {
+		var spans []acSpan
+		state := int32(0)
+		for i := range len(s) {
+			state = m.matcher.next(state, s[i])
+			if l := int(m.matcher.longest[state]); l > 0 {
+				spans = addSpan(spans, acSpan{start: i + 1 - l, end: i + 1})
+			}
+		}
+		if len(spans) > 0 {
+			var b strings.Builder
+			last := 0
+			for _, span := range spans {
+				b.WriteString(s[last:span.start])
+				b.WriteString(maskReplacement)
+				last = span.end
+			}
+			b.WriteString(s[last:])
+			s = b.String()
+		}
 	}
 	for _, senseexp := range m.sensitiveRegexes {
-		s = senseexp.ReplaceAllLiteralString(s, "***")
+		s = senseexp.ReplaceAllLiteralString(s, maskReplacement)
 	}
 
 	return s
 }
 
+// maskRegexes returns b with the matches of the registered regexes replaced
+func (m *SecretsMasker) maskRegexes(b []byte) []byte {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	for _, senseexp := range m.sensitiveRegexes {
+		b = senseexp.ReplaceAllLiteral(b, []byte(maskReplacement))
+	}
+	return b
+}
+
+// currentMatcher returns the matcher of the registered secrets, or nil if there are none
+func (m *SecretsMasker) currentMatcher() *acMatcher {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.matcher
+}
+
 type secretValueEncoder func(string) string
 
 // src/Runner.Common/HostContext.cs
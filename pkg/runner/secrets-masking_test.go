@@ -0,0 +1,174 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+func TestSecretsMaskerMask(t *testing.T) {
+	var m SecretsMasker
+	assert.Equal(t, "nothing to mask", m.Mask("nothing to mask"))
+
+	m.AddString("hunter2", "abcd", "cdef")
+	assert.Equal(t, "password: ***", m.Mask("password: hunter2"))
+	assert.Equal(t, "*** and ***", m.Mask("hunter2 and hunter2"))
+	assert.Equal(t, "x***x", m.Mask("xabcdefx"), "overlapping secrets are masked together")
+	assert.Equal(t, "b64: ***", m.Mask("b64: "+base64.RawStdEncoding.EncodeToString([]byte("hunter2"))))
+}
+
+func TestMaskingWriter(t *testing.T) {
+	var m SecretsMasker
+	m.AddString("hunter2", "multi\nline secret")
+
+	writeAll := func(chunks ...string) string {
+		t.Helper()
+		var out bytes.Buffer
+		w := m.NewWriter(&out)
+		for _, c := range chunks {
+			_, err := io.WriteString(w, c)
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Flush())
+		return out.String()
+	}
+
+	assert.Equal(t, "password: ***\n", writeAll("password: hunter2\n"))
+	assert.Equal(t, "password: ***\n", writeAll("password: hun", "ter", "2\n"), "split across writes")
+	assert.Equal(t, "key: ***\n", writeAll("key: multi\n", "line secret\n"), "split across lines")
+	assert.Equal(t, "hunter!\n", writeAll("hunter", "!\n"), "held back bytes are written when they don't match")
+	assert.Equal(t, "***\n", writeAll("hunter2", "hunter2", "\n"), "adjacent secrets are masked together")
+	assert.Equal(t, "trailing hunt", writeAll("trailing hunt"), "flush writes the held back bytes")
+
+	t.Run("secrets added while writing", func(t *testing.T) {
+		var m SecretsMasker
+		var out bytes.Buffer
+		w := m.NewWriter(&out)
+		fmt.Fprint(w, "before: s3cr3t\n")
+		m.AddString("s3cr3t")
+		fmt.Fprint(w, "after: s3c")
+		fmt.Fprint(w, "r3t\n")
+		require.NoError(t, w.Flush())
+		assert.Equal(t, "before: s3cr3t\nafter: ***\n", out.String())
+	})
+
+	t.Run("regexes", func(t *testing.T) {
+		var m SecretsMasker
+		write := func(chunk string) string {
+			var out bytes.Buffer
+			w := m.NewWriter(&out)
+			fmt.Fprint(w, chunk)
+			require.NoError(t, w.Flush())
+			return out.String()
+		}
+		m.AddRegex(regexp.MustCompile(`ghp_[a-zA-Z0-9]+`))
+		assert.Equal(t, "token: ***\n", write("token: ghp_abc123\n"))
+		m.AddString("hunter2")
+		assert.Equal(t, "*** and ***\n", write("hunter2 and ghp_abc123\n"))
+	})
+
+	t.Run("every split", func(t *testing.T) {
+		const text = "a multi\nline secret then hunter2, hunter2hunter2 and hunter"
+		want := m.Mask(text)
+		for i := range len(text) {
+			for j := i; j < len(text); j++ {
+				assert.Equal(t, want, writeAll(text[:i], text[i:j], text[j:]), "split at %d and %d", i, j)
+			}
+		}
+	})
+}
+
+func newBenchmarkMasker(secrets int) (*SecretsMasker, []string) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	values := make([]string, secrets)
+	for i := range values {
+		b := make([]byte, 16+rnd.IntN(24))
+		for j := range b {
+			b[j] = alphabet[rnd.IntN(len(alphabet))]
+		}
+		values[i] = string(b)
+	}
+	m := &SecretsMasker{}
+	m.AddString(values...)
+	return m, values
+}
+
+// benchmarkLog is build output with a secret every few lines
+func benchmarkLog(secrets []string, size int) []byte {
+	var b bytes.Buffer
+	for i := 0; b.Len() < size; i++ {
+		fmt.Fprintf(&b, "[%d] compiling github.com/drornir/better-actions/pkg/runner with flags -trimpath -v\n", i)
+		if i%10 == 0 {
+			fmt.Fprintf(&b, "using token %s for the registry\n", secrets[i%len(secrets)])
+		}
+	}
+	return b.Bytes()
+}
+
+func BenchmarkMaskingWriter(b *testing.B) {
+	for _, secrets := range []int{10, 100, 500} {
+		b.Run(fmt.Sprintf("secrets=%d", secrets), func(b *testing.B) {
+			m, values := newBenchmarkMasker(secrets)
+			log := benchmarkLog(values, 4*1024*1024)
+			b.SetBytes(int64(len(log)))
+			b.ReportAllocs()
+			for b.Loop() {
+				w := m.NewWriter(io.Discard)
+				for chunk := range slices.Chunk(log, 4096) {
+					w.Write(chunk)
+				}
+				w.Flush()
+			}
+		})
+	}
+}
+
+func BenchmarkSecretsMaskerMaskLines(b *testing.B) {
+	for _, secrets := range []int{10, 100, 500} {
+		b.Run(fmt.Sprintf("secrets=%d", secrets), func(b *testing.B) {
+			m, values := newBenchmarkMasker(secrets)
+			lines := strings.Split(string(benchmarkLog(values, 1024*1024)), "\n")
+			b.SetBytes(1024 * 1024)
+			b.ReportAllocs()
+			for b.Loop() {
+				for _, l := range lines {
+					m.Mask(l)
+				}
+			}
+		})
+	}
+}
+
+func TestRuntimeTokenIsMasked(t *testing.T) {
+	wf, err := yamls.ReadWorkflow(strings.NewReader(`
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: |
+          test -n "$ACTIONS_RUNTIME_TOKEN"
+          echo "token=$ACTIONS_RUNTIME_TOKEN"
+`), false)
+	require.NoError(t, err)
+
+	console := &bytes.Buffer{}
+	r := New(console, EnvFromMap(map[string]string{"PATH": os.Getenv("PATH")}))
+	_, err = r.RunWorkflow(t.Context(), wf, &types.WorkflowContexts{})
+	require.NoError(t, err, console.String())
+	assert.Contains(t, console.String(), "token=***\n")
+}
@@ -9,185 +9,212 @@ import (
 	"errors"
 	"io"
 	"sync"
-	"sync/atomic"
 	"time"
 
-	"github.com/samber/oops"
-
-	"github.com/drornir/better-actions/pkg/concurrency"
 	"github.com/drornir/better-actions/pkg/ctxkit"
 	"github.com/drornir/better-actions/pkg/log"
 )
 
+const (
+	// outputBufferSize is the capacity of the buffer of each output stream of a step.
+	// When it's full, writes of the step block until the lines are processed.
+	outputBufferSize = 256 * 1024
+	// maxLineSize is the length after which a plain line is passed on in fragments
+	maxLineSize = 64 * 1024
+	// maxCommandLineSize is the length a workflow command line may have before it is printed instead of executed
+	maxCommandLineSize = 16 * 1024 * 1024
+)
+
+// OutputStream identifies the stream a line of step output was written to
+type OutputStream uint8
+
+const (
+	OutputStreamStdout OutputStream = iota
+	OutputStreamStderr
+)
+
+func (s OutputStream) String() string {
+	if s == OutputStreamStderr {
+		return "stderr"
+	}
+	return "stdout"
+}
+
+// OutputLine is a line of step output
+type OutputLine struct {
+	Stream OutputStream
+	// Time is when the line was read
+	Time time.Time
+	// Text is the line without its line terminator
+	Text string
+	// Partial is set on every fragment of a line that was too long to be passed on at once,
+	// except for the last one
+	Partial bool
+}
+
 type StepOutputEvaluator interface {
 	ExecuteCommand(ctx context.Context, command ParsedWorkflowCommand) error
-	Print(ctx context.Context, text string) error
+	PrintLine(ctx context.Context, line OutputLine) error
 }
 
+// StepOutputReader splits the output of a step into lines as it is written, executes the workflow commands
+// in it and passes the rest of the lines to the backend.
+// Stdout and stderr are separate streams with bounded buffers, so memory doesn't grow with chatty steps.
 type StepOutputReader struct {
-	stepOutput     *bytes.Buffer
-	stepOutputLock sync.Mutex
-	backend        StepOutputEvaluator
-
-	linesChan   chan string
-	scanner     *bufio.Scanner
-	stopScan    atomic.Bool
-	stoppedChan chan struct{}
-	err         error
-	errLock     sync.RWMutex
-
-	// extracted from the original context given to Start
-	ctx    context.Context
-	logger *log.Logger
-	oopser oops.OopsErrorBuilder
-}
-
-func NewStepOutputInterpreter(backend StepOutputEvaluator) *StepOutputReader {
-	var rw bytes.Buffer
-
-	r := &StepOutputReader{
-		stepOutput:  &rw,
-		backend:     backend,
-		linesChan:   make(chan string, 4096),
-		stoppedChan: make(chan struct{}),
-	}
+	backend StepOutputEvaluator
+	stdout  *ringBuffer
+	stderr  *ringBuffer
+
+	lines     chan OutputLine
+	readers   sync.WaitGroup
+	processed chan struct{}
+	closeOnce sync.Once
 
-	return r
+	err     error
+	errLock sync.RWMutex
 }
 
+func NewStepOutputReader(backend StepOutputEvaluator) *StepOutputReader {
+	return &StepOutputReader{
+		backend:   backend,
+		stdout:    newRingBuffer(outputBufferSize),
+		stderr:    newRingBuffer(outputBufferSize),
+		lines:     make(chan OutputLine, 256),
+		processed: make(chan struct{}),
+	}
+}
+
+// Start processes the output in the background until [StepOutputReader.Close] is called.
+// Cancelling ctx doesn't drop output that was already written.
 func (r *StepOutputReader) Start(ctx context.Context) {
-	ctx, logger, oopser := ctxkit.With(ctx)
-	r.ctx = ctx
-	r.logger = logger
-	r.oopser = oopser
+	ctx, _, _ = ctxkit.With(ctx, "output_reader_worker", "step_output")
+	// the output of a cancelled step is still printed, so don't let the processing be cancelled
+	ctx = context.WithoutCancel(ctx)
+
+	r.readers.Add(2)
+	go r.readLines(ctx, OutputStreamStdout, r.stdout)
+	go r.readLines(ctx, OutputStreamStderr, r.stderr)
+	go func() {
+		r.readers.Wait()
+		close(r.lines)
+	}()
+	go r.processLines(ctx)
+}
 
-	go r.readLines(ctx)
+// Stdout is the writer for the standard output of the step
+func (r *StepOutputReader) Stdout() io.Writer {
+	return r.stdout
+}
 
-	go r.processLines(ctx)
+// Stderr is the writer for the standard error of the step
+func (r *StepOutputReader) Stderr() io.Writer {
+	return r.stderr
 }
 
-// Write implements io.Writer so it can read the step output
-func (r *StepOutputReader) Write(p []byte) (n int, err error) {
-	stopped := r.stopScan.Load()
-	if stopped {
-		return 0, oops.Join(oops.Errorf("StepOutputReader was closed"), r.Err())
-	}
-	r.stepOutputLock.Lock()
-	defer r.stepOutputLock.Unlock()
-	return r.stepOutput.Write(p)
+// Write implements io.Writer by writing to [StepOutputReader.Stdout]
+func (r *StepOutputReader) Write(p []byte) (int, error) {
+	return r.stdout.Write(p)
 }
 
-// Close implements io.Closer. Always returns nil
+// Close waits for all the output written so far, including a trailing partial line, to be processed.
+// Writing after Close fails. Always returns nil, the processing error is returned by [StepOutputReader.Err].
 func (r *StepOutputReader) Close() error {
-	r.logger.D(r.ctx, "stopping step output reader")
-	r.stopScan.Store(true)
-	<-r.stoppedChan
-
+	r.closeOnce.Do(func() {
+		r.stdout.Close()
+		r.stderr.Close()
+	})
+	<-r.processed
 	return nil
 }
 
-func (r *StepOutputReader) readLines(ctx context.Context) {
-	ctxkv := []any{"output_reader_worker", "read_step_output"}
-	oopser := oops.FromContext(ctx).With(ctxkv...)
-	logger := log.FromContext(ctx).With(ctxkv...)
-
-	defer func() { close(r.linesChan) }()
-
-	var lineBuf bytes.Buffer
-	// the reason for this function is to do 'defer r.stepOutputLock.Unlock()' but not keeping the lock when waiting for more input
-	read := func() (line string, readNewBytes, gotEOF bool, err error) {
-		r.stepOutputLock.Lock()
-		defer r.stepOutputLock.Unlock()
+func (r *StepOutputReader) readLines(ctx context.Context, stream OutputStream, from io.Reader) {
+	defer r.readers.Done()
+	logger := log.FromContext(ctx).With("stream", stream.String())
+
+	br := bufio.NewReaderSize(from, maxLineSize)
+	// long is the beginning of a line that didn't fit in the bufio buffer and may be a workflow command
+	var long []byte
+	// continued is set while passing on the fragments of a long line
+	continued := false
+	emit := func(text []byte, partial bool) {
+		r.lines <- OutputLine{Stream: stream, Time: time.Now(), Text: string(text), Partial: partial}
+	}
 
-		l, err := r.stepOutput.ReadString('\n')
-		if err != nil && !errors.Is(err, io.EOF) {
-			return "", false, false, oopser.Wrapf(err, "unexpected error reading from input")
-		}
-		if l != "" {
-			if _, err := lineBuf.WriteString(l); err != nil {
-				return "", false, false, oopser.Wrapf(err, "unexpected error writing to internal line buffer")
+	for {
+		fragment, err := br.ReadSlice('\n')
+		switch {
+		case err == nil:
+			line := bytes.TrimSuffix(bytes.TrimSuffix(fragment, []byte("\n")), []byte("\r"))
+			if long != nil {
+				line = append(long, line...)
+				long = nil
 			}
-		}
-		if errors.Is(err, io.EOF) {
-			if r.stopScan.Load() {
-				fullLine := lineBuf.String()
-				lineBuf.Reset()
-				return fullLine, len(l) > 0, true, nil
+			emit(line, false)
+			continued = false
+
+		case errors.Is(err, bufio.ErrBufferFull):
+			// a workflow command must be parsed as a whole, so its fragments are collected
+			if long != nil || (!continued && mayBeWorkflowCommand(fragment)) {
+				long = append(long, fragment...)
+				if len(long) <= maxCommandLineSize {
+					continue
+				}
+				logger.W(ctx, "workflow command line is too long, printing it instead", "limit", maxCommandLineSize)
+				fragment, long = long, nil
 			}
-			return "", len(l) > 0, true, nil
-		}
-
-		fullLine := lineBuf.String()
-		lineBuf.Reset()
-		return fullLine, len(l) > 0, false, nil
-	}
+			emit(fragment, true)
+			continued = true
 
-	const (
-		initialBackoff = time.Millisecond
-		maxBackoff     = time.Second * 5
-	)
-
-	backoff := initialBackoff
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-r.stoppedChan:
-			return
 		default:
-			line, readNewBytes, gotEOF, err := read()
-			if err != nil {
-				r.setErr(err)
-				return
+			// EOF or the processing failed. What's left is a line without a line terminator
+			if len(fragment) > 0 || long != nil {
+				emit(append(long, fragment...), false)
 			}
-			if readNewBytes {
-				backoff = initialBackoff
+			if !errors.Is(err, io.EOF) {
+				logger.D(ctx, "stopped reading step output", "error", err)
 			}
-			if gotEOF {
-				if r.stopScan.Load() {
-					if len(line) > 0 {
-						r.linesChan <- line
-					}
-					return
-				}
-				backoff = min(backoff*2, maxBackoff)
-				logger.With("backoff_amount", backoff.String()).
-					D(ctx, "EOF backoff: waiting for more input", "backoff", backoff)
-				select {
-				case <-ctx.Done():
-				case <-time.After(backoff):
-				}
-				continue
-			}
-			r.linesChan <- line
+			return
 		}
 	}
 }
 
 func (r *StepOutputReader) processLines(ctx context.Context) {
-	ctx, _, _ = ctxkit.With(ctx, "output_reader_worker", "process_lines")
-
-	defer func() { close(r.stoppedChan) }()
-
-	for line := range concurrency.ClosedOrDone(r.linesChan, ctx) {
-		wfcmd, ok := parseWorkflowCommand(ctx, line)
-		if ok {
-			err := r.backend.ExecuteCommand(ctx, wfcmd)
-			if err != nil {
-				r.setErr(err)
-				r.stopScan.Store(true)
-				return
-			}
-			continue
+	defer close(r.processed)
+
+	// continued is set per stream when the next line is the rest of a partial line
+	var continued [2]bool
+	failed := false
+	for line := range r.lines {
+		if failed {
+			continue // drain
 		}
-		if err := r.backend.Print(ctx, line); err != nil {
+		if err := r.processLine(ctx, line, continued[line.Stream]); err != nil {
 			r.setErr(err)
-			r.stopScan.Store(true)
-			return
+			failed = true
+			// writers of the step fail from now on
+			r.stdout.CloseRead(err)
+			r.stderr.CloseRead(err)
+			continue
 		}
+		continued[line.Stream] = line.Partial
 	}
 }
 
+func (r *StepOutputReader) processLine(ctx context.Context, line OutputLine, continued bool) error {
+	if !continued && !line.Partial {
+		if wfcmd, ok := parseWorkflowCommand(ctx, line.Text); ok {
+			return r.backend.ExecuteCommand(ctx, wfcmd)
+		}
+	}
+	return r.backend.PrintLine(ctx, line)
+}
+
+// mayBeWorkflowCommand reports whether a line that starts with the given prefix may be a workflow command
+func mayBeWorkflowCommand(prefix []byte) bool {
+	trimmed := bytes.TrimLeft(prefix, " \t")
+	return bytes.HasPrefix(trimmed, []byte("::")) || bytes.Contains(prefix, []byte("##["))
+}
+
 func (r *StepOutputReader) Err() error {
 	r.errLock.RLock()
 	defer r.errLock.RUnlock()
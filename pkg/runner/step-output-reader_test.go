@@ -0,0 +1,210 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/samber/oops"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingEvaluator records what a [StepOutputReader] passes on
+type recordingEvaluator struct {
+	mu       sync.Mutex
+	lines    []OutputLine
+	commands []ParsedWorkflowCommand
+	failOn   string
+}
+
+func (e *recordingEvaluator) ExecuteCommand(ctx context.Context, command ParsedWorkflowCommand) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.commands = append(e.commands, command)
+	return nil
+}
+
+func (e *recordingEvaluator) PrintLine(ctx context.Context, line OutputLine) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.failOn != "" && line.Text == e.failOn {
+		return oops.Errorf("failing on %q", line.Text)
+	}
+	e.lines = append(e.lines, line)
+	return nil
+}
+
+// texts joins partial lines and returns the text of the lines of stream
+func (e *recordingEvaluator) texts(stream OutputStream) []string {
+	var texts []string
+	var partial strings.Builder
+	for _, l := range e.lines {
+		if l.Stream != stream {
+			continue
+		}
+		partial.WriteString(l.Text)
+		if !l.Partial {
+			texts = append(texts, partial.String())
+			partial.Reset()
+		}
+	}
+	return texts
+}
+
+func TestJobStepOutputEvaluatorInterleavedStreams(t *testing.T) {
+	var console bytes.Buffer
+	job := &Job{Workflow: &WorkflowState{}}
+	eval := &JobStepOutputEvaluator{job: job, step: &StepContext{Console: job.secretsMasker.NewWriter(&console)}}
+
+	for _, line := range []OutputLine{
+		{Stream: OutputStreamStdout, Text: "out 1 begins", Partial: true},
+		{Stream: OutputStreamStderr, Text: "err 1"},
+		{Stream: OutputStreamStdout, Text: " and ends"},
+		{Stream: OutputStreamStderr, Text: "err 2 begins", Partial: true},
+		{Stream: OutputStreamStderr, Text: " and ends"},
+		{Stream: OutputStreamStdout, Text: "out 2", Partial: true},
+	} {
+		require.NoError(t, eval.PrintLine(t.Context(), line))
+	}
+	require.NoError(t, eval.Print(t.Context(), "from the runner"))
+
+	assert.Equal(t, "out 1 begins\n"+
+		"[stderr] err 1\n"+
+		" and ends\n"+
+		"[stderr] err 2 begins and ends\n"+
+		"out 2\n"+
+		"from the runner\n", console.String())
+}
+
+func TestStepOutputReaderStreams(t *testing.T) {
+	eval := &recordingEvaluator{}
+	r := NewStepOutputReader(eval)
+	r.Start(t.Context())
+
+	fmt.Fprint(r.Stdout(), "out 1\nout")
+	fmt.Fprint(r.Stderr(), "err 1\r\n")
+	fmt.Fprint(r.Stdout(), " 2\n::set-output name=a::b\n")
+	fmt.Fprint(r.Stderr(), "::add-mask::secret\ntrailing without newline")
+	require.NoError(t, r.Close())
+	require.NoError(t, r.Err())
+
+	assert.Equal(t, []string{"out 1", "out 2"}, eval.texts(OutputStreamStdout))
+	assert.Equal(t, []string{"err 1", "trailing without newline"}, eval.texts(OutputStreamStderr))
+	require.Len(t, eval.commands, 2)
+	for _, l := range eval.lines {
+		assert.False(t, l.Time.IsZero(), "lines are timestamped")
+	}
+
+	_, err := r.Stdout().Write([]byte("late\n"))
+	assert.Error(t, err, "writing after close fails")
+}
+
+func TestStepOutputReaderLongLines(t *testing.T) {
+	eval := &recordingEvaluator{}
+	r := NewStepOutputReader(eval)
+	r.Start(t.Context())
+
+	longText := strings.Repeat("x", 3*maxLineSize+17)
+	longValue := strings.Repeat("v", 3*maxLineSize)
+	// the command is written in small chunks, like a pipe would deliver it
+	command := "::set-output name=big::" + longValue + "\n"
+	fmt.Fprintln(r.Stdout(), longText)
+	for chunk := range chunks(command, 4096) {
+		_, err := io.WriteString(r.Stdout(), chunk)
+		require.NoError(t, err)
+	}
+	// a long line that has a command marker only after the first fragment is not a command
+	fmt.Fprintln(r.Stdout(), longText+"::set-output name=no::no")
+	require.NoError(t, r.Close())
+	require.NoError(t, r.Err())
+
+	assert.Equal(t, []string{longText, longText + "::set-output name=no::no"}, eval.texts(OutputStreamStdout))
+	for _, l := range eval.lines {
+		assert.LessOrEqual(t, len(l.Text), maxLineSize, "plain lines are passed on in bounded fragments")
+	}
+	require.Len(t, eval.commands, 1)
+	assert.Equal(t, WorkflowCommandNameSetOutput, eval.commands[0].Command)
+	assert.Equal(t, longValue, eval.commands[0].Data)
+}
+
+func TestStepOutputReaderKeepsOutputOfCancelledSteps(t *testing.T) {
+	eval := &recordingEvaluator{}
+	r := NewStepOutputReader(eval)
+	ctx, cancel := context.WithCancel(t.Context())
+	r.Start(ctx)
+
+	fmt.Fprint(r.Stdout(), "before cancel\n")
+	cancel()
+	fmt.Fprint(r.Stdout(), "after cancel")
+	require.NoError(t, r.Close())
+	assert.Equal(t, []string{"before cancel", "after cancel"}, eval.texts(OutputStreamStdout))
+}
+
+func TestStepOutputReaderBackendError(t *testing.T) {
+	eval := &recordingEvaluator{failOn: "boom"}
+	r := NewStepOutputReader(eval)
+	r.Start(t.Context())
+
+	fmt.Fprint(r.Stdout(), "ok\nboom\n")
+	// writes fail once the processing fails, instead of blocking the step forever
+	var err error
+	for range 1000 {
+		if _, err = r.Stdout().Write([]byte(strings.Repeat("more\n", 1024))); err != nil {
+			break
+		}
+	}
+	assert.Error(t, err)
+	require.NoError(t, r.Close())
+	assert.ErrorContains(t, r.Err(), "failing on")
+}
+
+func chunks(s string, n int) func(func(string) bool) {
+	return func(yield func(string) bool) {
+		for len(s) > 0 {
+			end := min(n, len(s))
+			if !yield(s[:end]) {
+				return
+			}
+			s = s[end:]
+		}
+	}
+}
+
+type discardEvaluator struct{}
+
+func (discardEvaluator) ExecuteCommand(context.Context, ParsedWorkflowCommand) error { return nil }
+func (discardEvaluator) PrintLine(context.Context, OutputLine) error                 { return nil }
+
+func benchmarkStepOutputReader(b *testing.B, line string) {
+	chunk := []byte(strings.Repeat(line, max(1, 32*1024/len(line))))
+	const total = 16 * 1024 * 1024
+	b.SetBytes(total)
+	b.ReportAllocs()
+	for b.Loop() {
+		r := NewStepOutputReader(discardEvaluator{})
+		r.Start(b.Context())
+		for written := 0; written < total; written += len(chunk) {
+			if _, err := r.Stdout().Write(chunk); err != nil {
+				b.Fatal(err)
+			}
+		}
+		r.Close()
+	}
+}
+
+func BenchmarkStepOutputReaderShortLines(b *testing.B) {
+	benchmarkStepOutputReader(b, "compiling package github.com/drornir/better-actions/pkg/runner\n")
+}
+
+func BenchmarkStepOutputReaderLongLines(b *testing.B) {
+	benchmarkStepOutputReader(b, strings.Repeat("x", 1024*1024)+"\n")
+}
+
+func BenchmarkStepOutputReaderCommands(b *testing.B) {
+	benchmarkStepOutputReader(b, "::debug::a debug message that is not printed\n")
+}
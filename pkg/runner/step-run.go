@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/kballard/go-shellquote"
+	"github.com/samber/oops"
 
 	"github.com/drornir/better-actions/pkg/ctxkit"
 	"github.com/drornir/better-actions/pkg/shell"
@@ -20,9 +21,10 @@ import (
 type StepRun struct {
 	Config  *yamls.Step
 	Context *StepContext
+	Job     *Job
 }
 
-func (s *StepRun) Run(ctx context.Context, writeTo io.Writer) (StepResult, error) {
+func (s *StepRun) Run(ctx context.Context, stdout, stderr io.Writer) (StepResult, error) {
 	step := s.Config
 	wd := s.Context.WorkingDir
 
@@ -31,21 +33,22 @@ func (s *StepRun) Run(ctx context.Context, writeTo io.Writer) (StepResult, error
 		"step.shellCommand", step.ShellCommand(),
 		"step.run", step.Run)
 
-	const scriptName = "script.sh"
-	if err := wd.WriteFile(scriptName, []byte(step.Run), 0o777); err != nil {
-		return StepResult{}, oopser.With("scriptFile", path.Join(wd.Name(), scriptName)).
-			Wrapf(err, "writing script file")
+	bin, templateArgs, err := resolveShell(step)
+	if err != nil {
+		return StepResult{}, oopser.Wrap(err)
 	}
 
-	shellCommand := strings.ReplaceAll(step.ShellCommand(), "{0}",
-		shellquote.Join(path.Join(wd.Name(), scriptName)),
-	)
-
-	binArgs, err := shellquote.Split(shellCommand)
+	run, err := s.evaluateScript(ctx)
 	if err != nil {
-		return StepResult{}, oopser.Wrapf(err, "parsing shell command")
+		return StepResult{}, oopser.Wrapf(err, "evaluating run")
+	}
+	scriptName, script := scriptFile(bin, run)
+	scriptPath := path.Join(wd.Name(), scriptName)
+	if err := wd.WriteFile(scriptName, []byte(script), 0o777); err != nil {
+		return StepResult{}, oopser.With("scriptFile", scriptPath).Wrapf(err, "writing script file")
 	}
-	bin, args := binArgs[0], binArgs[1:]
+
+	args := scriptArgs(templateArgs, scriptPath)
 	sh, err := shell.NewShell(bin, args...)
 	if err != nil {
 		return StepResult{}, oopser.With("step.shell.bin", bin).With("step.shell.args", args).Wrapf(err, "initializing shell")
@@ -61,10 +64,10 @@ func (s *StepRun) Run(ctx context.Context, writeTo io.Writer) (StepResult, error
 	}
 
 	cmd := sh.NewCommand(ctx, shell.CommandOpts{
-		ExtraEnv: s.Context.Env,
-		Dir:      workDir,
-		StdOut:   writeTo,
-		StdErr:   writeTo,
+		Env:    s.Context.Env,
+		Dir:    workDir,
+		StdOut: stdout,
+		StdErr: stderr,
 	})
 
 	logger.D(ctx, "running command", "command.path", cmd.Path, "command.args", cmd.Args)
@@ -83,3 +86,84 @@ func (s *StepRun) Run(ctx context.Context, writeTo io.Writer) (StepResult, error
 		Status: StepStatusSucceeded,
 	}, nil
 }
+
+// evaluateScript evaluates the templates in the `run:` script of the step
+func (s *StepRun) evaluateScript(ctx context.Context) (string, error) {
+	evaluator, err := newEvaluator(ctx, MakeExprContextParams{
+		Workflow: s.Job.Workflow,
+		Job:      s.Job,
+		Step:     s.Context,
+	})
+	if err != nil {
+		return "", err
+	}
+	script, err := evaluator.EvaluateTemplate(s.Config.Run)
+	if err != nil {
+		return "", s.Job.Workflow.errorAt(s.Config.ValueNode("run"), err)
+	}
+	return script, nil
+}
+
+// resolveShell returns the binary of the shell that runs step and the arguments of its template, which
+// have the {0} placeholder of the script. Like the GitHub runner, it falls back to the shells that are installed.
+func resolveShell(step *yamls.Step) (bin string, templateArgs []string, err error) {
+	shellCommand := step.ShellCommand()
+	if step.Shell == "" {
+		if _, err := exec.LookPath("bash"); err != nil {
+			// like the GitHub runner, fall back to sh when bash is not installed
+			shellCommand = (&yamls.Step{Shell: "sh"}).ShellCommand()
+		}
+	}
+	binArgs, err := shellquote.Split(shellCommand)
+	if err != nil {
+		return "", nil, oops.Wrapf(err, "parsing shell command")
+	}
+	if len(binArgs) == 0 {
+		return "", nil, oops.Errorf("shell command is empty")
+	}
+	bin = binArgs[0]
+	if bin == "python" {
+		if _, err := exec.LookPath(bin); err != nil {
+			// many systems only ship python3
+			bin = "python3"
+		}
+	}
+	return bin, binArgs[1:], nil
+}
+
+// scriptFile returns the name and the content of the script file of a step that runs script with the shell bin.
+// Some shells need a specific extension, and some need the script to be wrapped so errors fail the step.
+// Reference: https://github.com/actions/runner/blob/main/src/Runner.Worker/Handlers/ScriptHandlerHelpers.cs
+func scriptFile(bin, script string) (name, content string) {
+	switch strings.TrimSuffix(strings.ToLower(path.Base(filepath.ToSlash(bin))), ".exe") {
+	case "bash", "sh":
+		return "script.sh", script
+	case "python", "python3":
+		return "script.py", script
+	case "cmd":
+		return "script.cmd", "@echo off\n" + script
+	case "pwsh", "powershell":
+		return "script.ps1", "$ErrorActionPreference = 'stop'\n" + script +
+			"\nif ((Test-Path -LiteralPath variable:\\LASTEXITCODE)) { exit $LASTEXITCODE }"
+	default:
+		return "script", script
+	}
+}
+
+// scriptArgs replaces the {0} placeholder in the arguments of a shell template with scriptPath.
+// Templates without a placeholder get scriptPath as their last argument.
+func scriptArgs(templateArgs []string, scriptPath string) []string {
+	args := make([]string, 0, len(templateArgs)+1)
+	replaced := false
+	for _, arg := range templateArgs {
+		if strings.Contains(arg, "{0}") {
+			arg = strings.ReplaceAll(arg, "{0}", scriptPath)
+			replaced = true
+		}
+		args = append(args, arg)
+	}
+	if !replaced {
+		args = append(args, scriptPath)
+	}
+	return args
+}
@@ -0,0 +1,39 @@
+package runner
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+func TestStepRunEvaluatesScript(t *testing.T) {
+	wf, err := yamls.ReadWorkflow(strings.NewReader(`
+on: push
+env:
+  GREETING: hello
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: |
+          echo "${{ env.GREETING }} from ${{ github.job }}"
+          echo "token is ${{ secrets.TOKEN }}"
+`), false)
+	require.NoError(t, err)
+
+	console := &bytes.Buffer{}
+	r := New(console, EnvFromMap(map[string]string{"PATH": os.Getenv("PATH")}))
+	_, err = r.RunWorkflow(t.Context(), wf, &types.WorkflowContexts{Secrets: map[string]string{"TOKEN": "s3cr3t"}})
+	require.NoError(t, err, console.String())
+
+	assert.Contains(t, console.String(), "hello from build\n")
+	assert.Contains(t, console.String(), "token is ***\n")
+	assert.NotContains(t, console.String(), "s3cr3t")
+}
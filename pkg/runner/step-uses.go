@@ -0,0 +1,98 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/builtin"
+	"github.com/drornir/better-actions/pkg/ctxkit"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+// StepUses runs a step that `uses:` an action. Only builtin actions are supported.
+type StepUses struct {
+	Config  *yamls.Step
+	Context *StepContext
+	Job     *Job
+}
+
+func (s *StepUses) Run(ctx context.Context, writeTo io.Writer) (StepResult, error) {
+	step := s.Config
+	ctx, logger, oopser := ctxkit.With(ctx, "step.uses", step.Uses)
+
+	var registry *builtin.Registry
+	if s.Job.Workflow.runner != nil {
+		registry = s.Job.Workflow.runner.Builtins
+	}
+	action, ok := registry.Lookup(step.Uses)
+	if !ok {
+		return StepResult{}, oopser.Errorf("'uses' is not implemented for %s: only builtin actions are supported", step.Uses)
+	}
+	logger.D(ctx, "running builtin action")
+
+	inputs, err := s.evaluateInputs(ctx)
+	if err != nil {
+		return StepResult{}, oopser.Wrapf(err, "evaluating inputs")
+	}
+
+	wf := s.Job.Workflow
+	actx := &builtin.Context{
+		Uses:      step.Uses,
+		Inputs:    inputs,
+		Workspace: s.Context.WorkspaceDir,
+		Env:       s.Context.Env,
+		GitHub:    s.Job.github,
+		RepoDir:   wf.workspace.Source,
+		Console:   writeTo,
+	}
+	if wf.services != nil {
+		actx.Cache = wf.services.cache
+		actx.Artifacts = wf.services.artifacts
+	}
+	res, err := action.Run(ctx, actx)
+	if err != nil {
+		logger.D(ctx, "builtin action failed", "error", err)
+		return StepResult{
+			Status:     StepStatusFailed,
+			FailReason: fmt.Sprintf("%s failed: %s", step.Uses, err.Error()),
+		}, nil
+	}
+
+	for k, v := range res.Outputs {
+		if err := s.Job.appendToCommandFile(ctx, s.Context, GithubOutput, encodeEnvfileLikeKeyValue(k, v)); err != nil {
+			return StepResult{}, oopser.Wrapf(err, "writing output %s", k)
+		}
+	}
+	if res.Post != nil {
+		s.Job.addPostStep(step.Uses, res.Post)
+	}
+
+	return StepResult{
+		Status: StepStatusSucceeded,
+	}, nil
+}
+
+// evaluateInputs evaluates the templates in the `with:` values of the step
+func (s *StepUses) evaluateInputs(ctx context.Context) (map[string]string, error) {
+	evaluator, err := newEvaluator(ctx, MakeExprContextParams{
+		Workflow: s.Job.Workflow,
+		Job:      s.Job,
+		Step:     s.Context,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := make(map[string]string, len(s.Config.With))
+	for k, v := range s.Config.With {
+		evaled, err := evaluator.EvaluateTemplate(v)
+		if err != nil {
+			return nil, oops.With("input", k).Wrapf(s.Job.Workflow.errorAt(s.Config.ValueNode("with", k), err), "evaluating input %s", k)
+		}
+		inputs[k] = evaled
+	}
+	return inputs, nil
+}
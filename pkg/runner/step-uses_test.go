@@ -0,0 +1,66 @@
+package runner
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/cache"
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+func TestCachePostStepOnlyOnSuccess(t *testing.T) {
+	const wfYAML = `
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/cache@v4
+        with:
+          path: deps
+          key: deps-v1
+      - run: |
+          mkdir -p deps
+          echo dependency > deps/lib.txt
+          test "$FAIL" != "true"
+`
+	run := func(t *testing.T, fail bool) (*cache.Entry, error) {
+		t.Helper()
+		wf, err := yamls.ReadWorkflow(strings.NewReader(wfYAML), false)
+		require.NoError(t, err)
+
+		r := New(&bytes.Buffer{}, EnvFromMap(map[string]string{
+			"PATH": os.Getenv("PATH"),
+			"FAIL": strconv.FormatBool(fail),
+		}))
+		r.CacheDir = t.TempDir()
+		_, runErr := r.RunWorkflow(t.Context(), wf, &types.WorkflowContexts{})
+
+		store, err := cache.NewStore(r.CacheDir, 0)
+		require.NoError(t, err)
+		t.Cleanup(func() { store.Close() })
+		entry, err := store.Lookup(t.Context(), "deps-v1", nil, cache.Version([]string{"deps"}, "gzip"))
+		require.NoError(t, err)
+		return entry, runErr
+	}
+
+	t.Run("success saves", func(t *testing.T) {
+		entry, err := run(t, false)
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+		assert.Equal(t, "deps-v1", entry.Key)
+	})
+
+	t.Run("failure doesn't save", func(t *testing.T) {
+		entry, err := run(t, true)
+		require.Error(t, err)
+		assert.Nil(t, entry)
+	})
+}
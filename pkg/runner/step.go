@@ -2,7 +2,6 @@ package runner
 
 import (
 	"fmt"
-	"io"
 	"os"
 	"strings"
 	"unicode"
@@ -32,8 +31,12 @@ type StepContext struct {
 	WorkspaceDir string
 	Env          map[string]string
 	StepID       string
-	Console      io.Writer
+	Console      *MaskingWriter
 	EchoCommands bool
+	// partialLine is set when Console ends with a partial line of partialStream.
+	// Output of the other stream ends it, and the rest of the line is printed on a new line.
+	partialLine   bool
+	partialStream OutputStream
 }
 
 func makeStepID(index int, step *yamls.Step) string {
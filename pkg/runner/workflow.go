@@ -2,11 +2,23 @@ package runner
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/samber/oops"
 
 	"github.com/drornir/better-actions/pkg/ctxkit"
+	"github.com/drornir/better-actions/pkg/gitinfo"
 	"github.com/drornir/better-actions/pkg/runner/expr"
+	"github.com/drornir/better-actions/pkg/secrets"
 	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/workspace"
 	"github.com/drornir/better-actions/pkg/yamls"
 )
 
@@ -14,52 +26,247 @@ func (r *Runner) RunWorkflow(ctx context.Context, wf *yamls.Workflow, wfContext
 	ctx, _, oopser := ctxkit.With(ctx, "workflow", wf.Name)
 	jobs := wf.Jobs
 
+	repoDir, err := r.repoDir()
+	if err != nil {
+		return nil, oopser.Wrap(err)
+	}
+	github, err := newGithubContext(ctx, repoDir, wf, wfContext.GitHub)
+	if err != nil {
+		return nil, oopser.Wrapf(err, "creating github context")
+	}
+
+	secretValues, err := secrets.Resolve(ctx, r.SecretProviders...)
+	if err != nil {
+		return nil, oopser.Wrapf(err, "resolving secrets")
+	}
+	maps.Copy(secretValues, wfContext.Secrets)
+
+	run, runDir, runDirCleanup, err := r.makeRunDir(github.RunID)
+	if err != nil {
+		return nil, oopser.Wrapf(err, "creating run directory")
+	}
+	defer runDirCleanup()
+	services, servicesCleanup, err := r.startRunServices(ctx, runDir)
+	if err != nil {
+		return nil, oopser.Wrapf(err, "starting run services")
+	}
+	defer servicesCleanup()
+
 	wfState := &WorkflowState{
-		Name:   wf.Name,
-		Jobs:   make(map[string]*Job, len(jobs)),
-		Env:    nil, // need to run through tempalting
-		Inputs: wfContext.Inputs,
+		Name:    wf.Name,
+		Config:  wf,
+		Jobs:    make(map[string]*Job, len(jobs)),
+		Env:     nil, // need to run through tempalting
+		Inputs:  wfContext.Inputs,
+		Secrets: secretValues,
+		Vars:    wfContext.Vars,
+		GitHub:  github,
+		RepoDir: repoDir,
+		Run:     run,
+		RunDir:  runDir,
+
+		runner:    r,
+		services:  services,
+		workspace: resolveWorkspaceOptions(ctx, r.Workspace, repoDir, github.SHA),
+		templates: expr.NewTemplateCache(),
 	}
 
-	{
-		exprContext, err := MakeExprContext(MakeExprContextParams{GlobalEnv: r.Env, Workflow: wfState})
-		if err != nil {
-			return nil, oopser.Wrapf(err, "failed to create expression context")
-		}
-		evaluator, err := expr.NewEvaluator(exprContext)
-		if err != nil {
-			return nil, oopser.Wrapf(err, "failed to create expression evaluator")
-		}
-		wfEnv := maps.Clone(r.Env)
-		for k, v := range wf.Env {
-			evaled, err := evaluator.EvaluateTemplate(v)
-			if err != nil {
-				return nil, oopser.Wrapf(err, "failed to evaluate env var %s", k)
-			}
-			wfEnv[k] = evaled
-		}
-		wfState.Env = wfEnv
+	wfState.Env, err = r.workflowEnv(ctx, wfState)
+	if err != nil {
+		return nil, oopser.Wrap(err)
 	}
 
-	for jobName, job := range jobs {
-		j := NewJob(jobName, job, wfState, r.Console)
+	wfName := wf.Name
+	if wfName == "" {
+		wfName = filepath.Base(wf.File)
+	}
+	ctx, releaseGroup, err := r.joinConcurrencyGroup(ctx, "workflow "+wfName, wf.Concurrency(), MakeExprContextParams{Workflow: wfState})
+	if err != nil {
+		return nil, oopser.Wrapf(err, "joining concurrency group")
+	}
+	defer releaseGroup()
+
+	order, err := jobOrder(jobs)
+	if err != nil {
+		return nil, oopser.Wrapf(err, "invalid job dependencies")
+	}
+	for _, jobName := range order {
+		j := NewJob(jobName, jobs[jobName], wfState, r.Console)
 		wfState.Jobs[jobName] = j
 	}
 
 	// TODO parallel, remote execution etc.
-	for _, j := range wfState.Jobs {
+	// a failed job doesn't stop the run: the jobs that need it are skipped, unless they ask for failure()
+	var errs []error
+	for _, jobName := range order {
+		j := wfState.Jobs[jobName]
+		needed := make([]*Job, 0, len(j.Config.Needs()))
+		for _, need := range j.Config.Needs() {
+			needed = append(needed, wfState.Jobs[need])
+		}
+		j.needs = needsContext(needed)
 		err := j.Run(ctx)
+		if err != nil && j.Failed() {
+			errs = append(errs, oopser.With("job", j.Name).Wrapf(err, "job %s failed", j.Name))
+		}
+	}
+	// runs outside of the state directory aren't kept, nor are their records
+	if r.StateDir != "" {
+		if err := writeRunRecord(wfState); err != nil {
+			errs = append(errs, oopser.Wrapf(err, "recording run"))
+		}
+	}
+
+	return wfState, oops.Join(errs...)
+}
+
+// repoDir is [Runner.RepoDir], or the current working directory when it's not set
+func (r *Runner) repoDir() (string, error) {
+	if r.RepoDir != "" {
+		return r.RepoDir, nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", oops.Wrapf(err, "getting current working directory")
+	}
+	return wd, nil
+}
+
+// workflowEnv is the env of the jobs of the workflow: the env of the host that passes the env policy,
+// the env of the runner and the evaluated env of the workflow
+func (r *Runner) workflowEnv(ctx context.Context, wfState *WorkflowState) (map[string]string, error) {
+	evaluator, err := newEvaluator(ctx, MakeExprContextParams{GlobalEnv: r.Env, Workflow: wfState})
+	if err != nil {
+		return nil, oops.Wrapf(err, "failed to create expression evaluator")
+	}
+	wfEnv := r.hostEnv()
+	maps.Copy(wfEnv, r.Env)
+	for k, v := range wfState.Config.Env {
+		evaled, err := evaluator.EvaluateTemplate(v)
 		if err != nil {
-			return nil, oopser.With("job", j.Name).Wrapf(err, "failed to run job")
+			return nil, oops.Wrapf(wfState.errorAt(wfState.Config.ValueNode("env", k), err), "failed to evaluate env var %s", k)
+		}
+		wfEnv[k] = evaled
+	}
+	return wfEnv, nil
+}
+
+// jobOrder sorts the jobs so that every job comes after the jobs it needs.
+// Jobs that don't depend on each other are sorted by name.
+func jobOrder(jobs map[string]*yamls.Job) ([]string, error) {
+	names := slices.Sorted(maps.Keys(jobs))
+	for _, name := range names {
+		for _, need := range jobs[name].Needs() {
+			if _, ok := jobs[need]; !ok {
+				return nil, oops.With("job", name).Errorf("job %s needs unknown job %s", name, need)
+			}
 		}
 	}
 
-	return wfState, nil
+	order := make([]string, 0, len(jobs))
+	done := make(map[string]bool, len(jobs))
+	for len(order) < len(names) {
+		progressed := false
+		for _, name := range names {
+			if done[name] {
+				continue
+			}
+			ready := true
+			for _, need := range jobs[name].Needs() {
+				ready = ready && done[need]
+			}
+			if ready {
+				done[name] = true
+				order = append(order, name)
+				progressed = true
+			}
+		}
+		if !progressed {
+			var cycle []string
+			for _, name := range names {
+				if !done[name] {
+					cycle = append(cycle, name)
+				}
+			}
+			return nil, oops.With("jobs", cycle).Errorf("jobs %s need each other", strings.Join(cycle, ", "))
+		}
+	}
+	return order, nil
 }
 
 type WorkflowState struct {
 	Name   string
+	Config *yamls.Workflow
 	Jobs   map[string]*Job
 	Env    map[string]string
 	Inputs TODO
+	// Secrets is the secrets context. Every job masks all of its values.
+	Secrets map[string]string
+	// Vars is the vars context
+	Vars   map[string]string
+	GitHub types.GitHub
+	// RepoDir is the resolved [Runner.RepoDir]
+	RepoDir string
+	// Run identifies this run in the state directory, in bact commands like bact workflow approve. It's
+	// github.run_id, with a suffix when another run has the same run_id.
+	Run string
+	// RunDir holds the data of this run that is shared between jobs, like artifacts
+	RunDir string
+
+	runner    *Runner
+	services  *runServices
+	workspace workspace.Options
+	// templates are the templates and conditions of the workflow, compiled
+	templates *expr.TemplateCache
+}
+
+// makeRunDir creates the directory of a run with runID under the state directory, or a temporary
+// directory if there is no state directory. It returns the run the directory is of, see [WorkflowState.Run].
+func (r *Runner) makeRunDir(runID string) (string, string, func(), error) {
+	if r.StateDir == "" {
+		dir, err := os.MkdirTemp(os.TempDir(), "bact-run-")
+		if err != nil {
+			return "", "", func() {}, oops.Wrap(err)
+		}
+		return runID, dir, func() { os.RemoveAll(dir) }, nil
+	}
+	if err := os.MkdirAll(filepath.Join(r.StateDir, "runs"), 0o755); err != nil {
+		return "", "", func() {}, oops.Wrap(err)
+	}
+	// workflows that run together, and runs with a run_id from --github, can have the same run ID,
+	// so every run after the first gets the next suffix that no run has
+	for i := 1; ; i++ {
+		run := runID
+		if i > 1 {
+			run = fmt.Sprintf("%s-%d", runID, i)
+		}
+		dir := RunDir(r.StateDir, run)
+		err := os.Mkdir(dir, 0o755)
+		if err == nil {
+			return run, dir, func() {}, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", "", func() {}, oops.Wrap(err)
+		}
+	}
+}
+
+// RunDir is the directory of run under stateDir, see [WorkflowState.Run]
+func RunDir(stateDir, run string) string {
+	return filepath.Join(stateDir, "runs", run)
+}
+
+// resolveWorkspaceOptions fills the defaults of opts: the source is the root of the git checkout
+// that contains repoDir (or repoDir itself outside of git), and the ref is the commit the run is for.
+func resolveWorkspaceOptions(ctx context.Context, opts workspace.Options, repoDir, sha string) workspace.Options {
+	if opts.Source == "" {
+		opts.Source = repoDir
+		if root, err := gitinfo.Git(ctx, repoDir, "rev-parse", "--show-toplevel"); err == nil {
+			opts.Source = root
+		}
+	}
+	if opts.Ref == "" {
+		opts.Ref = sha
+	}
+	return opts
 }
@@ -0,0 +1,77 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/ctxkit"
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+// WorkflowRunResult is the outcome of one workflow out of several that were run together
+type WorkflowRunResult struct {
+	Workflow DiscoveredWorkflow
+	State    *WorkflowState
+	Err      error
+}
+
+// RunWorkflows runs all the given workflows concurrently, each with its own [WorkflowState].
+// Console output of every workflow is prefixed with its display name.
+// Workflows that couldn't be read fail with their [DiscoveredWorkflow.Err] without running.
+// The returned results are in the same order as workflows. The returned error joins the errors of
+// all the workflows that failed, so it is nil only if all of them succeeded.
+func (r *Runner) RunWorkflows(
+	ctx context.Context,
+	workflows []DiscoveredWorkflow,
+	wfContext *types.WorkflowContexts,
+) ([]WorkflowRunResult, error) {
+	console := NewLockedWriter(r.Console)
+	results := make([]WorkflowRunResult, len(workflows))
+
+	var wg sync.WaitGroup
+	for i, dwf := range workflows {
+		results[i].Workflow = dwf
+		wg.Go(func() {
+			ctx, logger, oopser := ctxkit.With(ctx, "workflowFile", dwf.Path)
+
+			prefixed := NewPrefixWriter(console, fmt.Sprintf("[%s] ", dwf.DisplayName()))
+			defer func() {
+				if err := prefixed.Flush(); err != nil {
+					logger.E(ctx, "failed to flush workflow console", "error", err)
+				}
+			}()
+
+			if dwf.Err != nil {
+				fmt.Fprintf(prefixed, "invalid workflow file: %s\n", strings.TrimSuffix(yamls.FormatError(dwf.Err), "\n"))
+				results[i].Err = oopser.Wrapf(dwf.Err, "workflow %s failed", dwf.DisplayName())
+				return
+			}
+
+			wfRunner := *r
+			wfRunner.Console = prefixed
+
+			state, err := wfRunner.RunWorkflow(ctx, dwf.Workflow, wfContext)
+			results[i].State = state
+			if err != nil {
+				results[i].Err = oopser.Wrapf(err, "workflow %s failed", dwf.DisplayName())
+			}
+		})
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, res := range results {
+		if res.Err != nil {
+			errs = append(errs, res.Err)
+		}
+	}
+	if len(errs) > 0 {
+		return results, oops.Join(errs...)
+	}
+	return results, nil
+}
@@ -0,0 +1,330 @@
+package runner
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/types"
+	"github.com/drornir/better-actions/pkg/yamls"
+)
+
+func writeRepoWorkflows(t *testing.T, files map[string]string) string {
+	t.Helper()
+	repo := t.TempDir()
+	dir := filepath.Join(repo, WorkflowsDir)
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	return repo
+}
+
+func TestDiscoverWorkflows(t *testing.T) {
+	repo := writeRepoWorkflows(t, map[string]string{
+		"push.yml": `
+on: push
+jobs:
+  a:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo a
+`,
+		"both.yaml": `
+on: [push, pull_request]
+jobs:
+  b:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo b
+`,
+		"pr.yaml": `
+on:
+  pull_request:
+    branches: [main]
+jobs:
+  c:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo c
+`,
+		"README.md": "not a workflow",
+	})
+
+	found, err := DiscoverWorkflows(t.Context(), repo, "push", nil, nil)
+	require.NoError(t, err)
+	var names []string
+	for _, wf := range found {
+		names = append(names, wf.DisplayName())
+	}
+	assert.Equal(t, []string{"both.yaml", "push.yml"}, names)
+
+	found, err = DiscoverWorkflows(t.Context(), repo, "pull_request", nil, nil)
+	require.NoError(t, err)
+	names = nil
+	for _, wf := range found {
+		names = append(names, wf.DisplayName())
+	}
+	assert.Equal(t, []string{"both.yaml", "pr.yaml"}, names)
+
+	found, err = DiscoverWorkflows(t.Context(), repo, "pull_request", &types.GitHub{BaseRef: "develop"}, nil)
+	require.NoError(t, err)
+	names = nil
+	for _, wf := range found {
+		names = append(names, wf.DisplayName())
+	}
+	assert.Equal(t, []string{"both.yaml"}, names, "pr.yaml only runs for pull requests into main")
+}
+
+func TestDiscoverWorkflowsRefFilters(t *testing.T) {
+	repo := writeRepoWorkflows(t, map[string]string{
+		"main.yml": `
+on:
+  push:
+    branches: [main]
+jobs:
+  a:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo a
+`,
+		"release.yml": `
+on:
+  push:
+    branches: ['release/**']
+    tags: ['v*']
+jobs:
+  b:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo b
+`,
+	})
+
+	discover := func(ref string) []string {
+		t.Helper()
+		found, err := DiscoverWorkflows(t.Context(), repo, "push", &types.GitHub{Ref: ref}, nil)
+		require.NoError(t, err)
+		var names []string
+		for _, wf := range found {
+			names = append(names, wf.DisplayName())
+		}
+		return names
+	}
+	assert.Equal(t, []string{"main.yml"}, discover("refs/heads/main"))
+	assert.Equal(t, []string{"release.yml"}, discover("refs/heads/release/1.0"))
+	assert.Equal(t, []string{"release.yml"}, discover("refs/tags/v1.0.0"))
+	assert.Empty(t, discover("refs/heads/feature"))
+}
+
+func TestRunWorkflowsPrefixesAndAggregates(t *testing.T) {
+	repo := writeRepoWorkflows(t, map[string]string{
+		"ok.yml": `
+name: good
+on: push
+jobs:
+  a:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo from-good
+`,
+		"fail.yml": `
+name: bad
+on: push
+jobs:
+  b:
+    runs-on: ubuntu-latest
+    steps:
+      - run: exit 3
+`,
+	})
+
+	found, err := DiscoverWorkflows(t.Context(), repo, "push", nil, nil)
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+
+	var console bytes.Buffer
+	rnr := New(&console, EnvFromEmpty())
+	results, err := rnr.RunWorkflows(t.Context(), found, &types.WorkflowContexts{})
+	require.Error(t, err)
+	require.Len(t, results, 2)
+
+	byName := map[string]WorkflowRunResult{}
+	for _, res := range results {
+		byName[res.Workflow.DisplayName()] = res
+	}
+	assert.Error(t, byName["bad"].Err)
+	assert.NoError(t, byName["good"].Err)
+
+	for line := range strings.Lines(console.String()) {
+		assert.True(t,
+			strings.HasPrefix(line, "[good] ") || strings.HasPrefix(line, "[bad] "),
+			"line without workflow prefix: %q", line)
+	}
+	assert.Contains(t, console.String(), "[good] from-good\n")
+}
+
+func TestRunWorkflowsWithInvalidFile(t *testing.T) {
+	repo := writeRepoWorkflows(t, map[string]string{
+		"ok.yml": `
+name: good
+on: push
+jobs:
+  a:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo from-good
+`,
+		"broken.yml": `
+on: push
+jobs:
+  b:
+    runs-on: ubuntu-latest
+    steps: [
+`,
+		"invalid.yml": `
+on: push
+jobs:
+  c:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo ${{ fromJSON( }}
+`,
+	})
+
+	found, err := DiscoverWorkflows(t.Context(), repo, "push", nil, nil)
+	require.NoError(t, err)
+	require.Len(t, found, 3)
+
+	var console bytes.Buffer
+	rnr := New(&console, EnvFromEmpty())
+	results, err := rnr.RunWorkflows(t.Context(), found, &types.WorkflowContexts{})
+	require.Error(t, err)
+	require.Len(t, results, 3)
+
+	byName := map[string]WorkflowRunResult{}
+	for _, res := range results {
+		byName[res.Workflow.DisplayName()] = res
+	}
+	assert.NoError(t, byName["good"].Err)
+	assert.Error(t, byName["broken.yml"].Err)
+	assert.Nil(t, byName["broken.yml"].State, "invalid workflows don't run")
+	assert.Error(t, byName["invalid.yml"].Err)
+	assert.Contains(t, console.String(), "[good] from-good\n")
+	assert.Contains(t, console.String(), "[broken.yml] invalid workflow file: ")
+}
+
+func TestRunWorkflowErrorPositions(t *testing.T) {
+	repo := writeRepoWorkflows(t, map[string]string{
+		"ci.yml": `
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo ok
+      - if: success() && fromJSON('{')
+        run: echo never
+`,
+	})
+	found, err := DiscoverWorkflows(t.Context(), repo, "push", nil, nil)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+
+	rnr := New(&bytes.Buffer{}, EnvFromEmpty())
+	_, err = rnr.RunWorkflows(t.Context(), found, &types.WorkflowContexts{})
+	require.Error(t, err)
+
+	var sourceErr *yamls.SourceError
+	require.ErrorAs(t, err, &sourceErr)
+	assert.Equal(t, found[0].Path, sourceErr.File)
+	assert.Equal(t, 8, sourceErr.Line)
+	assert.Equal(t, 13, sourceErr.Column)
+	assert.Equal(t, "      - if: success() && fromJSON('{')", sourceErr.Text)
+	assert.True(t, strings.HasPrefix(yamls.FormatError(err), found[0].Path+":8:13: "), yamls.FormatError(err))
+}
+
+func TestRunWorkflowStepFailurePosition(t *testing.T) {
+	repo := writeRepoWorkflows(t, map[string]string{
+		"ci.yml": `
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo ok
+      - name: broken
+        run: exit 3
+`,
+	})
+	found, err := DiscoverWorkflows(t.Context(), repo, "push", nil, nil)
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+
+	rnr := New(&bytes.Buffer{}, EnvFromEmpty())
+	_, err = rnr.RunWorkflows(t.Context(), found, &types.WorkflowContexts{})
+	require.Error(t, err)
+
+	var sourceErr *yamls.SourceError
+	require.ErrorAs(t, err, &sourceErr)
+	assert.Equal(t, 8, sourceErr.Line)
+	assert.Equal(t, 9, sourceErr.Column)
+	assert.True(t, strings.HasPrefix(yamls.FormatError(err), found[0].Path+":8:9: "), yamls.FormatError(err))
+	assert.Contains(t, yamls.FormatError(err), "8 |       - name: broken\n")
+}
+
+func TestPrefixWriterPartialLines(t *testing.T) {
+	var out bytes.Buffer
+	pw := NewPrefixWriter(&out, "> ")
+
+	_, err := pw.Write([]byte("hel"))
+	require.NoError(t, err)
+	assert.Empty(t, out.String())
+
+	_, err = pw.Write([]byte("lo\nwor"))
+	require.NoError(t, err)
+	assert.Equal(t, "> hello\n", out.String())
+
+	require.NoError(t, pw.Flush())
+	assert.Equal(t, "> hello\n> wor\n", out.String())
+}
+
+func TestRunWorkflowsWithSameRunID(t *testing.T) {
+	files := map[string]string{}
+	for _, name := range []string{"w1", "w2", "w3"} {
+		files[name+".yml"] = "name: " + name + `
+on: push
+jobs:
+  a:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo "$GITHUB_RUN_ID"
+`
+	}
+	repo := writeRepoWorkflows(t, files)
+	found, err := DiscoverWorkflows(t.Context(), repo, "push", nil, nil)
+	require.NoError(t, err)
+
+	var console bytes.Buffer
+	rnr := New(&console, EnvFromEmpty())
+	rnr.StateDir = t.TempDir()
+	results, err := rnr.RunWorkflows(t.Context(), found, &types.WorkflowContexts{GitHub: &types.GitHub{RunID: "42"}})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	runs := map[string]bool{}
+	for _, res := range results {
+		assert.Equal(t, "42", res.State.GitHub.RunID)
+		runs[res.State.Run] = true
+		record, err := ReadRunRecord(RunDir(rnr.StateDir, res.State.Run))
+		require.NoError(t, err)
+		assert.Equal(t, res.Workflow.DisplayName(), record.Workflow, "every run has its own directory")
+	}
+	assert.Equal(t, map[string]bool{"42": true, "42-2": true, "42-3": true}, runs)
+	assert.Equal(t, 3, strings.Count(console.String(), "42\n"))
+}
@@ -0,0 +1,111 @@
+// Package runtimetoken issues and verifies ACTIONS_RUNTIME_TOKEN, the credential actions use to call
+// the services of the runner (artifacts, cache).
+//
+// The token is a JWT, because upstream clients decode it to find the backend ids of the run and the job
+// in the "scp" claim. It is signed with HMAC, so every service that shares a [Signer] accepts it.
+package runtimetoken
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/samber/oops"
+)
+
+const resultsScopePrefix = "Actions.Results:"
+
+type claims struct {
+	Scope     string `json:"scp"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Signer signs and verifies tokens with a random key
+type Signer struct {
+	key []byte
+}
+
+// NewSigner creates a Signer with a new random key
+func NewSigner() (*Signer, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, oops.Wrapf(err, "generating signing key")
+	}
+	return &Signer{key: key}, nil
+}
+
+// Sign issues a token for a job of a run
+func (s *Signer) Sign(runBackendID, jobBackendID string) (string, error) {
+	now := time.Now()
+	header, err := json.Marshal(map[string]string{"typ": "JWT", "alg": "HS256"})
+	if err != nil {
+		return "", oops.Wrap(err)
+	}
+	payload, err := json.Marshal(claims{
+		Scope:     "Actions.GenericRead:00000000-0000-0000-0000-000000000000 " + resultsScopePrefix + runBackendID + ":" + jobBackendID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(24 * time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", oops.Wrap(err)
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(s.MAC(unsigned)), nil
+}
+
+// Verify checks the signature of token and returns the backend ids in its scope
+func (s *Signer) Verify(token string) (runBackendID, jobBackendID string, _ error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", "", oops.Errorf("malformed token")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, s.MAC(parts[0]+"."+parts[1])) {
+		return "", "", oops.Errorf("invalid token signature")
+	}
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", "", oops.Wrapf(err, "decoding token claims")
+	}
+	var c claims
+	if err := json.Unmarshal(rawClaims, &c); err != nil {
+		return "", "", oops.Wrapf(err, "parsing token claims")
+	}
+	if time.Now().Unix() > c.ExpiresAt {
+		return "", "", oops.Errorf("token expired")
+	}
+	for scope := range strings.FieldsSeq(c.Scope) {
+		if ids, ok := strings.CutPrefix(scope, resultsScopePrefix); ok {
+			run, job, _ := strings.Cut(ids, ":")
+			return run, job, nil
+		}
+	}
+	return "", "", oops.Errorf("token has no results scope")
+}
+
+// VerifyRequest verifies the bearer token in the Authorization header of r
+func (s *Signer) VerifyRequest(r *http.Request) (runBackendID, jobBackendID string, _ error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", "", oops.Errorf("missing bearer token")
+	}
+	return s.Verify(token)
+}
+
+// MAC signs arbitrary data with the key of the signer. Services use it to sign urls.
+func (s *Signer) MAC(data string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// CheckMAC reports whether mac is the signature of data
+func (s *Signer) CheckMAC(data string, mac []byte) bool {
+	return hmac.Equal(mac, s.MAC(data))
+}
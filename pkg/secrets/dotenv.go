@@ -0,0 +1,131 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/samber/oops"
+)
+
+// DotenvFile provides the secrets in a dotenv file: KEY=VALUE lines, with # comments, an optional
+// `export ` prefix and single or double quoted values that may span lines.
+// In double quoted values \n, \r, \t, \" and \\ are escapes.
+type DotenvFile struct {
+	Path string
+}
+
+func (p DotenvFile) Name() string {
+	return "dotenv:" + p.Path
+}
+
+func (p DotenvFile) Fetch(ctx context.Context) (map[string]string, error) {
+	content, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, oops.Wrapf(err, "reading dotenv file")
+	}
+	values, err := ParseDotenv(string(content))
+	if err != nil {
+		return nil, oops.With("path", p.Path).Wrap(err)
+	}
+	return values, nil
+}
+
+// ParseDotenv parses the content of a dotenv file. See [DotenvFile] for the format.
+func ParseDotenv(content string) (map[string]string, error) {
+	values := make(map[string]string)
+	rest := strings.ReplaceAll(content, "\r\n", "\n")
+	lineNum := 0
+	for rest != "" {
+		var line string
+		line, rest, _ = strings.Cut(rest, "\n")
+		lineNum++
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		trimmed = strings.TrimPrefix(trimmed, "export ")
+
+		key, value, ok := strings.Cut(trimmed, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !validKey(key) {
+			return nil, oops.With("line", lineNum).Errorf("line %d: expected KEY=VALUE", lineNum)
+		}
+		value = strings.TrimLeft(value, " \t")
+
+		if value != "" && (value[0] == '"' || value[0] == '\'') {
+			// a quoted value ends at the closing quote, which may be on a later line
+			quoted := value + "\n" + rest
+			parsed, consumed, err := parseQuoted(quoted)
+			if err != nil {
+				return nil, oops.With("line", lineNum).Wrapf(err, "line %d: %s", lineNum, key)
+			}
+			var after string
+			if consumed <= len(value) {
+				after = value[consumed:]
+			} else {
+				lineNum += strings.Count(quoted[len(value):consumed], "\n")
+				after, rest, _ = strings.Cut(quoted[consumed:], "\n")
+			}
+			if after = strings.TrimSpace(after); after != "" && !strings.HasPrefix(after, "#") {
+				return nil, oops.With("line", lineNum).Errorf("line %d: %s: unexpected characters after the closing quote", lineNum, key)
+			}
+			values[key] = parsed
+			continue
+		}
+
+		// an unquoted value ends at a comment
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+		values[key] = strings.TrimSpace(value)
+	}
+	return values, nil
+}
+
+// parseQuoted parses the quoted string s starts with, and returns it and the number of bytes it took
+func parseQuoted(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && quote == '"' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\':
+				b.WriteByte(s[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, oops.Errorf("missing closing %c", quote)
+}
+
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, c := range key {
+		switch {
+		case c == '_', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
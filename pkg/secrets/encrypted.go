@@ -0,0 +1,181 @@
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/samber/oops"
+)
+
+// KeySize is the size in bytes of the keys of encrypted secrets files
+const KeySize = 32
+
+const (
+	encPrefix = "ENC[AES256_GCM,"
+	encSuffix = "]"
+)
+
+// EncryptedFile provides the secrets of a dotenv file that is safe to commit: the names are in the clear,
+// and every value is encrypted with AES-256-GCM (authenticated with its name) in the form
+// ENC[AES256_GCM,data:<base64>,iv:<base64>,tag:<base64>], like sops does.
+// The key is read from KeyFile, which is created with [GenerateKey] and [EncodeKey] and must not be committed.
+type EncryptedFile struct {
+	Path    string
+	KeyFile string
+}
+
+func (p EncryptedFile) Name() string {
+	return "encrypted:" + p.Path
+}
+
+func (p EncryptedFile) Fetch(ctx context.Context) (map[string]string, error) {
+	oopser := oops.With("path", p.Path)
+	key, err := ReadKeyFile(p.KeyFile)
+	if err != nil {
+		return nil, oopser.Wrap(err)
+	}
+	content, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, oopser.Wrapf(err, "reading encrypted secrets file")
+	}
+	encrypted, err := ParseDotenv(string(content))
+	if err != nil {
+		return nil, oopser.Wrap(err)
+	}
+	values := make(map[string]string, len(encrypted))
+	for name, enc := range encrypted {
+		values[name], err = DecryptValue(key, name, enc)
+		if err != nil {
+			return nil, oopser.With("secret", name).Wrap(err)
+		}
+	}
+	return values, nil
+}
+
+// GenerateKey returns a new random key for encrypted secrets files
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, oops.Wrap(err)
+	}
+	return key, nil
+}
+
+// EncodeKey returns the content of a key file for key
+func EncodeKey(key []byte) string {
+	return "# bact secrets key. Keep it out of version control\n" + base64.StdEncoding.EncodeToString(key) + "\n"
+}
+
+// ReadKeyFile reads a key written by [EncodeKey]. Lines that start with # are ignored.
+func ReadKeyFile(path string) ([]byte, error) {
+	if path == "" {
+		return nil, oops.Errorf("a key file is required to decrypt secrets")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, oops.Wrapf(err, "reading key file")
+	}
+	for line := range strings.Lines(string(content)) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || len(key) != KeySize {
+			return nil, oops.With("path", path).Errorf("key file doesn't contain a base64 encoded %d byte key", KeySize)
+		}
+		return key, nil
+	}
+	return nil, oops.With("path", path).Errorf("key file is empty")
+}
+
+// EncryptValue encrypts the value of the secret name
+func EncryptValue(key []byte, name, value string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", oops.Wrap(err)
+	}
+	sealed := gcm.Seal(nil, iv, []byte(value), []byte(name))
+	data, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+	enc := base64.StdEncoding
+	return fmt.Sprintf("%sdata:%s,iv:%s,tag:%s%s",
+		encPrefix, enc.EncodeToString(data), enc.EncodeToString(iv), enc.EncodeToString(tag), encSuffix), nil
+}
+
+// DecryptValue decrypts a value encrypted by [EncryptValue] for the secret name
+func DecryptValue(key []byte, name, encrypted string) (string, error) {
+	fields, ok := strings.CutPrefix(encrypted, encPrefix)
+	if ok {
+		fields, ok = strings.CutSuffix(fields, encSuffix)
+	}
+	if !ok {
+		return "", oops.Errorf("value is not encrypted")
+	}
+	parts := make(map[string][]byte)
+	for field := range strings.SplitSeq(fields, ",") {
+		k, v, _ := strings.Cut(field, ":")
+		decoded, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return "", oops.Errorf("malformed %s of encrypted value", k)
+		}
+		parts[k] = decoded
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(parts["iv"]) != gcm.NonceSize() || len(parts["tag"]) != gcm.Overhead() {
+		return "", oops.Errorf("malformed encrypted value")
+	}
+	plain, err := gcm.Open(nil, parts["iv"], append(parts["data"], parts["tag"]...), []byte(name))
+	if err != nil {
+		return "", oops.Errorf("decrypting value failed, the key is wrong or the value was modified")
+	}
+	return string(plain), nil
+}
+
+// EncryptDotenv encrypts the values of a plain dotenv file, returning the content of an [EncryptedFile].
+// Values that are already encrypted are kept as they are.
+func EncryptDotenv(key []byte, content string) (string, error) {
+	values, err := ParseDotenv(content)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		value := values[name]
+		if !strings.HasPrefix(value, encPrefix) {
+			value, err = EncryptValue(key, name, value)
+			if err != nil {
+				return "", err
+			}
+		}
+		fmt.Fprintf(&b, "%s=%s\n", name, value)
+	}
+	return b.String(), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, oops.Wrapf(err, "invalid key")
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, oops.Wrap(err)
+	}
+	return gcm, nil
+}
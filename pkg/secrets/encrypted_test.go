@@ -0,0 +1,67 @@
+package secrets_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/secrets"
+)
+
+func TestEncryptedFile(t *testing.T) {
+	dir := t.TempDir()
+	key, err := secrets.GenerateKey()
+	require.NoError(t, err)
+	keyFile := filepath.Join(dir, "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte(secrets.EncodeKey(key)), 0o600))
+
+	encrypted, err := secrets.EncryptDotenv(key, "TOKEN=s3cret\nCERT=\"line1\nline2\"\n")
+	require.NoError(t, err)
+	assert.NotContains(t, encrypted, "s3cret")
+	assert.Contains(t, encrypted, "TOKEN=ENC[AES256_GCM,data:")
+
+	again, err := secrets.EncryptDotenv(key, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, encrypted, again, "encrypted values are kept")
+
+	path := filepath.Join(dir, "secrets.enc.env")
+	require.NoError(t, os.WriteFile(path, []byte(encrypted), 0o644))
+	values, err := secrets.EncryptedFile{Path: path, KeyFile: keyFile}.Fetch(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"TOKEN": "s3cret", "CERT": "line1\nline2"}, values)
+
+	t.Run("wrong key", func(t *testing.T) {
+		other, err := secrets.GenerateKey()
+		require.NoError(t, err)
+		otherFile := filepath.Join(t.TempDir(), "key")
+		require.NoError(t, os.WriteFile(otherFile, []byte(secrets.EncodeKey(other)), 0o600))
+		_, err = secrets.EncryptedFile{Path: path, KeyFile: otherFile}.Fetch(t.Context())
+		assert.Error(t, err)
+	})
+
+	t.Run("value moved to another name", func(t *testing.T) {
+		token, err := secrets.EncryptValue(key, "TOKEN", "s3cret")
+		require.NoError(t, err)
+		_, err = secrets.DecryptValue(key, "OTHER", token)
+		assert.Error(t, err)
+	})
+
+	t.Run("plain value", func(t *testing.T) {
+		plain := filepath.Join(t.TempDir(), "plain.env")
+		require.NoError(t, os.WriteFile(plain, []byte("TOKEN=s3cret\n"), 0o644))
+		_, err := secrets.EncryptedFile{Path: plain, KeyFile: keyFile}.Fetch(t.Context())
+		require.Error(t, err)
+		assert.NotContains(t, err.Error(), "s3cret")
+	})
+
+	t.Run("bad key file", func(t *testing.T) {
+		bad := filepath.Join(t.TempDir(), "key")
+		require.NoError(t, os.WriteFile(bad, []byte("# comment\n"+strings.Repeat("A", 8)+"\n"), 0o600))
+		_, err := secrets.ReadKeyFile(bad)
+		assert.Error(t, err)
+	})
+}
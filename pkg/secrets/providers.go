@@ -0,0 +1,118 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/samber/oops"
+)
+
+// Dir provides a secret for every file in a directory, named after the file, like the secrets Kubernetes and
+// Docker mount into containers. Trailing line breaks are trimmed from the values. Hidden files and
+// subdirectories are ignored.
+type Dir struct {
+	Path string
+}
+
+func (p Dir) Name() string {
+	return "dir:" + p.Path
+}
+
+func (p Dir) Fetch(ctx context.Context) (map[string]string, error) {
+	entries, err := os.ReadDir(p.Path)
+	if err != nil {
+		return nil, oops.Wrapf(err, "reading secrets directory")
+	}
+	values := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(p.Path, entry.Name())
+		// Kubernetes mounts secrets as symlinks, so entry.IsDir isn't enough
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, oops.Wrapf(err, "reading secret %s", entry.Name())
+		}
+		if info.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, oops.Wrapf(err, "reading secret %s", entry.Name())
+		}
+		values[entry.Name()] = strings.TrimRight(string(content), "\r\n")
+	}
+	return values, nil
+}
+
+// EnvPrefix provides the environment variables that start with Prefix as secrets, without the prefix
+// (BACT_SECRET_TOKEN is the secret TOKEN for the prefix BACT_SECRET_)
+type EnvPrefix struct {
+	Prefix string
+	// Environ is the environment to look in. nil means [os.Environ].
+	Environ []string
+}
+
+func (p EnvPrefix) Name() string {
+	return "env:" + p.Prefix
+}
+
+func (p EnvPrefix) Fetch(ctx context.Context) (map[string]string, error) {
+	if p.Prefix == "" {
+		return nil, oops.Errorf("an env prefix is required")
+	}
+	environ := p.Environ
+	if environ == nil {
+		environ = os.Environ()
+	}
+	values := make(map[string]string)
+	for _, pair := range environ {
+		key, value, _ := strings.Cut(pair, "=")
+		if name, ok := strings.CutPrefix(key, p.Prefix); ok && name != "" {
+			values[name] = value
+		}
+	}
+	return values, nil
+}
+
+// Command provides the secrets an external command (e.g a password manager CLI) prints to its stdout
+// as a JSON object of strings
+type Command struct {
+	Args []string
+	// Dir is the working directory of the command. Empty means the current directory.
+	Dir string
+}
+
+func (p Command) Name() string {
+	if len(p.Args) == 0 {
+		return "command"
+	}
+	return "command:" + p.Args[0]
+}
+
+func (p Command) Fetch(ctx context.Context) (map[string]string, error) {
+	if len(p.Args) == 0 {
+		return nil, oops.Errorf("a command is required")
+	}
+	cmd := exec.CommandContext(ctx, p.Args[0], p.Args[1:]...)
+	cmd.Dir = p.Dir
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	// stderr is passed on as is, it's where the command prompts for credentials
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, oops.Wrapf(err, "running secrets command")
+	}
+	var values map[string]string
+	if err := json.Unmarshal(stdout.Bytes(), &values); err != nil {
+		// don't include the output, it's full of secrets
+		return nil, oops.Errorf("secrets command didn't print a JSON object of strings")
+	}
+	return values, nil
+}
@@ -0,0 +1,59 @@
+// Package secrets fetches the values of the secrets context from the places users keep them,
+// so they don't have to be passed on the command line.
+package secrets
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/samber/oops"
+)
+
+// Provider is a source of secrets (a SecretProvider)
+type Provider interface {
+	// Name identifies the provider in errors and listings
+	Name() string
+	// Fetch returns all the secrets of the provider by name
+	Fetch(ctx context.Context) (map[string]string, error)
+}
+
+// Resolve fetches the secrets of all the providers. When a secret is provided more than once,
+// the value of the provider that comes first wins.
+func Resolve(ctx context.Context, providers ...Provider) (map[string]string, error) {
+	resolved := make(map[string]string)
+	for i := len(providers) - 1; i >= 0; i-- {
+		fetched, err := providers[i].Fetch(ctx)
+		if err != nil {
+			return nil, oops.With("provider", providers[i].Name()).Wrapf(err, "fetching secrets")
+		}
+		maps.Copy(resolved, fetched)
+	}
+	return resolved, nil
+}
+
+// Source is a secret name together with the provider it's resolved from
+type Source struct {
+	Name     string
+	Provider string
+}
+
+// Sources returns where each secret [Resolve] would return comes from, without keeping the values
+func Sources(ctx context.Context, providers ...Provider) ([]Source, error) {
+	seen := make(map[string]bool)
+	var sources []Source
+	for _, p := range providers {
+		fetched, err := p.Fetch(ctx)
+		if err != nil {
+			return nil, oops.With("provider", p.Name()).Wrapf(err, "fetching secrets")
+		}
+		for _, name := range slices.Sorted(maps.Keys(fetched)) {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			sources = append(sources, Source{Name: name, Provider: p.Name()})
+		}
+	}
+	return sources, nil
+}
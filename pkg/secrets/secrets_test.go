@@ -0,0 +1,116 @@
+package secrets_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/secrets"
+)
+
+func TestParseDotenv(t *testing.T) {
+	content := `# a comment
+PLAIN=value
+export EXPORTED=exported
+SPACED = spaced value   
+COMMENTED=value # comment
+EMPTY=
+SINGLE='single $NOT "expanded" \n'
+DOUBLE="line1\nline2 \"quoted\"" # comment
+MULTI="first
+second"
+MULTI_SINGLE='a
+b
+c'
+AFTER=after
+`
+	values, err := secrets.ParseDotenv(content)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"PLAIN":        "value",
+		"EXPORTED":     "exported",
+		"SPACED":       "spaced value",
+		"COMMENTED":    "value",
+		"EMPTY":        "",
+		"SINGLE":       `single $NOT "expanded" \n`,
+		"DOUBLE":       "line1\nline2 \"quoted\"",
+		"MULTI":        "first\nsecond",
+		"MULTI_SINGLE": "a\nb\nc",
+		"AFTER":        "after",
+	}, values)
+
+	for _, bad := range []string{
+		"NO_EQUALS",
+		"=value",
+		"1KEY=value",
+		`UNCLOSED="value`,
+		`TRAILING="value" junk`,
+	} {
+		_, err := secrets.ParseDotenv(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "TOKEN"), []byte("s3cret\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "KEY"), []byte("line1\nline2"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".hidden"), []byte("x"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o755))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "TOKEN"), filepath.Join(dir, "LINKED")))
+
+	values, err := secrets.Dir{Path: dir}.Fetch(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"TOKEN":  "s3cret",
+		"KEY":    "line1\nline2",
+		"LINKED": "s3cret",
+	}, values)
+}
+
+func TestEnvPrefix(t *testing.T) {
+	values, err := secrets.EnvPrefix{
+		Prefix:  "BACT_SECRET_",
+		Environ: []string{"BACT_SECRET_TOKEN=abc", "BACT_SECRET_=empty-name", "OTHER=x", "BACT_SECRET_EQ=a=b"},
+	}.Fetch(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"TOKEN": "abc", "EQ": "a=b"}, values)
+}
+
+func TestCommand(t *testing.T) {
+	values, err := secrets.Command{Args: []string{"sh", "-c", `echo '{"TOKEN": "from-command"}'`}}.Fetch(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"TOKEN": "from-command"}, values)
+
+	_, err = secrets.Command{Args: []string{"sh", "-c", "echo not-json"}}.Fetch(t.Context())
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "not-json", "the output of the command is not in the error")
+
+	_, err = secrets.Command{Args: []string{"sh", "-c", "exit 3"}}.Fetch(t.Context())
+	require.Error(t, err)
+}
+
+func TestResolvePrecedence(t *testing.T) {
+	dir := t.TempDir()
+	dotenv := filepath.Join(dir, ".env")
+	require.NoError(t, os.WriteFile(dotenv, []byte("SHARED=dotenv\nDOTENV_ONLY=1\n"), 0o600))
+	env := secrets.EnvPrefix{Prefix: "S_", Environ: []string{"S_SHARED=env", "S_ENV_ONLY=2"}}
+
+	values, err := secrets.Resolve(t.Context(), secrets.DotenvFile{Path: dotenv}, env)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"SHARED": "dotenv", "DOTENV_ONLY": "1", "ENV_ONLY": "2"}, values)
+
+	sources, err := secrets.Sources(t.Context(), env, secrets.DotenvFile{Path: dotenv})
+	require.NoError(t, err)
+	assert.Equal(t, []secrets.Source{
+		{Name: "ENV_ONLY", Provider: "env:S_"},
+		{Name: "SHARED", Provider: "env:S_"},
+		{Name: "DOTENV_ONLY", Provider: "dotenv:" + dotenv},
+	}, sources)
+
+	_, err = secrets.Resolve(t.Context(), secrets.DotenvFile{Path: filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+}
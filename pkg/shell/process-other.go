@@ -0,0 +1,8 @@
+//go:build !unix
+
+package shell
+
+import "os/exec"
+
+// killProcessGroup is a no-op where there are no process groups. cmd.WaitDelay stops waiting for their output.
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -3,8 +3,10 @@ package shell
 import (
 	"context"
 	"io"
-	"os"
+	"maps"
 	"os/exec"
+	"slices"
+	"time"
 
 	"github.com/samber/oops"
 )
@@ -29,12 +31,16 @@ func NewShell(bin string, args ...string) (*Shell, error) {
 	}, nil
 }
 
+// waitDelay is how long a cancelled command may take to close its output
+const waitDelay = 5 * time.Second
+
 type CommandOpts struct {
-	Args     []string
-	ExtraEnv map[string]string
-	Dir      string
-	StdOut   io.Writer
-	StdErr   io.Writer
+	Args []string
+	// Env is the complete environment of the command. Nothing is inherited from the current process.
+	Env    map[string]string
+	Dir    string
+	StdOut io.Writer
+	StdErr io.Writer
 }
 
 func (s *Shell) NewCommand(ctx context.Context, opts CommandOpts) *exec.Cmd {
@@ -43,15 +49,15 @@ func (s *Shell) NewCommand(ctx context.Context, opts CommandOpts) *exec.Cmd {
 	cmd := exec.CommandContext(ctx, s.bin, args...)
 	cmd.Stdout = opts.StdOut
 	cmd.Stderr = opts.StdErr
-	cmd.Env = os.Environ() // TODO remove
-
 	cmd.Dir = opts.Dir
-	if opts.ExtraEnv != nil {
-		extraEnv := make([]string, 0, len(opts.ExtraEnv))
-		for k, v := range opts.ExtraEnv {
-			extraEnv = append(extraEnv, k+"="+v)
-		}
-		cmd.Env = append(cmd.Env, extraEnv...)
+	killProcessGroup(cmd)
+	// don't wait forever for processes that outlived a cancelled command and hold its output
+	cmd.WaitDelay = waitDelay
+
+	// a nil Env would make exec inherit the environment of the current process
+	cmd.Env = make([]string, 0, len(opts.Env))
+	for _, k := range slices.Sorted(maps.Keys(opts.Env)) {
+		cmd.Env = append(cmd.Env, k+"="+opts.Env[k])
 	}
 	return cmd
 }
@@ -0,0 +1,225 @@
+// Package workspace populates the workspace directory of a job (GITHUB_WORKSPACE) from a local repository.
+package workspace
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/samber/oops"
+
+	"github.com/drornir/better-actions/pkg/gitinfo"
+	"github.com/drornir/better-actions/pkg/log"
+)
+
+// Mode is the strategy used to populate the workspace
+type Mode string
+
+const (
+	// ModeEmpty leaves the workspace empty. The workflow is expected to check out the code itself.
+	ModeEmpty Mode = "empty"
+	// ModeCopy copies the files of the source repository, skipping files ignored by git and the .git directory.
+	ModeCopy Mode = "copy"
+	// ModeBind uses the source directory in place as the workspace. Changes made by steps affect the source.
+	ModeBind Mode = "bind"
+	// ModeWorktree creates a detached `git worktree` of the source repository at the target ref.
+	ModeWorktree Mode = "worktree"
+	// ModeClone clones the source repository and checks out the target ref.
+	ModeClone Mode = "clone"
+)
+
+var allModes = []Mode{ModeEmpty, ModeCopy, ModeBind, ModeWorktree, ModeClone}
+
+// ParseMode parses s into a Mode. The empty string is parsed as [ModeEmpty].
+func ParseMode(s string) (Mode, error) {
+	if s == "" {
+		return ModeEmpty, nil
+	}
+	m := Mode(strings.ToLower(s))
+	if !slices.Contains(allModes, m) {
+		return "", oops.With("mode", s, "allowed", allModes).Errorf("unknown workspace mode %q", s)
+	}
+	return m, nil
+}
+
+// Options configure how a workspace is prepared
+type Options struct {
+	Mode Mode
+	// Source is a path to the repository the workspace is populated from
+	Source string
+	// Ref is the commit-ish to check out in [ModeWorktree] and [ModeClone]. Defaults to HEAD.
+	Ref string
+}
+
+// Prepare populates dir according to opts.
+// It returns the path to use as the workspace, which is dir in every mode except [ModeBind], where it is
+// the source itself. The returned cleanup function must be called when the workspace is no longer needed
+// and it does not delete dir.
+func Prepare(ctx context.Context, opts Options, dir string) (workspacePath string, cleanup func(), _ error) {
+	logger := log.FromContext(ctx)
+	oopser := oops.FromContext(ctx).With("workspace.mode", opts.Mode, "workspace.source", opts.Source, "workspace.dir", dir)
+	noop := func() {}
+
+	mode := opts.Mode
+	if mode == "" {
+		mode = ModeEmpty
+	}
+	if mode != ModeEmpty && opts.Source == "" {
+		return "", noop, oopser.Errorf("workspace mode %s requires a source repository", mode)
+	}
+	ref := opts.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	logger.D(ctx, "preparing workspace", "workspace.mode", mode, "workspace.source", opts.Source, "workspace.ref", ref)
+
+	switch mode {
+	case ModeEmpty:
+		return dir, noop, nil
+
+	case ModeBind:
+		source, err := filepath.Abs(opts.Source)
+		if err != nil {
+			return "", noop, oopser.Wrapf(err, "resolving source path")
+		}
+		return source, noop, nil
+
+	case ModeCopy:
+		if err := copyRepo(ctx, opts.Source, dir); err != nil {
+			return "", noop, oopser.Wrapf(err, "copying source into workspace")
+		}
+		return dir, noop, nil
+
+	case ModeWorktree:
+		// git worktree add refuses to use an existing directory unless it's empty, which it is
+		if _, err := gitinfo.Git(ctx, opts.Source, "worktree", "add", "--detach", "--force", dir, ref); err != nil {
+			return "", noop, oopser.Wrapf(err, "creating git worktree")
+		}
+		return dir, func() {
+			if _, err := gitinfo.Git(ctx, opts.Source, "worktree", "remove", "--force", dir); err != nil {
+				logger.W(ctx, "failed to remove git worktree", "error", err)
+			}
+		}, nil
+
+	case ModeClone:
+		if _, err := gitinfo.Git(ctx, dir, "clone", "--quiet", "--no-checkout", opts.Source, "."); err != nil {
+			return "", noop, oopser.Wrapf(err, "cloning source repository")
+		}
+		sha, err := gitinfo.Git(ctx, opts.Source, "rev-parse", "--verify", ref+"^{commit}")
+		if err != nil {
+			return "", noop, oopser.With("workspace.ref", ref).Wrapf(err, "resolving ref in source repository")
+		}
+		if _, err := gitinfo.Git(ctx, dir, "checkout", "--quiet", "--detach", sha); err != nil {
+			return "", noop, oopser.With("workspace.ref", ref).Wrapf(err, "checking out ref")
+		}
+		return dir, noop, nil
+
+	default:
+		return "", noop, oopser.Errorf("unknown workspace mode %q", mode)
+	}
+}
+
+// copyRepo copies the files of source to dest. If source is inside a git work tree, only tracked and
+// untracked-but-not-ignored files are copied. Otherwise, everything except .git directories is copied.
+func copyRepo(ctx context.Context, source, dest string) error {
+	files, err := gitListFiles(ctx, source)
+	if err != nil {
+		log.FromContext(ctx).D(ctx, "source is not a git repository, copying all files", "error", err)
+		files, err = walkFiles(source)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, rel := range files {
+		if err := copyFile(filepath.Join(source, rel), filepath.Join(dest, rel)); err != nil {
+			return oops.With("file", rel).Wrapf(err, "copying file")
+		}
+	}
+	return nil
+}
+
+func gitListFiles(ctx context.Context, source string) ([]string, error) {
+	out, err := gitinfo.Git(ctx, source, "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for f := range strings.SplitSeq(out, "\x00") {
+		if f == "" {
+			continue
+		}
+		// deleted but still tracked files are listed too
+		if _, err := os.Lstat(filepath.Join(source, f)); err != nil {
+			continue
+		}
+		files = append(files, filepath.FromSlash(f))
+	}
+	return files, nil
+}
+
+func walkFiles(source string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(source, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(source, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, oops.With("source", source).Wrapf(err, "walking source directory")
+	}
+	return files, nil
+}
+
+func copyFile(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return oops.Wrap(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return oops.Wrap(err)
+	}
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return oops.Wrap(err)
+		}
+		return oops.Wrap(os.Symlink(target, dst))
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return oops.Wrap(err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return oops.Wrap(err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return oops.Wrap(err)
+	}
+	return oops.Wrap(out.Close())
+}
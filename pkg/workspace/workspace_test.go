@@ -0,0 +1,134 @@
+package workspace
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeSourceRepo creates a repository with two commits. The first commit has version.txt=v1, the second v2.
+// It also has an ignored file and an untracked file.
+func makeSourceRepo(t *testing.T) (dir string, firstSHA string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	dir = t.TempDir()
+	runGit := func(args ...string) string {
+		t.Helper()
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	write := func(name, content string) {
+		t.Helper()
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+
+	runGit("init", "--quiet")
+	runGit("config", "user.name", "Octo Cat")
+	runGit("config", "user.email", "octo@example.com")
+	write(".gitignore", "build/\n")
+	write("version.txt", "v1")
+	runGit("add", ".")
+	runGit("commit", "--quiet", "-m", "first")
+	firstSHA = runGit("rev-parse", "HEAD")
+
+	write("version.txt", "v2")
+	write("src/main.go", "package main")
+	runGit("add", ".")
+	runGit("commit", "--quiet", "-m", "second")
+
+	write("build/out.bin", "ignored")
+	write("notes.txt", "untracked")
+	return dir, firstSHA
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestParseMode(t *testing.T) {
+	m, err := ParseMode("")
+	require.NoError(t, err)
+	assert.Equal(t, ModeEmpty, m)
+
+	m, err = ParseMode("Worktree")
+	require.NoError(t, err)
+	assert.Equal(t, ModeWorktree, m)
+
+	_, err = ParseMode("rsync")
+	assert.Error(t, err)
+}
+
+func TestPrepareCopy(t *testing.T) {
+	source, _ := makeSourceRepo(t)
+	dir := t.TempDir()
+
+	ws, cleanup, err := Prepare(t.Context(), Options{Mode: ModeCopy, Source: source}, dir)
+	require.NoError(t, err)
+	defer cleanup()
+
+	assert.Equal(t, dir, ws)
+	assert.Equal(t, "v2", readFile(t, filepath.Join(ws, "version.txt")))
+	assert.Equal(t, "package main", readFile(t, filepath.Join(ws, "src", "main.go")))
+	assert.Equal(t, "untracked", readFile(t, filepath.Join(ws, "notes.txt")))
+	assert.NoFileExists(t, filepath.Join(ws, "build", "out.bin"), "ignored files must not be copied")
+	assert.NoDirExists(t, filepath.Join(ws, ".git"))
+}
+
+func TestPrepareBind(t *testing.T) {
+	source, _ := makeSourceRepo(t)
+
+	ws, cleanup, err := Prepare(t.Context(), Options{Mode: ModeBind, Source: source}, t.TempDir())
+	require.NoError(t, err)
+	defer cleanup()
+
+	assert.Equal(t, source, ws)
+}
+
+func TestPrepareWorktree(t *testing.T) {
+	source, firstSHA := makeSourceRepo(t)
+	dir := filepath.Join(t.TempDir(), "workspace")
+	require.NoError(t, os.Mkdir(dir, 0o755))
+
+	ws, cleanup, err := Prepare(t.Context(), Options{Mode: ModeWorktree, Source: source, Ref: firstSHA}, dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, dir, ws)
+	assert.Equal(t, "v1", readFile(t, filepath.Join(ws, "version.txt")))
+	assert.NoFileExists(t, filepath.Join(ws, "src", "main.go"))
+
+	cleanup()
+	out, err := exec.Command("git", "-C", source, "worktree", "list").CombinedOutput()
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), dir, "worktree should be removed by cleanup")
+}
+
+func TestPrepareClone(t *testing.T) {
+	source, firstSHA := makeSourceRepo(t)
+	dir := t.TempDir()
+
+	ws, cleanup, err := Prepare(t.Context(), Options{Mode: ModeClone, Source: source, Ref: firstSHA}, dir)
+	require.NoError(t, err)
+	defer cleanup()
+
+	assert.Equal(t, dir, ws)
+	assert.Equal(t, "v1", readFile(t, filepath.Join(ws, "version.txt")))
+	assert.DirExists(t, filepath.Join(ws, ".git"))
+}
+
+func TestPrepareRequiresSource(t *testing.T) {
+	_, _, err := Prepare(t.Context(), Options{Mode: ModeCopy}, t.TempDir())
+	assert.Error(t, err)
+}
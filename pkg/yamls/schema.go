@@ -7,13 +7,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math"
 	"regexp"
-	"strconv"
+	"slices"
 	"strings"
+	"sync"
 
-	"github.com/rhysd/actionlint"
 	"gopkg.in/yaml.v3"
+
+	"github.com/drornir/better-actions/pkg/runner/expr"
 )
 
 //go:embed workflow_schema.json
@@ -26,6 +27,25 @@ var functions = regexp.MustCompile(`^([a-zA-Z0-9_]+)\(([0-9]+),([0-9]+|MAX)\)$`)
 
 type Schema struct {
 	Definitions map[string]Definition
+
+	contextFunctionsOnce sync.Once
+	contextFunctionNames map[string]bool
+}
+
+// contextFunctions returns the lower cased names of the functions that contexts of the schema list,
+// which may only be called where they are listed
+func (s *Schema) contextFunctions() map[string]bool {
+	s.contextFunctionsOnce.Do(func() {
+		s.contextFunctionNames = make(map[string]bool)
+		for _, def := range s.Definitions {
+			for _, v := range def.Context {
+				if name := functionName(v); name != "" {
+					s.contextFunctionNames[strings.ToLower(name)] = true
+				}
+			}
+		}
+	})
+	return s.contextFunctionNames
 }
 
 func (s *Schema) GetDefinition(name string) Definition {
@@ -126,128 +146,105 @@ type Node struct {
 	Definition string
 	Schema     *Schema
 	Context    []string
+	// Functions are the functions expressions may call, [expr.DefaultFunctions] if nil
+	Functions expr.FunctionStore
 }
 
-type FunctionInfo struct {
-	name string
-	min  int
-	max  int
+var defaultFunctions = expr.DefaultFunctions()
+
+// functions returns the functions expressions may call, the default ones if there are none
+func (s *Node) functions() expr.FunctionStore {
+	if s.Functions == nil {
+		return defaultFunctions
+	}
+	return s.Functions
 }
 
-func (s *Node) checkSingleExpression(exprNode actionlint.ExprNode) error {
+// checkSingleExpression checks an expression that starts at offset in the value of node.
+// Functions are checked against the same store they run from. The ones the schema lists in contexts,
+// like hashFiles or success, may only be called where a context lists them.
+func (s *Node) checkSingleExpression(node *yaml.Node, offset int, exprNode expr.Node) error {
 	if len(s.Context) == 0 {
 		switch exprNode.Token().Kind {
-		case actionlint.TokenKindInt:
-		case actionlint.TokenKindFloat:
-		case actionlint.TokenKindString:
+		case expr.TokenKindInt:
+		case expr.TokenKindFloat:
+		case expr.TokenKindString:
 			return nil
 		default:
-			return fmt.Errorf("expressions are not allowed here")
+			return expressionErrorf(node, offset, "expressions are not allowed here")
 		}
 	}
 
-	funcs := s.GetFunctions()
+	funcs := s.functions()
+	contextFunctions := s.Schema.contextFunctions()
 
 	var err error
-	actionlint.VisitExprNode(exprNode, func(node, _ actionlint.ExprNode, entering bool) {
-		if funcCallNode, ok := node.(*actionlint.FuncCallNode); entering && ok {
-			for _, v := range *funcs {
-				if strings.EqualFold(funcCallNode.Callee, v.name) {
-					if v.min > len(funcCallNode.Args) {
-						err = errors.Join(err, fmt.Errorf("missing parameters for %s expected >= %v got %v", funcCallNode.Callee, v.min, len(funcCallNode.Args)))
-					}
-					if v.max < len(funcCallNode.Args) {
-						err = errors.Join(err, fmt.Errorf("too many parameters for %s expected <= %v got %v", funcCallNode.Callee, v.max, len(funcCallNode.Args)))
-					}
-					return
-				}
-			}
-			err = errors.Join(err, fmt.Errorf("unknown function call %s", funcCallNode.Callee))
+	expr.VisitExprNode(exprNode, func(exprNode, _ expr.Node, entering bool) {
+		if !entering {
+			return
 		}
-		if varNode, ok := node.(*actionlint.VariableNode); entering && ok {
+		at := offset + exprNode.Token().Offset
+		switch n := exprNode.(type) {
+		case *expr.FuncCallNode:
+			name := strings.ToLower(n.Callee)
+			if contextFunctions[name] && !slices.ContainsFunc(s.Context, func(v string) bool {
+				return strings.EqualFold(functionName(v), name)
+			}) {
+				err = errors.Join(err, expressionErrorf(node, at, "unknown function call %s", n.Callee))
+				return
+			}
+			if callErr := funcs.CheckCall(n); callErr != nil {
+				err = errors.Join(err, expressionErrorf(node, at, "%s", callErr.Error()))
+			}
+		case *expr.VariableNode:
 			for _, v := range s.Context {
-				if strings.EqualFold(varNode.Name, v) {
+				if strings.EqualFold(n.Name, v) {
 					return
 				}
 			}
-			err = errors.Join(err, fmt.Errorf("unknown variable access %s", varNode.Name))
+			err = errors.Join(err, expressionErrorf(node, at, "unknown variable access %s", n.Name))
 		}
 	})
 	return err
 }
 
-func (s *Node) GetFunctions() *[]FunctionInfo {
-	funcs := &[]FunctionInfo{}
-	AddFunction(funcs, "contains", 2, 2)
-	AddFunction(funcs, "endsWith", 2, 2)
-	AddFunction(funcs, "format", 1, 255)
-	AddFunction(funcs, "join", 1, 2)
-	AddFunction(funcs, "startsWith", 2, 2)
-	AddFunction(funcs, "toJson", 1, 1)
-	AddFunction(funcs, "fromJson", 1, 1)
-	for _, v := range s.Context {
-		i := strings.Index(v, "(")
-		if i == -1 {
-			continue
-		}
-		smatch := functions.FindStringSubmatch(v)
-		if len(smatch) > 0 {
-			functionName := smatch[1]
-			minParameters, _ := strconv.ParseInt(smatch[2], 10, 32)
-			maxParametersRaw := smatch[3]
-			var maxParameters int64
-			if strings.EqualFold(maxParametersRaw, "MAX") {
-				maxParameters = math.MaxInt32
-			} else {
-				maxParameters, _ = strconv.ParseInt(maxParametersRaw, 10, 32)
-			}
-			*funcs = append(*funcs, FunctionInfo{
-				name: functionName,
-				min:  int(minParameters),
-				max:  int(maxParameters),
-			})
-		}
+// functionName returns the name of the function of a context like hashFiles(1,255), or ""
+func functionName(context string) string {
+	if m := functions.FindStringSubmatch(context); m != nil {
+		return m[1]
 	}
-	return funcs
+	return ""
 }
 
 func (s *Node) checkExpression(node *yaml.Node) (bool, error) {
 	val := node.Value
+	offset := 0
 	hadExpr := false
 	var err error
 	for {
-		if i := strings.Index(val, "${{"); i != -1 {
-			val = val[i+3:]
-		} else {
+		i := strings.Index(val[offset:], "${{")
+		if i == -1 {
 			return hadExpr, err
 		}
+		offset += i + len("${{")
 		hadExpr = true
 
-		parser := actionlint.NewExprParser()
-		lexer := actionlint.NewExprLexer(val)
-		exprNode, parseErr := parser.Parse(lexer)
+		lexer := expr.NewExprLexer(val[offset:])
+		exprNode, parseErr := expr.NewParser().Parse(lexer)
 		if parseErr != nil {
-			err = errors.Join(err, fmt.Errorf("%sfailed to parse: %s", formatLocation(node), parseErr.Message))
+			err = errors.Join(err, expressionErrorf(node, offset+parseErr.Offset, "failed to parse: %s", parseErr.Message))
 			continue
 		}
-		val = val[lexer.Offset():]
-		cerr := s.checkSingleExpression(exprNode)
-		if cerr != nil {
-			err = errors.Join(err, fmt.Errorf("%s%w", formatLocation(node), cerr))
-		}
+		err = errors.Join(err, s.checkSingleExpression(node, offset, exprNode))
+		offset += lexer.Offset()
 	}
 }
 
-func AddFunction(funcs *[]FunctionInfo, s string, i1, i2 int) {
-	*funcs = append(*funcs, FunctionInfo{
-		name: s,
-		min:  i1,
-		max:  i2,
-	})
-}
-
 func (s *Node) UnmarshalYAML(node *yaml.Node) error {
 	if node != nil && node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return schemaErrorf(node, "the document is empty")
+		}
 		return s.UnmarshalYAML(node.Content[0])
 	}
 	def := s.Schema.GetDefinition(s.Definition)
@@ -271,17 +268,23 @@ func (s *Node) UnmarshalYAML(node *yaml.Node) error {
 	}
 
 	if node.Kind != yaml.ScalarNode {
-		return fmt.Errorf("%sexpected a scalar got %v", formatLocation(node), getStringKind(node.Kind))
+		return schemaErrorf(node, "expected a scalar got %v", getStringKind(node.Kind))
 	}
 
 	if def.String != nil {
 		return s.checkString(node, def)
 	} else if def.Number != nil {
 		var num float64
-		return node.Decode(&num)
+		if node.Decode(&num) != nil {
+			return schemaErrorf(node, "expected a number got %s", node.Value)
+		}
+		return nil
 	} else if def.Boolean != nil {
 		var b bool
-		return node.Decode(&b)
+		if node.Decode(&b) != nil {
+			return schemaErrorf(node, "expected a boolean got %s", node.Value)
+		}
+		return nil
 	} else if def.AllowedValues != nil {
 		s := node.Value
 		for _, v := range *def.AllowedValues {
@@ -289,10 +292,13 @@ func (s *Node) UnmarshalYAML(node *yaml.Node) error {
 				return nil
 			}
 		}
-		return fmt.Errorf("%sexpected one of %s got %s", formatLocation(node), strings.Join(*def.AllowedValues, ","), s)
+		return schemaErrorf(node, "expected one of %s got %s", strings.Join(*def.AllowedValues, ","), s)
 	} else if def.Null != nil {
 		var myNull *byte
-		return node.Decode(&myNull)
+		if node.Decode(&myNull) != nil {
+			return schemaErrorf(node, "expected null got %s", node.Value)
+		}
+		return nil
 	}
 	return errors.ErrUnsupported
 }
@@ -300,39 +306,64 @@ func (s *Node) UnmarshalYAML(node *yaml.Node) error {
 func (s *Node) checkString(node *yaml.Node, def Definition) error {
 	val := node.Value
 	if def.String.Constant != "" && def.String.Constant != val {
-		return fmt.Errorf("%sexpected %s got %s", formatLocation(node), def.String.Constant, val)
+		return schemaErrorf(node, "expected %s got %s", def.String.Constant, val)
 	}
 	if def.String.IsExpression {
-		parser := actionlint.NewExprParser()
-		lexer := actionlint.NewExprLexer(val + "}}")
-		exprNode, parseErr := parser.Parse(lexer)
+		exprNode, parseErr := expr.NewParser().Parse(expr.NewExprLexer(val + "}}"))
 		if parseErr != nil {
-			return fmt.Errorf("%sfailed to parse: %s", formatLocation(node), parseErr.Message)
-		}
-		cerr := s.checkSingleExpression(exprNode)
-		if cerr != nil {
-			return fmt.Errorf("%s%w", formatLocation(node), cerr)
+			return expressionErrorf(node, parseErr.Offset, "failed to parse: %s", parseErr.Message)
 		}
+		return s.checkSingleExpression(node, 0, exprNode)
 	}
 	return nil
 }
 
+// checkOneOf checks that node matches one of the definitions of def.
+// When none does, and some match the kind of node but not its content, the errors in the content of the
+// closest of them are returned, since they are more useful than a list of everything node could have been.
 func (s *Node) checkOneOf(def Definition, node *yaml.Node) error {
 	var allErrors error
+	var closest []*SchemaError
+	closestBadKeys := 0
 	for _, v := range *def.OneOf {
 		sub := &Node{
 			Definition: v,
 			Schema:     s.Schema,
 			Context:    append(append([]string{}, s.Context...), s.Schema.GetDefinition(v).Context...),
+			Functions:  s.Functions,
 		}
 
 		err := sub.UnmarshalYAML(node)
 		if err == nil {
 			return nil
 		}
-		allErrors = errors.Join(allErrors, fmt.Errorf("%sfailed to match %s: %w", formatLocation(node), v, err))
+		allErrors = errors.Join(allErrors, fmt.Errorf("failed to match %s: %w", v, err))
+
+		schemaErrs := SchemaErrors(err)
+		inContent := len(schemaErrs) > 0
+		badKeys := 0
+		for _, se := range schemaErrs {
+			inContent = inContent && se.node != node
+			if i := slices.Index(node.Content, se.node); node.Kind == yaml.MappingNode && i%2 == 0 {
+				badKeys++
+			}
+		}
+		// the closest definition is the one that knows the most keys of node, and then has the least errors
+		if inContent && (closest == nil || badKeys < closestBadKeys ||
+			(badKeys == closestBadKeys && len(schemaErrs) < len(closest))) {
+			closest, closestBadKeys = schemaErrs, badKeys
+		}
 	}
-	return allErrors
+	if closest != nil {
+		errs := make([]error, len(closest))
+		for i, se := range closest {
+			errs[i] = se
+		}
+		return errors.Join(errs...)
+	}
+	err := schemaErrorf(node, "expected one of %s", strings.Join(*def.OneOf, ", "))
+	err.Err = allErrors
+	return err
 }
 
 func getStringKind(k yaml.Kind) string {
@@ -354,7 +385,7 @@ func getStringKind(k yaml.Kind) string {
 
 func (s *Node) checkSequence(node *yaml.Node, def Definition) error {
 	if node.Kind != yaml.SequenceNode {
-		return fmt.Errorf("%sexpected a sequence got %v", formatLocation(node), getStringKind(node.Kind))
+		return schemaErrorf(node, "expected a sequence got %v", getStringKind(node.Kind))
 	}
 	var allErrors error
 	for _, v := range node.Content {
@@ -362,18 +393,80 @@ func (s *Node) checkSequence(node *yaml.Node, def Definition) error {
 			Definition: def.Sequence.ItemType,
 			Schema:     s.Schema,
 			Context:    append(append([]string{}, s.Context...), s.Schema.GetDefinition(def.Sequence.ItemType).Context...),
+			Functions:  s.Functions,
 		}).UnmarshalYAML(v))
 	}
 	return allErrors
 }
 
-func formatLocation(node *yaml.Node) string {
-	return fmt.Sprintf("Line: %v Column %v: ", node.Line, node.Column)
+// SchemaError is a part of a YAML that doesn't match its schema
+type SchemaError struct {
+	Line    int
+	Column  int
+	Message string
+	// Expression is set for errors in the expressions of the YAML, rather than in its structure
+	Expression bool
+	// Offset is, for expression errors, the byte offset in the value of the node where the problem is
+	Offset int
+	// Err is the reason, if there is more to tell than Message
+	Err error
+
+	node *yaml.Node
+}
+
+func (e *SchemaError) Error() string {
+	msg := fmt.Sprintf("Line: %v Column %v: %s", e.Line, e.Column, e.Message)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+func schemaErrorf(node *yaml.Node, format string, args ...any) *SchemaError {
+	return &SchemaError{
+		Line:    node.Line,
+		Column:  node.Column,
+		Message: fmt.Sprintf(format, args...),
+		node:    node,
+	}
+}
+
+func expressionErrorf(node *yaml.Node, offset int, format string, args ...any) *SchemaError {
+	err := schemaErrorf(node, format, args...)
+	err.Expression = true
+	err.Offset = offset
+	return err
+}
+
+// SchemaErrors returns all the schema errors in err, like the errors of [ReadWorkflow].
+// Validation doesn't stop at the first error, so there may be many.
+func SchemaErrors(err error) []*SchemaError {
+	var found []*SchemaError
+	var walk func(err error)
+	walk = func(err error) {
+		switch e := err.(type) {
+		case nil:
+		case *SchemaError:
+			found = append(found, e)
+		case interface{ Unwrap() []error }:
+			for _, inner := range e.Unwrap() {
+				walk(inner)
+			}
+		case interface{ Unwrap() error }:
+			walk(e.Unwrap())
+		}
+	}
+	walk(err)
+	return found
 }
 
 func (s *Node) checkMapping(node *yaml.Node, def Definition) error {
 	if node.Kind != yaml.MappingNode {
-		return fmt.Errorf("%sexpected a mapping got %v", formatLocation(node), getStringKind(node.Kind))
+		return schemaErrorf(node, "expected a mapping got %v", getStringKind(node.Kind))
 	}
 	insertDirective := regexp.MustCompile(`\${{\s*insert\s*}}`)
 	var allErrors error
@@ -381,7 +474,7 @@ func (s *Node) checkMapping(node *yaml.Node, def Definition) error {
 		if i%2 == 0 {
 			if insertDirective.MatchString(k.Value) {
 				if len(s.Context) == 0 {
-					allErrors = errors.Join(allErrors, fmt.Errorf("%sinsert is not allowed here", formatLocation(k)))
+					allErrors = errors.Join(allErrors, expressionErrorf(k, 0, "insert is not allowed here"))
 				}
 				continue
 			}
@@ -397,7 +490,7 @@ func (s *Node) checkMapping(node *yaml.Node, def Definition) error {
 			vdef, ok := def.Mapping.Properties[k.Value]
 			if !ok {
 				if def.Mapping.LooseValueType == "" {
-					allErrors = errors.Join(allErrors, fmt.Errorf("%sunknown property %v", formatLocation(k), k.Value))
+					allErrors = errors.Join(allErrors, schemaErrorf(k, "unknown property %v", k.Value))
 					continue
 				}
 				vdef = MappingProperty{Type: def.Mapping.LooseValueType}
@@ -407,6 +500,7 @@ func (s *Node) checkMapping(node *yaml.Node, def Definition) error {
 				Definition: vdef.Type,
 				Schema:     s.Schema,
 				Context:    append(append([]string{}, s.Context...), s.Schema.GetDefinition(vdef.Type).Context...),
+				Functions:  s.Functions,
 			}).UnmarshalYAML(node.Content[i+1]); err != nil {
 				allErrors = errors.Join(allErrors, err)
 				continue
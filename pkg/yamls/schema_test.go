@@ -1,10 +1,17 @@
 package yamls
 
 import (
+	"context"
+	"fmt"
+	"maps"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
+
+	"github.com/drornir/better-actions/pkg/runner/expr"
 )
 
 func TestAdditionalFunctions(t *testing.T) {
@@ -90,3 +97,100 @@ jobs:
 	}).UnmarshalYAML(&node)
 	assert.NoError(t, err)
 }
+
+func TestSchemaErrors(t *testing.T) {
+	_, err := ReadWorkflow(strings.NewReader(`on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    foo: bar
+    timeout-minutes: abc
+    steps:
+      - run: echo ${{ foo.bar }}
+        bogus: 1
+  test:
+    runs-on: [1, {a: b}]
+    steps: hello
+`), true)
+	require.Error(t, err)
+
+	type found struct {
+		Line, Column int
+		Expression   bool
+		Message      string
+	}
+	var got []found
+	for _, se := range SchemaErrors(err) {
+		got = append(got, found{se.Line, se.Column, se.Expression, se.Message})
+	}
+	// the errors of the job definition that matches best, rather than of every kind of job
+	assert.ElementsMatch(t, []found{
+		{5, 5, false, "unknown property foo"},
+		{6, 22, false, "expected a number got abc"},
+		{8, 14, true, "unknown variable access foo"},
+		{9, 9, false, "unknown property bogus"},
+		{11, 18, false, "expected a scalar got mapping"},
+		{12, 12, false, "expected a sequence got scalar"},
+	}, got)
+}
+
+// expressions are checked against the functions they run with
+func TestExpressionFunctions(t *testing.T) {
+	const workflow = `on: push
+jobs:
+  build:
+    runs-on: ${{ shout('ubuntu') }}
+    env:
+      KEY: ${{ hashFiles('go.sum') }}
+    steps:
+      - run: echo ${{ hashFiles('go.sum') }} ${{ toJSON(1, 2) }}
+`
+	check := func(functions expr.FunctionStore) []string {
+		var node yaml.Node
+		require.NoError(t, yaml.Unmarshal([]byte(workflow), &node))
+		err := (&Node{
+			Definition: "workflow-root-strict",
+			Schema:     GetWorkflowSchema(),
+			Functions:  functions,
+		}).UnmarshalYAML(&node)
+		var messages []string
+		for _, se := range SchemaErrors(err) {
+			messages = append(messages, fmt.Sprintf("%d:%d+%d: %s", se.Line, se.Column, se.Offset, se.Message))
+		}
+		return messages
+	}
+
+	assert.ElementsMatch(t, []string{
+		"4:14+4: unknown function call shout",
+		// hashFiles runs, but the schema only lets steps call it
+		"6:12+4: unknown function call hashFiles",
+		"8:14+36: too many parameters for toJSON expected <= 1 got 2",
+	}, check(nil))
+
+	functions := expr.FunctionStore{}
+	maps.Copy(functions, expr.DefaultFunctions())
+	functions.Add("shout", 1, 1, func(_ context.Context, _ *expr.CallContext, args ...expr.JSValue) (expr.JSValue, error) {
+		return args[0], nil
+	})
+	assert.ElementsMatch(t, []string{
+		"6:12+4: unknown function call hashFiles",
+		"8:14+36: too many parameters for toJSON expected <= 1 got 2",
+	}, check(functions))
+}
+
+func TestReadWorkflowWithFunctions(t *testing.T) {
+	const workflow = `
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo ${{ toLower(github.ref_name) }}
+`
+	_, err := ReadWorkflow(strings.NewReader(workflow), true)
+	assert.ErrorContains(t, err, "unknown function call toLower, it is a better-actions extension that isn't enabled")
+
+	wf, err := ReadWorkflowWithFunctions(strings.NewReader(workflow), true, expr.ExtendedFunctions())
+	require.NoError(t, err)
+	assert.Equal(t, "echo ${{ toLower(github.ref_name) }}", wf.Jobs["build"].Steps[0].Run)
+}
@@ -0,0 +1,162 @@
+package yamls
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/drornir/better-actions/pkg/runner/expr"
+)
+
+// SourceError is an error about a value of a workflow file, at Line and Column of File.
+// Errors of expressions are at the expression, and other errors at the value.
+type SourceError struct {
+	File   string
+	Line   int
+	Column int
+	// Text is the line of the file with the error, without its line break
+	Text string
+	Err  error
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %v", e.File, e.Line, e.Column, e.Err)
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// Snippet shows the line of the error with a caret under its column, like
+//
+//	42 |     if: ${{ github.event.nothing( }}
+//	   |                                  ^
+//
+// It's empty when the line isn't known.
+func (e *SourceError) Snippet() string {
+	if e.Text == "" {
+		return ""
+	}
+	number := fmt.Sprint(e.Line)
+	caret := strings.Builder{}
+	for i, r := range e.Text {
+		if i >= e.Column-1 {
+			break
+		}
+		// tabs keep their width
+		if r == '\t' {
+			caret.WriteRune('\t')
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	caret.WriteRune('^')
+	return fmt.Sprintf("%s | %s\n%s | %s\n", number, e.Text, strings.Repeat(" ", len(number)), caret.String())
+}
+
+// FormatError formats err like `workflow.yml:42:15: message`, followed by the snippet of the line, when there
+// is a [SourceError] in its chain, or as it is otherwise
+func FormatError(err error) string {
+	var sourceErr *SourceError
+	if !errors.As(err, &sourceErr) {
+		return err.Error()
+	}
+	// the position moves from the middle of the chain to its start
+	message := strings.Replace(err.Error(), sourceErr.Error(), sourceErr.Err.Error(), 1)
+	return fmt.Sprintf("%s:%d:%d: %s\n%s", sourceErr.File, sourceErr.Line, sourceErr.Column, message, sourceErr.Snippet())
+}
+
+// ErrorAt returns err as a [SourceError] at the value node of the workflow file, or at the expression of the
+// value when err is an [expr.ExpressionError]. err is returned as it is when the position of node isn't known.
+func (w *Workflow) ErrorAt(node *yaml.Node, err error) error {
+	if err == nil || node == nil || node.Line == 0 {
+		return err
+	}
+	var sourceErr *SourceError
+	if errors.As(err, &sourceErr) {
+		return err
+	}
+
+	line, column := node.Line, node.Column
+	var exprErr *expr.ExpressionError
+	if errors.As(err, &exprErr) {
+		line, column = ValuePosition(node, exprErr.Offset, w.lines)
+	}
+	sourceErr = &SourceError{File: w.File, Line: line, Column: column, Err: err}
+	if line <= len(w.lines) {
+		sourceErr.Text = w.lines[line-1]
+	}
+	return sourceErr
+}
+
+// ValuePosition returns the line and column in the file of the byte at offset in the value of node, whose
+// file has lines.
+// The position is exact in single line values and in literal block scalars, and is the position of node
+// otherwise.
+func ValuePosition(node *yaml.Node, offset int, lines []string) (line, column int) {
+	if offset < 0 || offset > len(node.Value) {
+		return node.Line, node.Column
+	}
+	switch node.Style {
+	case yaml.LiteralStyle:
+		before := node.Value[:offset]
+		line = node.Line + 1 + strings.Count(before, "\n")
+		if line > len(lines) {
+			return node.Line, node.Column
+		}
+		lineStart := strings.LastIndex(before, "\n") + 1
+		// the value keeps the indentation of lines that are more indented than the block
+		return line, blockIndent(node, lines) + offset - lineStart + 1
+	case 0, yaml.SingleQuotedStyle, yaml.DoubleQuotedStyle:
+		if strings.Contains(node.Value, "\n") {
+			return node.Line, node.Column
+		}
+		column = node.Column + offset
+		if node.Style != 0 {
+			// the opening quote
+			column++
+			// escapes make the value differ from its source
+			if node.Line <= len(lines) && !strings.HasPrefix(lines[node.Line-1][min(node.Column, len(lines[node.Line-1])):], node.Value) {
+				return node.Line, node.Column
+			}
+		}
+		return node.Line, column
+	}
+	return node.Line, node.Column
+}
+
+// blockIndent returns the indentation of the content of the block scalar node, which is the indentation of
+// its first non-empty line
+func blockIndent(node *yaml.Node, lines []string) int {
+	for _, src := range lines[min(node.Line, len(lines)):] {
+		if strings.TrimSpace(src) != "" {
+			return len(src) - len(strings.TrimLeft(src, " "))
+		}
+	}
+	return 0
+}
+
+// valueNode returns the value at path in the mapping node, like the node of `with.token` in a step, or nil
+func valueNode(node *yaml.Node, path ...string) *yaml.Node {
+	for _, key := range path {
+		if node == nil || node.Kind != yaml.MappingNode {
+			return nil
+		}
+		var value *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				value = node.Content[i+1]
+				break
+			}
+		}
+		node = value
+	}
+	return node
+}
+
+// ReadLines splits the source of a workflow file into its lines, for [ValuePosition]
+func ReadLines(source []byte) []string {
+	return strings.Split(strings.ReplaceAll(string(source), "\r\n", "\n"), "\n")
+}
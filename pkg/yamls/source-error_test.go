@@ -0,0 +1,147 @@
+package yamls
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/samber/oops"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drornir/better-actions/pkg/runner/expr"
+)
+
+const sourceErrorWorkflow = `on: push
+env:
+  PLAIN: a-${{ fromJSON('{') }}
+  QUOTED: "b-${{ fromJSON('[') }}"
+  ESCAPED: "\t${{ fromJSON('[') }}"
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    concurrency: deploy-${{ fromJSON('{') }}
+    environment:
+      name: ${{ fromJSON('{') }}
+    steps:
+      - if: ${{ fromJSON('{') }}
+        run: |
+          echo one
+          echo ${{ fromJSON('{') }}
+      - uses: actions/checkout@v4
+        with:
+          token: ${{ github.token }}
+      - run: |
+          if true; then
+            echo ${{ fromJSON('[') }}
+          fi
+`
+
+func TestErrorAt(t *testing.T) {
+	wf, err := ReadWorkflow(strings.NewReader(sourceErrorWorkflow), false)
+	require.NoError(t, err)
+	wf.File = "ci.yml"
+	job := wf.GetJob("build")
+	require.NotNil(t, job)
+	step := job.Steps[0]
+
+	evaluator, err := expr.NewEvaluator(&expr.EvalContext{})
+	require.NoError(t, err)
+	evalErr := func(template string) error {
+		_, err := evaluator.EvaluateTemplate(template)
+		require.Error(t, err)
+		return err
+	}
+	_, conditionErr := evaluator.EvaluateCondition(step.If.Value)
+	require.Error(t, conditionErr)
+
+	testCases := []struct {
+		name         string
+		node         func() error
+		line, column int
+	}{
+		{
+			name: "plain",
+			node: func() error { return wf.ErrorAt(wf.ValueNode("env", "PLAIN"), evalErr(wf.Env["PLAIN"])) },
+			line: 3, column: 12,
+		},
+		{
+			name: "quoted",
+			node: func() error { return wf.ErrorAt(wf.ValueNode("env", "QUOTED"), evalErr(wf.Env["QUOTED"])) },
+			line: 4, column: 14,
+		},
+		{
+			name: "escapes are at the value",
+			node: func() error { return wf.ErrorAt(wf.ValueNode("env", "ESCAPED"), evalErr(wf.Env["ESCAPED"])) },
+			line: 5, column: 12,
+		},
+		{
+			name: "condition",
+			node: func() error { return wf.ErrorAt(step.ValueNode("if"), conditionErr) },
+			line: 13, column: 17,
+		},
+		{
+			name: "literal block",
+			node: func() error { return wf.ErrorAt(step.ValueNode("run"), evalErr(step.Run)) },
+			line: 16, column: 16,
+		},
+		{
+			name: "more indented line of a literal block",
+			node: func() error { return wf.ErrorAt(job.Steps[2].ValueNode("run"), evalErr(job.Steps[2].Run)) },
+			line: 22, column: 18,
+		},
+		{
+			name: "concurrency",
+			node: func() error {
+				return wf.ErrorAt(job.Concurrency().GroupNode(), evalErr(job.Concurrency().Group))
+			},
+			line: 9, column: 25,
+		},
+		{
+			name: "environment",
+			node: func() error {
+				return wf.ErrorAt(job.DeploymentEnvironment().NameNode(), evalErr(job.DeploymentEnvironment().Name))
+			},
+			line: 11, column: 13,
+		},
+		{
+			name: "errors that aren't of expressions are at the value",
+			node: func() error { return wf.ErrorAt(job.Steps[1].ValueNode("with", "token"), oops.Errorf("no token")) },
+			line: 19, column: 18,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.node()
+			var sourceErr *SourceError
+			require.ErrorAs(t, err, &sourceErr)
+			assert.Equal(t, "ci.yml", sourceErr.File)
+			assert.Equal(t, tc.line, sourceErr.Line, "line")
+			assert.Equal(t, tc.column, sourceErr.Column, "column")
+			assert.Equal(t, strings.Split(sourceErrorWorkflow, "\n")[tc.line-1], sourceErr.Text)
+		})
+	}
+
+	assert.NoError(t, wf.ErrorAt(step.ValueNode("if"), nil))
+	noPosition := oops.Errorf("no position")
+	assert.Equal(t, noPosition, wf.ErrorAt(step.ValueNode("nothing"), noPosition))
+	located := wf.ErrorAt(step.ValueNode("if"), conditionErr)
+	assert.Same(t, located, wf.ErrorAt(job.ValueNode("steps"), located), "errors are located once")
+}
+
+func TestFormatError(t *testing.T) {
+	wf, err := ReadWorkflow(strings.NewReader(sourceErrorWorkflow), false)
+	require.NoError(t, err)
+	wf.File = "ci.yml"
+	step := wf.GetJob("build").Steps[1]
+
+	located := wf.ErrorAt(step.ValueNode("with", "token"), oops.Errorf("no token"))
+	err = oops.Wrapf(oops.Wrapf(located, "evaluating input token"), "job build failed")
+	assert.Equal(t, `ci.yml:19:18: job build failed: evaluating input token: no token
+19 |           token: ${{ github.token }}
+   |                  ^
+`, FormatError(err))
+
+	assert.Equal(t, "no position", FormatError(oops.Errorf("no position")))
+	assert.Empty(t, (&SourceError{File: "ci.yml", Line: 1, Column: 1, Err: context.Canceled}).Snippet())
+}
@@ -1,53 +1,113 @@
 package yamls
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"reflect"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/drornir/better-actions/pkg/log"
+	"github.com/drornir/better-actions/pkg/runner/expr"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/samber/oops"
 	"gopkg.in/yaml.v3"
 )
 
 // Workflow is the structure of the files in .github/workflows
 type Workflow struct {
-	File     string
-	Name     string            `yaml:"name"`
-	RawOn    yaml.Node         `yaml:"on"`
-	Env      map[string]string `yaml:"env"`
-	Jobs     map[string]*Job   `yaml:"jobs"`
-	Defaults Defaults          `yaml:"defaults"`
+	File           string
+	Name           string            `yaml:"name"`
+	RawOn          yaml.Node         `yaml:"on"`
+	Env            map[string]string `yaml:"env"`
+	Jobs           map[string]*Job   `yaml:"jobs"`
+	Defaults       Defaults          `yaml:"defaults"`
+	RawConcurrency yaml.Node         `yaml:"concurrency"`
+	// Node is the root mapping of the workflow file, for the positions of its values. See [Workflow.ErrorAt].
+	Node *yaml.Node `yaml:"-"`
+	// lines are the lines of the workflow file, for the snippets of errors
+	lines []string
 }
 
 // ReadWorkflow returns a list of jobs for a given workflow file reader
 func ReadWorkflow(in io.Reader, strict bool) (*Workflow, error) {
+	source, err := io.ReadAll(in)
+	if err != nil {
+		return new(Workflow), oops.Wrapf(err, "reading workflow")
+	}
+	var w *Workflow
 	if strict {
-		w := new(WorkflowStrict)
-		err := yaml.NewDecoder(in).Decode(w)
-		return (*Workflow)(w), err
+		ws := new(WorkflowStrict)
+		err = yaml.NewDecoder(bytes.NewReader(source)).Decode(ws)
+		w = (*Workflow)(ws)
+	} else {
+		w = new(Workflow)
+		err = yaml.NewDecoder(bytes.NewReader(source)).Decode(w)
 	}
-	w := new(Workflow)
-	err := yaml.NewDecoder(in).Decode(w)
+	w.lines = ReadLines(source)
 	return w, err
 }
 
-func (w *Workflow) UnmarshalYAML(node *yaml.Node) error {
-	// Validate the schema before deserializing it into our model
+// ReadWorkflowWithFunctions is [ReadWorkflow] for workflows whose expressions call functions,
+// like the better-actions extensions, that aren't in [expr.DefaultFunctions]
+func ReadWorkflowWithFunctions(in io.Reader, strict bool, functions expr.FunctionStore) (*Workflow, error) {
+	source, err := io.ReadAll(in)
+	if err != nil {
+		return new(Workflow), oops.Wrapf(err, "reading workflow")
+	}
+	var doc yaml.Node
+	if err := yaml.NewDecoder(bytes.NewReader(source)).Decode(&doc); err != nil {
+		return new(Workflow), err
+	}
+	node := &doc
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		node = doc.Content[0]
+	}
+	definition := "workflow-root"
+	if strict {
+		definition = "workflow-root-strict"
+	}
+	w := &Workflow{lines: ReadLines(source)}
+	if err := validateWorkflow(node, definition, functions); err != nil {
+		return w, err
+	}
+	type WorkflowDefault Workflow
+	err = node.Decode((*WorkflowDefault)(w))
+	w.Node = node
+	return w, err
+}
+
+// validateWorkflow validates node against the definition of the workflow schema, with expressions that call
+// functions, or the default ones if it's nil
+func validateWorkflow(node *yaml.Node, definition string, functions expr.FunctionStore) error {
 	if err := (&Node{
-		Definition: "workflow-root",
+		Definition: definition,
 		Schema:     GetWorkflowSchema(),
+		Functions:  functions,
 	}).UnmarshalYAML(node); err != nil {
+		message := "actions YAML schema validation error"
+		if definition == "workflow-root-strict" {
+			message = "actions YAML strict schema validation error detected:"
+		}
 		return oops.
-			With("definition", "workflow-root").
-			Wrapf(err, "actions YAML schema validation error")
+			With("definition", definition).
+			Wrapf(err, "%s", message)
+	}
+	return nil
+}
+
+func (w *Workflow) UnmarshalYAML(node *yaml.Node) error {
+	// Validate the schema before deserializing it into our model
+	if err := validateWorkflow(node, "workflow-root", nil); err != nil {
+		return err
 	}
 	type WorkflowDefault Workflow
+	w.Node = node
 	return node.Decode((*WorkflowDefault)(w))
 }
 
@@ -55,18 +115,19 @@ type WorkflowStrict Workflow
 
 func (w *WorkflowStrict) UnmarshalYAML(node *yaml.Node) error {
 	// Validate the schema before deserializing it into our model
-	if err := (&Node{
-		Definition: "workflow-root-strict",
-		Schema:     GetWorkflowSchema(),
-	}).UnmarshalYAML(node); err != nil {
-		return oops.
-			With("definition", "workflow-root-strict").
-			Wrapf(err, "actions YAML strict schema validation error detected:")
+	if err := validateWorkflow(node, "workflow-root-strict", nil); err != nil {
+		return err
 	}
 	type WorkflowDefault Workflow
+	w.Node = node
 	return node.Decode((*WorkflowDefault)(w))
 }
 
+// ValueNode returns the node of the value at path in the workflow file, like `env.NAME`, or nil
+func (w *Workflow) ValueNode(path ...string) *yaml.Node {
+	return valueNode(w.Node, path...)
+}
+
 // On events for the workflow
 func (w *Workflow) On(ctx context.Context) ([]string, error) {
 	switch w.RawOn.Kind {
@@ -99,6 +160,84 @@ func (w *Workflow) On(ctx context.Context) ([]string, error) {
 	return nil, nil
 }
 
+// TriggeredBy reports whether the workflow lists event in its `on:` triggers, and whether ref passes the
+// branch and tag filters of the event. ref is the fully formed ref the filters match, like refs/heads/main
+// for a push or the base branch of a pull request. Filters are ignored when ref is empty.
+// paths and paths-ignore filters aren't supported: the workflow is triggered as if the changed files match them.
+func (w *Workflow) TriggeredBy(ctx context.Context, event, ref string) (bool, error) {
+	events, err := w.On(ctx)
+	if err != nil {
+		return false, oops.With("event", event).Wrapf(err, "failed to read workflow triggers")
+	}
+	if !slices.Contains(events, event) {
+		return false, nil
+	}
+	if ref == "" || w.RawOn.Kind != yaml.MappingNode {
+		return true, nil
+	}
+	node := valueNode(&w.RawOn, event)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return true, nil
+	}
+	var filters refFilters
+	if err := node.Decode(&filters); err != nil {
+		return false, oops.With("event", event).Wrapf(err, "failed to read the filters of %s", event)
+	}
+	if event != "push" {
+		// only push events are for tags
+		filters.Tags, filters.TagsIgnore = nil, nil
+	}
+	return filters.match(ref), nil
+}
+
+// refFilters are the branch and tag filters of an event
+type refFilters struct {
+	Branches       []string `yaml:"branches"`
+	BranchesIgnore []string `yaml:"branches-ignore"`
+	Tags           []string `yaml:"tags"`
+	TagsIgnore     []string `yaml:"tags-ignore"`
+}
+
+// match reports whether ref passes the filters. Like on GitHub, when there are only branch filters tags
+// don't pass, and when there are only tag filters branches don't pass.
+func (f refFilters) match(ref string) bool {
+	hasBranches := f.Branches != nil || f.BranchesIgnore != nil
+	hasTags := f.Tags != nil || f.TagsIgnore != nil
+	if branch, ok := strings.CutPrefix(ref, "refs/heads/"); ok {
+		if !hasBranches {
+			return !hasTags
+		}
+		return matchFilter(branch, f.Branches, f.BranchesIgnore)
+	}
+	if tag, ok := strings.CutPrefix(ref, "refs/tags/"); ok {
+		if !hasTags {
+			return !hasBranches
+		}
+		return matchFilter(tag, f.Tags, f.TagsIgnore)
+	}
+	return true
+}
+
+// matchFilter reports whether name matches the glob patterns of include, or doesn't match the ones of ignore.
+// A pattern that starts with ! excludes the names it matches from the patterns before it.
+func matchFilter(name string, include, ignore []string) bool {
+	if include == nil {
+		return !matchPatterns(name, ignore)
+	}
+	return matchPatterns(name, include)
+}
+
+func matchPatterns(name string, patterns []string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		pattern, negated := strings.CutPrefix(pattern, "!")
+		if ok, _ := doublestar.Match(pattern, name); ok {
+			matched = !negated
+		}
+	}
+	return matched
+}
+
 func (w *Workflow) OnEvent(event string) any {
 	if w.RawOn.Kind == yaml.MappingNode {
 		var val map[string]any
@@ -202,22 +341,78 @@ func (w *Workflow) WorkflowCallConfig() *WorkflowCall {
 
 // Job is the structure of one job in a workflow
 type Job struct {
-	Name           string                    `yaml:"name"`
-	RawNeeds       yaml.Node                 `yaml:"needs"`
-	RawRunsOn      yaml.Node                 `yaml:"runs-on"`
-	Env            yaml.Node                 `yaml:"env"`
-	If             yaml.Node                 `yaml:"if"`
-	Steps          []*Step                   `yaml:"steps"`
-	TimeoutMinutes string                    `yaml:"timeout-minutes"`
-	Services       map[string]*ContainerSpec `yaml:"services"`
-	Strategy       *Strategy                 `yaml:"strategy"`
-	RawContainer   yaml.Node                 `yaml:"container"`
-	Defaults       Defaults                  `yaml:"defaults"`
-	Outputs        map[string]string         `yaml:"outputs"`
-	Uses           string                    `yaml:"uses"`
-	With           map[string]any            `yaml:"with"`
-	RawSecrets     yaml.Node                 `yaml:"secrets"`
-	Result         string
+	Name               string                    `yaml:"name"`
+	RawNeeds           yaml.Node                 `yaml:"needs"`
+	RawRunsOn          yaml.Node                 `yaml:"runs-on"`
+	Env                yaml.Node                 `yaml:"env"`
+	If                 yaml.Node                 `yaml:"if"`
+	Steps              []*Step                   `yaml:"steps"`
+	TimeoutMinutes     string                    `yaml:"timeout-minutes"`
+	Services           map[string]*ContainerSpec `yaml:"services"`
+	Strategy           *Strategy                 `yaml:"strategy"`
+	RawContainer       yaml.Node                 `yaml:"container"`
+	Defaults           Defaults                  `yaml:"defaults"`
+	Outputs            map[string]string         `yaml:"outputs"`
+	Uses               string                    `yaml:"uses"`
+	With               map[string]any            `yaml:"with"`
+	RawSecrets         yaml.Node                 `yaml:"secrets"`
+	RawEnvironment     yaml.Node                 `yaml:"environment"`
+	RawContinueOnError string                    `yaml:"continue-on-error"`
+	RawConcurrency     yaml.Node                 `yaml:"concurrency"`
+	Result             string
+	// Node is the mapping of the job in the workflow file, for the positions of its values
+	Node *yaml.Node `yaml:"-"`
+}
+
+func (j *Job) UnmarshalYAML(node *yaml.Node) error {
+	type JobDefault Job
+	j.Node = node
+	return node.Decode((*JobDefault)(j))
+}
+
+// ValueNode returns the node of the value at path in the job, like `outputs.NAME`, or nil
+func (j *Job) ValueNode(path ...string) *yaml.Node {
+	return valueNode(j.Node, path...)
+}
+
+// JobEnvironment is the deployment environment a job targets
+type JobEnvironment struct {
+	Name string `yaml:"name"`
+	// URL is shown as the result of the deployment. It may reference step outputs.
+	URL string `yaml:"url"`
+	// Node is the `environment:` of the job in the workflow file
+	Node *yaml.Node `yaml:"-"`
+}
+
+// NameNode is the node of the name of the environment in the workflow file
+func (e *JobEnvironment) NameNode() *yaml.Node {
+	if e.Node != nil && e.Node.Kind == yaml.ScalarNode {
+		return e.Node
+	}
+	return valueNode(e.Node, "name")
+}
+
+// Concurrency is the `concurrency:` of a workflow or a job
+type Concurrency struct {
+	// Group is an expression. Runs in the same group run one at a time.
+	Group string `yaml:"group"`
+	// CancelInProgress is a boolean or an expression
+	CancelInProgress string `yaml:"cancel-in-progress"`
+	// Node is the `concurrency:` in the workflow file
+	Node *yaml.Node `yaml:"-"`
+}
+
+// GroupNode is the node of the group in the workflow file
+func (c *Concurrency) GroupNode() *yaml.Node {
+	if c.Node != nil && c.Node.Kind == yaml.ScalarNode {
+		return c.Node
+	}
+	return valueNode(c.Node, "group")
+}
+
+// CancelInProgressNode is the node of cancel-in-progress in the workflow file, or nil if it isn't set
+func (c *Concurrency) CancelInProgressNode() *yaml.Node {
+	return valueNode(c.Node, "cancel-in-progress")
 }
 
 // Strategy for the job
@@ -299,6 +494,57 @@ func (j *Job) Secrets() map[string]string {
 	return val
 }
 
+// DeploymentEnvironment returns the `environment:` of the job, or nil if it doesn't target one.
+// Not to be confused with [Job.Environment], which returns its env vars.
+func (j *Job) DeploymentEnvironment() *JobEnvironment {
+	switch j.RawEnvironment.Kind {
+	case yaml.ScalarNode:
+		val := new(JobEnvironment)
+		if !decodeNode(j.RawEnvironment, &val.Name) {
+			return nil
+		}
+		val.Node = j.ValueNode("environment")
+		return val
+	case yaml.MappingNode:
+		val := new(JobEnvironment)
+		if !decodeNode(j.RawEnvironment, val) {
+			return nil
+		}
+		val.Node = j.ValueNode("environment")
+		return val
+	}
+	return nil
+}
+
+// Concurrency returns the `concurrency:` of the job, or nil if it doesn't set one
+func (j *Job) Concurrency() *Concurrency {
+	return concurrency(j.RawConcurrency, j.ValueNode("concurrency"))
+}
+
+// Concurrency returns the `concurrency:` of the workflow, or nil if it doesn't set one
+func (w *Workflow) Concurrency() *Concurrency {
+	return concurrency(w.RawConcurrency, w.ValueNode("concurrency"))
+}
+
+// concurrency decodes node, which is the value of source in the workflow file, if it was read from one
+func concurrency(node yaml.Node, source *yaml.Node) *Concurrency {
+	val := new(Concurrency)
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if !decodeNode(node, &val.Group) {
+			return nil
+		}
+	case yaml.MappingNode:
+		if !decodeNode(node, val) {
+			return nil
+		}
+	default:
+		return nil
+	}
+	val.Node = source
+	return val
+}
+
 // Container details for the job
 func (j *Job) Container() *ContainerSpec {
 	var val *ContainerSpec
@@ -596,6 +842,19 @@ type Step struct {
 	With               map[string]string `yaml:"with"`
 	RawContinueOnError string            `yaml:"continue-on-error"`
 	TimeoutMinutes     string            `yaml:"timeout-minutes"`
+	// Node is the mapping of the step in the workflow file, for the positions of its values
+	Node *yaml.Node `yaml:"-"`
+}
+
+func (s *Step) UnmarshalYAML(node *yaml.Node) error {
+	type StepDefault Step
+	s.Node = node
+	return node.Decode((*StepDefault)(s))
+}
+
+// ValueNode returns the node of the value at path in the step, like `with.token`, or nil
+func (s *Step) ValueNode(path ...string) *yaml.Node {
+	return valueNode(s.Node, path...)
 }
 
 // String gets the name of step
@@ -627,6 +886,23 @@ func (s *Step) GetEnv() map[string]string {
 	return env
 }
 
+// ApplyRunDefaults returns a copy of s where the shell and working directory that are not set in the step
+// are taken from defaults. defaults are ordered by precedence: the job's defaults.run before the workflow's.
+// WorkflowShell of the copy is the shell that the workflow configures for the step, if any.
+func (s *Step) ApplyRunDefaults(defaults ...RunDefaults) *Step {
+	step := *s
+	for _, d := range defaults {
+		if step.Shell == "" {
+			step.Shell = d.Shell
+		}
+		if step.WorkingDirectory == "" {
+			step.WorkingDirectory = d.WorkingDirectory
+		}
+	}
+	step.WorkflowShell = step.Shell
+	return &step
+}
+
 // ShellCommand returns the command for the shell
 func (s *Step) ShellCommand() string {
 	shellCommand := ""
@@ -642,7 +918,7 @@ func (s *Step) ShellCommand() string {
 			shellCommand = "bash --noprofile --norc -e -o pipefail {0}"
 		}
 	case "pwsh":
-		shellCommand = "pwsh -command . '{0}'"
+		shellCommand = "pwsh -command \". '{0}'\""
 	case "python":
 		shellCommand = "python {0}"
 	case "sh":
@@ -650,7 +926,7 @@ func (s *Step) ShellCommand() string {
 	case "cmd":
 		shellCommand = "cmd /D /E:ON /V:OFF /S /C \"CALL \"{0}\"\""
 	case "powershell":
-		shellCommand = "powershell -command . '{0}'"
+		shellCommand = "powershell -command \". '{0}'\""
 	default:
 		shellCommand = s.Shell
 	}
@@ -0,0 +1,42 @@
+package yamls
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTriggeredBy(t *testing.T) {
+	testCases := []struct {
+		name  string
+		on    string
+		event string
+		ref   string
+		want  bool
+	}{
+		{name: "other event", on: "on: pull_request", event: "push", ref: "refs/heads/main", want: false},
+		{name: "no filters", on: "on: [push]", event: "push", ref: "refs/heads/main", want: true},
+		{name: "branches", on: "on: {push: {branches: [main, 'release/**']}}", event: "push", ref: "refs/heads/release/1.0", want: true},
+		{name: "branches mismatch", on: "on: {push: {branches: [release]}}", event: "push", ref: "refs/heads/main", want: false},
+		{name: "negated branches", on: "on: {push: {branches: ['feature/*', '!feature/wip']}}", event: "push", ref: "refs/heads/feature/wip", want: false},
+		{name: "branches-ignore", on: "on: {push: {branches-ignore: ['dependabot/**']}}", event: "push", ref: "refs/heads/dependabot/npm/x", want: false},
+		{name: "only branch filters skip tags", on: "on: {push: {branches: [main]}}", event: "push", ref: "refs/tags/v1", want: false},
+		{name: "tags", on: "on: {push: {tags: ['v*']}}", event: "push", ref: "refs/tags/v1.2.0", want: true},
+		{name: "only tag filters skip branches", on: "on: {push: {tags: ['v*']}}", event: "push", ref: "refs/heads/main", want: false},
+		{name: "tags-ignore", on: "on: {push: {tags-ignore: ['nightly-*']}}", event: "push", ref: "refs/tags/nightly-1", want: false},
+		{name: "pull request branches", on: "on: {pull_request: {branches: [main]}}", event: "pull_request", ref: "refs/heads/main", want: true},
+		{name: "unknown ref", on: "on: {push: {branches: [main]}}", event: "push", ref: "", want: true},
+		{name: "paths are not filtered", on: "on: {push: {paths: ['docs/**']}}", event: "push", ref: "refs/heads/main", want: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wf, err := ReadWorkflow(strings.NewReader(tc.on+"\njobs: {}\n"), false)
+			require.NoError(t, err)
+			got, err := wf.TriggeredBy(t.Context(), tc.event, tc.ref)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}